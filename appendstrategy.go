@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+)
+
+var appendStrategy string // What happens when a file would receive a second document
+
+func init() {
+	flag.StringVar(&appendStrategy, "append-strategy", "append", "What to do when a file would receive a second document: append (join them with the separator), error, replace (keep the last document), number (write the later ones to name-2.yaml, name-3.yaml, ...) or dedupe (append only documents the file doesn't hold yet)")
+}
+
+func validateAppendStrategy(strategy string) error {
+	switch strategy {
+	case "append", "error", "replace", "number", "dedupe":
+		return nil
+	}
+	return fmt.Errorf("invalid -append-strategy %q (expected append, error, replace, number or dedupe)", strategy)
+}
+
+// heldDocument is a document -append-strategy replace or number writes once the
+// render is done.
+type heldDocument struct {
+	dest   string
+	spec   *spec
+	output string
+}
+
+// appends applies the -append-strategy to the documents of a render.
+type appends struct {
+	strategy string
+	digests  map[string]map[string]bool // destination -> digests of its documents, for dedupe
+	held     map[string]heldDocument    // destination -> last document, for replace
+	order    []string                   // destinations of held, in the order first written
+	// numbered are the later documents of destinations, for number. They get their
+	// numbered names once every document of the chart has its own destination, so
+	// a numbered name never takes that of a Source rendered later.
+	numbered []heldDocument
+}
+
+func newAppends(strategy string) *appends {
+	return &appends{strategy: strategy, digests: make(map[string]map[string]bool), held: make(map[string]heldDocument)}
+}
+
+// place returns the destination of a document of s with the given output that would
+// go to dest, seen telling which destinations were written already. It returns false
+// if the document is to be dropped.
+func (a *appends) place(dest, output string, s *spec, seen map[string]bool) (string, bool, error) {
+	switch a.strategy {
+	case "error":
+		if seen[dest] {
+			return "", false, fmt.Errorf("%s would receive a second document, from %s; use -append-strategy append to allow it", dest, s.source)
+		}
+	case "replace":
+		if _, ok := a.held[dest]; ok {
+			log.Printf("Replacing the document of %s with the next one from %s", dest, s.source)
+		}
+	case "dedupe":
+		digest := sha256Hex([]byte(strings.TrimSpace(output)))
+		if a.digests[dest][digest] {
+			log.Printf("Skipping document from %s already written to %s", s.source, dest)
+			return "", false, nil
+		}
+		if a.digests[dest] == nil {
+			a.digests[dest] = make(map[string]bool)
+		}
+		a.digests[dest][digest] = true
+	}
+	return dest, true, nil
+}
+
+// hold keeps the document for dest until release, seen telling which destinations
+// were written already. With replace it replaces an earlier one, and with number
+// the documents of destinations that were written are held. It returns false if
+// the document is to be written now.
+func (a *appends) hold(dest, output string, s *spec, seen map[string]bool) bool {
+	switch a.strategy {
+	case "replace":
+		if _, ok := a.held[dest]; !ok {
+			a.order = append(a.order, dest)
+		}
+		a.held[dest] = heldDocument{dest: dest, spec: s, output: output}
+		return true
+	case "number":
+		if seen[dest] {
+			a.numbered = append(a.numbered, heldDocument{dest: dest, spec: s, output: output})
+			return true
+		}
+	}
+	return false
+}
+
+// release writes the held documents with write, which records their destinations
+// in seen. Numbered documents go to the first of name-2.yaml, name-3.yaml, ... that
+// no document was written to.
+func (a *appends) release(seen map[string]bool, write func(dest, output string, s *spec) error) error {
+	for _, dest := range a.order {
+		held := a.held[dest]
+		if err := write(dest, held.output, held.spec); err != nil {
+			return err
+		}
+	}
+	a.order = nil
+	for _, held := range a.numbered {
+		ext := path.Ext(held.dest)
+		stem := strings.TrimSuffix(held.dest, ext)
+		dest := ""
+		for n := 2; dest == "" || seen[dest]; n++ {
+			dest = fmt.Sprintf("%s-%d%s", stem, n, ext)
+		}
+		if err := write(dest, held.output, held.spec); err != nil {
+			return err
+		}
+	}
+	a.numbered = nil
+	return nil
+}
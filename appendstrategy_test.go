@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAppendStrategy(t *testing.T) {
+	cm := func(name string) string {
+		return "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: " + name + "\n"
+	}
+	twice := helmOutput("c/templates/cm.yaml", cm("a"), "c/templates/cm.yaml", cm("b"), "c/templates/cm.yaml", cm("a"))
+	tests := []struct {
+		strategy string
+		input    string
+		want     map[string]string // nil when the render fails
+	}{
+		{"append", twice, map[string]string{"c/templates/cm.yaml": cm("a") + "\n---\n" + cm("b") + "\n---\n" + cm("a")}},
+		{"error", twice, nil},
+		{"error", helmOutput("c/templates/a.yaml", cm("a"), "c/templates/b.yaml", cm("b")), map[string]string{"c/templates/a.yaml": cm("a"), "c/templates/b.yaml": cm("b")}},
+		{"replace", twice, map[string]string{"c/templates/cm.yaml": cm("a")}},
+		{"replace", helmOutput("c/templates/cm.yaml", cm("a"), "c/templates/cm.yaml", cm("b")), map[string]string{"c/templates/cm.yaml": cm("b")}},
+		{"dedupe", twice, map[string]string{"c/templates/cm.yaml": cm("a") + "\n---\n" + cm("b")}},
+		{"number", twice, map[string]string{"c/templates/cm.yaml": cm("a"), "c/templates/cm-2.yaml": cm("b"), "c/templates/cm-3.yaml": cm("a")}},
+		// Numbered names leave the names of Sources rendered later to them.
+		{"number", helmOutput("c/templates/cm.yaml", cm("a"), "c/templates/cm.yaml", cm("b"), "c/templates/cm-2.yaml", cm("c")),
+			map[string]string{"c/templates/cm.yaml": cm("a"), "c/templates/cm-2.yaml": cm("c"), "c/templates/cm-3.yaml": cm("b")}},
+		{"number", helmOutput("c/templates/cm-2.yaml", cm("c"), "c/templates/cm-2.yaml", cm("d"), "c/templates/cm.yaml", cm("a"), "c/templates/cm.yaml", cm("b")),
+			map[string]string{"c/templates/cm.yaml": cm("a"), "c/templates/cm-2.yaml": cm("c"), "c/templates/cm-2-2.yaml": cm("d"), "c/templates/cm-3.yaml": cm("b")}},
+		{"number", helmOutput("c/templates/notes", cm("a"), "c/templates/notes", cm("b")), map[string]string{"c/templates/notes": cm("a"), "c/templates/notes-2": cm("b")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			setFlag(t, &appendStrategy, tt.strategy)
+			if tt.want == nil {
+				if _, err := renderInMemory(strings.NewReader(tt.input)); err == nil {
+					t.Error("render succeeded")
+				}
+				return
+			}
+			if files := render(t, tt.input); !reflect.DeepEqual(files, tt.want) {
+				t.Errorf("files = %q, want %q", files, tt.want)
+			}
+		})
+	}
+	if err := validateAppendStrategy("merge"); err == nil {
+		t.Error("-append-strategy merge is valid")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	authConfigFile string // Clients allowed to render with schelm serve
+	clientCAFile   string // CA bundle client certificates are verified against
+)
+
+func init() {
+	flag.StringVar(&authConfigFile, "auth-config", "", "With schelm serve, require renders to authenticate as one of the clients in this file, by bearer token or client certificate")
+	flag.StringVar(&clientCAFile, "client-ca", "", "With schelm serve and TLS, verify client certificates against this CA bundle (mTLS)")
+}
+
+// serveClient is an entry of the -auth-config file. A client authenticates with its
+// bearer token or with a verified client certificate whose common name or a DNS name
+// is certificateSubject, and only renders below its root.
+type serveClient struct {
+	Name               string   `yaml:"name"`
+	Token              string   `yaml:"token"`
+	CertificateSubject string   `yaml:"certificateSubject"`
+	Root               string   `yaml:"root"`    // subdirectory of OUTPUT_ROOT; empty for all of it
+	Tenants            []string `yaml:"tenants"` // tenants the client may pick with -tenant-header
+}
+
+// loadServeClients reads the YAML list of clients from file.
+func loadServeClients(file string) ([]serveClient, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading auth config: %w", err)
+	}
+	var clients []serveClient
+	if err := yaml.Unmarshal(data, &clients); err != nil {
+		return nil, fmt.Errorf("error parsing auth config %s: %w", file, err)
+	}
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("auth config %s lists no clients", file)
+	}
+	for i := range clients {
+		c := &clients[i]
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("client %d", i+1)
+		}
+		if (c.Token == "") == (c.CertificateSubject == "") {
+			return nil, fmt.Errorf("auth config %s: %s needs exactly one of token or certificateSubject", file, c.Name)
+		}
+		if c.Root != "" {
+			root, ok := relativePath(c.Root)
+			if !ok {
+				return nil, fmt.Errorf("auth config %s: root %q of %s is outside OUTPUT_ROOT", file, c.Root, c.Name)
+			}
+			c.Root = root
+		}
+	}
+	return clients, nil
+}
+
+// errUnauthenticated is returned for requests carrying no known credentials.
+var errUnauthenticated = errors.New("unauthenticated")
+
+// authenticate returns the client r comes from.
+func authenticate(clients []serveClient, r *http.Request) (*serveClient, error) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		for i, c := range clients {
+			if c.Token != "" && subtle.ConstantTimeCompare([]byte(c.Token), []byte(token)) == 1 {
+				return &clients[i], nil
+			}
+		}
+		return nil, errUnauthenticated
+	}
+	// Only certificates the TLS handshake verified against -client-ca have chains.
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cert := r.TLS.VerifiedChains[0][0]
+		for i, c := range clients {
+			if c.CertificateSubject != "" && (cert.Subject.CommonName == c.CertificateSubject || slices.Contains(cert.DNSNames, c.CertificateSubject)) {
+				return &clients[i], nil
+			}
+		}
+	}
+	return nil, errUnauthenticated
+}
+
+// clientTLSConfig configures the verification of client certificates for mTLS.
+func clientTLSConfig(config *tls.Config) error {
+	if clientCAFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return fmt.Errorf("error reading client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("client CA %s contains no certificates", clientCAFile)
+	}
+	config.ClientCAs = pool
+	// Token clients connect without certificates; authenticate decides per request.
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadServeClients(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []serveClient // nil when loading fails
+	}{
+		{
+			name:   "token and certificate",
+			config: "- name: ci\n  token: s3cret\n  root: ci/\n- certificateSubject: deploy.example.com\n  tenants: [shop]\n",
+			want: []serveClient{
+				{Name: "ci", Token: "s3cret", Root: "ci"},
+				{Name: "client 2", CertificateSubject: "deploy.example.com", Tenants: []string{"shop"}},
+			},
+		},
+		{name: "no clients", config: "[]\n"},
+		{name: "no credentials", config: "- name: ci\n"},
+		{name: "both credentials", config: "- token: s3cret\n  certificateSubject: ci\n"},
+		{name: "root outside", config: "- token: s3cret\n  root: ../other\n"},
+		{name: "not a list", config: "token: s3cret\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "auth.yaml")
+			if err := os.WriteFile(file, []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadServeClients(file)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("loadServeClients() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadServeClients() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if _, err := loadServeClients(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("loadServeClients() of a missing file succeeded")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	clients := []serveClient{
+		{Name: "ci", Token: "s3cret"},
+		{Name: "deploy", CertificateSubject: "deploy.example.com"},
+		{Name: "ops", CertificateSubject: "ops"},
+	}
+	verified := func(cert *x509.Certificate) *tls.ConnectionState {
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	tests := []struct {
+		name  string
+		token string
+		tls   *tls.ConnectionState
+		want  string // client name, empty when unauthenticated
+	}{
+		{"token", "s3cret", nil, "ci"},
+		{"wrong token", "guess", nil, ""},
+		{"empty token", "", nil, ""},
+		{"DNS name", "", verified(&x509.Certificate{DNSNames: []string{"other", "deploy.example.com"}}), "deploy"},
+		{"common name", "", verified(&x509.Certificate{Subject: pkix.Name{CommonName: "ops"}}), "ops"},
+		{"unknown certificate", "", verified(&x509.Certificate{Subject: pkix.Name{CommonName: "intruder"}}), ""},
+		// Certificates not verified against -client-ca have no chains.
+		{"unverified certificate", "", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "ops"}}}}, ""},
+		// A wrong token isn't made up for by a certificate.
+		{"wrong token and certificate", "guess", verified(&x509.Certificate{Subject: pkix.Name{CommonName: "ops"}}), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/render/x", nil)
+			if tt.token != "" || tt.name == "empty token" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			r.TLS = tt.tls
+			c, err := authenticate(clients, r)
+			switch {
+			case tt.want == "" && err == nil:
+				t.Errorf("authenticated as %s", c.Name)
+			case tt.want != "" && (err != nil || c.Name != tt.want):
+				t.Errorf("authenticate() = %v, %v; want %s", c, err, tt.want)
+			}
+		})
+	}
+}
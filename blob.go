@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+	"gocloud.dev/blob"
+	_ "gocloud.dev/blob/azureblob" // azblob:// destinations
+	_ "gocloud.dev/blob/gcsblob"   // gs:// destinations
+	_ "gocloud.dev/blob/s3blob"    // s3:// destinations
+)
+
+// blobSink collects files in memory and uploads them to an object storage bucket when
+// it is closed, since objects cannot be appended to in place.
+type blobSink struct {
+	*split.MemSink
+	dest   string
+	bucket *blob.Bucket
+}
+
+// isBlobURL reports whether dest names an object storage location rather than a directory.
+func isBlobURL(dest string) bool {
+	for _, scheme := range []string{"s3://", "gs://", "azblob://"} {
+		if strings.HasPrefix(dest, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// newBlobSink opens the bucket named by dest, e.g. s3://bucket/prefix?region=eu-west-1.
+// Like an output directory, a non-empty prefix is only replaced when force is set.
+func newBlobSink(ctx context.Context, dest string, force bool) (*blobSink, error) {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination %s: %w", dest, err)
+	}
+	prefix := strings.Trim(u.Path, "/")
+	u.Path = ""
+
+	bucket, err := blob.OpenBucket(ctx, u.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bucket %s: %w", dest, err)
+	}
+	if prefix != "" {
+		bucket = blob.PrefixedBucket(bucket, prefix+"/")
+	}
+
+	existing, err := listBlobs(ctx, bucket)
+	if err != nil {
+		bucket.Close()
+		return nil, fmt.Errorf("failed to check destination %s: %w", dest, err)
+	}
+	if len(existing) > 0 {
+		if !force {
+			bucket.Close()
+			return nil, fmt.Errorf(`destination "%s" already contains objects. Use -f to overwrite`, dest)
+		}
+		log.Printf("Removing %d existing objects under %s (-f specified)", len(existing), dest)
+		for _, key := range existing {
+			if err := bucket.Delete(ctx, key); err != nil {
+				bucket.Close()
+				return nil, fmt.Errorf("failed to remove %s from %s: %w", key, dest, err)
+			}
+		}
+	}
+	return &blobSink{MemSink: split.NewMemSink(), dest: dest, bucket: bucket}, nil
+}
+
+// listBlobs returns the keys of every object in bucket.
+func listBlobs(ctx context.Context, bucket *blob.Bucket) ([]string, error) {
+	var keys []string
+	iter := bucket.List(nil)
+	for {
+		obj, err := iter.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, obj.Key)
+	}
+}
+
+// Close uploads the collected files and closes the bucket.
+func (b *blobSink) Close() error {
+	ctx := context.Background()
+	for _, name := range b.Names() {
+		log.Printf("Uploading %s to %s", name, b.dest)
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = "text/plain; charset=utf-8"
+		}
+		opts := &blob.WriterOptions{ContentType: contentType}
+		if err := b.bucket.WriteAll(ctx, name, b.Files()[name], opts); err != nil {
+			b.bucket.Close()
+			return fmt.Errorf("error uploading %s to %s: %w", name, b.dest, err)
+		}
+	}
+	return b.bucket.Close()
+}
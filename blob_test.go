@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/fileblob"
+)
+
+// testBuckets opens every testblob:// bucket in one directory, standing in for
+// object storage the way s3:// or gs:// URLs name an existing bucket.
+var testBuckets = &testBucketOpener{}
+
+type testBucketOpener struct{ dir string }
+
+func (o *testBucketOpener) OpenBucketURL(_ context.Context, _ *url.URL) (*blob.Bucket, error) {
+	return fileblob.OpenBucket(o.dir, nil)
+}
+
+func init() {
+	blob.DefaultURLMux().RegisterBucket("testblob", testBuckets)
+}
+
+func TestIsBlobURL(t *testing.T) {
+	tests := []struct {
+		dest string
+		want bool
+	}{
+		{"s3://bucket/prefix?region=eu-west-1", true},
+		{"gs://bucket", true},
+		{"azblob://container/prefix", true},
+		{"out", false},
+		{"/tmp/s3://bucket", false},
+		{"file:///tmp/out", false},
+	}
+	for _, tt := range tests {
+		if got := isBlobURL(tt.dest); got != tt.want {
+			t.Errorf("isBlobURL(%q) = %v, want %v", tt.dest, got, tt.want)
+		}
+	}
+}
+
+func TestBlobSink(t *testing.T) {
+	dir := t.TempDir()
+	setFlag(t, &testBuckets.dir, dir)
+	dest := "testblob://bucket/renders"
+	ctx := context.Background()
+
+	s, err := newBlobSink(ctx, dest, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, doc := range []struct{ name, content string }{
+		{"chart/templates/cm.yaml", "kind: ConfigMap\n"},
+		{"chart/templates/cm.yaml", "---\nkind: Secret\n"},
+		{"chart/index.html", "<html></html>"},
+		{"chart/LICENSE", "MIT\n"},
+	} {
+		if err := s.CreateOrAppend(doc.name, []byte(doc.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bucket, err := blob.OpenBucket(ctx, "testblob://bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bucket.Close()
+	got, err := bucket.ReadAll(ctx, "renders/chart/templates/cm.yaml")
+	if err != nil || string(got) != "kind: ConfigMap\n---\nkind: Secret\n" {
+		t.Errorf("cm.yaml = %q, %v", got, err)
+	}
+	for key, want := range map[string]string{
+		"renders/chart/LICENSE":    "text/plain; charset=utf-8",
+		"renders/chart/index.html": "text/html; charset=utf-8",
+	} {
+		attrs, err := bucket.Attributes(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if attrs.ContentType != want {
+			t.Errorf("%s has content type %s, want %s", key, attrs.ContentType, want)
+		}
+	}
+
+	// A prefix that already holds objects is only replaced with -f.
+	if _, err := newBlobSink(ctx, dest, false); err == nil || !strings.Contains(err.Error(), "Use -f") {
+		t.Errorf("newBlobSink() over existing objects = %v", err)
+	}
+	s, err = newBlobSink(ctx, dest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateOrAppend("other.yaml", []byte("kind: Service\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := listBlobs(ctx, bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "renders/other.yaml" {
+		t.Errorf("bucket holds %q after -f, want only renders/other.yaml", keys)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "renders", "chart", "templates", "cm.yaml")); err == nil {
+		t.Error("the replaced objects are still on disk")
+	}
+}
+
+func TestBlobSinkInvalidDestination(t *testing.T) {
+	if _, err := newBlobSink(context.Background(), "nosuch://bucket", false); err == nil {
+		t.Error("newBlobSink() opened a bucket of an unknown scheme")
+	}
+}
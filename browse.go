@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// ANSI escape sequences for terminal output.
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiDim     = "\x1b[2m"
+	ansiReverse = "\x1b[7m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiCyan    = "\x1b[36m"
+)
+
+// browseMain implements "schelm browse [options]": it splits the helm output read
+// from stdin in memory and opens a terminal UI over the documents.
+func browseMain(args []string) int {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return 2
+	}
+	if flag.NArg() != 0 {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: schelm browse [options]")
+		flag.PrintDefaults()
+		return 2
+	}
+	if err := runBrowse(os.Stdin); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// browseEntry is one document of the render.
+type browseEntry struct {
+	file, kind, name, content string
+}
+
+func (e browseEntry) label() string {
+	return fmt.Sprintf("%s/%v", valueOr(e.kind, "-"), valueOr(e.name, "-"))
+}
+
+// runBrowse renders the stream and runs the browser on the controlling terminal,
+// since stdin carries the helm output.
+func runBrowse(stdin io.Reader) error {
+	if format != "yaml" {
+		return errors.New("schelm browse requires -format yaml")
+	}
+	files, err := renderInMemory(stdin)
+	if err != nil {
+		return err
+	}
+	b := &browser{}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		for _, doc := range strings.Split(string(files[name]), "\n---\n") {
+			s := newSpec(name, doc)
+			b.entries = append(b.entries, browseEntry{file: name, kind: s.kind(), name: s.name(), content: strings.TrimSpace(doc)})
+		}
+	}
+	if len(b.entries) == 0 {
+		return errors.New("the stream renders no documents")
+	}
+	b.filter()
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("schelm browse needs a terminal: %w", err)
+	}
+	defer tty.Close()
+	state, err := stty(tty, "-g")
+	if err != nil {
+		return fmt.Errorf("error reading the terminal mode: %w", err)
+	}
+	if _, err := stty(tty, "raw", "-echo"); err != nil {
+		return fmt.Errorf("error switching the terminal to raw mode: %w", err)
+	}
+	defer stty(tty, strings.TrimSpace(state))
+	fmt.Fprint(tty, "\x1b[?1049h\x1b[?25l") // Alternate screen, hidden cursor
+	defer fmt.Fprint(tty, "\x1b[?25h\x1b[?1049l")
+
+	keys := bufio.NewReader(tty)
+	for {
+		b.rows, b.cols = terminalSize(tty)
+		b.draw(tty)
+		key, err := readKey(keys)
+		if err != nil {
+			return err
+		}
+		if b.key(key) {
+			return nil
+		}
+	}
+}
+
+// stty runs stty on the terminal tty and returns its output.
+func stty(tty *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// terminalSize returns the rows and columns of tty, or 24x80 when they are unknown.
+func terminalSize(tty *os.File) (int, int) {
+	var rows, cols int
+	if out, err := stty(tty, "size"); err == nil {
+		fmt.Sscan(out, &rows, &cols)
+	}
+	if rows <= 2 || cols <= 10 {
+		return 24, 80
+	}
+	return rows, cols
+}
+
+// readKey reads one key press, returning escape sequences such as the arrow keys
+// whole.
+func readKey(r *bufio.Reader) (string, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	key := []byte{c}
+	if c == 0x1b {
+		for r.Buffered() > 0 {
+			c, _ := r.ReadByte()
+			key = append(key, c)
+			if len(key) > 2 && (c >= 'A' && c <= 'Z' || c == '~') {
+				break
+			}
+		}
+	}
+	return string(key), nil
+}
+
+// browser is the state of the terminal UI: the documents on the left, the selected
+// one on the right and the search narrowing the list.
+type browser struct {
+	entries    []browseEntry
+	visible    []int // indexes into entries matching the query
+	cursor     int   // position in visible
+	top        int   // first visible entry shown
+	offset     int   // first line of the selected document shown
+	query      string
+	searching  bool
+	rows, cols int
+}
+
+// filter recomputes the entries matching the query.
+func (b *browser) filter() {
+	b.visible = b.visible[:0]
+	for i, e := range b.entries {
+		if fuzzyMatch(b.query, e.file+" "+e.label()) {
+			b.visible = append(b.visible, i)
+		}
+	}
+	b.cursor, b.top, b.offset = 0, 0, 0
+}
+
+// fuzzyMatch reports whether the characters of pattern appear in s in order,
+// ignoring case.
+func fuzzyMatch(pattern, s string) bool {
+	s = strings.ToLower(s)
+	for _, c := range strings.ToLower(pattern) {
+		i := strings.IndexRune(s, c)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(string(c)):]
+	}
+	return true
+}
+
+// key handles a key press and reports whether the browser should quit.
+func (b *browser) key(key string) bool {
+	if b.searching {
+		switch key {
+		case "\r", "\x1b":
+			b.searching = false
+		case "\x7f", "\b":
+			if b.query != "" {
+				runes := []rune(b.query)
+				b.query = string(runes[:len(runes)-1])
+				b.filter()
+			}
+		case "\x03":
+			return true
+		default:
+			if len(key) == 1 && key[0] >= ' ' {
+				b.query += key
+				b.filter()
+			}
+		}
+		return false
+	}
+
+	page := b.rows - 2
+	switch key {
+	case "q", "\x03":
+		return true
+	case "/":
+		b.searching = true
+	case "\x1b":
+		b.query = ""
+		b.filter()
+	case "j", "\x1b[B":
+		b.move(1)
+	case "k", "\x1b[A":
+		b.move(-1)
+	case "g", "\x1b[H":
+		b.move(-len(b.visible))
+	case "G", "\x1b[F":
+		b.move(len(b.visible))
+	case " ", "\x1b[6~":
+		b.offset += page
+	case "b", "\x1b[5~":
+		b.offset -= page
+	case "J":
+		b.offset++
+	case "K":
+		b.offset--
+	}
+	b.offset = max(0, min(b.offset, len(b.lines())-page))
+	return false
+}
+
+// move moves the cursor by delta entries, scrolling the list as needed.
+func (b *browser) move(delta int) {
+	if len(b.visible) == 0 {
+		return
+	}
+	b.cursor = max(0, min(b.cursor+delta, len(b.visible)-1))
+	b.offset = 0
+	if height := b.rows - 1; b.cursor >= b.top+height {
+		b.top = b.cursor - height + 1
+	}
+	b.top = min(b.top, b.cursor)
+}
+
+// lines returns the lines of the selected document.
+func (b *browser) lines() []string {
+	if len(b.visible) == 0 {
+		return nil
+	}
+	e := b.entries[b.visible[b.cursor]]
+	return append([]string{"# Source: " + e.file}, strings.Split(e.content, "\n")...)
+}
+
+// draw paints the whole screen: the list, the document and the status line.
+func (b *browser) draw(w io.Writer) {
+	var out strings.Builder
+	out.WriteString("\x1b[H")
+	left := min(max(b.cols*2/5, 20), b.cols/2)
+	right := b.cols - left - 1
+	lines := b.lines()
+	for row := 0; row < b.rows-1; row++ {
+		if i := b.top + row; i < len(b.visible) {
+			e := b.entries[b.visible[i]]
+			cell := padRight(truncate(e.label()+"  "+e.file, left), left)
+			if i == b.cursor {
+				out.WriteString(ansiReverse + cell + ansiReset)
+			} else {
+				out.WriteString(cell)
+			}
+		} else {
+			out.WriteString(strings.Repeat(" ", left))
+		}
+		out.WriteString(ansiDim + "│" + ansiReset)
+		if i := b.offset + row; i < len(lines) {
+			out.WriteString(highlightTerminalLine(truncate(lines[i], right)))
+		}
+		out.WriteString("\x1b[K\r\n")
+	}
+	status := fmt.Sprintf("%d/%d  j/k: select  space/b: scroll  /: search  q: quit", len(b.visible), len(b.entries))
+	if b.searching || b.query != "" {
+		status = "/" + b.query
+	}
+	out.WriteString(ansiBold + truncate(status, b.cols) + ansiReset + "\x1b[K")
+	io.WriteString(w, out.String())
+}
+
+// highlightTerminalLine colors a YAML line with the same rules as the HTML report.
+func highlightTerminalLine(line string) string {
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case strings.HasPrefix(trimmed, "#"), trimmed == "---":
+		return ansiDim + line + ansiReset
+	}
+	if m := yamlLine.FindStringSubmatch(line); m != nil {
+		return m[1] + ansiCyan + m[2] + ansiReset + ":" + highlightTerminalValue(m[3])
+	}
+	return highlightTerminalValue(line)
+}
+
+// highlightTerminalValue colors strings and literals.
+func highlightTerminalValue(value string) string {
+	v := strings.TrimSpace(value)
+	switch {
+	case v == "":
+		return value
+	case strings.HasPrefix(v, `"`), strings.HasPrefix(v, "'"):
+		return ansiGreen + value + ansiReset
+	case yamlLiteral.MatchString(v):
+		return ansiYellow + value + ansiReset
+	}
+	return value
+}
+
+// truncate shortens s to at most width characters.
+func truncate(s string, width int) string {
+	if runes := []rune(s); len(runes) > width {
+		return string(runes[:max(width, 0)])
+	}
+	return s
+}
+
+// padRight pads s with spaces to width characters.
+func padRight(s string, width int) string {
+	return s + strings.Repeat(" ", max(width-len([]rune(s)), 0))
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+var byChart bool // Whether every chart of an umbrella chart gets its own directory
+
+func init() {
+	flag.BoolVar(&byChart, "by-chart", false, "Write the resources of every chart under OUTPUT_DIR/<chart>/, moving those of subcharts (umbrella/charts/<name>/templates/...) to <name>/templates/...")
+}
+
+// chartRoute moves a Source of a subchart, at any depth of charts/<name>/
+// nesting, below the directory of that subchart.
+func chartRoute(source string) (string, error) {
+	parts := strings.Split(source, "/")
+	start := subchartStart(parts)
+	if start == 0 {
+		return source, nil
+	}
+	return checkDestination(source, strings.Join(parts[start:], "/"))
+}
+
+// subchartStart returns the index of the innermost subchart name in the parts of a
+// Source, or 0 when it belongs to the top chart.
+func subchartStart(parts []string) int {
+	start := 0
+	for i := 1; i+2 < len(parts); i++ {
+		if parts[i] == "charts" && i == start+1 {
+			start = i + 1
+			i++
+		}
+	}
+	return start
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// caseFolds remembers the written paths and their directories by the name they
+// get on case-insensitive filesystems, to catch paths that only differ by case.
+type caseFolds map[string]foldedPath
+
+type foldedPath struct {
+	path, source string
+}
+
+// foldName is the name macOS and Windows see for a path: case does not matter, and
+// Windows drops trailing dots and spaces from every component.
+func foldName(name string) string {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		parts[i] = strings.ToLower(strings.TrimRight(part, ". "))
+	}
+	return strings.Join(parts, "/")
+}
+
+// check records dest, written for source, and fails if it or one of its
+// directories collides with a different path written earlier.
+func (c caseFolds) check(dest, source string) error {
+	for i := len(dest); i > 0; i = strings.LastIndex(dest[:i], "/") {
+		prefix := dest[:i]
+		key := foldName(prefix)
+		if earlier, ok := c[key]; !ok {
+			c[key] = foldedPath{prefix, source}
+		} else if earlier.path != prefix {
+			return fmt.Errorf("source %s is written to %s, which differs only by case from %s of source %s; "+
+				"the two collide on case-insensitive filesystems such as macOS and Windows, losing files when the output is checked out there",
+				source, prefix, earlier.path, earlier.source)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+const cdk8sManifestsDir = "manifests"
+
+var cdk8sScaffold bool // Whether to wrap the output in a cdk8s project scaffold
+
+func init() {
+	flag.BoolVar(&cdk8sScaffold, "cdk8s", false, "Write manifests to manifests/ and generate a cdk8s TypeScript app including them")
+}
+
+const cdk8sPackageJSON = `{
+  "name": "rendered-chart",
+  "private": true,
+  "scripts": {
+    "import": "cdk8s import",
+    "synth": "cdk8s synth"
+  },
+  "dependencies": {
+    "cdk8s": "^2.0.0",
+    "constructs": "^10.0.0"
+  },
+  "devDependencies": {
+    "cdk8s-cli": "^2.0.0",
+    "ts-node": "^10.0.0",
+    "typescript": "^5.0.0"
+  }
+}
+`
+
+const cdk8sTSConfig = `{
+  "compilerOptions": {
+    "target": "ES2020",
+    "module": "commonjs",
+    "strict": true,
+    "esModuleInterop": true
+  },
+  "include": ["**/*.ts"]
+}
+`
+
+// writeCdk8sScaffold writes a cdk8s project around the rendered manifests: cdk8s.yaml
+// importing the core API plus any CustomResourceDefinitions in the render, and a main.ts
+// whose chart includes every rendered file.
+func writeCdk8sScaffold(sink split.Sink, result *renderResult) error {
+	crdFiles := make(map[string]bool)
+	for _, s := range result.specs {
+		if s.kind() == "CustomResourceDefinition" {
+			crdFiles[s.dest] = true
+		}
+	}
+
+	var config strings.Builder
+	config.WriteString("language: typescript\napp: npx ts-node main.ts\nimports:\n  - k8s\n")
+	for _, file := range result.files {
+		if crdFiles[file] {
+			fmt.Fprintf(&config, "  - %s\n", path.Join(cdk8sManifestsDir, file))
+		}
+	}
+
+	var app strings.Builder
+	app.WriteString("import { App, Chart, Include } from 'cdk8s';\n")
+	app.WriteString("import { Construct } from 'constructs';\n\n")
+	app.WriteString("export class RenderedChart extends Chart {\n")
+	app.WriteString("  constructor(scope: Construct, id: string) {\n")
+	app.WriteString("    super(scope, id);\n")
+	for _, file := range result.files {
+		// Construct ids may not contain the construct path separator.
+		id := strings.ReplaceAll(strings.TrimSuffix(file, path.Ext(file)), "/", "-")
+		url := path.Join(cdk8sManifestsDir, file)
+		fmt.Fprintf(&app, "    new Include(this, %s, { url: %s });\n", quoteString(id), quoteString(url))
+	}
+	app.WriteString("  }\n}\n\n")
+	app.WriteString("const app = new App();\nnew RenderedChart(app, 'rendered');\napp.synth();\n")
+
+	files := []struct{ name, content string }{
+		{"cdk8s.yaml", config.String()},
+		{"main.ts", app.String()},
+		{"package.json", cdk8sPackageJSON},
+		{"tsconfig.json", cdk8sTSConfig},
+	}
+	for _, f := range files {
+		if err := sink.CreateOrAppend(f.name, []byte(f.content)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
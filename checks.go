@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Severities of check findings. Only errors fail a run.
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// finding is a problem a check reported for one written document.
+type finding struct {
+	spec     *spec
+	check    string // name of the check, e.g. "forbid-kind"
+	severity string
+	message  string
+	line     int // line within the document the finding is about, 0 for the whole document
+}
+
+// inputLine returns the line of the input stream the finding is about, or 0.
+func (f finding) inputLine() int {
+	if f.spec.inputLine == 0 {
+		return 0
+	}
+	return f.spec.inputLine + max(f.line, 1) - 1
+}
+
+// inputLocation describes where the finding is in the input stream, or within the
+// document when the input line isn't known.
+func (f finding) inputLocation() string {
+	if f.spec.inputLine == 0 && f.line > 0 {
+		return fmt.Sprintf(", document line %d", f.line)
+	}
+	return f.spec.inputLocation(f.line)
+}
+
+// check inspects the written documents and returns its findings.
+type check func(specs []*spec) []finding
+
+// enabledChecks returns the checks requested by flags, in the order they report.
+func enabledChecks() ([]check, error) {
+	var checks []check
+	if kinds := splitList(forbidKinds); len(kinds) > 0 {
+		checks = append(checks, forbidKindCheck(kinds))
+	}
+	if requireNamespace {
+		checks = append(checks, requireNamespaceCheck)
+	}
+	if warnYAMLGotchas {
+		checks = append(checks, yamlGotchasCheck)
+	}
+	if checkDeprecations {
+		c, err := newDeprecationCheck()
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, c)
+	}
+	if lintEnabled {
+		c, err := newLintCheck()
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, c)
+	}
+	if checkAPIResources {
+		c, err := newAPIResourcesCheck()
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, c)
+	}
+	if serverValidate {
+		c, err := newServerValidateCheck()
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, c)
+	}
+	return checks, nil
+}
+
+// resourceName returns "Kind/name" for messages, or the Source for documents without metadata.
+func resourceName(s *spec) string {
+	if s.kind() == "" {
+		return s.source
+	}
+	if s.name() == "" {
+		return s.kind()
+	}
+	return s.kind() + "/" + s.name()
+}
+
+// runChecks runs every check over specs, logs the findings grouped by output file and
+// returns an error if any of them has error severity.
+func runChecks(checks []check, specs []*spec) ([]finding, error) {
+	var findings []finding
+	for _, c := range checks {
+		findings = append(findings, c(specs)...)
+	}
+
+	failed := 0
+	for _, f := range findings {
+		if f.severity == severityError {
+			failed++
+		}
+		log.Printf("%s: %s: %s: %s [%s%s]", strings.ToUpper(f.severity[:1])+f.severity[1:], f.spec.dest, resourceName(f.spec), f.message, f.check, f.inputLocation())
+	}
+	if failed > 0 {
+		return findings, fmt.Errorf("checks reported %d error(s)", failed)
+	}
+	return findings, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configChecksumAnnotation is the pod template annotation that changes, and so
+// rolls the workload, whenever a ConfigMap or Secret it uses changes.
+const configChecksumAnnotation = "checksum/config"
+
+var configChecksums bool // Whether to annotate workloads with the checksum of their config
+
+func init() {
+	flag.BoolVar(&configChecksums, "config-checksums", false, "Annotate the pod templates of Deployments, StatefulSets and DaemonSets with a "+configChecksumAnnotation+" of the rendered ConfigMaps and Secrets they reference")
+}
+
+// configChecksumKinds are the workloads whose pods are rolled when the annotation changes.
+var configChecksumKinds = []string{"Deployment", "StatefulSet", "DaemonSet"}
+
+// configChecksumTransform sets the checksum annotation on every workload that
+// references ConfigMaps or Secrets of the render, leaving charts that already set
+// it alone, as well as those the untouched rules of the config protect.
+func configChecksumTransform(specs []*spec) ([]*spec, error) {
+	var configs []*spec
+	for _, s := range specs {
+		if kind := s.kind(); kind == "ConfigMap" || kind == "Secret" {
+			configs = append(configs, s)
+		}
+	}
+	if len(configs) == 0 {
+		return specs, nil
+	}
+
+	for i, s := range specs {
+		if !slices.Contains(configChecksumKinds, s.kind()) {
+			continue
+		}
+		pod := podSpec(s)
+		if pod == nil {
+			continue
+		}
+		used := make(map[string]*spec)
+		for _, ref := range configReferences(pod) {
+			if c := findConfig(configs, ref, s.namespace()); c != nil {
+				used[ref.kind+"/"+ref.name] = c
+			}
+		}
+		if len(used) == 0 {
+			continue
+		}
+		root, _ := s.root()
+		paths := podSpecPaths[s.kind()]
+		template := lookupNode(root, paths[:len(paths)-1]...)
+		if scalarField(template, "metadata", "annotations", configChecksumAnnotation) != "" {
+			continue
+		}
+
+		hash := sha256.New()
+		for _, ref := range slices.Sorted(maps.Keys(used)) {
+			fmt.Fprintf(hash, "%s\n%s\n", ref, used[ref].content)
+		}
+		// Annotate a copy when rules may undo it, leaving the parsed document intact.
+		before := root
+		if len(untouched) > 0 {
+			root = cloneNode(root)
+			template = lookupNode(root, paths[:len(paths)-1]...)
+		}
+		setAnnotation(template, configChecksumAnnotation, hex.EncodeToString(hash.Sum(nil)))
+		if len(untouched) > 0 {
+			if untouched.restore(before, root) || scalarField(template, "metadata", "annotations", configChecksumAnnotation) == "" {
+				log.Printf("Leaving %s untouched, as the config lists it", resourceName(s))
+				continue
+			}
+		}
+
+		content, err := encodeYAML(root)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding %s from %s: %w", resourceName(s), s.source, err)
+		}
+		log.Printf("Adding %s to %s (%d config reference(s))", configChecksumAnnotation, resourceName(s), len(used))
+		specs[i] = s.withContent(content)
+	}
+	return specs, nil
+}
+
+// findConfig returns the ConfigMap or Secret ref points to for a workload in
+// namespace. Documents without a namespace are taken to be in the release's one.
+func findConfig(configs []*spec, ref configReference, namespace string) *spec {
+	for _, c := range configs {
+		if c.kind() == ref.kind && c.name() == ref.name && (c.namespace() == namespace || c.namespace() == "" || namespace == "") {
+			return c
+		}
+	}
+	return nil
+}
+
+// configReference names a ConfigMap or Secret used by a pod.
+type configReference struct {
+	kind, name string
+}
+
+// configReferences lists the ConfigMaps and Secrets a pod spec mounts or reads
+// environment variables from.
+func configReferences(pod *yaml.Node) []configReference {
+	var refs []configReference
+	add := func(kind string, n *yaml.Node, keys ...string) {
+		if name := scalarField(n, keys...); name != "" {
+			refs = append(refs, configReference{kind, name})
+		}
+	}
+	for _, v := range sequenceItems(lookupNode(pod, "volumes")) {
+		add("ConfigMap", v, "configMap", "name")
+		add("Secret", v, "secret", "secretName")
+		for _, source := range sequenceItems(lookupNode(v, "projected", "sources")) {
+			add("ConfigMap", source, "configMap", "name")
+			add("Secret", source, "secret", "name")
+		}
+	}
+	for _, c := range append(containers(pod, "initContainers"), containers(pod, "containers")...) {
+		for _, env := range sequenceItems(lookupNode(c, "env")) {
+			add("ConfigMap", env, "valueFrom", "configMapKeyRef", "name")
+			add("Secret", env, "valueFrom", "secretKeyRef", "name")
+		}
+		for _, from := range sequenceItems(lookupNode(c, "envFrom")) {
+			add("ConfigMap", from, "configMapRef", "name")
+			add("Secret", from, "secretRef", "name")
+		}
+	}
+	return refs
+}
+
+// sequenceItems returns the items of a sequence node, or nil for anything else.
+func sequenceItems(n *yaml.Node) []*yaml.Node {
+	if n == nil || n.Kind != yaml.SequenceNode {
+		return nil
+	}
+	items := make([]*yaml.Node, len(n.Content))
+	for i, item := range n.Content {
+		items[i] = resolveAlias(item)
+	}
+	return items
+}
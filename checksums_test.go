@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestConfigChecksums(t *testing.T) {
+	setFlag(t, &configChecksums, true)
+	cm := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\ndata:\n  a: \"1\"\n"
+	secret := "apiVersion: v1\nkind: Secret\nmetadata:\n  name: token\n  namespace: prod\n"
+	workload := func(kind, annotations string) string {
+		return "apiVersion: apps/v1\nkind: " + kind + "\nmetadata:\n  name: web\n  namespace: prod\nspec:\n  template:\n    metadata:\n" + annotations +
+			"    spec:\n      volumes:\n      - name: settings\n        configMap:\n          name: settings\n      containers:\n      - name: web\n        envFrom:\n        - secretRef:\n            name: token\n"
+	}
+	sum := sha256.Sum256([]byte("ConfigMap/settings\n" + cm + "\nSecret/token\n" + secret + "\n"))
+	checksum := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name     string
+		workload string
+		want     string // the annotation, empty for none
+	}{
+		{"Deployment", workload("Deployment", "      labels:\n        app: web\n"), checksum},
+		{"StatefulSet", workload("StatefulSet", "      labels:\n        app: web\n"), checksum},
+		{"set by the chart", workload("DaemonSet", "      annotations:\n        checksum/config: chart\n"), "chart"},
+		{"not a workload", workload("Job", "      labels:\n        app: web\n"), ""},
+		{"config of another namespace", strings.NewReplacer("namespace: prod", "namespace: dev", "name: settings\n      containers", "name: missing\n      containers").Replace(workload("Deployment", "      labels:\n        app: web\n")), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := render(t, helmOutput("web/templates/cm.yaml", cm, "web/templates/secret.yaml", secret, "web/templates/workload.yaml", tt.workload))
+			s := &spec{source: "web/templates/workload.yaml", content: files["web/templates/workload.yaml"]}
+			root, err := s.root()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := scalarField(root, "spec", "template", "metadata", "annotations", configChecksumAnnotation)
+			if tt.want == "" && got == "" && s.content != tt.workload {
+				t.Errorf("rewrote the workload:\n%s", s.content)
+			}
+			if got != tt.want {
+				t.Errorf("%s = %q, want %q", configChecksumAnnotation, got, tt.want)
+			}
+		})
+	}
+}
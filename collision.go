@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+)
+
+var collisionStrategy string // What happens when different Sources end up in the same file
+
+func init() {
+	flag.StringVar(&collisionStrategy, "collision", "error", "What to do when documents of different Sources end up in the same file after -map, -rewrite, sanitizing or shortening: error, suffix (write the later Source to name-2.yaml, ...) or append (write both to the file)")
+}
+
+func validateCollisionStrategy(strategy string) error {
+	switch strategy {
+	case "error", "suffix", "append":
+		return nil
+	}
+	return fmt.Errorf("invalid -collision %q (expected error, suffix or append)", strategy)
+}
+
+// collisions tracks which Source each destination was first written for and
+// resolves clashes with the -collision strategy.
+type collisions struct {
+	strategy string
+	owner    map[string]string    // destination -> Source it was written for
+	moved    map[[2]string]string // Source and destination -> suffixed destination
+}
+
+func newCollisions(strategy string) *collisions {
+	return &collisions{strategy: strategy, owner: make(map[string]string), moved: make(map[[2]string]string)}
+}
+
+// resolve returns the destination of a document of source that would go to dest.
+func (c *collisions) resolve(dest, source string) (string, error) {
+	if moved, ok := c.moved[[2]string{source, dest}]; ok {
+		return moved, nil
+	}
+	owner, ok := c.owner[dest]
+	if !ok {
+		c.owner[dest] = source
+		return dest, nil
+	}
+	if owner == source {
+		return dest, nil
+	}
+	switch c.strategy {
+	case "append":
+		c.moved[[2]string{source, dest}] = dest
+		log.Printf("Warning: %s and %s are both written to %s (-collision append)", owner, source, dest)
+		return dest, nil
+	case "suffix":
+		ext := path.Ext(dest)
+		stem := strings.TrimSuffix(dest, ext)
+		for n := 2; ; n++ {
+			suffixed := fmt.Sprintf("%s-%d%s", stem, n, ext)
+			if _, taken := c.owner[suffixed]; !taken {
+				log.Printf("Writing %s to %s, since %s is written for %s", source, suffixed, dest, owner)
+				c.owner[suffixed] = source
+				c.moved[[2]string{source, dest}] = suffixed
+				return suffixed, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("sources %s and %s are both written to %s; use -collision suffix or -collision append to allow it", owner, source, dest)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"bromaniac.github.com/schelm/split"
+	"gopkg.in/yaml.v3"
+)
+
+var configFile string // Config file describing the releases schelm renders itself
+
+func init() {
+	flag.StringVar(&configFile, "config", ".schelm.yaml", "Config file listing the releases schelm daemon renders, with their charts, values and output directories, and the fields -config-checksums and -normalize-profile leave untouched")
+}
+
+// schelmConfig is the config file of the modes that render charts on their own
+// instead of being handed helm output, such as schelm daemon.
+type schelmConfig struct {
+	Releases  []releaseConfig `yaml:"releases"`
+	Git       gitConfig       `yaml:"git"`
+	Untouched untouchedRules  `yaml:"untouched"` // fields -config-checksums and -normalize-profile never rewrite
+}
+
+// releaseConfig is one release: the chart, how helm renders it and where the split
+// manifests go.
+type releaseConfig struct {
+	Name             string   `yaml:"name"`
+	Chart            string   `yaml:"chart"`   // path, repo/name or OCI reference
+	Version          string   `yaml:"version"` // pinned version or constraint; empty for the latest
+	Namespace        string   `yaml:"namespace"`
+	Values           []string `yaml:"values"`
+	Set              []string `yaml:"set"`
+	SetString        []string `yaml:"setString"`
+	SetFile          []string `yaml:"setFile"`
+	KubeVersion      string   `yaml:"kubeVersion"`
+	APIVersions      []string `yaml:"apiVersions"`
+	IncludeCRDs      bool     `yaml:"includeCRDs"`
+	DependencyUpdate bool     `yaml:"dependencyUpdate"`
+	Output           string   `yaml:"output"`
+}
+
+// gitConfig controls committing the re-rendered manifests.
+type gitConfig struct {
+	Commit  bool   `yaml:"commit"`  // commit the outputs after every re-render
+	Push    bool   `yaml:"push"`    // push the commit to the upstream of the current branch
+	Message string `yaml:"message"` // commit message; %s is replaced with the release names
+}
+
+// loadConfig reads and checks the config file.
+func loadConfig(file string) (*schelmConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+	var config schelmConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing config %s: %w", file, err)
+	}
+	seen := make(map[string]bool)
+	for i, r := range config.Releases {
+		if r.Name == "" || r.Chart == "" || r.Output == "" {
+			return nil, fmt.Errorf("config %s: release %d needs a name, chart and output", file, i+1)
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("config %s: release %s is listed twice", file, r.Name)
+		}
+		seen[r.Name] = true
+	}
+	for i := range config.Untouched {
+		if err := config.Untouched[i].parsePaths(); err != nil {
+			return nil, fmt.Errorf("config %s: untouched: %w", file, err)
+		}
+	}
+	if config.Git.Push && !config.Git.Commit {
+		return nil, fmt.Errorf("config %s: git push requires commit", file)
+	}
+	if config.Git.Message == "" {
+		config.Git.Message = "Re-render %s"
+	}
+	return &config, nil
+}
+
+// renderRelease renders r with helm and splits it into its output directory,
+// replacing the previous render. Every helm option of the command line is swapped
+// for the release's own while it runs, so no release renders with the values of
+// another.
+func renderRelease(r releaseConfig) error {
+	defer currentHelmOptions().apply()
+	overwrite := force
+	defer func() { force = overwrite }()
+	helmOptions{
+		chart: r.Chart, version: r.Version, release: r.Name, namespace: r.Namespace,
+		values: r.Values, set: r.Set, setString: r.SetString, setFile: r.SetFile,
+		kubeVersion: r.KubeVersion, apiVersions: r.APIVersions,
+		includeCRDs: r.IncludeCRDs, dependencyUpdate: r.DependencyUpdate,
+	}.apply()
+	force = true
+	if err := run(split.OSFS{}, nil, os.Stdout, r.Output); err != nil {
+		return fmt.Errorf("release %s: %w", r.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+	"gopkg.in/yaml.v3"
+)
+
+const configMapFilesDir = "_files"
+
+var (
+	extractConfigMapData bool // Whether to write ConfigMap data entries as standalone files
+	configMapGenerator   bool // Whether to write a kustomize configMapGenerator for the extracted files
+)
+
+func init() {
+	flag.BoolVar(&extractConfigMapData, "extract-configmap-data", false, "Write every ConfigMap data and binaryData entry to "+configMapFilesDir+"/<configmap>/<key>")
+	flag.BoolVar(&configMapGenerator, "configmap-generator", false, "With -extract-configmap-data, also write "+configMapFilesDir+"/"+kustomizationFile+" with a configMapGenerator for the extracted files")
+}
+
+// writeConfigMapData writes the entries of every ConfigMap in specs as files below
+// _files/<name>/, or _files/<namespace>_<name>/ for names rendered in several
+// namespaces, so embedded scripts and configs can be linted and diffed natively,
+// and with generator a kustomization recreating the ConfigMaps from them.
+func writeConfigMapData(sink split.Sink, specs []*spec, generator bool) error {
+	var kustomization strings.Builder
+	kustomization.WriteString(kustomizationHeader)
+	kustomization.WriteString("configMapGenerator:\n")
+	written := make(map[string]bool) // namespace/name of the ConfigMaps written
+
+	// Names rendered in several namespaces get a directory per namespace
+	namespaces := make(map[string]map[string]bool)
+	for _, s := range specs {
+		if s.kind() == "ConfigMap" {
+			if namespaces[s.name()] == nil {
+				namespaces[s.name()] = make(map[string]bool)
+			}
+			namespaces[s.name()][s.namespace()] = true
+		}
+	}
+
+	for _, s := range specs {
+		if s.kind() != "ConfigMap" {
+			continue
+		}
+		root, err := s.root()
+		if err != nil {
+			return err
+		}
+		name := s.name()
+		if !isPathComponent(name) {
+			log.Printf("Warning: ConfigMap %q in %s has no usable name, skipping its data", name, s.source)
+			continue
+		}
+		namespace := s.namespace()
+		if written[namespace+"/"+name] {
+			log.Printf("Warning: ConfigMap %s is rendered more than once, skipping the data from %s", resourceName(s), s.source)
+			continue
+		}
+		written[namespace+"/"+name] = true
+		dir := name
+		if len(namespaces[name]) > 1 && namespace != "" {
+			// Namespaces and ConfigMap names can't contain underscores, so this
+			// can't clash with another ConfigMap's directory.
+			dir = namespace + "_" + name
+		}
+
+		var files []string
+		for _, field := range []string{"data", "binaryData"} {
+			entries := lookupNode(root, field)
+			if entries == nil || entries.Kind != yaml.MappingNode {
+				continue
+			}
+			for i := 0; i+1 < len(entries.Content); i += 2 {
+				key, value := entries.Content[i].Value, resolveAlias(entries.Content[i+1])
+				if !isPathComponent(key) || value.Kind != yaml.ScalarNode {
+					log.Printf("Warning: skipping entry %q of ConfigMap %s", key, name)
+					continue
+				}
+				data := []byte(value.Value)
+				if field == "binaryData" {
+					if data, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value.Value), "")); err != nil {
+						return fmt.Errorf("error decoding binaryData %s of ConfigMap %s: %w", key, name, err)
+					}
+				}
+				file := path.Join(dir, key)
+				if err := sink.CreateOrAppend(path.Join(configMapFilesDir, file), data); err != nil {
+					return err
+				}
+				files = append(files, file)
+			}
+		}
+
+		fmt.Fprintf(&kustomization, "  - name: %s\n", name)
+		if namespace != "" {
+			fmt.Fprintf(&kustomization, "    namespace: %s\n", namespace)
+		}
+		kustomization.WriteString("    options:\n      disableNameSuffixHash: true\n")
+		if len(files) > 0 {
+			kustomization.WriteString("    files:\n")
+			for _, file := range files {
+				fmt.Fprintf(&kustomization, "      - %s=%s\n", path.Base(file), file)
+			}
+		}
+	}
+
+	if generator && len(written) > 0 {
+		return sink.CreateOrAppend(path.Join(configMapFilesDir, kustomizationFile), []byte(kustomization.String()))
+	}
+	return nil
+}
+
+// isPathComponent reports whether name can be used as a single file name.
+func isPathComponent(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
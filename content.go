@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"path"
+	"slices"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+// contentIndexFile maps the logical paths of a content-addressed output to the
+// hashes of their content.
+const contentIndexFile = "index.txt"
+
+var contentAddressed bool // Whether files are stored under the hash of their content
+
+func init() {
+	flag.BoolVar(&contentAddressed, "content-addressed", false, "Store every file as objects/<hash prefix>/<sha256>.<ext>, writing identical files once, with "+contentIndexFile+" mapping the file paths to their hashes")
+}
+
+// contentSink collects the files of a render and writes them to the wrapped sink
+// under the SHA-256 of their content when closed, followed by the index.
+type contentSink struct {
+	*split.MemSink
+	target split.Sink
+}
+
+func newContentSink(target split.Sink) *contentSink {
+	return &contentSink{MemSink: split.NewMemSink(), target: target}
+}
+
+// objectPath is where content with the given hash is stored.
+func objectPath(hash, name string) string {
+	return path.Join("objects", hash[:2], hash+path.Ext(name))
+}
+
+// Close writes the objects and the index, then closes the wrapped sink.
+func (c *contentSink) Close() error {
+	var index bytes.Buffer
+	written := make(map[string]bool)
+	for _, name := range slices.Sorted(maps.Keys(c.Files())) {
+		hash := sha256Hex(c.Files()[name])
+		object := objectPath(hash, name)
+		if !written[object] {
+			written[object] = true
+			if err := c.target.CreateOrAppend(object, c.Files()[name]); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(&index, "%s  %s\n", hash, name)
+	}
+	if len(written) < len(c.Files()) {
+		log.Printf("Stored %d files as %d objects", len(c.Files()), len(written))
+	}
+	if err := c.target.CreateOrAppend(contentIndexFile, index.Bytes()); err != nil {
+		return err
+	}
+	return split.Close(c.target)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+	"gopkg.in/yaml.v3"
+)
+
+const schemasDir = "schemas"
+
+var extractCRDSchemas bool // Whether to write the openAPIV3Schema of rendered CRDs as JSON Schema
+
+func init() {
+	flag.BoolVar(&extractCRDSchemas, "extract-crd-schemas", false, "Write the openAPIV3Schema of every rendered CustomResourceDefinition to schemas/<group>/<kind>_<version>.json")
+}
+
+// writeCRDSchemas extracts the schema of every version of every CustomResourceDefinition
+// in specs and writes it as a JSON Schema file below schemas/.
+func writeCRDSchemas(sink split.Sink, specs []*spec) error {
+	for _, s := range specs {
+		if s.kind() != "CustomResourceDefinition" {
+			continue
+		}
+		root, err := s.root()
+		if err != nil {
+			return err
+		}
+		group := s.field("spec", "group")
+		kind := strings.ToLower(s.field("spec", "names", "kind"))
+		if group == "" || kind == "" {
+			log.Printf("Warning: CustomResourceDefinition %s in %s has no group or kind, skipping its schema", s.name(), s.source)
+			continue
+		}
+
+		schemas, err := crdVersionSchemas(root)
+		if err != nil {
+			return fmt.Errorf("error reading schemas of CustomResourceDefinition %s: %w", s.name(), err)
+		}
+		for _, version := range slices.Sorted(maps.Keys(schemas)) {
+			schema, ok := openAPIToJSONSchema(schemas[version]).(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("schema of %s/%s %s is not an object", group, version, kind)
+			}
+			schema["$schema"] = "http://json-schema.org/draft-04/schema#"
+			data, err := json.MarshalIndent(schema, "", "  ")
+			if err != nil {
+				return fmt.Errorf("error encoding schema for %s/%s %s: %w", group, version, kind, err)
+			}
+			name := path.Join(schemasDir, group, kind+"_"+version+".json")
+			if err := sink.CreateOrAppend(name, append(data, '\n')); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// crdVersionSchemas returns the openAPIV3Schema of each served version, keyed by version.
+// Both apiextensions.k8s.io/v1 (per-version schemas) and v1beta1 (a single top-level
+// validation schema) layouts are understood.
+func crdVersionSchemas(root *yaml.Node) (map[string]interface{}, error) {
+	schemas := make(map[string]interface{})
+	decode := func(n *yaml.Node) (interface{}, error) {
+		var v interface{}
+		err := n.Decode(&v)
+		return v, err
+	}
+
+	var shared interface{}
+	if n := lookupNode(root, "spec", "validation", "openAPIV3Schema"); n != nil {
+		v, err := decode(n)
+		if err != nil {
+			return nil, err
+		}
+		shared = v
+	}
+
+	if versions := lookupNode(root, "spec", "versions"); versions != nil && versions.Kind == yaml.SequenceNode {
+		for _, item := range versions.Content {
+			name := lookupNode(item, "name")
+			if name == nil {
+				continue
+			}
+			if n := lookupNode(item, "schema", "openAPIV3Schema"); n != nil {
+				v, err := decode(n)
+				if err != nil {
+					return nil, err
+				}
+				schemas[name.Value] = v
+			} else if shared != nil {
+				schemas[name.Value] = shared
+			}
+		}
+	} else if version := lookupNode(root, "spec", "version"); version != nil && shared != nil {
+		schemas[version.Value] = shared
+	}
+	return schemas, nil
+}
+
+// openAPIToJSONSchema rewrites the OpenAPI-only constructs Kubernetes uses into their
+// JSON Schema equivalents: nullable becomes a "null" type alternative and
+// x-kubernetes-int-or-string becomes a oneOf of string and integer.
+func openAPIToJSONSchema(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			out[key] = openAPIToJSONSchema(value)
+		}
+		if intOrString, _ := out["x-kubernetes-int-or-string"].(bool); intOrString {
+			out["oneOf"] = []interface{}{
+				map[string]interface{}{"type": "string"},
+				map[string]interface{}{"type": "integer"},
+			}
+		}
+		if nullable, _ := out["nullable"].(bool); nullable {
+			if t, ok := out["type"].(string); ok {
+				out["type"] = []interface{}{t, "null"}
+			}
+			delete(out, "nullable")
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, value := range v {
+			out[i] = openAPIToJSONSchema(value)
+		}
+		return out
+	}
+	return v
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	wednesday := at(10, 14, 10, 7).Add(30 * time.Second)
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"*/15 * * * *", wednesday, at(10, 14, 10, 15)},
+		{"*/15 * * * *", at(10, 14, 10, 15), at(10, 14, 10, 30)}, // strictly after
+		{"0 */6 * * *", wednesday, at(10, 14, 12, 0)},
+		{"@daily", wednesday, at(10, 15, 0, 0)},
+		{"@hourly", wednesday, at(10, 14, 11, 0)},
+		{"@monthly", wednesday, at(11, 1, 0, 0)},
+		{"0 9 * * 1-5", at(10, 16, 10, 0), at(10, 19, 9, 0)}, // Friday after 9 to Monday
+		{"0 0 * * 7", wednesday, at(10, 18, 0, 0)},           // 7 is Sunday
+		{"0 0 1,15 * 0", wednesday, at(10, 15, 0, 0)},        // either day field
+		{"0 0 1,20 * 0", wednesday, at(10, 18, 0, 0)},
+		{"0 0 * * 0", at(10, 18, 0, 30), at(10, 25, 0, 0)},
+		{"30 23 31 12 *", wednesday, at(12, 31, 23, 30)},
+		{"5,10-12 * * * *", wednesday, at(10, 14, 10, 10)},
+		{"0 0 30 2 *", wednesday, time.Time{}}, // never
+	}
+	for _, tt := range tests {
+		s, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q) = %v", tt.expr, err)
+			continue
+		}
+		if got := s.next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%q after %s = %s, want %s", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"@fortnightly",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"1-x * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) succeeded", expr)
+		}
+	}
+}
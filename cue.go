@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// cueKeywords cannot be used as unquoted field labels.
+var cueKeywords = map[string]bool{
+	"package": true, "import": true, "for": true, "in": true, "if": true,
+	"let": true, "true": true, "false": true, "null": true,
+}
+
+// cueStyle writes CUE struct and list literals.
+var cueStyle = literalStyle{language: "CUE", assign: ": ", key: cueLabel, str: quoteString}
+
+// cueFormat writes each document as a field of a CUE file, using one package per
+// output directory so CUE can unify everything rendered into that directory.
+type cueFormat struct {
+	fields  identifierSet   // field names are scoped per package, i.e. per directory
+	created map[string]bool // files that already carry their package clause
+}
+
+func newCueFormat() *cueFormat {
+	return &cueFormat{fields: make(identifierSet), created: make(map[string]bool)}
+}
+
+func (c *cueFormat) render(s *spec) (string, string, error) {
+	root, err := s.root()
+	if err != nil {
+		return "", "", err
+	}
+	if root == nil {
+		return "", "", nil
+	}
+
+	dir := path.Dir(s.source)
+	dest := strings.TrimSuffix(s.source, path.Ext(s.source)) + ".cue"
+
+	var b strings.Builder
+	if !c.created[dest] {
+		c.created[dest] = true
+		fmt.Fprintf(&b, "package %s\n\n", cuePackageName(dir))
+	}
+	b.WriteString(c.fields.claim(dir, specIdentifier(s)))
+	b.WriteString(": ")
+	if err := writeLiteral(&b, cueStyle, root, 0); err != nil {
+		return "", "", fmt.Errorf("error converting document from %s: %w", s.source, err)
+	}
+	b.WriteString("\n")
+	return dest, b.String(), nil
+}
+
+func (c *cueFormat) separator(string) string {
+	return "\n"
+}
+
+// cueLabel returns key as a CUE field label. Labels starting with an underscore or
+// hash would declare hidden fields or definitions, so those are quoted as well.
+func cueLabel(key string) string {
+	if isIdentifier(key, false) && key[0] != '_' && !cueKeywords[key] {
+		return key
+	}
+	return quoteString(key)
+}
+
+// cuePackageName derives a package name from the last component of dir.
+func cuePackageName(dir string) string {
+	name := path.Base(dir)
+	if name == "." || name == "/" {
+		name = "manifests"
+	}
+	name = sanitizeIdentifier(name)
+	if name[0] == '_' {
+		name = "pkg" + name
+	}
+	return name
+}
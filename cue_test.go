@@ -0,0 +1,99 @@
+package main
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestCueLabel(t *testing.T) {
+	tests := []struct{ key, want string }{
+		{"name", "name"},
+		{"_hidden", `"_hidden"`},
+		{"#Definition", `"#Definition"`},
+		{"app-name", `"app-name"`},
+		{"package", `"package"`},
+		{"let", `"let"`},
+		{"null", `"null"`},
+	}
+	for _, tt := range tests {
+		if got := cueLabel(tt.key); got != tt.want {
+			t.Errorf("cueLabel(%q) = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestCuePackageName(t *testing.T) {
+	tests := []struct{ dir, want string }{
+		{"web/templates", "templates"},
+		{"web/charts/my-db", "my_db"},
+		{".", "manifests"},
+		{"/", "manifests"},
+		{"web/1.2", "pkg_1_2"},
+		{"web/_internal", "pkg_internal"},
+	}
+	for _, tt := range tests {
+		if got := cuePackageName(tt.dir); got != tt.want {
+			t.Errorf("cuePackageName(%q) = %s, want %s", tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestCueFormat(t *testing.T) {
+	setFlag(t, &format, "cue")
+	cm := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\ndata:\n  _key: \"1\"\n"
+	input := helmOutput(
+		"web/templates/a.yaml", cm,
+		"web/templates/a.yaml", cm, // a second field of the same name in the package
+		"web/templates/b.yaml", "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\nspec:\n  ports: []\n",
+	)
+	files := render(t, input)
+	want := map[string]string{
+		"web/templates/a.cue": `package templates
+
+configmap_web: {
+  apiVersion: "v1"
+  kind: "ConfigMap"
+  metadata: {
+    name: "web"
+  }
+  data: {
+    "_key": "1"
+  }
+}
+
+configmap_web_2: {
+  apiVersion: "v1"
+  kind: "ConfigMap"
+  metadata: {
+    name: "web"
+  }
+  data: {
+    "_key": "1"
+  }
+}
+`,
+		"web/templates/b.cue": `package templates
+
+service_web: {
+  apiVersion: "v1"
+  kind: "Service"
+  metadata: {
+    name: "web"
+  }
+  spec: {
+    ports: []
+  }
+}
+`,
+	}
+	if !reflect.DeepEqual(slices.Sorted(maps.Keys(files)), slices.Sorted(maps.Keys(want))) {
+		t.Fatalf("wrote %v, want %v", slices.Sorted(maps.Keys(files)), slices.Sorted(maps.Keys(want)))
+	}
+	for name, content := range want {
+		if files[name] != content {
+			t.Errorf("%s:\n%s\nwant:\n%s", name, files[name], content)
+		}
+	}
+}
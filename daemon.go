@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var webhookSecret string // Shared secret webhook senders authenticate with
+
+func init() {
+	flag.StringVar(&webhookSecret, "webhook-secret", "", "With schelm daemon, require webhooks to carry this secret as a bearer token or an X-Hub-Signature-256 HMAC")
+}
+
+// daemonMain implements "schelm daemon [options]": a service re-rendering the
+// releases of the -config file when a webhook reports a new chart version, and on
+// the -schedule.
+func daemonMain(args []string) int {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return 2
+	}
+	if flag.NArg() != 0 {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: schelm daemon [options] [-config FILE]")
+		flag.PrintDefaults()
+		return 2
+	}
+	config, err := loadConfig(configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	d := &daemon{config: config}
+	if schedule != "" {
+		if d.schedule, err = parseCron(schedule); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+	}
+	if webhookSecret == "" && d.schedule == nil {
+		fmt.Fprintln(os.Stderr, "Error: schelm daemon requires -webhook-secret to accept webhooks, or a -schedule")
+		return 2
+	}
+	if err := d.listen(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// daemon re-renders configured releases. Renders run one at a time, in the
+// background of the requests triggering them.
+type daemon struct {
+	config   *schelmConfig
+	schedule *cronSchedule // nil without -schedule
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+}
+
+// listen serves webhooks until SIGTERM or SIGINT, then waits for running renders.
+func (d *daemon) listen() error {
+	mux := http.NewServeMux()
+	// Webhooks trigger renders, and commits and pushes, so they are only accepted
+	// from senders that know the secret
+	if webhookSecret != "" {
+		mux.HandleFunc("POST /webhook", d.webhook)
+	}
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		io.WriteString(w, "ok\n")
+	})
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: mux}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(listener) }()
+	if webhookSecret != "" {
+		log.Printf("Waiting for webhooks on %s for %d releases", listener.Addr(), len(d.config.Releases))
+	} else {
+		log.Printf("Not accepting webhooks without -webhook-secret; rendering %d releases on the schedule", len(d.config.Releases))
+	}
+	if d.schedule != nil {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.runSchedule(ctx)
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	log.Printf("Shutting down, waiting for running renders")
+	srv.Shutdown(context.Background())
+	d.wg.Wait()
+	return nil
+}
+
+// runSchedule re-renders all releases whenever the -schedule fires, until ctx is
+// done.
+func (d *daemon) runSchedule(ctx context.Context) {
+	for {
+		next := d.schedule.next(time.Now())
+		if next.IsZero() {
+			log.Printf("Warning: -schedule %q never fires", schedule)
+			return
+		}
+		log.Printf("Next scheduled re-render at %s", next.Format(time.RFC3339))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			log.Printf("Scheduled re-render of all releases")
+			d.rerender(d.config.Releases)
+		}
+	}
+}
+
+// webhook matches the pushed chart of a registry event against the releases and
+// re-renders those using it.
+func (d *daemon) webhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error reading request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if !webhookAuthorized(r, body) {
+		http.Error(w, "invalid webhook secret", http.StatusUnauthorized)
+		return
+	}
+	pushes, err := parseChartPushes(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var matched []releaseConfig
+	for _, rc := range d.config.Releases {
+		for _, p := range pushes {
+			if p.matches(rc) {
+				matched = append(matched, rc)
+				break
+			}
+		}
+	}
+	if len(matched) == 0 {
+		io.WriteString(w, "no release uses the pushed chart\n")
+		return
+	}
+	var names []string
+	for _, rc := range matched {
+		names = append(names, rc.Name)
+	}
+	log.Printf("Webhook for %v: re-rendering %s", pushes, strings.Join(names, ", "))
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.rerender(matched)
+	}()
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "re-rendering %s\n", strings.Join(names, ", "))
+}
+
+// rerender renders the releases and commits the results if the config asks for it.
+// Failures are logged; the releases that rendered are still committed.
+func (d *daemon) rerender(releases []releaseConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var rendered []releaseConfig
+	for _, rc := range releases {
+		if err := renderRelease(rc); err != nil {
+			log.Printf("Error: %v", err)
+			continue
+		}
+		rendered = append(rendered, rc)
+	}
+	if d.config.Git.Commit && len(rendered) > 0 {
+		if err := commitRenders(d.config.Git, rendered); err != nil {
+			log.Printf("Error: %v", err)
+		}
+	}
+}
+
+// webhookAuthorized checks the -webhook-secret, sent as a bearer token or, the way
+// GitHub and Harbor sign deliveries, as an HMAC of the body. Without a secret no
+// webhook is authorized.
+func webhookAuthorized(r *http.Request, body []byte) bool {
+	if webhookSecret == "" {
+		return false
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(webhookSecret)) == 1
+	}
+	if signature, ok := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256="); ok {
+		mac := hmac.New(sha256.New, []byte(webhookSecret))
+		mac.Write(body)
+		want := hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(signature), []byte(want))
+	}
+	return false
+}
+
+// chartPush is a chart repository, or OCI repository, a webhook reports a push to.
+type chartPush struct {
+	Repository string // e.g. charts/myapp
+	Tag        string // the pushed version, if the event says
+}
+
+func (p chartPush) String() string {
+	if p.Tag == "" {
+		return p.Repository
+	}
+	return p.Repository + ":" + p.Tag
+}
+
+// matches reports whether the release renders the pushed chart: its reference is
+// the pushed repository or ends in it after a /, and a pinned version is the pushed
+// one.
+func (p chartPush) matches(rc releaseConfig) bool {
+	chart := strings.TrimSuffix(strings.TrimPrefix(rc.Chart, "oci://"), "/")
+	repository := strings.Trim(p.Repository, "/")
+	if repository == "" || chart != repository && !strings.HasSuffix(chart, "/"+repository) {
+		return false
+	}
+	return rc.Version == "" || p.Tag == "" || rc.Version == p.Tag
+}
+
+// parseChartPushes extracts the pushed charts from the webhook payloads of the
+// common registries: Harbor, the distribution registry (Docker Hub, GitLab, ...),
+// GitHub package events, and a plain {"chart": ..., "version": ...}.
+func parseChartPushes(body []byte) ([]chartPush, error) {
+	var event struct {
+		// Harbor
+		Type      string `json:"type"`
+		EventData struct {
+			Repository struct {
+				RepoFullName string `json:"repo_full_name"`
+			} `json:"repository"`
+			Resources []struct {
+				Tag string `json:"tag"`
+			} `json:"resources"`
+		} `json:"event_data"`
+		// distribution notifications
+		Events []struct {
+			Action string `json:"action"`
+			Target struct {
+				Repository string `json:"repository"`
+				Tag        string `json:"tag"`
+			} `json:"target"`
+		} `json:"events"`
+		// GitHub package events
+		Package struct {
+			Name           string `json:"name"`
+			PackageVersion struct {
+				Version string `json:"version"`
+			} `json:"package_version"`
+		} `json:"package"`
+		// generic
+		Chart   string `json:"chart"`
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("error parsing webhook: %w", err)
+	}
+
+	var pushes []chartPush
+	if name := event.EventData.Repository.RepoFullName; name != "" && (event.Type == "" || event.Type == "PUSH_ARTIFACT") {
+		if len(event.EventData.Resources) == 0 {
+			pushes = append(pushes, chartPush{Repository: name})
+		}
+		for _, res := range event.EventData.Resources {
+			pushes = append(pushes, chartPush{Repository: name, Tag: res.Tag})
+		}
+	}
+	for _, e := range event.Events {
+		if e.Action == "push" && e.Target.Repository != "" {
+			pushes = append(pushes, chartPush{Repository: e.Target.Repository, Tag: e.Target.Tag})
+		}
+	}
+	if event.Package.Name != "" {
+		pushes = append(pushes, chartPush{Repository: event.Package.Name, Tag: event.Package.PackageVersion.Version})
+	}
+	if event.Chart != "" {
+		pushes = append(pushes, chartPush{Repository: event.Chart, Tag: event.Version})
+	}
+	if len(pushes) == 0 {
+		return nil, fmt.Errorf("webhook reports no chart push")
+	}
+	return pushes, nil
+}
+
+// commitRenders commits the outputs of the releases to the Git repository they are
+// in, and pushes the commit if configured. Nothing is committed if the render left
+// them unchanged.
+func commitRenders(g gitConfig, releases []releaseConfig) error {
+	var names, outputs []string
+	for _, rc := range releases {
+		names = append(names, rc.Name)
+		outputs = append(outputs, rc.Output)
+	}
+	if _, err := git(append([]string{"add", "--all", "--"}, outputs...)...); err != nil {
+		return err
+	}
+	if _, err := git(append([]string{"diff", "--cached", "--quiet", "--"}, outputs...)...); err == nil {
+		log.Printf("Rendered manifests of %s are unchanged", strings.Join(names, ", "))
+		return nil
+	}
+	message := strings.ReplaceAll(g.Message, "%s", strings.Join(names, ", "))
+	if _, err := git(append([]string{"commit", "--message", message, "--"}, outputs...)...); err != nil {
+		return err
+	}
+	log.Printf("Committed %q", message)
+	if g.Push {
+		if _, err := git("push"); err != nil {
+			return err
+		}
+		log.Printf("Pushed the re-rendered manifests")
+	}
+	return nil
+}
+
+// git runs a git command in the working directory.
+func git(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func signature(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookAuthorized(t *testing.T) {
+	const body = `{"chart": "myapp"}`
+	tests := []struct {
+		name   string
+		secret string
+		header map[string]string
+		want   bool
+	}{
+		{"bearer token", "s3cret", map[string]string{"Authorization": "Bearer s3cret"}, true},
+		{"wrong token", "s3cret", map[string]string{"Authorization": "Bearer guess"}, false},
+		{"HMAC", "s3cret", map[string]string{"X-Hub-Signature-256": signature("s3cret", body)}, true},
+		{"HMAC with another secret", "s3cret", map[string]string{"X-Hub-Signature-256": signature("guess", body)}, false},
+		{"HMAC of another body", "s3cret", map[string]string{"X-Hub-Signature-256": signature("s3cret", body+" ")}, false},
+		{"nothing", "s3cret", nil, false},
+		// Without a secret nothing authorizes a webhook, not even an empty token.
+		{"no secret", "", map[string]string{"Authorization": "Bearer "}, false},
+		{"no secret, empty HMAC", "", map[string]string{"X-Hub-Signature-256": signature("", body)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, &webhookSecret, tt.secret)
+			r := httptest.NewRequest("POST", "/webhook", strings.NewReader(body))
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			if got := webhookAuthorized(r, []byte(body)); got != tt.want {
+				t.Errorf("webhookAuthorized() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChartPushMatches(t *testing.T) {
+	tests := []struct {
+		push       chartPush
+		chart, pin string
+		want       bool
+	}{
+		{chartPush{Repository: "charts/myapp"}, "oci://registry.example.com/charts/myapp", "", true},
+		{chartPush{Repository: "charts/myapp", Tag: "1.2.0"}, "oci://registry.example.com/charts/myapp", "1.2.0", true},
+		{chartPush{Repository: "charts/myapp", Tag: "1.3.0"}, "oci://registry.example.com/charts/myapp", "1.2.0", false},
+		{chartPush{Repository: "charts/myapp", Tag: "1.3.0"}, "oci://registry.example.com/charts/myapp", "", true},
+		{chartPush{Repository: "myapp"}, "myrepo/myapp", "", true},
+		{chartPush{Repository: "myapp"}, "myapp", "", true},
+		{chartPush{Repository: "/charts/myapp/"}, "oci://registry.example.com/charts/myapp/", "", true},
+		// Suffixes only match whole path components.
+		{chartPush{Repository: "app"}, "oci://registry.example.com/charts/myapp", "", false},
+		{chartPush{Repository: "charts/myapp"}, "oci://registry.example.com/charts/myapp-extra", "", false},
+		{chartPush{Repository: "myapp"}, "oci://registry.example.com/myapp/other", "", false},
+		{chartPush{Repository: ""}, "myapp", "", false},
+		{chartPush{Repository: "/"}, "myapp", "", false},
+	}
+	for _, tt := range tests {
+		rc := releaseConfig{Name: "r", Chart: tt.chart, Version: tt.pin}
+		if got := tt.push.matches(rc); got != tt.want {
+			t.Errorf("%v matches chart %s version %q = %v, want %v", tt.push, tt.chart, tt.pin, got, tt.want)
+		}
+	}
+}
+
+func TestParseChartPushes(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []chartPush
+	}{
+		{"Harbor", `{"type": "PUSH_ARTIFACT", "event_data": {"repository": {"repo_full_name": "charts/myapp"}, "resources": [{"tag": "1.2.0"}]}}`,
+			[]chartPush{{"charts/myapp", "1.2.0"}}},
+		{"Harbor without resources", `{"type": "PUSH_ARTIFACT", "event_data": {"repository": {"repo_full_name": "charts/myapp"}}}`,
+			[]chartPush{{"charts/myapp", ""}}},
+		{"Harbor deletion", `{"type": "DELETE_ARTIFACT", "event_data": {"repository": {"repo_full_name": "charts/myapp"}}}`, nil},
+		{"distribution", `{"events": [{"action": "pull", "target": {"repository": "charts/a", "tag": "1"}}, {"action": "push", "target": {"repository": "charts/b", "tag": "2"}}]}`,
+			[]chartPush{{"charts/b", "2"}}},
+		{"GitHub package", `{"action": "published", "package": {"name": "myapp", "package_version": {"version": "0.3.1"}}}`,
+			[]chartPush{{"myapp", "0.3.1"}}},
+		{"generic", `{"chart": "myrepo/myapp", "version": "1.0.0"}`, []chartPush{{"myrepo/myapp", "1.0.0"}}},
+		{"no push", `{"zen": "Keep it logically awesome."}`, nil},
+		{"not JSON", `chart=myapp`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseChartPushes([]byte(tt.body))
+			if (err == nil) != (tt.want != nil) {
+				t.Fatalf("parseChartPushes() = %v, %v; want %v", got, err, tt.want)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseChartPushes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	setFlag(t, &webhookSecret, "s3cret")
+	d := &daemon{config: &schelmConfig{Releases: []releaseConfig{{Name: "web", Chart: "oci://registry.example.com/charts/web"}}}}
+	tests := []struct {
+		name   string
+		token  string
+		body   string
+		status int
+		reply  string
+	}{
+		{"unauthorized", "guess", `{"chart": "charts/web"}`, http.StatusUnauthorized, "invalid webhook secret"},
+		{"no push", "s3cret", `{}`, http.StatusBadRequest, "no chart push"},
+		{"other chart", "s3cret", `{"chart": "charts/api"}`, http.StatusOK, "no release uses the pushed chart"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/webhook", strings.NewReader(tt.body))
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			d.webhook(w, r)
+			if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.reply) {
+				t.Errorf("status %d, %q; want %d, %q", w.Code, w.Body, tt.status, tt.reply)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		message string // the commit message, empty when loading fails
+	}{
+		{"releases", "releases:\n- name: web\n  chart: ./charts/web\n  output: manifests/web\n- name: api\n  chart: oci://registry.example.com/charts/api\n  version: 1.x\n  output: manifests/api\n", "Re-render %s"},
+		{"commit message", "releases: []\ngit:\n  commit: true\n  push: true\n  message: 'chore: %s'\n", "chore: %s"},
+		{"untouched", "untouched:\n- kind: Secret\n  jsonPointers: [/data]\n", "Re-render %s"},
+		{"no output", "releases:\n- name: web\n  chart: ./charts/web\n", ""},
+		{"no name", "releases:\n- chart: ./charts/web\n  output: out\n", ""},
+		{"listed twice", "releases:\n- {name: web, chart: a, output: a}\n- {name: web, chart: b, output: b}\n", ""},
+		{"push without commit", "git:\n  push: true\n", ""},
+		{"invalid untouched path", "untouched:\n- kind: Secret\n  jsonPointers: [data]\n", ""},
+		{"not YAML", "releases: [\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), ".schelm.yaml")
+			writeFile(t, file, tt.config)
+			config, err := loadConfig(file)
+			if tt.message == "" {
+				if err == nil {
+					t.Errorf("loadConfig() = %+v, want an error", config)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Git.Message != tt.message {
+				t.Errorf("commit message %q, want %q", config.Git.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestCommitRenders(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_AUTHOR_NAME", "schelm")
+	t.Setenv("GIT_AUTHOR_EMAIL", "schelm@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "schelm")
+	t.Setenv("GIT_COMMITTER_EMAIL", "schelm@example.com")
+	if _, err := git("init", "--quiet"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join("web", "cm.yaml"), "kind: ConfigMap\n")
+	writeFile(t, "unrelated.txt", "not a render\n")
+
+	g := gitConfig{Commit: true, Message: "Re-render %s"}
+	releases := []releaseConfig{{Name: "web", Output: "web"}}
+	if err := commitRenders(g, releases); err != nil {
+		t.Fatal(err)
+	}
+	out, err := git("log", "--format=%s", "--name-only")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Re-render web\n\nweb/cm.yaml\n"; string(out) != want {
+		t.Errorf("git log = %q, want %q", out, want)
+	}
+
+	// An unchanged render commits nothing.
+	if err := commitRenders(g, releases); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := git("rev-list", "--count", "HEAD"); strings.TrimSpace(string(count)) != "1" {
+		t.Errorf("%s commits after an unchanged render, want 1", count)
+	}
+}
+
+// fakeHelm puts a helm on PATH whose template renders a ConfigMap holding its
+// arguments.
+func fakeHelm(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake helm is a shell script")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\nprintf -- '---\\n# Source: chart/templates/args.yaml\\napiVersion: v1\\nkind: ConfigMap\\nmetadata:\\n  name: args\\ndata:\\n  args: \"%s\"\\n' \"$*\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "helm"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+}
+
+func TestRerenderKeepsReleaseOptionsApart(t *testing.T) {
+	fakeHelm(t)
+	// Helm options of the command line apply to none of the releases.
+	setFlag(t, &helmSetString, stringList{"token=cli"})
+	setFlag(t, &helmKubeVersion, "1.29.0")
+	setFlag(t, &releaseName, "release-name")
+	out := t.TempDir()
+	releases := []releaseConfig{
+		{Name: "a", Chart: "./a", Set: []string{"replicas=3"}, SetString: []string{"tag=1.2.3"}, IncludeCRDs: true, Output: filepath.Join(out, "a")},
+		{Name: "b", Chart: "./b", Output: filepath.Join(out, "b")},
+	}
+	d := &daemon{config: &schelmConfig{Releases: releases}}
+	d.rerender(releases)
+
+	for name, want := range map[string]string{
+		"a": "template a ./a --include-crds --set replicas=3 --set-string tag=1.2.3",
+		"b": "template b ./b",
+	} {
+		data, err := os.ReadFile(filepath.Join(out, name, "chart", "templates", "args.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), `args: "`+want+`"`) {
+			t.Errorf("release %s rendered with:\n%s\nwant helm %s", name, data, want)
+		}
+	}
+	if helmSetString[0] != "token=cli" || helmKubeVersion != "1.29.0" || releaseName != "release-name" || chartRef != "" || helmSet != nil || helmIncludeCRDs {
+		t.Errorf("the helm options of the command line weren't restored: %+v", currentHelmOptions())
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var dedupeHardlink bool // Whether identical output files are hard-linked together
+
+func init() {
+	flag.BoolVar(&dedupeHardlink, "dedupe-hardlink", false, "Hard-link files of OUTPUT_DIR that are byte-identical to files in its sibling directories, or in OUTPUT_DIR itself, instead of storing them twice")
+}
+
+// dedupeFile is a file that may be linked to, with its hash computed on demand.
+type dedupeFile struct {
+	path string
+	info fs.FileInfo
+	hash string
+}
+
+func (f *dedupeFile) sum() (string, error) {
+	if f.hash == "" {
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return "", err
+		}
+		f.hash = sha256Hex(data)
+	}
+	return f.hash, nil
+}
+
+// dedupeHardlinks replaces the files of dir with hard links to identical files of
+// the directories next to it, such as the renders of other releases, and to
+// earlier identical files of dir. Only files of equal size are hashed, and hidden
+// directories such as .git are skipped.
+func dedupeHardlinks(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	own, err := regularFiles(abs, "")
+	if err != nil {
+		return err
+	}
+	sizes := make(map[int64]bool)
+	for _, f := range own {
+		sizes[f.info.Size()] = true
+	}
+	others, err := regularFiles(filepath.Dir(abs), abs)
+	if err != nil {
+		return err
+	}
+
+	// Files of the siblings come first, so the output links to them.
+	canonical := make(map[string]*dedupeFile)
+	var linked int
+	var saved int64
+	for _, f := range append(others, own...) {
+		if !sizes[f.info.Size()] || f.info.Size() == 0 {
+			continue
+		}
+		hash, err := f.sum()
+		if err != nil {
+			return err
+		}
+		first, ok := canonical[hash]
+		if !ok {
+			canonical[hash] = f
+			continue
+		}
+		if !strings.HasPrefix(f.path, abs+string(filepath.Separator)) || os.SameFile(first.info, f.info) {
+			continue
+		}
+		if err := replaceWithLink(first.path, f.path); err != nil {
+			return err
+		}
+		linked++
+		saved += f.info.Size()
+	}
+	if linked > 0 {
+		log.Printf("Hard-linked %d files of %s to identical files, saving %d bytes", linked, dir, saved)
+	}
+	return nil
+}
+
+// regularFiles lists the regular files below root, skipping hidden directories
+// and the directory skip.
+func regularFiles(root, skip string) ([]*dedupeFile, error) {
+	var files []*dedupeFile
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p == skip || p != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, &dedupeFile{path: p, info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error scanning %s: %w", root, err)
+	}
+	return files, nil
+}
+
+// replaceWithLink atomically replaces file with a hard link to target.
+func replaceWithLink(target, file string) error {
+	tmp := file + ".schelm-link"
+	if err := os.Link(target, tmp); err != nil {
+		return fmt.Errorf("error linking %s to %s: %w", file, target, err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error linking %s to %s: %w", file, target, err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	checkDeprecations  bool   // Whether to flag deprecated and removed apiVersions
+	targetVersion      string // Kubernetes version the render is checked against, e.g. 1.30
+	failOnDeprecations bool   // Whether deprecation findings fail the run
+)
+
+func init() {
+	flag.BoolVar(&checkDeprecations, "check-deprecations", false, "Flag documents using deprecated or removed Kubernetes apiVersions")
+	flag.StringVar(&targetVersion, "target-version", "", "Kubernetes version checked against by -check-deprecations, e.g. 1.30 (default: report every known deprecation)")
+	flag.BoolVar(&failOnDeprecations, "fail-on-deprecations", false, "Fail the run when -check-deprecations finds anything")
+}
+
+// deprecatedAPI describes an apiVersion of a kind that Kubernetes deprecated and removed.
+// Versions are minor versions of Kubernetes 1.x.
+type deprecatedAPI struct {
+	deprecatedIn int
+	removedIn    int
+	replacement  string // apiVersion to migrate to, empty if the kind was dropped
+}
+
+// deprecatedAPIs is keyed by "apiVersion/Kind", following the Kubernetes deprecated API migration guide.
+var deprecatedAPIs = map[string]deprecatedAPI{
+	"extensions/v1beta1/Deployment":        {9, 16, "apps/v1"},
+	"extensions/v1beta1/DaemonSet":         {9, 16, "apps/v1"},
+	"extensions/v1beta1/ReplicaSet":        {9, 16, "apps/v1"},
+	"extensions/v1beta1/NetworkPolicy":     {9, 16, "networking.k8s.io/v1"},
+	"extensions/v1beta1/PodSecurityPolicy": {10, 16, "policy/v1beta1"},
+	"extensions/v1beta1/Ingress":           {14, 22, "networking.k8s.io/v1"},
+	"apps/v1beta1/Deployment":              {9, 16, "apps/v1"},
+	"apps/v1beta1/StatefulSet":             {9, 16, "apps/v1"},
+	"apps/v1beta1/ControllerRevision":      {9, 16, "apps/v1"},
+	"apps/v1beta2/Deployment":              {9, 16, "apps/v1"},
+	"apps/v1beta2/StatefulSet":             {9, 16, "apps/v1"},
+	"apps/v1beta2/DaemonSet":               {9, 16, "apps/v1"},
+	"apps/v1beta2/ReplicaSet":              {9, 16, "apps/v1"},
+	"apps/v1beta2/ControllerRevision":      {9, 16, "apps/v1"},
+
+	"networking.k8s.io/v1beta1/Ingress":                                   {19, 22, "networking.k8s.io/v1"},
+	"networking.k8s.io/v1beta1/IngressClass":                              {19, 22, "networking.k8s.io/v1"},
+	"apiextensions.k8s.io/v1beta1/CustomResourceDefinition":               {16, 22, "apiextensions.k8s.io/v1"},
+	"admissionregistration.k8s.io/v1beta1/MutatingWebhookConfiguration":   {16, 22, "admissionregistration.k8s.io/v1"},
+	"admissionregistration.k8s.io/v1beta1/ValidatingWebhookConfiguration": {16, 22, "admissionregistration.k8s.io/v1"},
+	"apiregistration.k8s.io/v1beta1/APIService":                           {19, 22, "apiregistration.k8s.io/v1"},
+	"rbac.authorization.k8s.io/v1beta1/ClusterRole":                       {17, 22, "rbac.authorization.k8s.io/v1"},
+	"rbac.authorization.k8s.io/v1beta1/ClusterRoleBinding":                {17, 22, "rbac.authorization.k8s.io/v1"},
+	"rbac.authorization.k8s.io/v1beta1/Role":                              {17, 22, "rbac.authorization.k8s.io/v1"},
+	"rbac.authorization.k8s.io/v1beta1/RoleBinding":                       {17, 22, "rbac.authorization.k8s.io/v1"},
+	"scheduling.k8s.io/v1beta1/PriorityClass":                             {14, 22, "scheduling.k8s.io/v1"},
+	"storage.k8s.io/v1beta1/CSIDriver":                                    {19, 22, "storage.k8s.io/v1"},
+	"storage.k8s.io/v1beta1/CSINode":                                      {17, 22, "storage.k8s.io/v1"},
+	"storage.k8s.io/v1beta1/StorageClass":                                 {19, 22, "storage.k8s.io/v1"},
+	"storage.k8s.io/v1beta1/VolumeAttachment":                             {19, 22, "storage.k8s.io/v1"},
+	"coordination.k8s.io/v1beta1/Lease":                                   {19, 22, "coordination.k8s.io/v1"},
+	"certificates.k8s.io/v1beta1/CertificateSigningRequest":               {19, 22, "certificates.k8s.io/v1"},
+
+	"batch/v1beta1/CronJob":                                           {21, 25, "batch/v1"},
+	"discovery.k8s.io/v1beta1/EndpointSlice":                          {21, 25, "discovery.k8s.io/v1"},
+	"events.k8s.io/v1beta1/Event":                                     {21, 25, "events.k8s.io/v1"},
+	"autoscaling/v2beta1/HorizontalPodAutoscaler":                     {22, 25, "autoscaling/v2"},
+	"policy/v1beta1/PodDisruptionBudget":                              {21, 25, "policy/v1"},
+	"policy/v1beta1/PodSecurityPolicy":                                {21, 25, ""},
+	"node.k8s.io/v1beta1/RuntimeClass":                                {20, 25, "node.k8s.io/v1"},
+	"autoscaling/v2beta2/HorizontalPodAutoscaler":                     {23, 26, "autoscaling/v2"},
+	"flowcontrol.apiserver.k8s.io/v1beta1/FlowSchema":                 {23, 26, "flowcontrol.apiserver.k8s.io/v1"},
+	"flowcontrol.apiserver.k8s.io/v1beta1/PriorityLevelConfiguration": {23, 26, "flowcontrol.apiserver.k8s.io/v1"},
+	"storage.k8s.io/v1beta1/CSIStorageCapacity":                       {24, 27, "storage.k8s.io/v1"},
+	"flowcontrol.apiserver.k8s.io/v1beta2/FlowSchema":                 {26, 29, "flowcontrol.apiserver.k8s.io/v1"},
+	"flowcontrol.apiserver.k8s.io/v1beta2/PriorityLevelConfiguration": {26, 29, "flowcontrol.apiserver.k8s.io/v1"},
+	"flowcontrol.apiserver.k8s.io/v1beta3/FlowSchema":                 {29, 32, "flowcontrol.apiserver.k8s.io/v1"},
+	"flowcontrol.apiserver.k8s.io/v1beta3/PriorityLevelConfiguration": {29, 32, "flowcontrol.apiserver.k8s.io/v1"},
+}
+
+// parseMinorVersion returns the minor version of a Kubernetes 1.x version such as
+// "1.30", "v1.30" or "1.30.2".
+func parseMinorVersion(version string) (int, error) {
+	parts := strings.Split(strings.TrimPrefix(strings.TrimSpace(version), "v"), ".")
+	if len(parts) < 2 || parts[0] != "1" {
+		return 0, fmt.Errorf("invalid Kubernetes version %q (expected 1.x)", version)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid Kubernetes version %q (expected 1.x)", version)
+	}
+	return minor, nil
+}
+
+// deprecationCheck reports documents whose apiVersion is deprecated or removed as of the
+// target minor version. A negative target reports every known deprecation.
+func deprecationCheck(target int, fail bool) check {
+	severity := severityWarning
+	if fail {
+		severity = severityError
+	}
+	return func(specs []*spec) []finding {
+		var findings []finding
+		for _, s := range specs {
+			api, ok := deprecatedAPIs[s.apiVersion()+"/"+s.kind()]
+			if !ok || target >= 0 && target < api.deprecatedIn {
+				continue
+			}
+			var msg string
+			if target >= api.removedIn {
+				msg = fmt.Sprintf("%s %s was removed in Kubernetes 1.%d", s.apiVersion(), s.kind(), api.removedIn)
+			} else {
+				msg = fmt.Sprintf("%s %s is deprecated since Kubernetes 1.%d and removed in 1.%d", s.apiVersion(), s.kind(), api.deprecatedIn, api.removedIn)
+			}
+			if api.replacement != "" {
+				msg += "; use " + api.replacement
+			}
+			findings = append(findings, finding{spec: s, check: "deprecations", severity: severity, message: msg})
+		}
+		return findings
+	}
+}
+
+// newDeprecationCheck builds the check for the -check-deprecations flags.
+func newDeprecationCheck() (check, error) {
+	target := -1
+	if targetVersion != "" {
+		minor, err := parseMinorVersion(targetVersion)
+		if err != nil {
+			return nil, err
+		}
+		target = minor
+	}
+	return deprecationCheck(target, failOnDeprecations), nil
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+	"gopkg.in/yaml.v3"
+)
+
+// diffContext is the number of unchanged lines shown around each change of a text diff.
+const diffContext = 3
+
+var semanticDiff bool // Whether schelm diff compares documents structurally
+
+func init() {
+	flag.BoolVar(&semanticDiff, "semantic", false, "With schelm diff, compare documents structurally, ignoring key order, quoting and whitespace")
+}
+
+// errDifferences is returned by runDiff when the render differs from the directory.
+var errDifferences = errors.New("differences found")
+
+// diffMain implements "schelm diff [options] OUTPUT_DIR": it renders the helm output
+// read from stdin in memory and prints how it differs from OUTPUT_DIR. It returns the
+// exit status, 0 without differences, 1 with differences and 2 on errors.
+func diffMain(args []string) int {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return 2
+	}
+	if flag.NArg() != 1 || flag.Arg(0) == "" {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: schelm diff [options] OUTPUT_DIR")
+		flag.PrintDefaults()
+		return 2
+	}
+	err := runDiff(split.OSFS{}, os.Stdin, os.Stdout, flag.Arg(0))
+	if errors.Is(err, errDifferences) {
+		return 1
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// runDiff renders stdin into an in-memory tree with the current options and writes
+// the differences from dir on fsys to stdout.
+func runDiff(fsys split.FS, stdin io.Reader, stdout io.Writer, dir string) error {
+	if archivePath != "" || destURL != "" || krmOutput {
+		return fmt.Errorf("schelm diff compares against OUTPUT_DIR and cannot be combined with -archive, -dest or -krm-output")
+	}
+	var rules []ignoreRule
+	if ignoreDifferencesFile != "" {
+		var err error
+		if rules, err = loadIgnoreRules(ignoreDifferencesFile); err != nil {
+			return err
+		}
+	}
+	after, err := renderInMemory(stdin)
+	if err != nil {
+		return err
+	}
+	before, err := snapshotTree(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	names := slices.Sorted(maps.Keys(after))
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	changed := false
+	for _, name := range names {
+		old, new := stripIgnoredFields(name, before[name], rules), stripIgnoredFields(name, after[name], rules)
+		var out string
+		if semanticDiff {
+			out = semanticFileDiff(name, old, new)
+		} else {
+			out = textFileDiff(name, old, new)
+		}
+		if out != "" {
+			changed = true
+			if _, err := io.WriteString(stdout, out); err != nil {
+				return err
+			}
+		}
+	}
+	if changed {
+		return errDifferences
+	}
+	return nil
+}
+
+// renderInMemory splits the helm output read from stdin with the current options
+// and returns the resulting files, for subcommands that inspect a render rather
+// than write it.
+func renderInMemory(stdin io.Reader) (map[string][]byte, error) {
+	const renderDir = "render"
+	rendered := split.NewMemFS()
+	// The render itself is not what the user asked to see, only what is made of it.
+	logOutput := log.Writer()
+	log.SetOutput(io.Discard)
+	err := run(rendered, stdin, io.Discard, renderDir)
+	log.SetOutput(logOutput)
+	if err != nil {
+		return nil, err
+	}
+	return snapshotTree(rendered, renderDir)
+}
+
+// textFileDiff returns a unified diff between the old and new content of name. A nil
+// content stands for a missing file.
+func textFileDiff(name string, old, new []byte) string {
+	if bytes.Equal(old, new) && (old == nil) == (new == nil) {
+		return ""
+	}
+	oldName, newName := "a/"+name, "b/"+name
+	if old == nil {
+		oldName = "/dev/null"
+	}
+	if new == nil {
+		newName = "/dev/null"
+	}
+	a, b := markMissingNewline(splitLines(old), old), markMissingNewline(splitLines(new), new)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	ops := lineDiff(a, b)
+	var changes []int
+	for i, op := range ops {
+		if op.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	for c := 0; c < len(changes); {
+		// Merge the changes whose context overlaps into one hunk.
+		last := c
+		for last+1 < len(changes) && changes[last+1]-changes[last] <= 2*diffContext {
+			last++
+		}
+		from, to := max(changes[c]-diffContext, 0), min(changes[last]+diffContext+1, len(ops))
+
+		oldLen, newLen := 0, 0
+		var body strings.Builder
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				oldLen++
+			}
+			if op.kind != '-' {
+				newLen++
+			}
+			text, noNewline := strings.CutSuffix(op.text, noNewlineMarker)
+			fmt.Fprintf(&body, "%c%s\n", op.kind, text)
+			if noNewline {
+				body.WriteString("\\ No newline at end of file\n")
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n%s", hunkRange(ops[from].oldLine, oldLen), hunkRange(ops[from].newLine, newLen), body.String())
+		c = last + 1
+	}
+	return out.String()
+}
+
+// hunkRange formats the 1-based start and length of a hunk side.
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// noNewlineMarker ends the last line of content without a final newline, so that it
+// differs from the same line with one, as it does in a patch.
+const noNewlineMarker = "\x00"
+
+func markMissingNewline(lines []string, content []byte) []string {
+	if len(lines) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		lines[len(lines)-1] += noNewlineMarker
+	}
+	return lines
+}
+
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+// diffOp is one line of an edit script: kept (' '), removed ('-') or added ('+').
+type diffOp struct {
+	kind             byte
+	text             string
+	oldLine, newLine int // lines of a and b before this one
+}
+
+// lineDiff computes an edit script from a to b based on their longest common subsequence.
+func lineDiff(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i], i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i], i, j})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j], i, j})
+			j++
+		}
+	}
+	return ops
+}
+
+// semanticFileDiff compares the YAML documents of old and new by identity and
+// structure and describes the changed fields. Files that are not YAML, or don't
+// parse, fall back to a text diff.
+func semanticFileDiff(name string, old, new []byte) string {
+	switch {
+	case old == nil && new == nil:
+		return ""
+	case old == nil:
+		return fmt.Sprintf("+ %s\n", name)
+	case new == nil:
+		return fmt.Sprintf("- %s\n", name)
+	}
+	if ext := path.Ext(name); ext != ".yaml" && ext != ".yml" {
+		return textFileDiff(name, old, new)
+	}
+	oldDocs, err1 := decodeDocuments(old)
+	newDocs, err2 := decodeDocuments(new)
+	if err1 != nil || err2 != nil {
+		return textFileDiff(name, old, new)
+	}
+
+	var out strings.Builder
+	for _, id := range documentOrder(oldDocs, newDocs) {
+		a, inOld := oldDocs.byID[id]
+		b, inNew := newDocs.byID[id]
+		switch {
+		case !inOld:
+			fmt.Fprintf(&out, "  + %s\n", id)
+		case !inNew:
+			fmt.Fprintf(&out, "  - %s\n", id)
+		default:
+			var changes []string
+			valueDiff("", a, b, &changes)
+			if len(changes) > 0 {
+				fmt.Fprintf(&out, "  ~ %s\n", id)
+				for _, c := range changes {
+					fmt.Fprintf(&out, "      %s\n", c)
+				}
+			}
+		}
+	}
+	if out.Len() == 0 {
+		return ""
+	}
+	return fmt.Sprintf("~ %s\n%s", name, out.String())
+}
+
+// yamlDocuments holds the decoded documents of a file keyed by their identity.
+type yamlDocuments struct {
+	ids  []string
+	byID map[string]any
+}
+
+// decodeDocuments decodes every document of content, identifying them as
+// Kind/namespace/name where possible and by position otherwise.
+func decodeDocuments(content []byte) (yamlDocuments, error) {
+	docs := yamlDocuments{byID: make(map[string]any)}
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	for index := 0; ; index++ {
+		var v any
+		if err := dec.Decode(&v); errors.Is(err, io.EOF) {
+			return docs, nil
+		} else if err != nil {
+			return docs, err
+		}
+		if v == nil {
+			continue
+		}
+		id := documentID(v, index)
+		for n := 2; docs.byID[id] != nil; n++ {
+			id = fmt.Sprintf("%s#%d", documentID(v, index), n)
+		}
+		docs.ids = append(docs.ids, id)
+		docs.byID[id] = v
+	}
+}
+
+func documentID(v any, index int) string {
+	m, _ := v.(map[string]any)
+	kind, _ := m["kind"].(string)
+	meta, _ := m["metadata"].(map[string]any)
+	name, _ := meta["name"].(string)
+	if kind == "" || name == "" {
+		return fmt.Sprintf("document %d", index+1)
+	}
+	if namespace, _ := meta["namespace"].(string); namespace != "" {
+		return kind + "/" + namespace + "/" + name
+	}
+	return kind + "/" + name
+}
+
+// documentOrder lists the identities of both files, new documents following the old
+// ones they were written after.
+func documentOrder(old, new yamlDocuments) []string {
+	ids := slices.Clone(old.ids)
+	for _, id := range new.ids {
+		if _, ok := old.byID[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// valueDiff appends a line for every difference between a and b below path.
+func valueDiff(path string, a, b any, changes *[]string) {
+	switch av := a.(type) {
+	case map[string]any:
+		if bv, ok := b.(map[string]any); ok {
+			keys := slices.Sorted(maps.Keys(av))
+			for key := range bv {
+				if _, ok := av[key]; !ok {
+					keys = append(keys, key)
+				}
+			}
+			slices.Sort(keys)
+			for _, key := range keys {
+				child := fieldPath(path, key)
+				old, inOld := av[key]
+				new, inNew := bv[key]
+				switch {
+				case !inOld:
+					*changes = append(*changes, fmt.Sprintf("+ %s: %s", child, compactValue(new)))
+				case !inNew:
+					*changes = append(*changes, fmt.Sprintf("- %s: %s", child, compactValue(old)))
+				default:
+					valueDiff(child, old, new, changes)
+				}
+			}
+			return
+		}
+	case []any:
+		if bv, ok := b.([]any); ok {
+			for i := 0; i < max(len(av), len(bv)); i++ {
+				child := fmt.Sprintf("%s[%d]", path, i)
+				switch {
+				case i >= len(av):
+					*changes = append(*changes, fmt.Sprintf("+ %s: %s", child, compactValue(bv[i])))
+				case i >= len(bv):
+					*changes = append(*changes, fmt.Sprintf("- %s: %s", child, compactValue(av[i])))
+				default:
+					valueDiff(child, av[i], bv[i], changes)
+				}
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(a, b) {
+		if path == "" {
+			path = "."
+		}
+		*changes = append(*changes, fmt.Sprintf("%s: %s -> %s", path, compactValue(a), compactValue(b)))
+	}
+}
+
+// fieldPath appends key to a dotted path, bracketing keys that aren't plain words.
+func fieldPath(path, key string) string {
+	if isIdentifier(key, true) {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+	return fmt.Sprintf("%s[%q]", path, key)
+}
+
+// compactValue renders a value on a single line for diff output.
+func compactValue(v any) string {
+	if data, err := json.Marshal(v); err == nil {
+		return string(data)
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+func TestTextFileDiff(t *testing.T) {
+	long := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	tests := []struct {
+		name     string
+		old, new []byte
+		want     string
+	}{
+		{"unchanged", []byte("a: 1\n"), []byte("a: 1\n"), ""},
+		{"both missing", nil, nil, ""},
+		{"added", nil, []byte("a: 1\nb: 2\n"), "--- /dev/null\n+++ b/f.yaml\n@@ -0,0 +1,2 @@\n+a: 1\n+b: 2\n"},
+		{"removed", []byte("a: 1\n"), nil, "--- a/f.yaml\n+++ /dev/null\n@@ -1 +0,0 @@\n-a: 1\n"},
+		{"emptied", []byte("a: 1\n"), []byte{}, "--- a/f.yaml\n+++ b/f.yaml\n@@ -1 +0,0 @@\n-a: 1\n"},
+		{"changed", []byte("a: 1\nb: 2\nc: 3\n"), []byte("a: 1\nb: 3\nc: 3\n"), "--- a/f.yaml\n+++ b/f.yaml\n@@ -1,3 +1,3 @@\n a: 1\n-b: 2\n+b: 3\n c: 3\n"},
+		{"final newline", []byte("a: 1"), []byte("a: 1\n"), "--- a/f.yaml\n+++ b/f.yaml\n@@ -1 +1 @@\n-a: 1\n\\ No newline at end of file\n+a: 1\n"},
+		{"separate hunks", []byte(long), []byte(strings.Replace(strings.Replace(long, "a\n", "A\n", 1), "l\n", "L\n", 1)),
+			"--- a/f.yaml\n+++ b/f.yaml\n@@ -1,4 +1,4 @@\n-a\n+A\n b\n c\n d\n@@ -9,4 +9,4 @@\n i\n j\n k\n-l\n+L\n"},
+		{"merged hunks", []byte(long), []byte(strings.Replace(strings.Replace(long, "b\n", "B\n", 1), "g\n", "G\n", 1)),
+			"--- a/f.yaml\n+++ b/f.yaml\n@@ -1,10 +1,10 @@\n a\n-b\n+B\n c\n d\n e\n f\n-g\n+G\n h\n i\n j\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := textFileDiff("f.yaml", tt.old, tt.new); got != tt.want {
+				t.Errorf("textFileDiff() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSemanticFileDiff(t *testing.T) {
+	deployment := "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  namespace: prod\nspec:\n  replicas: 2\n  template:\n    spec:\n      containers:\n      - name: web\n        image: web:1\n"
+	tests := []struct {
+		name     string
+		file     string
+		old, new string
+		want     string
+	}{
+		{"key order, quoting and whitespace", "d.yaml", deployment,
+			"kind: Deployment\napiVersion: \"apps/v1\"\nmetadata: {namespace: prod, name: 'web'}\nspec:\n  template:\n    spec:\n      containers:\n        - image: web:1\n          name: web\n  replicas: 2\n\n", ""},
+		{"changed fields", "d.yaml", deployment, strings.NewReplacer("replicas: 2", "replicas: 3", "web:1", "web:2").Replace(deployment),
+			"~ d.yaml\n  ~ Deployment/prod/web\n      spec.replicas: 2 -> 3\n      spec.template.spec.containers[0].image: \"web:1\" -> \"web:2\"\n"},
+		{"added and removed fields", "cm.yaml", "kind: ConfigMap\nmetadata:\n  name: a\ndata:\n  x: \"1\"\n", "kind: ConfigMap\nmetadata:\n  name: a\n  labels:\n    app.kubernetes.io/name: a\n",
+			"~ cm.yaml\n  ~ ConfigMap/a\n      - data: {\"x\":\"1\"}\n      + metadata.labels: {\"app.kubernetes.io/name\":\"a\"}\n"},
+		{"added and removed documents", "all.yaml", "kind: ConfigMap\nmetadata:\n  name: a\n---\nkind: ConfigMap\nmetadata:\n  name: b\n", "kind: ConfigMap\nmetadata:\n  name: b\n---\nkind: Secret\nmetadata:\n  name: c\n",
+			"~ all.yaml\n  - ConfigMap/a\n  + Secret/c\n"},
+		{"moved within the file", "all.yaml", "kind: ConfigMap\nmetadata:\n  name: a\n---\nkind: ConfigMap\nmetadata:\n  name: b\n", "kind: ConfigMap\nmetadata:\n  name: b\n---\nkind: ConfigMap\nmetadata:\n  name: a\n", ""},
+		{"list items", "l.yaml", "items: [1, 2]\n", "items: [1, 3, 4]\n",
+			"~ l.yaml\n  ~ document 1\n      items[1]: 2 -> 3\n      + items[2]: 4\n"},
+		{"not YAML", "NOTES.txt", "Thanks\n", "Thanks!\n", "--- a/NOTES.txt\n+++ b/NOTES.txt\n@@ -1 +1 @@\n-Thanks\n+Thanks!\n"},
+		{"does not parse", "bad.yaml", "a: [\n", "a: 1\n", "--- a/bad.yaml\n+++ b/bad.yaml\n@@ -1 +1 @@\n-a: [\n+a: 1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := semanticFileDiff(tt.file, []byte(tt.old), []byte(tt.new)); got != tt.want {
+				t.Errorf("semanticFileDiff() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+	if got := semanticFileDiff("a.yaml", nil, []byte("a: 1\n")); got != "+ a.yaml\n" {
+		t.Errorf("semanticFileDiff() of an added file = %q", got)
+	}
+	if got := semanticFileDiff("a.yaml", []byte("a: 1\n"), nil); got != "- a.yaml\n" {
+		t.Errorf("semanticFileDiff() of a removed file = %q", got)
+	}
+}
+
+// writeTree writes files, by slash-separated name, to fsys.
+func writeTree(t *testing.T, fsys split.FS, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := fsys.MkdirAll(path.Dir(name), dirPermissions); err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.WriteFile(name, []byte(content), filePermissions); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	cm := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\n  annotations:\n    checksum/config: abc\ndata:\n  a: \"1\"\n"
+	svc := "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n"
+	input := helmOutput("web/templates/cm.yaml", cm, "web/templates/svc.yaml", svc)
+	tests := []struct {
+		name     string
+		before   map[string]string
+		semantic bool
+		ignore   string
+		want     string // empty without differences
+	}{
+		{"unchanged", map[string]string{"out/web/templates/cm.yaml": cm, "out/web/templates/svc.yaml": svc}, false, "", ""},
+		{"missing directory", nil, true, "", "+ web/templates/cm.yaml\n+ web/templates/svc.yaml\n"},
+		{"added, changed and removed", map[string]string{
+			"out/web/templates/cm.yaml":  strings.Replace(cm, `a: "1"`, `a: "2"`, 1),
+			"out/web/templates/old.yaml": svc,
+		}, false, "",
+			"--- a/web/templates/cm.yaml\n+++ b/web/templates/cm.yaml\n@@ -5,4 +5,4 @@\n   annotations:\n     checksum/config: abc\n data:\n-  a: \"2\"\n+  a: \"1\"\n" +
+				"--- a/web/templates/old.yaml\n+++ /dev/null\n@@ -1,4 +0,0 @@\n-apiVersion: v1\n-kind: Service\n-metadata:\n-  name: web\n" +
+				"--- /dev/null\n+++ b/web/templates/svc.yaml\n@@ -0,0 +1,4 @@\n+apiVersion: v1\n+kind: Service\n+metadata:\n+  name: web\n"},
+		{"semantic", map[string]string{
+			"out/web/templates/cm.yaml":  "kind: ConfigMap\napiVersion: v1\nmetadata: {name: web, annotations: {checksum/config: def}}\ndata: {a: '1'}\n",
+			"out/web/templates/svc.yaml": svc,
+		}, true, "",
+			"~ web/templates/cm.yaml\n  ~ ConfigMap/web\n      metadata.annotations[\"checksum/config\"]: \"def\" -> \"abc\"\n"},
+		{"ignored fields", map[string]string{
+			"out/web/templates/cm.yaml":  strings.Replace(cm, "abc", "def", 1),
+			"out/web/templates/svc.yaml": svc,
+		}, true, "- kind: ConfigMap\n  jsonPointers: [/metadata/annotations/checksum~1config]\n", ""},
+		{"ignored fields of another kind", map[string]string{
+			"out/web/templates/cm.yaml":  strings.Replace(cm, "abc", "def", 1),
+			"out/web/templates/svc.yaml": svc,
+		}, false, "- kind: Secret\n  fieldPaths: ['metadata.annotations[\"checksum/config\"]']\n",
+			"--- a/web/templates/cm.yaml\n+++ b/web/templates/cm.yaml\n@@ -3,6 +3,6 @@\n metadata:\n   name: web\n   annotations:\n-    checksum/config: def\n+    checksum/config: abc\n data:\n   a: \"1\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, &semanticDiff, tt.semantic)
+			if tt.ignore != "" {
+				file := filepath.Join(t.TempDir(), "ignore.yaml")
+				if err := os.WriteFile(file, []byte(tt.ignore), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				setFlag(t, &ignoreDifferencesFile, file)
+			}
+			fsys := split.NewMemFS()
+			writeTree(t, fsys, tt.before)
+			var out strings.Builder
+			err := runDiff(fsys, strings.NewReader(input), &out, "out")
+			if tt.want == "" {
+				if err != nil || out.Len() > 0 {
+					t.Errorf("runDiff() = %v:\n%s\nwant no differences", err, out.String())
+				}
+				return
+			}
+			if !errors.Is(err, errDifferences) {
+				t.Errorf("runDiff() = %v, want %v", err, errDifferences)
+			}
+			if out.String() != tt.want {
+				t.Errorf("runDiff() wrote:\n%s\nwant:\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRunDiffErrors(t *testing.T) {
+	fsys := split.NewMemFS()
+	setFlag(t, &archivePath, "out.tgz")
+	if err := runDiff(fsys, strings.NewReader(""), &strings.Builder{}, "out"); err == nil || errors.Is(err, errDifferences) {
+		t.Errorf("runDiff() with -archive = %v", err)
+	}
+	setFlag(t, &archivePath, "")
+	setFlag(t, &ignoreDifferencesFile, filepath.Join(t.TempDir(), "missing.yaml"))
+	if err := runDiff(fsys, strings.NewReader(""), &strings.Builder{}, "out"); err == nil || errors.Is(err, errDifferences) {
+		t.Errorf("runDiff() with a missing -ignore-differences file = %v", err)
+	}
+}
+
+func TestDiffMainExitStatus(t *testing.T) {
+	dir := t.TempDir()
+	cm := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\n"
+	if err := os.MkdirAll(filepath.Join(dir, "out", "web"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "out", "web", "cm.yaml"), []byte(cm), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	t.Cleanup(func() { os.Stdout = stdout })
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	os.Stdout = devNull
+	tests := []struct {
+		name  string
+		input string
+		args  []string
+		want  int
+	}{
+		{"no differences", helmOutput("web/cm.yaml", cm), []string{filepath.Join(dir, "out")}, 0},
+		{"differences", helmOutput("web/cm.yaml", cm+"data: {}\n"), []string{filepath.Join(dir, "out")}, 1},
+		{"no OUTPUT_DIR", "", nil, 2},
+		{"unknown option", "", []string{"-no-such-option", filepath.Join(dir, "out")}, 2},
+		{"invalid input", helmOutput("web/cm.yaml", "a: [\n"), []string{"-fail-on-invalid", filepath.Join(dir, "out")}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withCommandLine(t)
+			flag.CommandLine.SetOutput(io.Discard)
+			stdin := filepath.Join(t.TempDir(), "stdin")
+			if err := os.WriteFile(stdin, []byte(tt.input), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(stdin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			original := os.Stdin
+			os.Stdin = f
+			defer func() { os.Stdin = original }()
+			if got := diffMain(tt.args); got != tt.want {
+				t.Errorf("diffMain(%q) = %d, want %d", tt.args, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// diffStreamsMain implements "schelm diff-streams [options] OLD NEW": it splits two
+// helm outputs, such as the renders of two chart versions, in memory and reports
+// the resources added, removed and changed between them.
+func diffStreamsMain(args []string) int {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return 2
+	}
+	if flag.NArg() != 2 {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: schelm diff-streams [options] OLD.yaml NEW.yaml")
+		flag.PrintDefaults()
+		return 2
+	}
+	err := runDiffStreams(flag.Arg(0), flag.Arg(1), os.Stdout)
+	if errors.Is(err, errDifferences) {
+		return 1
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// streamResource is a rendered resource and the file it was split into.
+type streamResource struct {
+	file  string
+	value any
+}
+
+// runDiffStreams splits the helm outputs in the files old and new and writes their
+// resource-level differences to stdout. Resources are matched by kind, namespace
+// and name, so ones that moved to another file are still compared.
+func runDiffStreams(old, new string, stdout io.Writer) error {
+	if chartRef != "" {
+		return errors.New("schelm diff-streams reads its two inputs from files and cannot be combined with -chart")
+	}
+	var rules []ignoreRule
+	if ignoreDifferencesFile != "" {
+		var err error
+		if rules, err = loadIgnoreRules(ignoreDifferencesFile); err != nil {
+			return err
+		}
+	}
+	before, err := splitStreamFile(old, rules)
+	if err != nil {
+		return err
+	}
+	after, err := splitStreamFile(new, rules)
+	if err != nil {
+		return err
+	}
+
+	ids := slices.Sorted(maps.Keys(after))
+	for id := range before {
+		if _, ok := after[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	var out strings.Builder
+	added, removed, changed := 0, 0, 0
+	for _, id := range ids {
+		a, inOld := before[id]
+		b, inNew := after[id]
+		switch {
+		case !inOld:
+			added++
+			fmt.Fprintf(&out, "+ %s (%s)\n", id, b.file)
+		case !inNew:
+			removed++
+			fmt.Fprintf(&out, "- %s (%s)\n", id, a.file)
+		default:
+			var changes []string
+			valueDiff("", a.value, b.value, &changes)
+			if len(changes) == 0 && a.file == b.file {
+				continue
+			}
+			changed++
+			if a.file != b.file {
+				fmt.Fprintf(&out, "~ %s (moved from %s to %s)\n", id, a.file, b.file)
+			} else {
+				fmt.Fprintf(&out, "~ %s (%s)\n", id, b.file)
+			}
+			for _, c := range changes {
+				fmt.Fprintf(&out, "    %s\n", c)
+			}
+		}
+	}
+	if added+removed+changed == 0 {
+		return nil
+	}
+	fmt.Fprintf(&out, "%d added, %d removed, %d changed\n", added, removed, changed)
+	if _, err := io.WriteString(stdout, out.String()); err != nil {
+		return err
+	}
+	return errDifferences
+}
+
+// splitStreamFile splits the helm output in file with the current options and
+// returns its resources keyed by identity.
+func splitStreamFile(file string, rules []ignoreRule) (map[string]streamResource, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	files, err := renderInMemory(f)
+	if err != nil {
+		return nil, fmt.Errorf("error splitting %s: %w", file, err)
+	}
+
+	resources := make(map[string]streamResource)
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		docs, err := decodeDocuments(stripIgnoredFields(name, files[name], rules))
+		if err != nil {
+			continue
+		}
+		for _, id := range docs.ids {
+			key := id
+			if strings.HasPrefix(id, "document ") {
+				key = name + " " + id
+			}
+			resources[key] = streamResource{file: name, value: docs.byID[id]}
+		}
+	}
+	return resources, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var checkAPIResources bool // Whether to verify every apiVersion/kind against the cluster's discovery API
+
+func init() {
+	flag.BoolVar(&checkAPIResources, "check-api-resources", false, "Fail the run on documents whose apiVersion/kind the cluster doesn't serve, queried through its discovery API (kubectl, see -kubeconfig and -context)")
+}
+
+// apiResourceList is the part of a discovery document schelm reads.
+type apiResourceList struct {
+	Resources []struct {
+		Name string `json:"name"`
+		Kind string `json:"kind"`
+	} `json:"resources"`
+}
+
+// discoverKinds returns the kinds the cluster serves for apiVersion, or an error if
+// it doesn't serve that group version at all.
+func discoverKinds(apiVersion string) (map[string]bool, error) {
+	endpoint := "/apis/" + apiVersion
+	if !strings.Contains(apiVersion, "/") {
+		endpoint = "/api/" + apiVersion
+	}
+	out, err := kubectl(nil, "get", "--raw", endpoint)
+	if err != nil {
+		return nil, err
+	}
+	var list apiResourceList
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("error parsing discovery document %s: %w", endpoint, err)
+	}
+	kinds := make(map[string]bool)
+	for _, r := range list.Resources {
+		// Subresources such as deployments/scale report the kind they return.
+		if !strings.Contains(r.Name, "/") {
+			kinds[r.Kind] = true
+		}
+	}
+	return kinds, nil
+}
+
+// newAPIResourcesCheck returns a check flagging documents of kinds the cluster
+// doesn't know, such as custom resources whose CRD isn't installed or built-ins in
+// a removed version. Kinds defined by CRDs of the same render are accepted.
+func newAPIResourcesCheck() (check, error) {
+	if err := requireKubectl(); err != nil {
+		return nil, err
+	}
+	return func(specs []*spec) []finding {
+		rendered := make(map[string]bool)
+		for _, s := range specs {
+			if s.kind() != "CustomResourceDefinition" {
+				continue
+			}
+			root, _ := s.root()
+			group, kind := s.field("spec", "group"), s.field("spec", "names", "kind")
+			for _, v := range sequenceItems(lookupNode(root, "spec", "versions")) {
+				rendered[group+"/"+scalarField(v, "name")+"/"+kind] = true
+			}
+			if version := s.field("spec", "version"); version != "" {
+				rendered[group+"/"+version+"/"+kind] = true
+			}
+		}
+
+		served := make(map[string]map[string]bool)
+		errs := make(map[string]error)
+		var findings []finding
+		for _, s := range specs {
+			apiVersion, kind := s.apiVersion(), s.kind()
+			if apiVersion == "" || kind == "" || rendered[apiVersion+"/"+kind] {
+				continue
+			}
+			if _, ok := served[apiVersion]; !ok {
+				served[apiVersion], errs[apiVersion] = discoverKinds(apiVersion)
+			}
+			var message string
+			if err := errs[apiVersion]; err != nil {
+				message = fmt.Sprintf("apiVersion %s is not served by the cluster: %v", apiVersion, err)
+			} else if !served[apiVersion][kind] {
+				message = fmt.Sprintf("kind %s is not served by the cluster in %s", kind, apiVersion)
+			} else {
+				continue
+			}
+			findings = append(findings, finding{spec: s, check: "api-resources", severity: severityError, message: message})
+		}
+		return findings
+	}, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+	"gopkg.in/yaml.v3"
+)
+
+// driftMain implements "schelm drift [options] OUTPUT_DIR": it compares the split
+// manifests in OUTPUT_DIR against the live objects of the cluster and exits with 1
+// when they drifted, for scheduled GitOps audits.
+func driftMain(args []string) int {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return 2
+	}
+	if flag.NArg() != 1 || flag.Arg(0) == "" {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: schelm drift [options] OUTPUT_DIR")
+		flag.PrintDefaults()
+		return 2
+	}
+	err := runDrift(split.OSFS{}, flag.Arg(0), os.Stdout)
+	if errors.Is(err, errDifferences) {
+		return 1
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// runDrift writes the drift of every resource in dir on fsys to stdout. Only the
+// fields set in the manifests are compared, so defaults and status filled in by the
+// cluster don't count as drift.
+func runDrift(fsys split.FS, dir string, stdout io.Writer) error {
+	if err := requireKubectl(); err != nil {
+		return err
+	}
+	var rules []ignoreRule
+	if ignoreDifferencesFile != "" {
+		var err error
+		if rules, err = loadIgnoreRules(ignoreDifferencesFile); err != nil {
+			return err
+		}
+	}
+	files, err := snapshotTree(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	drifted, checked := 0, 0
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		docs, err := decodeDocuments(stripIgnoredFields(name, files[name], rules))
+		if err != nil {
+			continue
+		}
+		for _, id := range docs.ids {
+			desired, _ := docs.byID[id].(map[string]any)
+			if strings.HasPrefix(id, "document ") || desired["apiVersion"] == nil {
+				continue
+			}
+			checked++
+			live, err := liveObject(desired)
+			if errors.Is(err, errNotFound) {
+				drifted++
+				fmt.Fprintf(stdout, "- %s (%s): missing from the cluster\n", id, name)
+				continue
+			} else if err != nil {
+				return fmt.Errorf("error reading %s from the cluster: %w", id, err)
+			}
+			var changes []string
+			driftDiff("", desired, live, &changes)
+			if len(changes) > 0 {
+				drifted++
+				fmt.Fprintf(stdout, "~ %s (%s)\n", id, name)
+				for _, c := range changes {
+					fmt.Fprintf(stdout, "    %s\n", c)
+				}
+			}
+		}
+	}
+	fmt.Fprintf(stdout, "%d of %d resource(s) drifted\n", drifted, checked)
+	if drifted > 0 {
+		return errDifferences
+	}
+	return nil
+}
+
+// errNotFound is returned by liveObject for resources the cluster doesn't have.
+var errNotFound = errors.New("not found")
+
+// liveObject fetches the live counterpart of the manifest desired.
+func liveObject(desired map[string]any) (any, error) {
+	apiVersion, _ := desired["apiVersion"].(string)
+	kind, _ := desired["kind"].(string)
+	meta, _ := desired["metadata"].(map[string]any)
+	name, _ := meta["name"].(string)
+
+	// kind.version.group pins the exact API the manifest was written for; core
+	// kinds have no group to qualify them with.
+	resource := kind
+	if group, version, ok := strings.Cut(apiVersion, "/"); ok {
+		resource = kind + "." + version + "." + group
+	}
+	args := []string{"get", resource, name, "-o", "yaml"}
+	if namespace, _ := meta["namespace"].(string); namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	out, err := kubectl(nil, args...)
+	if err != nil {
+		if strings.Contains(err.Error(), "NotFound") {
+			return nil, errNotFound
+		}
+		return nil, err
+	}
+	var live any
+	if err := yaml.Unmarshal(out, &live); err != nil {
+		return nil, fmt.Errorf("error parsing live object: %w", err)
+	}
+	return live, nil
+}
+
+// driftDiff appends a line for every field of desired below path that the live
+// object lacks or holds a different value for.
+func driftDiff(path string, desired, live any, changes *[]string) {
+	switch d := desired.(type) {
+	case map[string]any:
+		if l, ok := live.(map[string]any); ok {
+			for _, key := range slices.Sorted(maps.Keys(d)) {
+				child := fieldPath(path, key)
+				if lv, ok := l[key]; ok {
+					driftDiff(child, d[key], lv, changes)
+				} else {
+					*changes = append(*changes, fmt.Sprintf("%s: %s (missing live)", child, compactValue(d[key])))
+				}
+			}
+			return
+		}
+	case []any:
+		if l, ok := live.([]any); ok && len(l) == len(d) {
+			for i := range d {
+				driftDiff(fmt.Sprintf("%s[%d]", path, i), d[i], l[i], changes)
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(desired, live) && fmt.Sprint(desired) != fmt.Sprint(live) {
+		if path == "" {
+			path = "."
+		}
+		*changes = append(*changes, fmt.Sprintf("%s: %s (live %s)", path, compactValue(desired), compactValue(live)))
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+var (
+	dryRun   bool // Whether to report instead of writing OUTPUT_DIR
+	dryDiffs bool // Whether the dry run prints unified diffs of the changed files
+)
+
+func init() {
+	flag.BoolVar(&dryRun, "dry-run", false, "Render in memory and print the files OUTPUT_DIR would gain, change and lose, without touching it")
+	flag.BoolVar(&dryDiffs, "diff", false, "With -dry-run, print unified diffs of the changed files, colored on terminals (see -color)")
+}
+
+// runDryRun renders the stream in memory and reports to stdout what a real run would
+// do to dir, as a list of files or as unified diffs.
+func runDryRun(fsys split.FS, stdin io.Reader, stdout io.Writer, dir string) error {
+	if archivePath != "" || destURL != "" || krmOutput {
+		return fmt.Errorf("-dry-run previews OUTPUT_DIR and cannot be combined with -archive, -dest or -krm-output")
+	}
+	if _, err := fsys.Stat(dir); err == nil && !force {
+		return fmt.Errorf(`output directory "%s" already exists. Use -f to preview overwriting it`, dir)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to check output directory %s: %w", dir, err)
+	}
+	after, err := renderInMemory(stdin)
+	if err != nil {
+		return err
+	}
+	before, err := snapshotTree(fsys, dir)
+	if err != nil {
+		return err
+	}
+	color, err := colorStdout()
+	if err != nil {
+		return err
+	}
+
+	added, changed, removed := treeChanges(before, after)
+	if dryDiffs {
+		names := slices.Concat(added, changed, removed)
+		slices.Sort(names)
+		for _, name := range names {
+			diff := textFileDiff(name, before[name], after[name])
+			if color {
+				diff = colorizeDiff(diff)
+			}
+			if _, err := io.WriteString(stdout, diff); err != nil {
+				return err
+			}
+		}
+	} else {
+		for _, group := range []struct {
+			verb, color string
+			names       []string
+		}{
+			{"create", ansiGreen, added},
+			{"update", ansiYellow, changed},
+			{"delete", ansiRed, removed},
+		} {
+			for _, name := range group.names {
+				if color {
+					fmt.Fprintf(stdout, "%s%s%s %s\n", group.color, group.verb, ansiReset, name)
+				} else {
+					fmt.Fprintf(stdout, "%s %s\n", group.verb, name)
+				}
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Dry run: %d to create, %d to update, %d to delete in %s\n", len(added), len(changed), len(removed), dir)
+	return nil
+}
+
+// colorStdout reports whether output written to stdout should be colored, following
+// -color like the terminal log does for stderr.
+func colorStdout() (bool, error) {
+	if colorMode == "auto" {
+		if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+			return false, nil
+		}
+		stat, err := os.Stdout.Stat()
+		return err == nil && stat.Mode()&os.ModeCharDevice != 0, nil
+	}
+	return useTerminalLog()
+}
+
+// colorizeDiff colors the lines of a unified diff the way git does.
+func colorizeDiff(diff string) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		text := strings.TrimSuffix(line, "\n")
+		var color string
+		switch {
+		case strings.HasPrefix(text, "--- "), strings.HasPrefix(text, "+++ "):
+			color = ansiBold
+		case strings.HasPrefix(text, "@@"):
+			color = ansiCyan
+		case strings.HasPrefix(text, "+"):
+			color = ansiGreen
+		case strings.HasPrefix(text, "-"):
+			color = ansiRed
+		}
+		if color == "" || text == "" {
+			b.WriteString(line)
+			continue
+		}
+		b.WriteString(color + text + ansiReset + line[len(text):])
+	}
+	return b.String()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+var fidelity string // Whether documents pass through as rendered or are re-encoded
+
+func init() {
+	flag.StringVar(&fidelity, "fidelity", "raw", "How documents are written: raw passes them through byte for byte, block scalars, certificates and embedded scripts included, unless an option such as -normalize-profile rewrites them; normalized re-encodes every document canonically with two-space indentation, keeping values and comments but not their original layout")
+}
+
+// newFidelityHook returns the hook re-encoding documents for -fidelity normalized,
+// or nil for raw.
+func newFidelityHook() (split.DocumentHook, error) {
+	switch fidelity {
+	case "raw":
+		return nil, nil
+	case "normalized":
+		if layout == "helm" {
+			return nil, fmt.Errorf("-fidelity normalized cannot be combined with -layout helm, which reproduces helm byte for byte")
+		}
+		return canonicalHook, nil
+	}
+	return nil, fmt.Errorf("invalid -fidelity %q (expected raw or normalized)", fidelity)
+}
+
+// canonicalHook re-encodes a document the way encodeYAML writes YAML. Comments are
+// kept, and so is the style of block scalars unless their lines end in whitespace,
+// which only a quoted scalar can hold. Documents holding only comments pass through.
+func canonicalHook(meta split.DocMeta, content []byte) ([]byte, error) {
+	root, err := metaSpec(meta, content).root()
+	if err != nil || root == nil {
+		return content, err
+	}
+	out, err := encodeYAML(root)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding document from %s: %w", meta.Source, err)
+	}
+	return []byte(out), nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const certificate = `-----BEGIN CERTIFICATE-----
+MIIBszCCAVmgAwIBAgIUJ0d4Yp1cMRFYm1rDlyq2f3o9mQkwCgYIKoZIzj0EAwIw
+FjEUMBIGA1UEAwwLZXhhbXBsZS5jb20wHhcNMjQwMTAxMDAwMDAwWhcNMzQwMTAx
+MDAwMDAwWjAWMRQwEgYDVQQDDAtleGFtcGxlLmNvbTBZMBMGByqGSM49AgEGCCqG
+SM49AwEHA0IABG5Gq3cP0m8oJmR1m0eS4S3n5gAq0Ph0O+3V4Y0N8Q1u1y3e0Q2+
+-----END CERTIFICATE-----`
+
+// fidelityDocuments are documents whose bytes a re-encoding would change.
+var fidelityDocuments = []struct {
+	name    string
+	content string
+}{
+	{"literal block with trailing spaces", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: motd\ndata:\n  motd: |\n    Welcome   \n    \tto the cluster \n"},
+	{"kept trailing blank lines", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: keep\ndata:\n  text: |+\n    line\n\n\n"},
+	{"folded and indented blocks", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: folded\ndata:\n  folded: >-\n    one\n    two\n\n    three\n  indented: |2\n      leading spaces\n    kept\n"},
+	{"PEM certificate", "apiVersion: v1\nkind: Secret\nmetadata:\n  name: tls\ntype: kubernetes.io/tls\nstringData:\n  tls.crt: |\n" + indent(certificate, "    ") + "\n"},
+	{"embedded script", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: entrypoint\ndata:\n  entrypoint.sh: |\n    #!/bin/sh\n    set -eu\n    # --- start ---\n    if [ -n \"${DEBUG:-}\" ]; then\n    \tset -x\n    fi\n    cat <<'EOF' > /etc/app.conf\n    key: \"value\" # not YAML\n    EOF\n    exec \"$@\"\n"},
+	{"comments and odd quoting", "# rendered by helm\napiVersion: v1   # trailing comment\nkind: ConfigMap\nmetadata:\n  name:   'spaced'\n  labels: {app: x,   tier: \"web\"}\ndata:\n  empty: \"\"\n  tilde: ~\n"},
+	{"missing trailing newline", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: last\ndata:\n  key: |-\n    no newline at the end"},
+}
+
+func indent(text, prefix string) string {
+	return prefix + strings.ReplaceAll(text, "\n", "\n"+prefix)
+}
+
+func TestRawFidelityIsByteForByte(t *testing.T) {
+	for _, tt := range fidelityDocuments {
+		t.Run(tt.name, func(t *testing.T) {
+			files := render(t, helmOutput("chart/templates/doc.yaml", tt.content))
+			if got := files["chart/templates/doc.yaml"]; got != tt.content {
+				t.Errorf("document changed:\n got %q\nwant %q", got, tt.content)
+			}
+		})
+	}
+}
+
+func TestRawFidelityKeepsSharedFilesByteForByte(t *testing.T) {
+	var docs []string
+	for _, tt := range fidelityDocuments {
+		docs = append(docs, "chart/templates/all.yaml", tt.content)
+	}
+	input := helmOutput(docs...)
+	got := render(t, input)["chart/templates/all.yaml"]
+	if want := baselineSplit(input)["chart/templates/all.yaml"]; got != want {
+		t.Errorf("shared file changed:\n got %q\nwant %q", got, want)
+	}
+	for _, tt := range fidelityDocuments {
+		if !strings.Contains(got, tt.content) {
+			t.Errorf("%s is not in the shared file byte for byte", tt.name)
+		}
+	}
+}
+
+func TestRawFidelityWithHelmLayout(t *testing.T) {
+	setFlag(t, &layout, "helm")
+	for _, tt := range fidelityDocuments {
+		t.Run(tt.name, func(t *testing.T) {
+			files := render(t, helmOutput("chart/templates/doc.yaml", tt.content))
+			if len(files) != 1 {
+				t.Fatalf("wrote %d files, want 1", len(files))
+			}
+			for name, got := range files {
+				if !strings.Contains(got, tt.content) {
+					t.Errorf("%s does not hold the document byte for byte:\n got %q\nwant %q", name, got, tt.content)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizedFidelityKeepsValues(t *testing.T) {
+	setFlag(t, &fidelity, "normalized")
+	for _, tt := range fidelityDocuments {
+		t.Run(tt.name, func(t *testing.T) {
+			files := render(t, helmOutput("chart/templates/doc.yaml", tt.content))
+			var got, want any
+			if err := yaml.Unmarshal([]byte(files["chart/templates/doc.yaml"]), &got); err != nil {
+				t.Fatalf("normalized document does not parse: %v", err)
+			}
+			if err := yaml.Unmarshal([]byte(tt.content), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("values changed:\n got %#v\nwant %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestNewFidelityHook(t *testing.T) {
+	tests := []struct {
+		fidelity, layout string
+		ok               bool
+	}{
+		{"raw", "source", true},
+		{"normalized", "source", true},
+		{"normalized", "helm", false},
+		{"pretty", "source", false},
+	}
+	for _, tt := range tests {
+		setFlag(t, &fidelity, tt.fidelity)
+		setFlag(t, &layout, tt.layout)
+		if _, err := newFidelityHook(); (err == nil) != tt.ok {
+			t.Errorf("-fidelity %s -layout %q: err = %v, want ok %v", tt.fidelity, tt.layout, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+// outputFormat converts rendered documents into the files written to the output directory.
+type outputFormat interface {
+	// render returns the destination path, relative to the output directory, and the
+	// content to write for s. An empty content means the document produces no output.
+	render(s *spec) (dest, content string, err error)
+	// separator returns the text written before content appended to an existing file.
+	separator(content string) string
+}
+
+// formatFinisher is implemented by formats that write extra files once every
+// document has been processed, such as an index of the generated files.
+type formatFinisher interface {
+	finish(sink split.Sink, written []string) error
+}
+
+// newOutputFormat returns the outputFormat selected by the --format flag.
+func newOutputFormat(name string) (outputFormat, error) {
+	switch name {
+	case "", "yaml":
+		return yamlFormat{}, nil
+	case "terraform":
+		mode, err := parseTerraformSplit(terraformSplit)
+		if err != nil {
+			return nil, err
+		}
+		return newTerraformFormat(mode), nil
+	case "jsonnet":
+		return newJsonnetFormat(), nil
+	case "cue":
+		return newCueFormat(), nil
+	case "kapp":
+		return kappFormat{}, nil
+	case "pulumi":
+		return newPulumiFormat(), nil
+	}
+	return nil, fmt.Errorf("unknown output format %q (expected yaml, terraform, jsonnet, cue, kapp or pulumi)", name)
+}
+
+var (
+	docSeparator           string // Line written between the documents of a file
+	ensureTrailingNewline  bool   // Whether every document ends with exactly one newline
+	trimTrailingWhitespace bool   // Whether spaces and tabs at the end of lines are removed
+	lineEndings            string // Line endings the written files are converted to, or keep
+)
+
+func init() {
+	flag.StringVar(&docSeparator, "doc-separator", "---", "Line written between the YAML documents that share a file")
+	flag.BoolVar(&ensureTrailingNewline, "ensure-trailing-newline", false, "End every YAML document, and so every file, with exactly one newline and drop the blank lines around the separators. Off by default, since -fidelity raw writes documents byte for byte")
+	flag.StringVar(&lineEndings, "line-endings", "keep", "Line endings of the written files: keep (as rendered), lf or crlf, which convert every document and separator so no file mixes both")
+	flag.BoolVar(&trimTrailingWhitespace, "trim-trailing-whitespace", false, "Remove spaces and tabs at the end of the lines of YAML documents, leaving the lines of block scalars, whose trailing spaces are part of their values, alone")
+}
+
+// yamlFormat writes documents unchanged to the file named by their Source path,
+// unless -ensure-trailing-newline or -trim-trailing-whitespace tidy them.
+type yamlFormat struct{}
+
+func (yamlFormat) render(s *spec) (string, string, error) {
+	return s.source, tidyWhitespace(s.content), nil
+}
+
+// tidyWhitespace applies -trim-trailing-whitespace and -ensure-trailing-newline to
+// a document, so linters such as yamllint accept the files.
+func tidyWhitespace(content string) string {
+	if trimTrailingWhitespace {
+		content = trimLineEnds(content)
+	}
+	if ensureTrailingNewline {
+		// Leading blank lines would follow the separator of the previous document.
+		for {
+			line, rest, found := strings.Cut(content, "\n")
+			if !found || strings.TrimSpace(line) != "" {
+				break
+			}
+			content = rest
+		}
+		// The trailing newlines of a final keep block scalar are part of its value.
+		if _, keep := blockScalarBodies(strings.Split(content, "\n")); keep {
+			if !strings.HasSuffix(content, "\n") {
+				content += "\n"
+			}
+			return content
+		}
+		trimmed := strings.TrimRight(content, "\r\n")
+		newline := "\n"
+		if strings.HasPrefix(content[len(trimmed):], "\r") {
+			newline = "\r\n"
+		}
+		content = trimmed + newline
+	}
+	return content
+}
+
+// blockScalarHeader matches a line that starts a literal or folded block scalar,
+// such as "data: |", "- >-", "- key: !!binary |" or "key: |2 # comment". The
+// indicator must follow the ":" of a key or the "-" of a sequence entry, so plain
+// scalars ending in " |" such as "key: a |" don't match. The first group is the
+// indentation and dashes before the key or entry, the second the indentation and
+// chomping indicators.
+var blockScalarHeader = regexp.MustCompile(`^([ \t]*(?:- +)*)(?:-|[^#\s][^#]*?:)(?:[ \t]+[!&]\S*)*[ \t]+[|>]([1-9]?[+-]?|[+-][1-9])[ \t]*(?:#.*)?$`)
+
+// blockScalarBodies reports for every line whether it's in the body of a block
+// scalar, which runs while the lines are blank or indented deeper than the key or
+// sequence entry of its header, and whether the lines end within one that keeps
+// its trailing newlines, as |+ and >+ do.
+func blockScalarBodies(lines []string) (body []bool, keep bool) {
+	body = make([]bool, len(lines))
+	parent := -1 // column of the key or entry of the block scalar being passed, -1 outside
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if parent >= 0 {
+			if strings.TrimSpace(line) == "" || indent > parent {
+				body[i] = true
+				continue
+			}
+			parent = -1
+		}
+		if m := blockScalarHeader.FindStringSubmatch(strings.TrimRight(line, " \t")); m != nil {
+			parent, keep = len(m[1]), strings.Contains(m[2], "+")
+		}
+	}
+	return body, parent >= 0 && keep
+}
+
+// trimLineEnds removes the spaces and tabs at the end of the lines of content,
+// except within block scalars, where they are part of the value. Line endings are
+// kept, CRLF included.
+func trimLineEnds(content string) string {
+	lines := strings.Split(content, "\n")
+	bodies, _ := blockScalarBodies(lines)
+	for i, body := range bodies {
+		if !body {
+			line, cr := strings.CutSuffix(lines[i], "\r")
+			lines[i] = strings.TrimRight(line, " \t")
+			if cr {
+				lines[i] += "\r"
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func validateLineEndings(mode string) error {
+	switch mode {
+	case "keep", "lf", "crlf":
+		return nil
+	}
+	return fmt.Errorf("invalid -line-endings %q (expected keep, lf or crlf)", mode)
+}
+
+// convertLineEndings returns data, a document and the separator before it, with
+// the line endings of -line-endings.
+func convertLineEndings(data []byte) []byte {
+	switch lineEndings {
+	case "lf":
+		return bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	case "crlf":
+		return bytes.ReplaceAll(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+	}
+	return data
+}
+
+func (yamlFormat) separator(content string) string {
+	if ensureTrailingNewline {
+		// The previous document ends with its newline, too.
+		return docSeparator + "\n"
+	}
+	// Ensure there's exactly one newline before the standard YAML separator '---'
+	// This assumes the previous content might or might not end with a newline.
+	separator := "\n" + docSeparator + "\n"
+	if !strings.HasSuffix(content, "\n") {
+		separator = "\n" + separator // Add extra newline if content doesn't end with one
+	}
+	return separator
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestYAMLSeparators(t *testing.T) {
+	first := "\n\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n\n\n"
+	second := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: b"
+	input := helmOutput("c/templates/cm.yaml", first, "c/templates/cm.yaml", second)
+	tests := []struct {
+		name      string
+		separator string
+		ensure    bool
+		want      string
+	}{
+		{"default", "---", false, first + "\n\n---\n" + second},
+		{"custom separator", "# ---", false, first + "\n\n# ---\n" + second},
+		{"trailing newline", "---", true, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n---\n" + second + "\n"},
+		{"trailing newline and custom separator", "--- # next", true, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n--- # next\n" + second + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, &docSeparator, tt.separator)
+			setFlag(t, &ensureTrailingNewline, tt.ensure)
+			if got := render(t, input)["c/templates/cm.yaml"]; got != tt.want {
+				t.Errorf("cm.yaml = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTidyWhitespace(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		ensure, trim bool
+		want         string
+	}{
+		{"untouched", "\na: 1  \n\n", false, false, "\na: 1  \n\n"},
+		{"one trailing newline", "\n \na: 1\n\n\n", true, false, "a: 1\n"},
+		{"newline added", "a: 1", true, false, "a: 1\n"},
+		{"empty", "", true, false, "\n"},
+		{"CRLF", "a: 1\r\n\r\n", true, false, "a: 1\r\n"},
+		{"final keep block", "a: |+\n  x\n\n\n", true, false, "a: |+\n  x\n\n\n"},
+		{"final keep block without newline", "a: >+\n  x", true, false, "a: >+\n  x\n"},
+		{"closed keep block", "a: |+\n  x\n\nb: 1\n\n", true, false, "a: |+\n  x\n\nb: 1\n"},
+		{"final strip block", "a: |-\n  x\n\n", true, false, "a: |-\n  x\n"},
+		{"trimmed", "a: 1  \nb: 2\t\n", false, true, "a: 1\nb: 2\n"},
+		{"both", "a: 1  \n  \n", true, true, "a: 1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, &ensureTrailingNewline, tt.ensure)
+			setFlag(t, &trimTrailingWhitespace, tt.trim)
+			if got := tidyWhitespace(tt.content); got != tt.want {
+				t.Errorf("tidyWhitespace(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewOutputFormat(t *testing.T) {
+	for _, name := range []string{"", "yaml", "terraform", "jsonnet", "cue", "kapp", "pulumi"} {
+		if _, err := newOutputFormat(name); err != nil {
+			t.Errorf("newOutputFormat(%q) = %v", name, err)
+		}
+	}
+	if _, err := newOutputFormat("json"); err == nil {
+		t.Error("newOutputFormat(json) succeeded")
+	}
+}
+
+func TestTrimLineEnds(t *testing.T) {
+	tests := []struct {
+		name, content, want string
+	}{
+		{"spaces and tabs", "a: 1 \t\nb:  \n", "a: 1\nb:\n"},
+		{"carriage returns", "a: 1\r\nb: 2 \t\r\n", "a: 1\r\nb: 2\r\n"},
+		{"CRLF block", "data: | \r\n  keep  \r\nnext: 1 \r\n", "data: |\r\n  keep  \r\nnext: 1\r\n"},
+		{"literal block", "data: |\n  keep  \n  \t\nnext: 1  \n", "data: |\n  keep  \n  \t\nnext: 1\n"},
+		{"folded block with header comment", "data: >- # note  \n  folded \nnext: 1 \n", "data: >- # note\n  folded \nnext: 1\n"},
+		{"indentation indicator", "script: |2\n    indented \n", "script: |2\n    indented \n"},
+		{"sequence item", "- |\n  item \n- b \n", "- |\n  item \n- b\n"},
+		{"nested block ends at its indentation", "a:\n  s: |+\n    x \n  t: 2 \n", "a:\n  s: |+\n    x \n  t: 2\n"},
+		{"not a header", "a: b|\nc: \"x >\" \n", "a: b|\nc: \"x >\"\n"},
+		{"plain scalar ending in a bar", "key: a |\n  b: 1 \nc: 2 \n", "key: a |\n  b: 1\nc: 2\n"},
+		{"plain scalar ending in a folded indicator", "- echo a >\n  b \n", "- echo a >\n  b\n"},
+		{"URL before a bar", "url: http://x |\n  y \n", "url: http://x |\n  y\n"},
+		{"comment", "# data: |\n  a: 1 \n", "# data: |\n  a: 1\n"},
+		{"tag and anchor", "bin: !!binary |\n  AAAA \nref: &r >\n  folded \n", "bin: !!binary |\n  AAAA \nref: &r >\n  folded \n"},
+		{"chomping before indentation", "a: |-2\n    x \nb: 1 \n", "a: |-2\n    x \nb: 1\n"},
+		{"key of a sequence entry", "- data: |\n    x \n  other: 1 \n", "- data: |\n    x \n  other: 1\n"},
+		{"nested sequence entry", "- - |\n    x \n  - b \n", "- - |\n    x \n  - b\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trimLineEnds(tt.content); got != tt.want {
+				t.Errorf("trimLineEnds(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimTrailingWhitespaceKeepsBlockScalars(t *testing.T) {
+	setFlag(t, &trimTrailingWhitespace, true)
+	doc := "apiVersion: v1  \nkind: ConfigMap\nmetadata:\n  name: a \ndata:\n  motd: |\n    hello  \n"
+	want := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\ndata:\n  motd: |\n    hello  \n"
+	if got := render(t, helmOutput("c/templates/cm.yaml", doc))["c/templates/cm.yaml"]; got != want {
+		t.Errorf("cm.yaml = %q, want %q", got, want)
+	}
+}
+
+func TestLineEndings(t *testing.T) {
+	windows := "apiVersion: v1\r\nkind: ConfigMap\r\nmetadata:\r\n  name: a\r\n"
+	unix := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: b\n"
+	input := helmOutput("c/templates/one.yaml", windows, "c/templates/two.yaml", unix, "c/templates/two.yaml", windows)
+	tests := []struct {
+		mode     string
+		one, two string
+	}{
+		{"keep", windows, unix + "\n---\n" + windows},
+		{"lf", strings.ReplaceAll(windows, "\r", ""), unix + "\n---\n" + strings.ReplaceAll(windows, "\r", "")},
+		{"crlf", windows, strings.ReplaceAll(unix, "\n", "\r\n") + "\r\n---\r\n" + windows},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			setFlag(t, &lineEndings, tt.mode)
+			files := render(t, input)
+			if got := files["c/templates/one.yaml"]; got != tt.one {
+				t.Errorf("one.yaml = %q, want %q", got, tt.one)
+			}
+			if got := files["c/templates/two.yaml"]; got != tt.two {
+				t.Errorf("two.yaml = %q, want %q", got, tt.two)
+			}
+		})
+	}
+	if err := validateLineEndings("cr"); err == nil {
+		t.Error("-line-endings cr is valid")
+	}
+}
+
+func TestEnsureTrailingNewlineKeepsBlockScalarValues(t *testing.T) {
+	setFlag(t, &ensureTrailingNewline, true)
+	setFlag(t, &trimTrailingWhitespace, true)
+	for _, doc := range []string{
+		"apiVersion: v1\nkind: ConfigMap\ndata:\n  script: |+\n    echo hi  \n\n\n",
+		"apiVersion: v1\nkind: ConfigMap\ndata:\n  motd: >+\n    hello\n\n",
+		"apiVersion: v1\nkind: ConfigMap\ndata:\n  a: |+\n    x\n\n  b: |\n    y\n\n\n",
+	} {
+		var want, got map[string]any
+		if err := yaml.Unmarshal([]byte(doc), &want); err != nil {
+			t.Fatal(err)
+		}
+		tidied := tidyWhitespace(doc)
+		if err := yaml.Unmarshal([]byte(tidied), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("tidyWhitespace(%q) = %q, which holds %v instead of %v", doc, tidied, got, want)
+		}
+		if !strings.HasSuffix(tidied, "\n") {
+			t.Errorf("tidyWhitespace(%q) = %q, without a final newline", doc, tidied)
+		}
+	}
+}
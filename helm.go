@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+var (
+	chartRef      string     // Chart rendered with helm template instead of reading stdin
+	chartVersion  string     // Version constraint of a repository or OCI -chart
+	releaseName   string     // Release name the chart is rendered with
+	helmValues    stringList // Values files forwarded to helm
+	helmSet       stringList // --set values forwarded to helm
+	helmSetString stringList // --set-string values forwarded to helm
+	helmSetFile   stringList // --set-file values forwarded to helm
+
+	helmKubeVersion string     // Kubernetes version helm renders for
+	helmAPIVersions stringList // Extra API versions helm reports as available
+	helmIncludeCRDs bool       // Whether helm renders the chart's crds/ directory
+	helmNamespace   string     // Namespace the release is rendered into
+
+	dependencyUpdate bool // Whether to fetch the chart's dependencies before rendering
+)
+
+func init() {
+	flag.StringVar(&chartRef, "chart", "", "Render this chart (path, repo/name or OCI reference) with helm template instead of reading helm output from stdin")
+	flag.StringVar(&chartVersion, "chart-version", "", "With a repository or OCI -chart, the chart version (or constraint) to render instead of the latest")
+	flag.StringVar(&releaseName, "release", "release-name", "With -chart, the release name to render with")
+	flag.Var(&helmValues, "values", "With -chart, a values file passed to helm (repeatable)")
+	flag.Var(&helmSet, "set", "With -chart, a key=value passed to helm --set (repeatable)")
+	flag.Var(&helmSetString, "set-string", "With -chart, a key=value passed to helm --set-string (repeatable)")
+	flag.Var(&helmSetFile, "set-file", "With -chart, a key=path passed to helm --set-file (repeatable)")
+	flag.StringVar(&helmKubeVersion, "kube-version", "", "With -chart, the Kubernetes version helm renders for (.Capabilities.KubeVersion)")
+	flag.Var(&helmAPIVersions, "api-versions", "With -chart, an API version helm reports as available in .Capabilities.APIVersions (repeatable)")
+	flag.BoolVar(&helmIncludeCRDs, "include-crds", false, "With -chart, include the chart's CRDs in the render")
+	flag.StringVar(&helmNamespace, "namespace", "", "With -chart, the namespace the release is rendered into")
+	flag.BoolVar(&dependencyUpdate, "dependency-update", false, "With a local -chart, fetch its dependencies first: helm dependency build if it has a Chart.lock, failing when the lock is out of date, update otherwise")
+}
+
+// helmOptions are the options of a -chart render: what helm renders and how.
+type helmOptions struct {
+	chart, version, release, namespace string
+	values, set, setString, setFile    stringList
+	kubeVersion                        string
+	apiVersions                        stringList
+	includeCRDs, dependencyUpdate      bool
+}
+
+// currentHelmOptions returns the helm options of the command line.
+func currentHelmOptions() helmOptions {
+	return helmOptions{
+		chart: chartRef, version: chartVersion, release: releaseName, namespace: helmNamespace,
+		values: helmValues, set: helmSet, setString: helmSetString, setFile: helmSetFile,
+		kubeVersion: helmKubeVersion, apiVersions: helmAPIVersions,
+		includeCRDs: helmIncludeCRDs, dependencyUpdate: dependencyUpdate,
+	}
+}
+
+// apply makes o the helm options of the next render.
+func (o helmOptions) apply() {
+	chartRef, chartVersion, releaseName, helmNamespace = o.chart, o.version, o.release, o.namespace
+	helmValues, helmSet, helmSetString, helmSetFile = o.values, o.set, o.setString, o.setFile
+	helmKubeVersion, helmAPIVersions = o.kubeVersion, o.apiVersions
+	helmIncludeCRDs, dependencyUpdate = o.includeCRDs, o.dependencyUpdate
+}
+
+// helmTemplateArgs returns the helm command line rendering the -chart.
+func helmTemplateArgs() []string {
+	args := []string{"template", releaseName, chartRef}
+	if chartVersion != "" {
+		args = append(args, "--version", chartVersion)
+	}
+	if helmNamespace != "" {
+		args = append(args, "--namespace", helmNamespace)
+	}
+	if helmKubeVersion != "" {
+		args = append(args, "--kube-version", helmKubeVersion)
+	}
+	for _, v := range helmAPIVersions {
+		args = append(args, "--api-versions", v)
+	}
+	if helmIncludeCRDs {
+		args = append(args, "--include-crds")
+	}
+	return append(args, helmValueArgs()...)
+}
+
+// helmValueArgs returns the values options of the helm command line.
+func helmValueArgs() []string {
+	var args []string
+	for _, group := range []struct {
+		flag   string
+		values stringList
+	}{
+		{"--values", helmValues},
+		{"--set", helmSet},
+		{"--set-string", helmSetString},
+		{"--set-file", helmSetFile},
+	} {
+		for _, value := range group.values {
+			args = append(args, group.flag, value)
+		}
+	}
+	return args
+}
+
+// renderChart runs helm template for the -chart and returns its output, so a single
+// schelm invocation fully describes the render.
+func renderChart() (io.Reader, error) {
+	if _, err := exec.LookPath("helm"); err != nil {
+		return nil, fmt.Errorf("helm is required to render -chart: %w", err)
+	}
+	if dependencyUpdate {
+		if err := updateDependencies(); err != nil {
+			return nil, err
+		}
+	}
+	args := helmTemplateArgs()
+	log.Printf("Rendering chart %s as release %s", chartRef, releaseName)
+	cmd := exec.Command("helm", args...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("helm template %s failed: %w", chartRef, err)
+	}
+	return bytes.NewReader(out), nil
+}
+
+// updateDependencies fetches the dependencies of the local -chart. With a Chart.lock
+// helm dependency build installs exactly the locked versions and fails if the lock
+// no longer matches Chart.yaml; without one helm dependency update resolves them.
+func updateDependencies() error {
+	if stat, err := os.Stat(chartRef); err != nil || !stat.IsDir() {
+		return fmt.Errorf("-dependency-update requires -chart to be a local chart directory")
+	}
+	command := "update"
+	if _, err := os.Stat(filepath.Join(chartRef, "Chart.lock")); err == nil {
+		command = "build"
+	}
+	log.Printf("Running helm dependency %s for %s", command, chartRef)
+	cmd := exec.Command("helm", "dependency", command, chartRef)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("helm dependency %s %s failed: %w", command, chartRef, err)
+	}
+	return nil
+}
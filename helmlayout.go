@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path"
+	"strings"
+)
+
+var (
+	layout         string // Directory layout of the written files
+	useReleaseName bool   // Whether -layout helm nests the files under the release name
+)
+
+func init() {
+	flag.StringVar(&layout, "layout", "source", "Directory layout: source writes every document to the file named by its Source; helm reproduces helm template --output-dir byte for byte, every document with its --- and # Source: header")
+	flag.BoolVar(&useReleaseName, "use-release-name", false, "With -layout helm, nest the files under the -release name, like helm template --output-dir --release-name")
+}
+
+// newLayoutFormat returns the output format of -layout, given the one of -format.
+func newLayoutFormat(f outputFormat) (outputFormat, error) {
+	switch layout {
+	case "source":
+		if useReleaseName {
+			return nil, fmt.Errorf("-use-release-name requires -layout helm")
+		}
+		return f, nil
+	case "helm":
+		if format != "yaml" {
+			return nil, fmt.Errorf("-layout helm requires -format yaml")
+		}
+		var dir string
+		if useReleaseName {
+			dir = releaseName
+		}
+		return helmLayoutFormat{dir: dir}, nil
+	}
+	return nil, fmt.Errorf("invalid -layout %q (expected source or helm)", layout)
+}
+
+// helmLayoutFormat writes documents the way helm template --output-dir does: each
+// one with the header helm prints before it, to the file of its Source below the
+// optional release directory.
+type helmLayoutFormat struct {
+	dir string
+}
+
+func (h helmLayoutFormat) render(s *spec) (string, string, error) {
+	// helm drops the documents its templates render empty.
+	if strings.TrimSpace(s.content) == "" {
+		return "", "", nil
+	}
+	return path.Join(h.dir, s.source), "---\n# Source: " + s.source + "\n" + s.content, nil
+}
+
+func (helmLayoutFormat) separator(string) string {
+	return ""
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+// hookMain implements "schelm hook [options] [-config FILE] [FILE...]", meant to run
+// as a pre-commit hook: it re-renders the releases of the config file into their
+// output directories and exits with status 1 if that changed any file, so the
+// committed manifests never drift from their charts. With FILEs, as pre-commit
+// passes them, only the releases whose chart, values or config they touch are
+// re-rendered.
+func hookMain(args []string) int {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return 2
+	}
+	config, err := loadConfig(configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if len(config.Releases) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: config %s lists no releases\n", configFile)
+		return 2
+	}
+	err = runHook(config, flag.Args())
+	if errors.Is(err, errDifferences) {
+		return 1
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runHook re-renders the releases of config that files concern, all of them
+// without files, and returns errDifferences if any output changed.
+func runHook(config *schelmConfig, files []string) error {
+	var changed int
+	for _, r := range config.Releases {
+		if len(files) > 0 && !hookConcerns(r, files) {
+			continue
+		}
+		before, err := snapshotTree(split.OSFS{}, r.Output)
+		if err != nil {
+			return err
+		}
+		if err := renderRelease(r); err != nil {
+			return err
+		}
+		after, err := snapshotTree(split.OSFS{}, r.Output)
+		if err != nil {
+			return err
+		}
+		added, modified, removed := treeChanges(before, after)
+		for _, group := range []struct {
+			status string
+			names  []string
+		}{{"added", added}, {"changed", modified}, {"removed", removed}} {
+			for _, name := range group.names {
+				log.Printf("%s: %s (%s)", r.Name, filepath.Join(r.Output, name), group.status)
+			}
+		}
+		changed += len(added) + len(modified) + len(removed)
+	}
+	if changed > 0 {
+		log.Printf("Re-rendering changed %d file(s); review and stage them, then commit again", changed)
+		return errDifferences
+	}
+	return nil
+}
+
+// hookConcerns reports whether one of files, relative to the working directory,
+// is the config file, lies in the local chart directory or the output of r, or is
+// one of its values files.
+func hookConcerns(r releaseConfig, files []string) bool {
+	output := filepath.Clean(r.Output)
+	chart := ""
+	if stat, err := os.Stat(r.Chart); err == nil && stat.IsDir() {
+		chart = filepath.Clean(r.Chart)
+	}
+	for _, file := range files {
+		file = filepath.Clean(file)
+		if file == filepath.Clean(configFile) {
+			return true
+		}
+		if chart != "" && (chart == "." || file == chart || strings.HasPrefix(file, chart+string(filepath.Separator))) {
+			return true
+		}
+		if strings.HasPrefix(file, output+string(filepath.Separator)) {
+			return true
+		}
+		for _, values := range r.Values {
+			if file == filepath.Clean(values) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package main
+
+import "bromaniac.github.com/schelm/split"
+
+// docMeta returns the metadata hooks see for s.
+func docMeta(s *spec, index int) split.DocMeta {
+	return split.DocMeta{
+		Source:     s.source,
+		Index:      index,
+		Line:       s.inputLine,
+		APIVersion: s.apiVersion(),
+		Kind:       s.kind(),
+		Name:       s.name(),
+		Namespace:  s.namespace(),
+	}
+}
+
+// metaSpec returns a spec for content, a document hooks were handed with meta.
+func metaSpec(meta split.DocMeta, content []byte) *spec {
+	s := newSpec(meta.Source, string(content))
+	s.inputLine = meta.Line
+	return s
+}
+
+// applyHooks runs hooks over s in order, re-reading the metadata whenever a hook
+// rewrites the document. It returns nil if a hook dropped the document. Without
+// hooks the document isn't parsed for its metadata.
+func applyHooks(s *spec, index int, hooks []split.DocumentHook) (*spec, error) {
+	if len(hooks) == 0 {
+		return s, nil
+	}
+	out, err := split.ApplyHooks(docMeta(s, index), []byte(s.content), hooks, func(_ split.DocMeta, content []byte) split.DocMeta {
+		s = s.withContent(string(content))
+		return docMeta(s, index)
+	})
+	if err != nil || out == nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"html/template"
+	"io/fs"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+var htmlReport string // Directory to write the static HTML report of the render to
+
+func init() {
+	flag.StringVar(&htmlReport, "html-report", "", "Write a browsable static HTML report of the render (file tree, highlighted manifests, charts of documents per kind, per namespace and by size, findings, and the change over earlier reports written to the same directory) to this directory")
+}
+
+// htmlEntry is a line of the file tree: a directory, or a file linking to its page.
+type htmlEntry struct {
+	Name   string
+	Depth  int
+	Link   string // page of a file, empty for directories
+	Status string // "added", "changed" or empty
+}
+
+type htmlIndex struct {
+	Files, Documents        int
+	Added, Changed, Removed []string
+	Tree                    []htmlEntry
+	Kinds, Namespaces       []htmlBar
+	Sizes                   []htmlBar
+	History                 []htmlRun
+	HistoryChart            template.HTML
+	Images                  []string
+	Findings                []htmlFinding
+}
+
+// htmlBar is a row of a bar chart.
+type htmlBar struct {
+	Label   string
+	Count   int
+	Percent int // width of the bar, relative to the largest row
+}
+
+// htmlHistoryFile keeps the counters of the reports written to the directory
+// before, for the change-over-time chart. It survives the -f that replaces the
+// report.
+const htmlHistoryFile = "history.json"
+
+// htmlHistoryLength is the number of runs the history keeps.
+const htmlHistoryLength = 50
+
+// htmlRun is the entry of a report in the history.
+type htmlRun struct {
+	Time      string `json:"time"`
+	Files     int    `json:"files"`
+	Documents int    `json:"documents"`
+	Bytes     int    `json:"bytes"`
+	Added     int    `json:"added"`
+	Changed   int    `json:"changed"`
+	Removed   int    `json:"removed"`
+}
+
+// htmlSizeBuckets are the upper bounds of the document size classes.
+var htmlSizeBuckets = []int{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10}
+
+type htmlFinding struct {
+	Severity, File, Resource, Message, Check string
+}
+
+type htmlPage struct {
+	Name, Root string
+	Status     string
+	Body       template.HTML
+}
+
+const htmlStyle = `<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+pre { background: #f6f8fa; padding: 1em; overflow-x: auto; line-height: 1.4; }
+ul.tree { list-style: none; padding: 0; font-family: monospace; }
+.added { color: #1a7f37; } .changed { color: #9a6700; } .removed { color: #cf222e; text-decoration: line-through; }
+.error { color: #cf222e; } .warning { color: #9a6700; }
+.k { color: #0550ae; } .c { color: #6e7781; font-style: italic; } .s { color: #0a3069; } .n { color: #953800; } .d { color: #8250df; }
+table { border-collapse: collapse; } td, th { border: 1px solid #d0d7de; padding: 0.2em 0.6em; text-align: left; }
+.charts { display: flex; flex-wrap: wrap; gap: 2em; } .charts > div { min-width: 20em; }
+td.bar { min-width: 12em; } td.bar div { background: #54aeff; height: 0.9em; }
+svg.history { border: 1px solid #d0d7de; } svg.history polyline { fill: none; stroke-width: 2; }
+</style>`
+
+var htmlIndexTemplate = template.Must(template.New("index").Funcs(template.FuncMap{"list": func(v ...any) []any { return v }}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>schelm render report</title>` + htmlStyle + `</head><body>
+<h1>schelm render report</h1>
+<p>{{.Files}} file(s), {{.Documents}} document(s): {{len .Added}} added, {{len .Changed}} changed, {{len .Removed}} removed.</p>
+<h2>Files</h2>
+<ul class="tree">
+{{- range .Tree}}
+<li style="padding-left: {{.Depth}}em">{{if .Link}}<a href="{{.Link}}" class="{{.Status}}">{{.Name}}</a>{{if .Status}} <span class="{{.Status}}">({{.Status}})</span>{{end}}{{else}}{{.Name}}/{{end}}</li>
+{{- end}}
+{{- range .Removed}}
+<li class="removed">{{.}}</li>
+{{- end}}
+</ul>
+{{- if .Kinds}}
+<div class="charts">
+{{- template "bars" (list "Documents per kind" "Kind" .Kinds)}}
+{{- template "bars" (list "Documents per namespace" "Namespace" .Namespaces)}}
+{{- template "bars" (list "Document sizes" "Size" .Sizes)}}
+</div>
+{{- end}}
+{{- if .History}}
+<h2>Over time</h2>
+{{.HistoryChart}}
+<table><tr><th>Report</th><th>Files</th><th>Documents</th><th>Bytes</th><th>Added</th><th>Changed</th><th>Removed</th></tr>
+{{- range .History}}
+<tr><td>{{.Time}}</td><td>{{.Files}}</td><td>{{.Documents}}</td><td>{{.Bytes}}</td><td class="added">{{.Added}}</td><td class="changed">{{.Changed}}</td><td class="removed">{{.Removed}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Images}}
+<h2>Images</h2>
+<ul>{{range .Images}}<li><code>{{.}}</code></li>{{end}}</ul>
+{{- end}}
+{{- if .Findings}}
+<h2>Findings</h2>
+<table><tr><th>Severity</th><th>File</th><th>Resource</th><th>Message</th><th>Check</th></tr>
+{{- range .Findings}}
+<tr class="{{.Severity}}"><td>{{.Severity}}</td><td>{{.File}}</td><td>{{.Resource}}</td><td>{{.Message}}</td><td>{{.Check}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body></html>
+{{- define "bars"}}
+<div><h2>{{index . 0}}</h2>
+<table><tr><th>{{index . 1}}</th><th>Documents</th><th></th></tr>
+{{- range index . 2}}
+<tr><td>{{.Label}}</td><td>{{.Count}}</td><td class="bar"><div style="width: {{.Percent}}%"></div></td></tr>
+{{- end}}
+</table></div>
+{{- end}}
+`))
+
+var htmlPageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Name}}</title>` + htmlStyle + `</head><body>
+<p><a href="{{.Root}}index.html">&larr; report</a></p>
+<h1>{{.Name}}{{if .Status}} <span class="{{.Status}}">({{.Status}})</span>{{end}}</h1>
+<pre>{{.Body}}</pre>
+</body></html>
+`))
+
+// writeHTMLReport writes index.html and one page per file of after to dir. before is
+// the output tree as it was before the run, for the change summary.
+func writeHTMLReport(fsys split.FS, dir string, before, after map[string][]byte, specs []*spec, findings []finding) error {
+	history, err := readHTMLHistory(fsys, dir)
+	if err != nil {
+		return err
+	}
+	if _, err := setupOutputDirectory(fsys, dir, force, nil); err != nil {
+		return err
+	}
+	added, changed, removed := treeChanges(before, after)
+	status := make(map[string]string)
+	for _, name := range added {
+		status[name] = "added"
+	}
+	for _, name := range changed {
+		status[name] = "changed"
+	}
+
+	index := htmlIndex{
+		Files: len(after), Documents: len(specs),
+		Added: added, Changed: changed, Removed: removed,
+		Kinds: htmlBars(kindCounts(specs), nil), Namespaces: htmlBars(namespaceCounts(specs), nil),
+		Sizes: htmlSizeBars(specs), Images: renderImages(specs),
+	}
+	run := htmlRun{
+		Time: time.Now().UTC().Format(time.RFC3339), Files: len(after), Documents: len(specs),
+		Added: len(added), Changed: len(changed), Removed: len(removed),
+	}
+	for _, data := range after {
+		run.Bytes += len(data)
+	}
+	history = append(history, run)
+	if len(history) > htmlHistoryLength {
+		history = history[len(history)-htmlHistoryLength:]
+	}
+	if len(history) > 1 {
+		index.History, index.HistoryChart = history, htmlHistoryChart(history)
+	}
+	for _, f := range findings {
+		index.Findings = append(index.Findings, htmlFinding{f.severity, f.spec.dest, resourceName(f.spec), f.message, f.check})
+	}
+
+	opened := map[string]bool{".": true}
+	for _, name := range slices.Sorted(maps.Keys(after)) {
+		// List the directories leading to the file the first time they're seen.
+		parts := strings.Split(name, "/")
+		for i := range parts[:len(parts)-1] {
+			if dir := path.Join(parts[:i+1]...); !opened[dir] {
+				opened[dir] = true
+				index.Tree = append(index.Tree, htmlEntry{Name: parts[i], Depth: i})
+			}
+		}
+		page := "files/" + name + ".html"
+		index.Tree = append(index.Tree, htmlEntry{Name: parts[len(parts)-1], Depth: len(parts) - 1, Link: page, Status: status[name]})
+
+		var buf bytes.Buffer
+		err := htmlPageTemplate.Execute(&buf, htmlPage{
+			Name:   name,
+			Root:   strings.Repeat("../", strings.Count(page, "/")),
+			Status: status[name],
+			Body:   highlightManifest(name, after[name]),
+		})
+		if err != nil {
+			return fmt.Errorf("error rendering HTML report page for %s: %w", name, err)
+		}
+		file := path.Join(dir, page)
+		if err := fsys.MkdirAll(path.Dir(file), dirPermissions); err != nil {
+			return fmt.Errorf("error creating directory for %s: %w", file, err)
+		}
+		if err := fsys.WriteFile(file, buf.Bytes(), filePermissions); err != nil {
+			return fmt.Errorf("error writing %s: %w", file, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := htmlIndexTemplate.Execute(&buf, index); err != nil {
+		return fmt.Errorf("error rendering HTML report index: %w", err)
+	}
+	file := path.Join(dir, "index.html")
+	if err := fsys.WriteFile(file, buf.Bytes(), filePermissions); err != nil {
+		return fmt.Errorf("error writing %s: %w", file, err)
+	}
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	file = path.Join(dir, htmlHistoryFile)
+	if err := fsys.WriteFile(file, append(data, '\n'), filePermissions); err != nil {
+		return fmt.Errorf("error writing %s: %w", file, err)
+	}
+	return nil
+}
+
+// readHTMLHistory reads the history of the report in dir, if there is one.
+func readHTMLHistory(fsys split.FS, dir string) ([]htmlRun, error) {
+	file := path.Join(dir, htmlHistoryFile)
+	data, err := fsys.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", file, err)
+	}
+	var history []htmlRun
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", file, err)
+	}
+	return history, nil
+}
+
+// namespaceCounts counts the documents per namespace.
+func namespaceCounts(specs []*spec) map[string]int {
+	namespaces := make(map[string]int)
+	for _, s := range specs {
+		namespace := s.namespace()
+		if namespace == "" {
+			namespace = "(none)"
+		}
+		namespaces[namespace]++
+	}
+	return namespaces
+}
+
+// htmlBars turns counts into chart rows, largest first, or in the order of labels
+// when it is given.
+func htmlBars(counts map[string]int, labels []string) []htmlBar {
+	if labels == nil {
+		labels = slices.SortedFunc(maps.Keys(counts), func(a, b string) int {
+			return cmp.Or(cmp.Compare(counts[b], counts[a]), strings.Compare(a, b))
+		})
+	}
+	largest := 0
+	for _, count := range counts {
+		largest = max(largest, count)
+	}
+	bars := make([]htmlBar, 0, len(labels))
+	for _, label := range labels {
+		bar := htmlBar{Label: label, Count: counts[label]}
+		if largest > 0 {
+			bar.Percent = bar.Count * 100 / largest
+		}
+		bars = append(bars, bar)
+	}
+	return bars
+}
+
+// htmlSizeBars counts the documents per size class.
+func htmlSizeBars(specs []*spec) []htmlBar {
+	labels := make([]string, len(htmlSizeBuckets)+1)
+	for i, limit := range htmlSizeBuckets {
+		labels[i] = "< " + formatBytes(float64(limit)) + "B"
+	}
+	labels[len(htmlSizeBuckets)] = "≥ " + formatBytes(float64(htmlSizeBuckets[len(htmlSizeBuckets)-1])) + "B"
+	counts := make(map[string]int)
+	for _, s := range specs {
+		i, _ := slices.BinarySearch(htmlSizeBuckets, len(s.content)+1)
+		counts[labels[i]]++
+	}
+	return htmlBars(counts, labels)
+}
+
+// htmlHistoryChart draws the files and documents of the runs in history as an SVG
+// line chart.
+func htmlHistoryChart(history []htmlRun) template.HTML {
+	const width, height, pad = 600, 160, 10
+	largest := 1
+	for _, r := range history {
+		largest = max(largest, r.Files, r.Documents)
+	}
+	line := func(value func(htmlRun) int) string {
+		points := make([]string, len(history))
+		for i, r := range history {
+			x := pad + i*(width-2*pad)/(len(history)-1)
+			y := height - pad - value(r)*(height-2*pad)/largest
+			points[i] = fmt.Sprintf("%d,%d", x, y)
+		}
+		return strings.Join(points, " ")
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="history" width="%d" height="%d" viewBox="0 0 %d %d">`, width, height, width, height)
+	fmt.Fprintf(&b, `<polyline points="%s" stroke="#0550ae"><title>documents</title></polyline>`, line(func(r htmlRun) int { return r.Documents }))
+	fmt.Fprintf(&b, `<polyline points="%s" stroke="#8250df"><title>files</title></polyline>`, line(func(r htmlRun) int { return r.Files }))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="12">%d</text></svg>`, pad, pad+12, largest)
+	b.WriteString(`<p><span style="color: #0550ae">&#9632; documents</span> <span style="color: #8250df">&#9632; files</span></p>`)
+	return template.HTML(b.String())
+}
+
+// yamlLine splits a YAML line into indentation (with any list dash), key and value.
+var yamlLine = regexp.MustCompile(`^(\s*(?:- )*)([^\s#'"{\[][^:#]*|"[^"]*"|'[^']*'):(\s.*|)$`)
+
+var yamlLiteral = regexp.MustCompile(`^(?:-?[0-9][0-9._eE+-]*|true|false|null|~)$`)
+
+// highlightManifest returns content as escaped HTML, with YAML keys, values and
+// comments wrapped in spans. Files in other formats are only escaped.
+func highlightManifest(name string, content []byte) template.HTML {
+	if ext := path.Ext(name); ext != ".yaml" && ext != ".yml" {
+		return template.HTML(html.EscapeString(string(content)))
+	}
+	var b strings.Builder
+	for i, line := range strings.Split(string(content), "\n") {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "#"):
+			fmt.Fprintf(&b, `<span class="c">%s</span>`, html.EscapeString(line))
+		case trimmed == "---":
+			fmt.Fprintf(&b, `<span class="d">%s</span>`, html.EscapeString(line))
+		default:
+			if m := yamlLine.FindStringSubmatch(line); m != nil {
+				fmt.Fprintf(&b, `%s<span class="k">%s</span>:%s`, html.EscapeString(m[1]), html.EscapeString(m[2]), highlightValue(m[3]))
+			} else {
+				b.WriteString(highlightValue(line))
+			}
+		}
+	}
+	return template.HTML(b.String())
+}
+
+// highlightValue escapes a scalar value, marking strings and literals.
+func highlightValue(value string) string {
+	v := strings.TrimSpace(value)
+	lead := value[:len(value)-len(strings.TrimLeft(value, " \t"))]
+	class := ""
+	switch {
+	case v == "":
+		return html.EscapeString(value)
+	case strings.HasPrefix(v, `"`), strings.HasPrefix(v, "'"):
+		class = "s"
+	case yamlLiteral.MatchString(v):
+		class = "n"
+	default:
+		return html.EscapeString(value)
+	}
+	return fmt.Sprintf(`%s<span class="%s">%s</span>`, lead, class, html.EscapeString(strings.TrimLeft(value, " \t")))
+}
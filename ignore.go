@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ignoreDifferencesFile string // Rules file of fields the diff modes skip
+
+func init() {
+	flag.StringVar(&ignoreDifferencesFile, "ignore-differences", "", "With schelm diff, skip the fields listed in this rules file (jsonPointers or fieldPaths per group/kind)")
+}
+
+// ignoreRule selects the fields to leave out of diffs for matching resources, in the
+// shape of Argo CD's ignoreDifferences. Empty selectors match everything.
+type ignoreRule struct {
+	Group        string   `yaml:"group"`
+	Kind         string   `yaml:"kind"`
+	Name         string   `yaml:"name"`
+	Namespace    string   `yaml:"namespace"`
+	JSONPointers []string `yaml:"jsonPointers"` // e.g. /webhooks/0/clientConfig/caBundle
+	FieldPaths   []string `yaml:"fieldPaths"`   // e.g. spec.template.metadata.annotations["checksum/config"]
+
+	paths [][]string // parsed pointers and field paths; "*" matches any key or index
+}
+
+// loadIgnoreRules reads a YAML list of ignore rules from file.
+func loadIgnoreRules(file string) ([]ignoreRule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ignore rules: %w", err)
+	}
+	var rules []ignoreRule
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("error parsing ignore rules %s: %w", file, err)
+	}
+	for i := range rules {
+		if err := rules[i].parsePaths(); err != nil {
+			return nil, fmt.Errorf("ignore rules %s: %w", file, err)
+		}
+	}
+	return rules, nil
+}
+
+// parsePaths fills r.paths from the pointers and field paths of the rule.
+func (r *ignoreRule) parsePaths() error {
+	for _, p := range r.JSONPointers {
+		segs, err := parseJSONPointer(p)
+		if err != nil {
+			return err
+		}
+		r.paths = append(r.paths, segs)
+	}
+	for _, p := range r.FieldPaths {
+		segs, err := parseFieldPath(p)
+		if err != nil {
+			return err
+		}
+		r.paths = append(r.paths, segs)
+	}
+	return nil
+}
+
+// parseJSONPointer splits an RFC 6901 pointer into its unescaped segments.
+func parseJSONPointer(p string) ([]string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q (must start with /)", p)
+	}
+	segs := strings.Split(p[1:], "/")
+	for i, s := range segs {
+		segs[i] = strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+	}
+	return segs, nil
+}
+
+// parseFieldPath splits a field path as printed by schelm diff -semantic: dotted keys,
+// [n] indexes, ["key"] for keys that aren't plain words and [*] or * wildcards.
+func parseFieldPath(p string) ([]string, error) {
+	var segs []string
+	rest := strings.TrimPrefix(p, ".")
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "[\""):
+			end := strings.Index(rest, "\"]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid field path %q: unterminated key", p)
+			}
+			key, err := strconv.Unquote(rest[1 : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid field path %q: %w", p, err)
+			}
+			segs = append(segs, key)
+			rest = rest[end+2:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid field path %q: unterminated index", p)
+			}
+			segs = append(segs, rest[1:end])
+			rest = rest[end+1:]
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			segs = append(segs, rest[:end])
+			rest = rest[end:]
+		}
+		rest = strings.TrimPrefix(rest, ".")
+	}
+	if len(segs) == 0 {
+		return nil, fmt.Errorf("invalid field path %q: empty", p)
+	}
+	return segs, nil
+}
+
+// matches reports whether the rule applies to the document rooted at root.
+func (r ignoreRule) matches(root *yaml.Node) bool {
+	group := ""
+	if apiVersion := scalarField(root, "apiVersion"); strings.Contains(apiVersion, "/") {
+		group = apiVersion[:strings.Index(apiVersion, "/")]
+	}
+	return (r.Group == "" || r.Group == group) &&
+		(r.Kind == "" || r.Kind == scalarField(root, "kind")) &&
+		(r.Name == "" || r.Name == scalarField(root, "metadata", "name")) &&
+		(r.Namespace == "" || r.Namespace == scalarField(root, "metadata", "namespace"))
+}
+
+// stripIgnoredFields removes the fields selected by rules from every document of a
+// YAML file. Content that isn't YAML or that no rule touches is returned as-is.
+func stripIgnoredFields(name string, content []byte, rules []ignoreRule) []byte {
+	if content == nil || len(rules) == 0 {
+		return content
+	}
+	if ext := path.Ext(name); ext != ".yaml" && ext != ".yml" {
+		return content
+	}
+	var docs []*yaml.Node
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return content
+		}
+		docs = append(docs, &doc)
+	}
+
+	stripped := false
+	for _, doc := range docs {
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		root := doc.Content[0]
+		for _, r := range rules {
+			if !r.matches(root) {
+				continue
+			}
+			for _, segs := range r.paths {
+				if removeField(root, segs) {
+					stripped = true
+				}
+			}
+		}
+	}
+	if !stripped {
+		return content
+	}
+
+	var out strings.Builder
+	for i, doc := range docs {
+		text, err := encodeYAML(doc)
+		if err != nil {
+			return content
+		}
+		if i > 0 {
+			out.WriteString("---\n")
+		}
+		out.WriteString(text)
+	}
+	return []byte(out.String())
+}
+
+// removeField deletes the field at segs below n and reports whether anything was removed.
+func removeField(n *yaml.Node, segs []string) bool {
+	n = resolveAlias(n)
+	seg, last := segs[0], len(segs) == 1
+	removed := false
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if seg != "*" && n.Content[i].Value != seg {
+				continue
+			}
+			if last {
+				n.Content = append(n.Content[:i], n.Content[i+2:]...)
+				i -= 2
+				removed = true
+			} else if removeField(n.Content[i+1], segs[1:]) {
+				removed = true
+			}
+		}
+	case yaml.SequenceNode:
+		for i := 0; i < len(n.Content); i++ {
+			if seg != "*" && seg != strconv.Itoa(i) {
+				continue
+			}
+			if last {
+				n.Content = append(n.Content[:i], n.Content[i+1:]...)
+				i--
+				removed = true
+				if seg != "*" {
+					break
+				}
+			} else if removeField(n.Content[i], segs[1:]) {
+				removed = true
+			}
+		}
+	}
+	return removed
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+var interactive bool // Whether the rendered resources are picked on the terminal before writing
+
+func init() {
+	flag.BoolVar(&interactive, "interactive", false, "List the rendered resources on the terminal and toggle which of them get written")
+}
+
+// interactiveTransform lets the user pick the documents to write. It talks to the
+// controlling terminal, since stdin carries the helm output.
+func interactiveTransform(specs []*spec) ([]*spec, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("-interactive needs a terminal: %w", err)
+	}
+	defer tty.Close()
+	return selectSpecs(tty, tty, specs)
+}
+
+// selectSpecs shows the documents with their selection state and applies the
+// toggles read from in until an empty line confirms the selection.
+func selectSpecs(in io.Reader, out io.Writer, specs []*spec) ([]*spec, error) {
+	selected := make([]bool, len(specs))
+	for i := range selected {
+		selected[i] = true
+	}
+	scanner := bufio.NewScanner(in)
+	for {
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		for i, s := range specs {
+			mark := " "
+			if selected[i] {
+				mark = "x"
+			}
+			fmt.Fprintf(tw, "[%s] %d\t%s\t%s\t%s\n", mark, i+1, valueOr(s.kind(), "-"), valueOr(s.name(), "-"), s.source)
+		}
+		tw.Flush()
+		fmt.Fprint(out, "Toggle (e.g. 1,3-5), a: all, n: none, q: quit, Enter: write selected> ")
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, errors.New("no selection made")
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			break
+		}
+		if err := applyToggles(line, selected); errors.Is(err, errAborted) {
+			return nil, err
+		} else if err != nil {
+			fmt.Fprintf(out, "%v\n", err)
+		}
+	}
+
+	var kept []*spec
+	for i, s := range specs {
+		if selected[i] {
+			kept = append(kept, s)
+		}
+	}
+	return kept, nil
+}
+
+// applyToggles updates selected according to line, a list of commands separated by
+// commas or spaces.
+func applyToggles(line string, selected []bool) error {
+	for _, token := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' }) {
+		switch token {
+		case "a", "n":
+			for i := range selected {
+				selected[i] = token == "a"
+			}
+			continue
+		case "q":
+			return errAborted
+		}
+		first, last, isRange := strings.Cut(token, "-")
+		from, err := strconv.Atoi(first)
+		to := from
+		if err == nil && isRange {
+			to, err = strconv.Atoi(last)
+		}
+		if err != nil || from < 1 || to > len(selected) || from > to {
+			return fmt.Errorf("invalid selection %q", token)
+		}
+		for i := from - 1; i < to; i++ {
+			selected[i] = !selected[i]
+		}
+	}
+	return nil
+}
+
+// errAborted is returned when the user quits the selection; nothing is written.
+var errAborted = errors.New("aborted")
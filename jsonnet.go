@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+// jsonnetIndexFile is the top-level file importing every generated .libsonnet object.
+const jsonnetIndexFile = "index.jsonnet"
+
+// jsonnetKeywords cannot be used as unquoted object field names.
+var jsonnetKeywords = map[string]bool{
+	"assert": true, "else": true, "error": true, "false": true, "for": true,
+	"function": true, "if": true, "import": true, "importstr": true, "importbin": true,
+	"in": true, "local": true, "null": true, "tailstrict": true, "then": true,
+	"self": true, "super": true, "true": true,
+}
+
+// jsonnetStyle writes Jsonnet object and array literals.
+var jsonnetStyle = literalStyle{language: "Jsonnet", assign: ": ", fieldEnd: ",", key: jsonnetKey, str: quoteString}
+
+// jsonnetFormat writes every document as its own .libsonnet object. Documents sharing a
+// Source get numbered files, since a Jsonnet file holds exactly one expression.
+type jsonnetFormat struct {
+	counts map[string]int
+}
+
+func newJsonnetFormat() *jsonnetFormat {
+	return &jsonnetFormat{counts: make(map[string]int)}
+}
+
+func (j *jsonnetFormat) render(s *spec) (string, string, error) {
+	root, err := s.root()
+	if err != nil {
+		return "", "", err
+	}
+	if root == nil {
+		return "", "", nil
+	}
+
+	j.counts[s.source]++
+	base := strings.TrimSuffix(s.source, path.Ext(s.source))
+	if n := j.counts[s.source]; n > 1 {
+		base += "-" + strconv.Itoa(n)
+	}
+
+	var b strings.Builder
+	if err := writeLiteral(&b, jsonnetStyle, root, 0); err != nil {
+		return "", "", fmt.Errorf("error converting document from %s: %w", s.source, err)
+	}
+	b.WriteString("\n")
+	return base + ".libsonnet", b.String(), nil
+}
+
+func (j *jsonnetFormat) separator(string) string {
+	return ""
+}
+
+// finish writes index.jsonnet, an array importing every generated object in render order.
+func (j *jsonnetFormat) finish(sink split.Sink, written []string) error {
+	var b strings.Builder
+	b.WriteString("[\n")
+	for _, file := range written {
+		fmt.Fprintf(&b, "  import %s,\n", quoteString(file))
+	}
+	b.WriteString("]\n")
+
+	return sink.CreateOrAppend(jsonnetIndexFile, []byte(b.String()))
+}
+
+// jsonnetKey returns key as a Jsonnet field name, quoting it unless it is a plain identifier.
+func jsonnetKey(key string) string {
+	if isIdentifier(key, false) && !jsonnetKeywords[key] {
+		return key
+	}
+	return quoteString(key)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestJsonnetKey(t *testing.T) {
+	tests := []struct{ key, want string }{
+		{"name", "name"},
+		{"_hidden", "_hidden"},
+		{"app-name", `"app-name"`},
+		{"app.kubernetes.io/name", `"app.kubernetes.io/name"`},
+		{"local", `"local"`},
+		{"self", `"self"`},
+		{"importstr", `"importstr"`},
+		{"2", `"2"`},
+	}
+	for _, tt := range tests {
+		if got := jsonnetKey(tt.key); got != tt.want {
+			t.Errorf("jsonnetKey(%q) = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestJsonnetFormat(t *testing.T) {
+	setFlag(t, &format, "jsonnet")
+	input := helmOutput(
+		"web/templates/app.yaml", "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n  labels:\n    for: x\nspec:\n  ports: [{port: 80}]\n  selector: {}\n",
+		"web/templates/app.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\ndata:\n  image: \"nginx:${TAG}\"\n  script: \"echo \\\"hi\\\"\\n\"\n",
+		"web/templates/empty.yaml", "# only a comment\n",
+		"web/templates/other.yaml", "apiVersion: v1\nkind: List\nitems: []\n",
+	)
+	files := render(t, input)
+	want := map[string]string{
+		"index.jsonnet": `[
+  import "web/templates/app.libsonnet",
+  import "web/templates/app-2.libsonnet",
+  import "web/templates/other.libsonnet",
+]
+`,
+		"web/templates/app.libsonnet": `{
+  apiVersion: "v1",
+  kind: "Service",
+  metadata: {
+    name: "web",
+    labels: {
+      "for": "x",
+    },
+  },
+  spec: {
+    ports: [
+      {
+        port: 80,
+      },
+    ],
+    selector: {},
+  },
+}
+`,
+		"web/templates/app-2.libsonnet": `{
+  apiVersion: "v1",
+  kind: "ConfigMap",
+  metadata: {
+    name: "web",
+  },
+  data: {
+    image: "nginx:${TAG}",
+    script: "echo \"hi\"\n",
+  },
+}
+`,
+		"web/templates/other.libsonnet": `{
+  apiVersion: "v1",
+  kind: "List",
+  items: [],
+}
+`,
+	}
+	if !reflect.DeepEqual(slices.Sorted(maps.Keys(files)), slices.Sorted(maps.Keys(want))) {
+		t.Fatalf("wrote %v, want %v", slices.Sorted(maps.Keys(files)), slices.Sorted(maps.Keys(want)))
+	}
+	for name, content := range want {
+		if files[name] != content {
+			t.Errorf("%s:\n%s\nwant:\n%s", name, files[name], content)
+		}
+	}
+}
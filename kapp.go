@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Change groups the kapp format puts documents in. kapp applies CRDs and Namespaces
+// before the resources that may depend on them, and deletes them after.
+const (
+	kappCRDGroup       = "schelm.io/crds"
+	kappNamespaceGroup = "schelm.io/namespaces"
+	kappResourceGroup  = "schelm.io/resources"
+)
+
+// kappFormat writes documents like the yaml format, annotated with kapp change
+// groups and change rules, so kapp deploy -f OUTPUT_DIR orders them itself.
+type kappFormat struct{}
+
+func (kappFormat) render(s *spec) (string, string, error) {
+	root, err := s.root()
+	if err != nil || root == nil || s.kind() == "" {
+		return s.source, tidyWhitespace(s.content), err
+	}
+	root = cloneNode(root)
+	annotations := lookupNode(root, "metadata", "annotations")
+	set := func(key, value string) {
+		// Leave the ordering a chart asked for alone.
+		if scalarField(annotations, key) == "" {
+			setAnnotation(root, key, value)
+		}
+	}
+	switch s.kind() {
+	case "CustomResourceDefinition":
+		set("kapp.k14s.io/change-group", kappCRDGroup)
+	case "Namespace":
+		set("kapp.k14s.io/change-group", kappNamespaceGroup)
+	default:
+		set("kapp.k14s.io/change-group", kappResourceGroup)
+		set("kapp.k14s.io/change-rule.schelm-crds", "upsert after upserting "+kappCRDGroup)
+		set("kapp.k14s.io/change-rule.schelm-namespaces", "upsert after upserting "+kappNamespaceGroup)
+		set("kapp.k14s.io/change-rule.schelm-crds-delete", "delete before deleting "+kappCRDGroup)
+		set("kapp.k14s.io/change-rule.schelm-namespaces-delete", "delete before deleting "+kappNamespaceGroup)
+	}
+	content, err := encodeYAML(root)
+	if err != nil {
+		return "", "", fmt.Errorf("error encoding document from %s: %w", s.source, err)
+	}
+	return s.source, tidyWhitespace(content), nil
+}
+
+func (kappFormat) separator(content string) string {
+	return yamlFormat{}.separator(content)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKappFormat(t *testing.T) {
+	resourceRules := `    kapp.k14s.io/change-rule.schelm-crds: upsert after upserting schelm.io/crds
+    kapp.k14s.io/change-rule.schelm-namespaces: upsert after upserting schelm.io/namespaces
+    kapp.k14s.io/change-rule.schelm-crds-delete: delete before deleting schelm.io/crds
+    kapp.k14s.io/change-rule.schelm-namespaces-delete: delete before deleting schelm.io/namespaces
+`
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "CRD",
+			content: "apiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\nmetadata:\n  name: widgets.example.com\n",
+			want:    "apiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\nmetadata:\n  name: widgets.example.com\n  annotations:\n    kapp.k14s.io/change-group: schelm.io/crds\n",
+		},
+		{
+			name:    "Namespace",
+			content: "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: prod\n",
+			want:    "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: prod\n  annotations:\n    kapp.k14s.io/change-group: schelm.io/namespaces\n",
+		},
+		{
+			name:    "resource",
+			content: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\n  annotations:\n    team: shop\n",
+			want:    "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\n  annotations:\n    team: shop\n    kapp.k14s.io/change-group: schelm.io/resources\n" + resourceRules,
+		},
+		{
+			name:    "ordering of the chart",
+			content: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\n  annotations:\n    kapp.k14s.io/change-group: custom\n    kapp.k14s.io/change-rule.schelm-crds: upsert after upserting custom-crds\n",
+			want: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\n  annotations:\n    kapp.k14s.io/change-group: custom\n    kapp.k14s.io/change-rule.schelm-crds: upsert after upserting custom-crds\n" +
+				strings.Join(strings.SplitAfter(resourceRules, "\n")[1:], ""),
+		},
+		{
+			name:    "no kind",
+			content: "# values\nreplicas:   2\n",
+			want:    "# values\nreplicas:   2\n",
+		},
+		{
+			name:    "only comments",
+			content: "# nothing rendered\n",
+			want:    "# nothing rendered\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSpec("web/templates/doc.yaml", tt.content)
+			dest, got, err := kappFormat{}.render(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dest != "web/templates/doc.yaml" || got != tt.want {
+				t.Errorf("render() = %s:\n%s\nwant:\n%s", dest, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKappFormatSharesFiles(t *testing.T) {
+	setFlag(t, &format, "kapp")
+	files := render(t, helmOutput(
+		"web/templates/all.yaml", "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: prod\n",
+		"web/templates/all.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\n",
+	))
+	got := files["web/templates/all.yaml"]
+	if !strings.Contains(got, "schelm.io/namespaces\n\n---\napiVersion: v1\nkind: ConfigMap") {
+		t.Errorf("all.yaml doesn't separate the documents like the yaml format:\n%s", got)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Annotations of the KRM function specification carrying an object's file layout.
+const (
+	krmPathAnnotation         = "config.kubernetes.io/path"
+	krmIndexAnnotation        = "config.kubernetes.io/index"
+	krmInternalAnnotationsPfx = "internal.config.kubernetes.io/"
+	krmInternalPathAnnotation = krmInternalAnnotationsPfx + "path"
+)
+
+var (
+	krmInput  bool // Whether stdin is a KRM ResourceList instead of helm output
+	krmOutput bool // Whether to write a KRM ResourceList to stdout
+)
+
+func init() {
+	flag.BoolVar(&krmInput, "krm-input", false, "Read a KRM ResourceList from stdin instead of helm output, taking each item's Source from its config.kubernetes.io/path annotation")
+	flag.BoolVar(&krmOutput, "krm-output", false, "Write the split documents to stdout as a KRM ResourceList annotated with their paths; OUTPUT_DIR becomes optional")
+}
+
+// processResourceList reads a KRM ResourceList from r and hands every item to w.
+// Items without a path annotation are named after their kind and name.
+func processResourceList(r io.Reader, w *specWriter) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading ResourceList: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("error parsing ResourceList: %w", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return fmt.Errorf("input is not a ResourceList")
+	}
+	root := doc.Content[0]
+	if kind := lookupNode(root, "kind"); kind == nil || kind.Value != "ResourceList" {
+		return fmt.Errorf("input is not a ResourceList")
+	}
+
+	items := lookupNode(root, "items")
+	if items == nil {
+		return nil
+	}
+	if items.Kind != yaml.SequenceNode {
+		return fmt.Errorf("ResourceList items must be a list")
+	}
+	for index, item := range items.Content {
+		source := krmItemPath(item)
+		removeKRMAnnotations(item)
+		content, err := encodeYAML(item)
+		if err != nil {
+			return fmt.Errorf("error encoding ResourceList item %d: %w", index, err)
+		}
+		if err := w.write(newSpec(source, content), index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// krmItemPath returns the file an item belongs to according to its annotations.
+func krmItemPath(item *yaml.Node) string {
+	for _, key := range []string{krmPathAnnotation, krmInternalPathAnnotation} {
+		if n := lookupNode(item, "metadata", "annotations", key); n != nil && n.Value != "" {
+			return path.Clean(n.Value)
+		}
+	}
+	kind := strings.ToLower(scalarField(item, "kind"))
+	name := scalarField(item, "metadata", "name")
+	if kind == "" {
+		kind = "resource"
+	}
+	if name == "" {
+		return kind + ".yaml"
+	}
+	return kind + "_" + name + ".yaml"
+}
+
+// removeKRMAnnotations strips the layout annotations a KRM orchestrator adds, dropping
+// the annotations mapping altogether if nothing else is left in it.
+func removeKRMAnnotations(item *yaml.Node) {
+	metadata := lookupNode(item, "metadata")
+	annotations := lookupNode(metadata, "annotations")
+	if annotations == nil || annotations.Kind != yaml.MappingNode {
+		return
+	}
+	var kept []*yaml.Node
+	for i := 0; i+1 < len(annotations.Content); i += 2 {
+		key := annotations.Content[i].Value
+		if key == krmPathAnnotation || key == krmIndexAnnotation || strings.HasPrefix(key, krmInternalAnnotationsPfx) {
+			continue
+		}
+		kept = append(kept, annotations.Content[i], annotations.Content[i+1])
+	}
+	annotations.Content = kept
+	if len(kept) == 0 {
+		deleteKey(metadata, "annotations")
+	}
+}
+
+// writeResourceList writes the documents in specs to out as a ResourceList whose items
+// are annotated with the file, and position within it, they were written to.
+func writeResourceList(out io.Writer, specs []*spec) error {
+	items := &yaml.Node{Kind: yaml.SequenceNode}
+	positions := make(map[string]int)
+	for _, s := range specs {
+		root, err := s.root()
+		if err != nil {
+			return err
+		}
+		if root == nil {
+			continue
+		}
+		item := cloneNode(root)
+		setAnnotation(item, krmPathAnnotation, s.dest)
+		setAnnotation(item, krmIndexAnnotation, strconv.Itoa(positions[s.dest]))
+		positions[s.dest]++
+		items.Content = append(items.Content, item)
+	}
+
+	list := &yaml.Node{Kind: yaml.MappingNode}
+	setKey(list, "apiVersion", scalarNode("config.kubernetes.io/v1"))
+	setKey(list, "kind", scalarNode("ResourceList"))
+	setKey(list, "items", items)
+	content, err := encodeYAML(list)
+	if err != nil {
+		return fmt.Errorf("error encoding ResourceList: %w", err)
+	}
+	_, err = io.WriteString(out, content)
+	return err
+}
+
+// encodeYAML renders n with the two-space indentation used by kubectl and helm.
+func encodeYAML(n *yaml.Node) (string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(n); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
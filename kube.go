@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Connection options shared by every feature that talks to a cluster.
+var (
+	kubeconfig            string // kubeconfig file, defaulting to $KUBECONFIG and then ~/.kube/config
+	kubeContext           string // kubeconfig context, defaulting to the current one
+	insecureSkipTLSVerify bool   // Whether to skip verifying the API server's certificate
+)
+
+func init() {
+	flag.StringVar(&kubeconfig, "kubeconfig", "", "Kubeconfig file for the features that talk to a cluster (default: $KUBECONFIG, then ~/.kube/config)")
+	flag.StringVar(&kubeContext, "context", "", "Kubeconfig context for the features that talk to a cluster (default: the current context)")
+	flag.BoolVar(&insecureSkipTLSVerify, "insecure-skip-tls-verify", false, "Don't verify the API server's certificate when talking to a cluster")
+}
+
+// requireKubectl checks that kubectl, which schelm drives for everything that needs a
+// cluster, is installed and that an explicit -kubeconfig exists.
+func requireKubectl() error {
+	if _, err := exec.LookPath("kubectl"); err != nil {
+		return fmt.Errorf("kubectl is required to talk to the cluster: %w", err)
+	}
+	if kubeconfig != "" {
+		if _, err := os.Stat(kubeconfig); err != nil {
+			return fmt.Errorf("invalid -kubeconfig: %w", err)
+		}
+	}
+	return nil
+}
+
+// kubectlConnectionArgs returns the kubectl flags selecting the cluster. Without
+// -kubeconfig kubectl itself falls back to $KUBECONFIG and ~/.kube/config.
+func kubectlConnectionArgs() []string {
+	var args []string
+	if kubeconfig != "" {
+		args = append(args, "--kubeconfig", kubeconfig)
+	}
+	if kubeContext != "" {
+		args = append(args, "--context", kubeContext)
+	}
+	if insecureSkipTLSVerify {
+		args = append(args, "--insecure-skip-tls-verify")
+	}
+	return args
+}
+
+// kubectl runs kubectl with args against the selected cluster, feeding it stdin, and
+// returns its output. A failure carries kubectl's error message.
+func kubectl(stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("kubectl", append(kubectlConnectionArgs(), args...)...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return out, errors.New(msg)
+		}
+		return out, fmt.Errorf("kubectl %s: %w", args[0], err)
+	}
+	return out, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+const (
+	kustomizeBaseDir     = "base"
+	kustomizeOverlaysDir = "overlays"
+	kustomizationFile    = "kustomization.yaml"
+	kustomizationHeader  = "apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\n"
+)
+
+// parseOverlayNames splits the --overlays value into overlay directory names.
+// Names must be usable as a single path component and must not clash with the base.
+func parseOverlayNames(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+			return nil, fmt.Errorf("overlay names cannot be empty")
+		case name == "." || name == ".." || strings.ContainsAny(name, `/\`):
+			return nil, fmt.Errorf("invalid overlay name %q", name)
+		case seen[name]:
+			return nil, fmt.Errorf("duplicate overlay name %q", name)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// writeKustomizeLayout writes base/kustomization.yaml listing the rendered files and
+// an overlays/<name>/kustomization.yaml for every overlay, each pointing at the base.
+func writeKustomizeLayout(sink split.Sink, resources []string, overlayNames []string) error {
+	var base strings.Builder
+	base.WriteString(kustomizationHeader)
+	base.WriteString("resources:\n")
+	for _, resource := range resources {
+		fmt.Fprintf(&base, "  - %s\n", resource)
+	}
+	if err := sink.CreateOrAppend(path.Join(kustomizeBaseDir, kustomizationFile), []byte(base.String())); err != nil {
+		return err
+	}
+
+	overlay := kustomizationHeader + "resources:\n  - ../../" + kustomizeBaseDir + "\n"
+	for _, name := range overlayNames {
+		if err := sink.CreateOrAppend(path.Join(kustomizeOverlaysDir, name, kustomizationFile), []byte(overlay)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
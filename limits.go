@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+var (
+	maxResources int    // Maximum number of documents, 0 for no limit
+	maxTotalSize string // Maximum combined document size, e.g. "50MiB"; empty for no limit
+	limitsAction string // What to do when a limit is exceeded: error or warn
+)
+
+func init() {
+	flag.IntVar(&maxResources, "max-resources", 0, "Fail when the input contains more than this many documents (0 disables the limit)")
+	flag.StringVar(&maxTotalSize, "max-total-size", "", "Fail when the documents add up to more than this size, e.g. 500K, 50MiB or 1G")
+	flag.StringVar(&limitsAction, "limits-action", "error", "What to do when -max-resources or -max-total-size is exceeded: error or warn")
+}
+
+// parseByteSize parses sizes like 1024, 500K, 50MB or 2GiB. Units are binary, so
+// K, KB and KiB all mean 1024 bytes.
+func parseByteSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	multiplier := int64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return n * multiplier, nil
+}
+
+// limitsHook returns a hook counting documents and bytes as they stream through and
+// failing, or warning once, when either limit is exceeded. Zero disables a limit.
+func limitsHook(maxDocs int, maxBytes int64, warnOnly bool) split.DocumentHook {
+	var docs int
+	var total int64
+	var warnedDocs, warnedBytes bool
+	return func(meta split.DocMeta, content []byte) ([]byte, error) {
+		docs++
+		total += int64(len(content))
+		if maxDocs > 0 && docs > maxDocs && !warnedDocs {
+			if !warnOnly {
+				return nil, fmt.Errorf("input exceeds -max-resources %d", maxDocs)
+			}
+			log.Printf("Warning: input exceeds -max-resources %d", maxDocs)
+			warnedDocs = true
+		}
+		if maxBytes > 0 && total > maxBytes && !warnedBytes {
+			if !warnOnly {
+				return nil, fmt.Errorf("input exceeds -max-total-size of %d bytes", maxBytes)
+			}
+			log.Printf("Warning: input exceeds -max-total-size of %d bytes", maxBytes)
+			warnedBytes = true
+		}
+		return content, nil
+	}
+}
+
+// newLimitsHook builds the hook for the -max-* flags, or returns nil if no limit is set.
+func newLimitsHook() (split.DocumentHook, error) {
+	var maxBytes int64
+	if maxTotalSize != "" {
+		n, err := parseByteSize(maxTotalSize)
+		if err != nil {
+			return nil, fmt.Errorf("-max-total-size: %w", err)
+		}
+		maxBytes = n
+	}
+	if maxResources < 0 {
+		return nil, fmt.Errorf("-max-resources cannot be negative")
+	}
+	var warnOnly bool
+	switch limitsAction {
+	case "error":
+	case "warn":
+		warnOnly = true
+	default:
+		return nil, fmt.Errorf("invalid -limits-action %q (expected error or warn)", limitsAction)
+	}
+	if maxResources == 0 && maxBytes == 0 {
+		return nil, nil
+	}
+	return limitsHook(maxResources, maxBytes, warnOnly), nil
+}
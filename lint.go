@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severities of lint rules, ordered from least to most severe.
+var lintSeverities = []string{"low", "medium", "high"}
+
+// lintPenalty is how many points a finding of each severity costs a workload's score.
+var lintPenalty = map[string]int{"low": 5, "medium": 15, "high": 30}
+
+var (
+	lintEnabled bool   // Whether to run the best-practices lint pass
+	lintFailOn  string // Lowest lint severity that fails the run, or "none"
+)
+
+func init() {
+	flag.BoolVar(&lintEnabled, "lint", false, "Lint workloads for best practices (limits, image tags, probes, host access, root) and print a score per workload")
+	flag.StringVar(&lintFailOn, "lint-fail-on", "none", "Fail the run on lint findings of this severity or higher: low, medium, high or none")
+}
+
+// lintIssue is a single best-practice violation found in a workload.
+type lintIssue struct {
+	rule     string
+	severity string
+	message  string
+}
+
+// lintWorkload applies every rule to the pod spec of a workload.
+func lintWorkload(kind string, pod *yaml.Node) []lintIssue {
+	var issues []lintIssue
+	add := func(rule, severity, format string, args ...interface{}) {
+		issues = append(issues, lintIssue{rule, severity, fmt.Sprintf(format, args...)})
+	}
+
+	for _, key := range []string{"hostNetwork", "hostPID", "hostIPC"} {
+		if isTrue(lookupNode(pod, key)) {
+			add("host-access", "high", "pod uses %s", key)
+		}
+	}
+	podNonRoot := isTrue(lookupNode(pod, "securityContext", "runAsNonRoot"))
+	podUser := scalarField(pod, "securityContext", "runAsUser")
+
+	// Jobs run to completion, so they don't need liveness and readiness probes.
+	longRunning := kind != "Job" && kind != "CronJob"
+
+	all := append(containers(pod, "initContainers"), containers(pod, "containers")...)
+	initCount := len(containers(pod, "initContainers"))
+	for i, c := range all {
+		name := scalarField(c, "name")
+		isInit := i < initCount
+
+		image := scalarField(c, "image")
+		if !strings.Contains(image, "@") {
+			tag := ""
+			if slash, colon := strings.LastIndex(image, "/"), strings.LastIndex(image, ":"); colon > slash {
+				tag = image[colon+1:]
+			}
+			if tag == "" || tag == "latest" {
+				add("image-tag", "high", "container %s uses image %q without a pinned tag", name, image)
+			}
+		}
+
+		limits := lookupNode(c, "resources", "limits")
+		for _, resource := range []string{"cpu", "memory"} {
+			if lookupNode(limits, resource) == nil {
+				add("resource-limits", "medium", "container %s has no %s limit", name, resource)
+			}
+		}
+		requests := lookupNode(c, "resources", "requests")
+		if lookupNode(requests, "cpu") == nil || lookupNode(requests, "memory") == nil {
+			add("resource-requests", "low", "container %s does not request both cpu and memory", name)
+		}
+
+		if longRunning && !isInit {
+			for _, probe := range []string{"livenessProbe", "readinessProbe"} {
+				if lookupNode(c, probe) == nil {
+					add("probes", "medium", "container %s has no %s", name, probe)
+				}
+			}
+		}
+
+		if isTrue(lookupNode(c, "securityContext", "privileged")) {
+			add("privileged", "high", "container %s runs privileged", name)
+		}
+		user := scalarField(c, "securityContext", "runAsUser")
+		if user == "" {
+			user = podUser
+		}
+		nonRoot := podNonRoot
+		if n := lookupNode(c, "securityContext", "runAsNonRoot"); n != nil {
+			nonRoot = isTrue(n)
+		}
+		if user == "0" || user == "" && !nonRoot {
+			add("run-as-root", "high", "container %s may run as root (set runAsNonRoot or a non-zero runAsUser)", name)
+		}
+	}
+	return issues
+}
+
+// lintCheck lints every workload, printing a score out of 100 for each, and reports
+// issues at or above failOn as errors and the rest as warnings.
+func lintCheck(failOn string) check {
+	failLevel := severityRank(failOn)
+	return func(specs []*spec) []finding {
+		var findings []finding
+		for _, s := range specs {
+			pod := podSpec(s)
+			if pod == nil {
+				continue
+			}
+			issues := lintWorkload(s.kind(), pod)
+			score := 100
+			for _, issue := range issues {
+				score -= lintPenalty[issue.severity]
+				severity := severityWarning
+				if failLevel >= 0 && severityRank(issue.severity) >= failLevel {
+					severity = severityError
+				}
+				findings = append(findings, finding{
+					spec:     s,
+					check:    "lint/" + issue.rule,
+					severity: severity,
+					message:  issue.severity + ": " + issue.message,
+				})
+			}
+			if score < 0 {
+				score = 0
+			}
+			log.Printf("Lint score %3d/100 for %s in %s (%d issues)", score, resourceName(s), s.dest, len(issues))
+		}
+		return findings
+	}
+}
+
+// severityRank returns the position of a lint severity, or -1 for "none" and unknown values.
+func severityRank(severity string) int {
+	for i, s := range lintSeverities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// newLintCheck builds the check for the -lint flags.
+func newLintCheck() (check, error) {
+	if lintFailOn != "none" && severityRank(lintFailOn) < 0 {
+		return nil, fmt.Errorf("invalid -lint-fail-on %q (expected low, medium, high or none)", lintFailOn)
+	}
+	return lintCheck(lintFailOn), nil
+}
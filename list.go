@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+var (
+	decodeSecrets bool // Whether schelm list prints the decoded values of Secrets
+	secretMaxSize int  // Decoded Secret values longer than this are redacted
+)
+
+func init() {
+	flag.BoolVar(&decodeSecrets, "decode-secrets", false, "With schelm list, print the base64-decoded keys and values of Secrets to the terminal (never written to files)")
+	flag.IntVar(&secretMaxSize, "secret-max-size", 256, "With -decode-secrets, redact values larger than this many bytes")
+}
+
+// listMain implements "schelm list [options]": it splits the helm output read from
+// stdin in memory and prints the documents each file would hold.
+func listMain(args []string) int {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return 2
+	}
+	if flag.NArg() != 0 {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: schelm list [options]")
+		flag.PrintDefaults()
+		return 2
+	}
+	if err := runList(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runList writes a table of the rendered documents to stdout.
+func runList(stdin io.Reader, stdout io.Writer) error {
+	if format != "yaml" {
+		return errors.New("schelm list requires -format yaml")
+	}
+	files, err := renderInMemory(stdin)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tKIND\tNAME\tNAMESPACE")
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		docs, err := decodeDocuments(files[name])
+		if err != nil {
+			fmt.Fprintf(tw, "%s\t(not YAML)\t\t\n", name)
+			continue
+		}
+		for _, id := range docs.ids {
+			doc, _ := docs.byID[id].(map[string]any)
+			meta, _ := doc["metadata"].(map[string]any)
+			kind, _ := doc["kind"].(string)
+			fmt.Fprintf(tw, "%s\t%s\t%v\t%v\n", name, kind, valueOr(meta["name"], "-"), valueOr(meta["namespace"], "-"))
+			if decodeSecrets && kind == "Secret" {
+				writeSecretValues(tw, doc)
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+// writeSecretValues prints the decoded data and the stringData of a Secret, one key
+// per line, redacting large and binary values.
+func writeSecretValues(w io.Writer, secret map[string]any) {
+	values := make(map[string][]byte)
+	data, _ := secret["data"].(map[string]any)
+	for key, value := range data {
+		encoded, _ := value.(string)
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			fmt.Fprintf(w, "\t  %s\t<invalid base64>\t\n", key)
+			continue
+		}
+		values[key] = decoded
+	}
+	stringData, _ := secret["stringData"].(map[string]any)
+	for key, value := range stringData {
+		values[key] = []byte(fmt.Sprint(value))
+	}
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		value := values[key]
+		var shown string
+		switch {
+		case len(value) > secretMaxSize:
+			shown = fmt.Sprintf("<redacted, %d bytes>", len(value))
+		case !utf8.Valid(value):
+			shown = fmt.Sprintf("<binary, %d bytes>", len(value))
+		default:
+			shown = strconv.Quote(string(value))
+		}
+		fmt.Fprintf(w, "\t  %s\t%s\t\n", key, shown)
+	}
+}
+
+// valueOr returns v, or fallback when it is nil or empty.
+func valueOr(v any, fallback string) any {
+	if v == nil || v == "" {
+		return fallback
+	}
+	return v
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// literalStyle describes how a configuration language spells object and list literals,
+// so a document tree can be written as HCL, Jsonnet or CUE by the same walker.
+type literalStyle struct {
+	language string
+	assign   string              // between an object key and its value
+	fieldEnd string              // after every object field, before the newline
+	key      func(string) string // renders an object key
+	str      func(string) string // renders a string value
+}
+
+// writeLiteral writes n in the given style, indenting nested literals by depth levels.
+func writeLiteral(b *strings.Builder, style literalStyle, n *yaml.Node, depth int) error {
+	n = resolveAlias(n)
+	indent := strings.Repeat("  ", depth+1)
+	closing := strings.Repeat("  ", depth)
+	switch n.Kind {
+	case yaml.MappingNode:
+		if len(n.Content) == 0 {
+			b.WriteString("{}")
+			return nil
+		}
+		b.WriteString("{\n")
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			b.WriteString(indent)
+			b.WriteString(style.key(n.Content[i].Value))
+			b.WriteString(style.assign)
+			if err := writeLiteral(b, style, n.Content[i+1], depth+1); err != nil {
+				return err
+			}
+			b.WriteString(style.fieldEnd + "\n")
+		}
+		b.WriteString(closing + "}")
+	case yaml.SequenceNode:
+		if len(n.Content) == 0 {
+			b.WriteString("[]")
+			return nil
+		}
+		b.WriteString("[\n")
+		for _, item := range n.Content {
+			b.WriteString(indent)
+			if err := writeLiteral(b, style, item, depth+1); err != nil {
+				return err
+			}
+			b.WriteString(",\n")
+		}
+		b.WriteString(closing + "]")
+	case yaml.ScalarNode:
+		v, err := scalarValue(n)
+		if err != nil {
+			return err
+		}
+		switch v := v.(type) {
+		case nil:
+			b.WriteString("null")
+		case bool:
+			b.WriteString(strconv.FormatBool(v))
+		case string:
+			b.WriteString(style.str(v))
+		default:
+			num, ok := formatNumber(v)
+			if !ok {
+				return fmt.Errorf("line %d: %s cannot be represented in %s", n.Line, n.Value, style.language)
+			}
+			b.WriteString(num)
+		}
+	default:
+		return fmt.Errorf("line %d: unsupported YAML node", n.Line)
+	}
+	return nil
+}
+
+// quoteString quotes s as a double-quoted string literal using JSON escapes,
+// which HCL, Jsonnet and CUE all accept.
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// isIdentifier reports whether s is a letter or underscore followed by letters,
+// digits and underscores, optionally allowing dashes after the first character.
+func isIdentifier(s string, allowDash bool) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		letter := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_'
+		if !letter && (i == 0 || !(r >= '0' && r <= '9' || allowDash && r == '-')) {
+			return false
+		}
+	}
+	return true
+}
+
+// specIdentifier derives an identifier from the document's kind, namespace and name,
+// falling back to the Source file name for documents without metadata.
+func specIdentifier(s *spec) string {
+	var parts []string
+	for _, p := range []string{s.kind(), s.namespace(), s.name()} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		parts = append(parts, strings.TrimSuffix(path.Base(s.source), path.Ext(s.source)))
+	}
+	return sanitizeIdentifier(strings.Join(parts, "_"))
+}
+
+// identifierSet hands out identifiers that are unique within a scope.
+type identifierSet map[string]map[string]bool
+
+// claim returns base, or base with a numeric suffix if it is already taken in scope.
+func (u identifierSet) claim(scope, base string) string {
+	used := u[scope]
+	if used == nil {
+		used = make(map[string]bool)
+		u[scope] = used
+	}
+	name := base
+	for i := 2; used[name]; i++ {
+		name = base + "_" + strconv.Itoa(i)
+	}
+	used[name] = true
+	return name
+}
+
+// sanitizeIdentifier lowercases s and replaces everything but letters, digits and
+// underscores, making sure the result starts with a letter or underscore.
+func sanitizeIdentifier(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	id := b.String()
+	if id == "" || id[0] >= '0' && id[0] <= '9' {
+		id = "_" + id
+	}
+	return id
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"bromaniac.github.com/schelm/split"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	maxPathLength int    // Longest destination path below OUTPUT_DIR before it is shortened
+	pathMapFile   string // File recording the shortened paths
+)
+
+func init() {
+	flag.IntVar(&maxPathLength, "max-path", 0, "Shorten destination paths longer than this many bytes below OUTPUT_DIR by replacing their directories with a hash, e.g. 200 to keep deep umbrella charts under the 260 character limit of Windows checkouts (0: no limit)")
+	flag.StringVar(&pathMapFile, "path-map", "", "With -max-path, write the shortened paths and the paths they stand for to this YAML file")
+}
+
+// pathShortener shortens destinations over the -max-path, one path at a time:
+// the files of a directory that fit stay where they are, and the hash standing
+// for the directory depends on it alone, so the long ones mostly share one short
+// directory, unless their names are too long to keep its first component.
+type pathShortener struct {
+	max      int
+	original map[string]string // shortened path -> original path
+}
+
+func newPathShortener(limit int) *pathShortener {
+	return &pathShortener{max: limit, original: make(map[string]string)}
+}
+
+// shorten returns dest, or if it is too long the first component of dest, a hash
+// of its directory and its file name, cut to fit if need be.
+func (p *pathShortener) shorten(dest string) string {
+	if p.max <= 0 || len(dest) <= p.max {
+		return dest
+	}
+	dir, file := path.Split(dest)
+	sum := sha256.Sum256([]byte(dir))
+	hash := "~" + hex.EncodeToString(sum[:4])
+	first, _, _ := strings.Cut(dir, "/")
+	short := path.Join(first, hash, file)
+	if len(short) > p.max {
+		short = path.Join(hash, file)
+	}
+	if len(short) > p.max {
+		// Cut the file name too, keeping its extension and telling files apart by hash.
+		fileSum := sha256.Sum256([]byte(file))
+		ext := path.Ext(file)
+		keep := max(p.max-len(hash)-len(ext)-10, 0)
+		for keep > 0 && !utf8.RuneStart(file[keep]) {
+			keep--
+		}
+		stem := file[:keep]
+		short = path.Join(hash, stem+"-"+hex.EncodeToString(fileSum[:4])+ext)
+	}
+	if _, ok := p.original[short]; !ok {
+		log.Printf("Shortening %s to %s", dest, short)
+		p.original[short] = dest
+	}
+	return short
+}
+
+// writeMap writes the shortened paths to file.
+func (p *pathShortener) writeMap(fsys split.FS, file string) error {
+	data, err := yaml.Marshal(p.original)
+	if err != nil {
+		return err
+	}
+	header := "# Paths shortened by schelm -max-path, and the paths they stand for\n"
+	if err := fsys.WriteFile(file, append([]byte(header), data...), filePermissions); err != nil {
+		return fmt.Errorf("error writing path map %s: %w", file, err)
+	}
+	return nil
+}
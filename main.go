@@ -3,65 +3,100 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"os"
 	"path"
 	"strings"
+	"time"
+
+	"bromaniac.github.com/schelm/split"
 )
 
 // Constants for file permissions and the YAML separator
 const (
-	dirPermissions  os.FileMode = 0750
-	filePermissions os.FileMode = 0640
-	yamlSeparator               = "---\n# Source: "
-	bufferSize                  = 1048576 // 1MB buffer for scanner
+	dirPermissions  = split.DirPermissions
+	filePermissions = split.FilePermissions
+	yamlSeparator   = split.Separator
+	bufferSize      = split.MaxDocumentSize // largest document the scanner reads
+)
+
+var (
+	force       bool   // Flag to force deletion of existing output directory
+	overlays    string // Comma-separated kustomize overlay names to generate
+	format      string // Output format the documents are converted to
+	archivePath string // Archive to write instead of an output directory
+	destURL     string // Object storage location to write instead of an output directory
 )
 
-var force bool // Flag to force deletion of existing output directory
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ", ") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
 
 func init() {
 	flag.BoolVar(&force, "f", false, "Overwrite existing output directory")
+	flag.StringVar(&format, "format", "yaml", "Output format: yaml, terraform, jsonnet, cue, kapp (yaml annotated with kapp change groups and rules) or pulumi (yaml plus a Pulumi YAML program of the resources)")
+	flag.StringVar(&archivePath, "archive", "", "Write the output to a .tar, .tar.gz/.tgz or .zip archive instead of OUTPUT_DIR")
+	flag.StringVar(&destURL, "dest", "", "Upload the output to s3://bucket/prefix, gs://bucket/prefix or azblob://container/prefix instead of OUTPUT_DIR")
+	flag.StringVar(&overlays, "overlays", "", "Comma-separated overlay names; writes manifests to base/ and generates kustomize overlays")
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: schelm [options] OUTPUT_DIR\n")
+		fmt.Fprintf(os.Stderr, "Usage: schelm [options] OUTPUT_DIR\n       schelm [options] -chart CHART OUTPUT_DIR\n       schelm [options] -archive FILE\n       schelm [options] -dest URL\n       schelm [options] -krm-output [OUTPUT_DIR]\n       schelm browse [options]\n       schelm daemon [options] [-config FILE]\n       schelm diff [options] OUTPUT_DIR\n       schelm diff-streams [options] OLD.yaml NEW.yaml\n       schelm drift [options] OUTPUT_DIR\n       schelm hook [options] [-config FILE] [FILE...]\n       schelm list [options]\n       schelm restore [-session ID] [PATH...]\n       schelm self-update [-check] [-version TAG] [-insecure]\n       schelm selftest [options] CHART\n       schelm serve [options] [-listen ADDR] OUTPUT_ROOT\n       schelm verify [options] [-update] GOLDEN_DIR\n       schelm version [-o json]\n")
 		flag.PrintDefaults()
 	}
 }
 
-// scanYamlSpecs is a split function for bufio.Scanner to split input by the custom YAML separator.
-func scanYamlSpecs(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	if atEOF && len(data) == 0 {
-		return 0, nil, nil
-	}
-	// Use the constant defined above
-	separatorBytes := []byte(yamlSeparator)
-	if i := bytes.Index(data, separatorBytes); i >= 0 {
-		// We found a separator. Return the data before it.
-		return i + len(separatorBytes), data[0:i], nil
-	}
-	// If we're at EOF, we have a final, non-terminated line. Return it.
-	if atEOF {
-		return len(data), data, nil
-	}
-	// Request more data.
-	return 0, nil, nil
-}
-
-func splitSpec(token string) (string, string) {
-	if i := strings.Index(token, "\n"); i >= 0 {
-		return token[0:i], token[i+1:]
-	}
-	// If no newline is found, it's likely an incomplete token or the last part.
-	// For simplicity, we'll assume valid input structure where source is always present.
-	// A more robust implementation might handle malformed tokens differently.
-	return token, "" // Return the whole token as source if no newline
+// slashSource converts the backslash separators of a Source written on Windows,
+// such as mychart\templates\deployment.yaml, to forward slashes.
+func slashSource(source string) string {
+	return strings.ReplaceAll(source, `\`, "/")
 }
 
 // parseFlagsAndArgs parses command-line flags and arguments.
-// It returns the output directory path or an error.
+// It returns the output directory path, which is empty when writing an archive or
+// uploading to object storage, or an error.
 func parseFlagsAndArgs() (string, error) {
 	flag.Parse()
+	if showVersion {
+		return "", nil
+	}
+	if archivePath != "" && destURL != "" {
+		flag.Usage()
+		return "", fmt.Errorf("-archive and -dest cannot be combined")
+	}
+	if destURL != "" && !isBlobURL(destURL) {
+		flag.Usage()
+		return "", fmt.Errorf("-dest must be an s3://, gs:// or azblob:// URL")
+	}
+	if archivePath != "" || destURL != "" {
+		if flag.NArg() != 0 {
+			flag.Usage()
+			return "", fmt.Errorf("OUTPUT_DIR cannot be combined with -archive or -dest")
+		}
+		return "", nil
+	}
+	// As a KRM function the ResourceList on stdout is the output; files are optional.
+	if krmOutput && flag.NArg() == 0 {
+		return "", nil
+	}
+	// With -stdout the files are printed instead.
+	if sliceStdout {
+		if flag.NArg() != 0 {
+			flag.Usage()
+			return "", fmt.Errorf("OUTPUT_DIR cannot be combined with -stdout")
+		}
+		return "", nil
+	}
 	if flag.NArg() != 1 {
 		flag.Usage()
 		return "", fmt.Errorf("expected exactly one argument: OUTPUT_DIR")
@@ -75,85 +110,223 @@ func parseFlagsAndArgs() (string, error) {
 }
 
 // setupOutputDirectory ensures the output directory exists, creating or clearing it based on the force flag.
-func setupOutputDirectory(outputDir string, force bool) error {
-	stat, err := os.Stat(outputDir)
+// Protected files survive the clearing; they are returned relative to outputDir.
+func setupOutputDirectory(fsys split.FS, outputDir string, force bool, protect protectedFiles) (map[string]bool, error) {
+	var kept map[string]bool
+	stat, err := fsys.Stat(outputDir)
 	if err == nil { // Directory exists
 		if !stat.IsDir() {
-			return fmt.Errorf(`"%s" exists but is not a directory`, outputDir)
+			return nil, fmt.Errorf(`"%s" exists but is not a directory`, outputDir)
 		}
-		if force {
-			log.Printf("Removing existing output directory %s (-f specified)\n", outputDir)
-			if err := os.RemoveAll(outputDir); err != nil {
-				return fmt.Errorf("failed to remove existing directory %s: %w", outputDir, err)
+		if !force {
+			return nil, fmt.Errorf(`output directory "%s" already exists. Use -f to overwrite`, outputDir)
+		}
+		if len(protect) > 0 {
+			log.Printf("Clearing existing output directory %s except protected files (-f specified)\n", outputDir)
+			if kept, err = clearUnprotected(fsys, outputDir, protect); err != nil {
+				return nil, err
 			}
 		} else {
-			return fmt.Errorf(`output directory "%s" already exists. Use -f to overwrite`, outputDir)
+			log.Printf("Removing existing output directory %s (-f specified)\n", outputDir)
+			if err := fsys.RemoveAll(outputDir); err != nil {
+				return nil, fmt.Errorf("failed to remove existing directory %s: %w", outputDir, err)
+			}
 		}
-	} else if !os.IsNotExist(err) {
+	} else if !errors.Is(err, fs.ErrNotExist) {
 		// Another error occurred during Stat
-		return fmt.Errorf("failed to check output directory %s: %w", outputDir, err)
+		return nil, fmt.Errorf("failed to check output directory %s: %w", outputDir, err)
 	}
 
 	// Directory doesn't exist (or was removed), create it.
 	log.Printf("Creating output directory %s\n", outputDir)
-	if err := os.MkdirAll(outputDir, dirPermissions); err != nil {
-		return fmt.Errorf("failed to create output directory %s: %w", outputDir, err)
+	if err := fsys.MkdirAll(outputDir, dirPermissions); err != nil {
+		return nil, fmt.Errorf("failed to create output directory %s: %w", outputDir, err)
 	}
-	return nil
+	return kept, nil
 }
 
-// writeOrAppendSpec writes content to a new file or appends it to an existing one.
-func writeOrAppendSpec(outputDir, source, content string) error {
-	destinationFile := path.Join(outputDir, source)
-	dir := path.Dir(destinationFile)
+// renderResult records what a specWriter wrote.
+type renderResult struct {
+	files []string // distinct destination paths, in the order they were first written
+	specs []*spec  // every document written, in input order
+	// skipped are the Sources that rendered nothing but comments or whitespace.
+	skipped []string
+}
+
+// batchTransform rewrites the documents of a whole render before any of them is
+// written, for changes that depend on other documents.
+type batchTransform func(specs []*spec) ([]*spec, error)
+
+// specWriter runs the document hooks over each spec, converts it to the output
+// format and writes it to the sink, recording the result. With batch transforms
+// the specs are held back until flush.
+type specWriter struct {
+	sink     split.Sink
+	format   outputFormat
+	hooks    []split.DocumentHook
+	mappers  []sourceMapper
+	batch    []batchTransform
+	pending  []*spec
+	result   *renderResult
+	seen     map[string]bool
+	lines    map[string]int // lines written to every destination so far
+	folds    caseFolds
+	sanitize *sanitizer
+	shorten  *pathShortener
+	raw      string          // -raw-documents mode
+	blank    []string        // Sources of blank documents, in input order
+	filled   map[string]bool // Sources of documents that aren't blank
+	// collisions tells the documents of different Sources apart by their Source
+	// before -map and -rewrite.
+	collisions *collisions
+	appends    *appends
+	slashed    map[string]bool // Sources whose backslashes were converted, logged once each
+}
 
-	// Ensure the subdirectory for the file exists
-	if err := os.MkdirAll(dir, dirPermissions); err != nil {
-		return fmt.Errorf("error creating directory %s: %w", dir, err)
+func newSpecWriter(sink split.Sink, f outputFormat, hooks []split.DocumentHook, mappers []sourceMapper, batch []batchTransform) *specWriter {
+	return &specWriter{
+		sink:       sink,
+		format:     f,
+		hooks:      hooks,
+		mappers:    mappers,
+		batch:      batch,
+		result:     &renderResult{},
+		seen:       make(map[string]bool),
+		lines:      make(map[string]int),
+		filled:     make(map[string]bool),
+		folds:      make(caseFolds),
+		sanitize:   newSanitizer(sanitizeMode),
+		shorten:    newPathShortener(maxPathLength),
+		raw:        rawDocumentsMode(),
+		collisions: newCollisions(collisionStrategy),
+		appends:    newAppends(appendStrategy),
+		slashed:    make(map[string]bool),
 	}
+}
 
-	// Check if the file already exists
-	if _, err := os.Stat(destinationFile); os.IsNotExist(err) {
-		// File does not exist, create and write
-		log.Printf("Creating %s", destinationFile)
-		if err := os.WriteFile(destinationFile, []byte(content), filePermissions); err != nil {
-			return fmt.Errorf("error writing new file %s: %w", destinationFile, err)
+// write processes the document found at the given position of the input.
+func (w *specWriter) write(s *spec, index int) error {
+	defer timed("transform")()
+	renderProgress.document()
+	if slashed := slashSource(s.source); slashed != s.source {
+		if !w.slashed[s.source] {
+			w.slashed[s.source] = true
+			log.Printf("Converting the backslashes of Source %s to %s", s.source, slashed)
 		}
-	} else if err == nil {
-		// File exists, append
-		log.Printf("Appending to %s", destinationFile)
-		f, openErr := os.OpenFile(destinationFile, os.O_APPEND|os.O_WRONLY, filePermissions)
-		if openErr != nil {
-			return fmt.Errorf("error opening file %s for appending: %w", destinationFile, openErr)
+		s.source = slashed
+	}
+	source := s.source
+	s, err := applyHooks(s, index, w.hooks)
+	if err != nil {
+		return fmt.Errorf("failed to process spec for source %s: %w", source, err)
+	}
+	if s == nil {
+		log.Printf("Skipping document %d from %s (dropped by hook)", index, source)
+		return nil
+	}
+	s.origin = s.source
+	for _, mapper := range w.mappers {
+		if s.source, err = mapper(s.source); err != nil {
+			return err
 		}
-		defer f.Close() // Ensure file is closed
+	}
+	if len(w.batch) > 0 {
+		w.pending = append(w.pending, s)
+		return nil
+	}
+	return w.emit(s)
+}
 
-		// Add separator before appending new content
-		// Ensure there's exactly one newline before the standard YAML separator '---'
-		// This assumes the previous content might or might not end with a newline.
-		separator := "\n---\n"
-		if !strings.HasSuffix(content, "\n") {
-			separator = "\n" + separator // Add extra newline if content doesn't end with one
+// flush runs the batch transforms over the held back specs and writes them, then
+// writes the documents -append-strategy replace held back.
+func (w *specWriter) flush() error {
+	if len(w.batch) > 0 {
+		specs := w.pending
+		w.pending = nil
+		done := timed("transform")
+		for _, transform := range w.batch {
+			var err error
+			if specs, err = transform(specs); err != nil {
+				done()
+				return err
+			}
 		}
-
-		if _, writeErr := f.WriteString(separator + content); writeErr != nil {
-			return fmt.Errorf("error appending to file %s: %w", destinationFile, writeErr)
+		done()
+		for _, s := range specs {
+			if err := w.emit(s); err != nil {
+				return err
+			}
 		}
-		// Check close error explicitly if needed, though defer handles the call.
-		// if closeErr := f.Close(); closeErr != nil {
-		// 	 return fmt.Errorf("error closing file %s after append: %w", destinationFile, closeErr)
-		// }
-	} else {
-		// Another error occurred during Stat
-		return fmt.Errorf("error checking file %s: %w", destinationFile, err)
+	}
+	defer timed("write")()
+	return w.appends.release(w.seen, func(dest, output string, s *spec) error {
+		if err := w.folds.check(dest, s.source); err != nil {
+			return err
+		}
+		return w.store(dest, output, s)
+	})
+}
+
+// emit converts s to the output format and writes it to the sink.
+func (w *specWriter) emit(s *spec) error {
+	defer timed("write")()
+	if !w.skipBlank(s) || !routeRaw(w.raw, s) {
+		return nil
+	}
+	dest, output, err := w.format.render(s)
+	if err != nil {
+		return fmt.Errorf("failed to process spec for source %s: %w", s.source, err)
+	}
+	if dest == "" {
+		log.Printf("Skipping empty document from %s", s.source)
+		return nil
+	}
+	dest = w.shorten.shorten(w.sanitize.sanitize(dest))
+	if dest, err = w.collisions.resolve(dest, s.origin); err != nil {
+		return err
+	}
+	dest, keep, err := w.appends.place(dest, output, s, w.seen)
+	if err != nil || !keep {
+		return err
+	}
+	if err := w.folds.check(dest, s.source); err != nil {
+		return err
+	}
+	if w.appends.hold(dest, output, s, w.seen) {
+		return nil
+	}
+	return w.store(dest, output, s)
+}
+
+// store writes the output of s to dest and records it.
+func (w *specWriter) store(dest, output string, s *spec) error {
+	// Add the format's separator before appending to a file written earlier
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if w.seen[dest] {
+		buf.WriteString(w.format.separator(output))
+	}
+	separatorLines := strings.Count(buf.String(), "\n")
+	buf.WriteString(output)
+	if err := w.sink.CreateOrAppend(dest, convertLineEndings(buf.Bytes())); err != nil {
+		// Log the specific error and continue processing other specs?
+		// Or return immediately? Returning seems safer for a batch process.
+		return fmt.Errorf("failed to process spec for source %s: %w", s.source, err)
+	}
+	s.dest, s.line = dest, w.lines[dest]+separatorLines+1
+	w.lines[dest] += strings.Count(buf.String(), "\n")
+	w.result.specs = append(w.result.specs, s)
+	if !w.seen[dest] {
+		w.seen[dest] = true
+		w.result.files = append(w.result.files, dest)
 	}
 	return nil
 }
 
-// processInput reads from stdin, splits the content, and writes/appends specs.
-func processInput(outputDir string) error {
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Split(scanYamlSpecs)
+// processInput reads the helm output from r, splits the content and hands every spec to w.
+func processInput(r io.Reader, w *specWriter) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(split.ScanDocuments)
 	// Allow for tokens (specs) up to 1MB in size
 	scanner.Buffer(make([]byte, bufio.MaxScanTokenSize), bufferSize)
 
@@ -166,18 +339,29 @@ func processInput(outputDir string) error {
 		log.Println("Warning: Input stream is empty or contains no separators.")
 		return nil
 	}
+	// Every separator starts a line of its own, followed by the Source line.
+	separatorLine := 1 + strings.Count(scanner.Text(), "\n")
 
 	// Process the rest of the stream
-	for scanner.Scan() {
-		source, content := splitSpec(scanner.Text())
+	for index := 0; ; index++ {
+		done := timed("scan")
+		ok := scanner.Scan()
+		done()
+		if !ok {
+			break
+		}
+		token := scanner.Text()
+		contentLine := separatorLine + 2
+		separatorLine += 1 + strings.Count(token, "\n")
+		source, content := split.ParseDocument(token)
 		if source == "" {
 			log.Println("Warning: Skipping empty source path in input.")
 			continue
 		}
-		if err := writeOrAppendSpec(outputDir, source, content); err != nil {
-			// Log the specific error and continue processing other specs?
-			// Or return immediately? Returning seems safer for a batch process.
-			return fmt.Errorf("failed to process spec for source %s: %w", source, err)
+		s := newSpec(source, content)
+		s.inputLine = contentLine
+		if err := w.write(s, index); err != nil {
+			return err
 		}
 	}
 
@@ -187,25 +371,554 @@ func processInput(outputDir string) error {
 	return nil
 }
 
+// run executes a full split with the parsed options: it prepares the output
+// directory on fsys, processes the helm output read from stdin, or rendered from
+// -chart, and writes any generated extras. Output meant for a pipeline, such as a ResourceList, goes to stdout.
+func run(fsys split.FS, stdin io.Reader, stdout io.Writer, outputDirectory string) error {
+	started := time.Now()
+	stages.durations = nil
+	// 1. Validate the options
+	outFormat, err := newOutputFormat(format)
+	if err != nil {
+		return err
+	}
+	if outFormat, err = newLayoutFormat(outFormat); err != nil {
+		return err
+	}
+	if outFormat, err = newSliceFormat(outFormat); err != nil {
+		return err
+	}
+	overlayNames, err := parseOverlayNames(overlays)
+	if err != nil {
+		return err
+	}
+	if len(overlayNames) > 0 && format != "yaml" {
+		return fmt.Errorf("-overlays requires -format yaml")
+	}
+	if cdk8sScaffold && (format != "yaml" || len(overlayNames) > 0) {
+		return fmt.Errorf("-cdk8s requires -format yaml and cannot be combined with -overlays")
+	}
+	if krmOutput && format != "yaml" {
+		return fmt.Errorf("-krm-output requires -format yaml")
+	}
+	if chartRef == "" && (len(helmValues)+len(helmSet)+len(helmSetString)+len(helmSetFile)+len(helmAPIVersions) > 0 ||
+		helmKubeVersion != "" || helmIncludeCRDs || helmNamespace != "" || chartVersion != "" || dependencyUpdate) {
+		return fmt.Errorf("helm options such as -values, -set, -kube-version and -namespace require -chart")
+	}
+	if valuesSnapshot && chartRef == "" {
+		return fmt.Errorf("-values-snapshot requires -chart")
+	}
+	if krmInput && (chartRef != "" || len(postRenderers) > 0) {
+		return fmt.Errorf("-chart and -post-renderer cannot be combined with -krm-input")
+	}
+	if configMapGenerator && !extractConfigMapData {
+		return fmt.Errorf("-configmap-generator requires -extract-configmap-data")
+	}
+	if versionDirsValue != "" && !versionDirs {
+		return fmt.Errorf("-dir-version requires -version-dirs")
+	}
+	if pathMapFile != "" && maxPathLength <= 0 {
+		return fmt.Errorf("-path-map requires -max-path")
+	}
+	if err := validateSanitizeMode(sanitizeMode); err != nil {
+		return err
+	}
+	if err := validateCollisionStrategy(collisionStrategy); err != nil {
+		return err
+	}
+	if err := validateRawDocuments(rawDocuments); err != nil {
+		return err
+	}
+	if err := validateLineEndings(lineEndings); err != nil {
+		return err
+	}
+	if err := validateAppendStrategy(appendStrategy); err != nil {
+		return err
+	}
+	untouched = nil
+	if configChecksums || normalizeProfile != "" {
+		if untouched, err = loadUntouchedRules(); err != nil {
+			return err
+		}
+	}
+	var sortTransform batchTransform
+	if sortDocs != "" {
+		if sortTransform, err = newSortDocsTransform(sortDocs); err != nil {
+			return err
+		}
+	}
+	if err := validateReportFormat(reportFormat); err != nil {
+		return err
+	}
+	if krmOutput && (resourcesReport || rbacReport || reportFormat != "" && reportFile == "") {
+		return fmt.Errorf("reports printed to stdout cannot be combined with -krm-output, which owns stdout")
+	}
+	if sliceStdout && (krmOutput || resourcesReport || rbacReport || reportFormat != "" && reportFile == "") {
+		return fmt.Errorf("-krm-output and reports printed to stdout cannot be combined with -stdout, which owns stdout")
+	}
+	if sliceStdout && (archivePath != "" || destURL != "") {
+		return fmt.Errorf("-stdout cannot be combined with -archive or -dest")
+	}
+
+	if dedupeHardlink && (archivePath != "" || destURL != "") {
+		return fmt.Errorf("-dedupe-hardlink links files of OUTPUT_DIR and cannot be combined with -archive or -dest")
+	}
+	if mergeEdits && (archivePath != "" || destURL != "") {
+		return fmt.Errorf("-merge merges into OUTPUT_DIR and cannot be combined with -archive or -dest")
+	}
+	if (skaffoldFile != "" || tiltFile != "") && outputDirectory == "" {
+		return fmt.Errorf("-skaffold and -tiltfile list the files of OUTPUT_DIR and cannot be combined with -archive, -dest or -stdout")
+	}
+	if updateOutput && (outputDirectory == "" || force || mergeEdits || protectPatterns != "") {
+		return fmt.Errorf("-update updates OUTPUT_DIR in place and cannot be combined with -f, -merge, -protect, -archive, -dest or -stdout")
+	}
+
+	checks, err := enabledChecks()
+	if err != nil {
+		return err
+	}
+
+	// The limits come first, so transforms cannot hide an exploding render.
+	var hooks []split.DocumentHook
+	limits, err := newLimitsHook()
+	if err != nil {
+		return err
+	}
+	if limits != nil {
+		hooks = append(hooks, limits)
+	}
+	filter, err := newSliceFilterHook()
+	if err != nil {
+		return err
+	}
+	if filter != nil {
+		hooks = append(hooks, filter)
+	}
+	for _, command := range transforms {
+		hooks = append(hooks, transformHook(command))
+	}
+	ctx := context.Background()
+	for _, file := range wasmPlugins {
+		plugin, err := loadWASMPlugin(ctx, file)
+		if err != nil {
+			return err
+		}
+		defer plugin.Close(ctx)
+		hooks = append(hooks, plugin.hook(ctx))
+	}
+	release, err := newReleaseMetadataHook()
+	if err != nil {
+		return err
+	}
+	if release != nil {
+		hooks = append(hooks, release)
+	}
+	if annotateOrigin {
+		hooks = append(hooks, originHook)
+	}
+	// Normalization comes last so whatever the other hooks produce is normalized too.
+	normalize, err := newNormalizeHook()
+	if err != nil {
+		return err
+	}
+	if normalize != nil {
+		hooks = append(hooks, normalize)
+	}
+	canonical, err := newFidelityHook()
+	if err != nil {
+		return err
+	}
+	if canonical != nil {
+		hooks = append(hooks, canonical)
+	}
+
+	// Render the chart before touching the output, so a failing render keeps it intact.
+	var values []byte // -values-snapshot
+	if chartRef != "" {
+		done := timed("chart")
+		stdin, err = renderChart()
+		if err == nil && valuesSnapshot {
+			values, err = computeValues()
+		}
+		done()
+		if err != nil {
+			return err
+		}
+	}
+	if len(postRenderers) > 0 {
+		if stdin, err = runPostRenderers(stdin); err != nil {
+			return err
+		}
+	}
+
+	// 2. Setup output directory, or the archive or bucket replacing it
+	var sink split.Sink
+	var previous map[string][]byte
+	var protector *protectSink
+	var merger *mergeSink
+	var printed *split.MemSink // files -stdout prints
+	if archivePath != "" {
+		if sink, err = split.NewArchiveSink(archivePath, force); err != nil {
+			return err
+		}
+	} else if destURL != "" {
+		if sink, err = newBlobSink(ctx, destURL, force); err != nil {
+			return err
+		}
+	} else if outputDirectory == "" {
+		// Only the ResourceList, or with -stdout the files, is wanted; keep the files in memory.
+		mem := split.NewMemSink()
+		if sliceStdout {
+			printed = mem
+		}
+		sink = mem
+	} else {
+		// The summaries compare against whatever the directory held before this run.
+		if summaryMD != "" || htmlReport != "" {
+			if previous, err = snapshotTree(fsys, outputDirectory); err != nil {
+				return err
+			}
+		}
+		if mergeEdits {
+			if merger, err = newMergeSink(fsys, outputDirectory); err != nil {
+				return err
+			}
+		}
+		clearFS := fsys
+		if trashFiles {
+			clearFS = newTrashFS(fsys)
+		}
+		if updateOutput {
+			if sink, err = newUpdateSink(fsys, clearFS, outputDirectory); err != nil {
+				return err
+			}
+		} else {
+			kept, err := setupOutputDirectory(clearFS, outputDirectory, force || mergeEdits, parseProtectPatterns(protectPatterns))
+			if err != nil {
+				return err
+			}
+			sink = split.NewFSSink(fsys, outputDirectory)
+			if merger != nil {
+				// Protected files are never rewritten, so there is nothing to merge into them.
+				for name := range kept {
+					delete(merger.edited, name)
+				}
+				merger.Sink = sink
+				sink = merger
+			}
+			if len(kept) > 0 {
+				protector = &protectSink{Sink: sink, existing: kept}
+				sink = protector
+			}
+		}
+	}
+
+	if contentAddressed {
+		sink = newContentSink(sink)
+	}
+
+	var recorder *recordingSink
+	if summaryMD != "" || htmlReport != "" || statsFile != "" {
+		recorder = newRecordingSink(sink)
+		sink = recorder
+	}
+
+	// With overlays the rendered manifests become the kustomize base; a cdk8s
+	// project keeps them next to its app.
+	specsSink, manifestsDir := sink, outputDirectory
+	if len(overlayNames) > 0 {
+		specsSink, manifestsDir = split.SubdirSink{Sink: sink, Dir: kustomizeBaseDir}, path.Join(outputDirectory, kustomizeBaseDir)
+	} else if cdk8sScaffold {
+		specsSink, manifestsDir = split.SubdirSink{Sink: sink, Dir: cdk8sManifestsDir}, path.Join(outputDirectory, cdk8sManifestsDir)
+	}
+
+	// 3. Process the input stream, either helm output or a KRM ResourceList
+	var mappers []sourceMapper
+	for _, rule := range sourceRewrites {
+		mapper, err := parseRewrite(rule)
+		if err != nil {
+			return err
+		}
+		mappers = append(mappers, mapper)
+	}
+	if sourceMapFile != "" {
+		mapper, err := loadSourceMap(sourceMapFile)
+		if err != nil {
+			return err
+		}
+		mappers = append(mappers, mapper)
+	}
+	if byChart {
+		mappers = append(mappers, chartRoute)
+	}
+	var batch []batchTransform
+	if versionDirs {
+		batch = append(batch, versionDirsTransform)
+	}
+	if namePrefix != "" || nameSuffix != "" {
+		batch = append(batch, nameAffixTransform)
+	}
+	if configChecksums {
+		batch = append(batch, configChecksumTransform)
+	}
+	if sortTransform != nil {
+		batch = append(batch, sortTransform)
+	}
+	if interactive {
+		batch = append(batch, interactiveTransform)
+	}
+	writer := newSpecWriter(specsSink, outFormat, hooks, mappers, batch)
+	if krmInput {
+		err = processResourceList(stdin, writer)
+	} else {
+		err = processInput(stdin, writer)
+	}
+	if err != nil {
+		return err
+	}
+	if err := writer.flush(); err != nil {
+		return err
+	}
+	result := writer.result
+	result.skipped = writer.skippedSources()
+
+	// 4. Let the format write its own extras, then any requested project layout
+	if finisher, ok := outFormat.(formatFinisher); ok {
+		if err := finisher.finish(specsSink, result.files); err != nil {
+			return err
+		}
+	}
+	if len(overlayNames) > 0 {
+		if err := writeKustomizeLayout(sink, result.files, overlayNames); err != nil {
+			return err
+		}
+	}
+	if cdk8sScaffold {
+		if err := writeCdk8sScaffold(sink, result); err != nil {
+			return err
+		}
+	}
+	if extractCRDSchemas {
+		if err := writeCRDSchemas(sink, result.specs); err != nil {
+			return err
+		}
+	}
+	if extractConfigMapData {
+		if err := writeConfigMapData(sink, result.specs, configMapGenerator); err != nil {
+			return err
+		}
+	}
+	if values != nil {
+		if err := sink.CreateOrAppend(valuesSnapshotFile, values); err != nil {
+			return fmt.Errorf("error writing %s: %w", valuesSnapshotFile, err)
+		}
+	}
+	if krmOutput {
+		if err := writeResourceList(stdout, result.specs); err != nil {
+			return err
+		}
+	}
+	done := timed("write")
+	err = split.Close(sink)
+	done()
+	if err != nil {
+		return err
+	}
+	if printed != nil {
+		if err := printFiles(stdout, printed); err != nil {
+			return err
+		}
+	}
+	if dedupeHardlink && outputDirectory != "" {
+		if _, ok := fsys.(split.OSFS); !ok {
+			return fmt.Errorf("-dedupe-hardlink requires OUTPUT_DIR on the local filesystem")
+		}
+		if err := dedupeHardlinks(outputDirectory); err != nil {
+			return err
+		}
+	}
+
+	// 5. Print the requested reports
+	if resourcesReport {
+		if err := writeResourcesReport(stdout, result.specs); err != nil {
+			return err
+		}
+	}
+	if rbacReport {
+		if err := writeRBACReport(stdout, result.specs); err != nil {
+			return err
+		}
+	}
+
+	// 6. Check the render against the requested policies and report the results
+	// Nomad jobspecs and podman kube YAML aren't meant for Kubernetes, so neither
+	// the checks nor the deployment configs see them
+	kubernetes := kubernetesSpecs(result.specs)
+	done = timed("check")
+	findings, checkErr := runChecks(checks, kubernetes)
+	done()
+	if reportFormat != "" {
+		var buf bytes.Buffer
+		if err := writeReport(&buf, reportFormat, manifestsDir, kubernetes, findings); err != nil {
+			return err
+		}
+		if reportFile == "" {
+			if _, err := stdout.Write(buf.Bytes()); err != nil {
+				return err
+			}
+		} else if err := fsys.WriteFile(reportFile, buf.Bytes(), filePermissions); err != nil {
+			return fmt.Errorf("error writing report %s: %w", reportFile, err)
+		}
+	}
+	if skaffoldFile != "" {
+		if err := writeSkaffoldConfig(fsys, skaffoldFile, manifestsDir, kubernetesFiles(result.files, result.specs)); err != nil {
+			return err
+		}
+	}
+	if tiltFile != "" {
+		if err := writeTiltfile(fsys, tiltFile, manifestsDir, kubernetes); err != nil {
+			return err
+		}
+	}
+	if pathMapFile != "" {
+		if err := writer.shorten.writeMap(fsys, pathMapFile); err != nil {
+			return err
+		}
+	}
+	if summaryMD != "" {
+		summary := writeMarkdownSummary(previous, recorder.copy.Files(), result, findings)
+		if err := fsys.WriteFile(summaryMD, summary, filePermissions); err != nil {
+			return fmt.Errorf("error writing summary %s: %w", summaryMD, err)
+		}
+	}
+	if statsFile != "" {
+		if err := writeStats(fsys, statsFile, recorder.copy.Files(), result, findings, started); err != nil {
+			return err
+		}
+	}
+
+	if htmlReport != "" {
+		if err := writeHTMLReport(fsys, htmlReport, previous, recorder.copy.Files(), result.specs, findings); err != nil {
+			return err
+		}
+	}
+	if checkErr == nil && protector != nil {
+		checkErr = protector.err()
+	}
+	if checkErr == nil && merger != nil {
+		checkErr = merger.err()
+	}
+	return checkErr
+}
+
+// subcommands are run instead of a split when named as the first argument. They
+// take the same options as a split.
+var subcommands = map[string]func(args []string) int{
+	"browse":       browseMain,
+	"diff":         diffMain,
+	"daemon":       daemonMain,
+	"diff-streams": diffStreamsMain,
+	"drift":        driftMain,
+	"hook":         hookMain,
+	"list":         listMain,
+	"restore":      restoreMain,
+	"self-update":  selfUpdateMain,
+	"selftest":     selftestMain,
+	"serve":        serveMain,
+	"verify":       verifyMain,
+	"version":      versionMain,
+}
+
 func main() {
-	// 1. Parse flags and arguments
+	if len(os.Args) > 1 {
+		if command, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
 	outputDirectory, err := parseFlagsAndArgs()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	if showVersion {
+		fmt.Println(currentBuild())
+		return
+	}
+	if emitPatch != "" {
+		if err := writePatch(split.OSFS{}, os.Stdin, outputDirectory, emitPatch); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if dryRun || dryDiffs {
+		err := errors.New("-diff requires -dry-run")
+		if dryRun {
+			err = runDryRun(split.OSFS{}, os.Stdin, os.Stdout, outputDirectory)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	// 2. Setup output directory
-	if err := setupOutputDirectory(outputDirectory, force); err != nil {
+	if signOutput {
+		if err := checkSigning(outputDirectory); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	fancy, err := useTerminalLog()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	var terminal *terminalLog
+	if fancy {
+		terminal = newTerminalLog(os.Stderr)
+		log.SetFlags(0)
+		log.SetOutput(terminal)
+	}
 
-	// 3. Process the input stream
-	if err := processInput(outputDirectory); err != nil {
+	stopProfiling, err := startProfiling()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	input, started := newDigestReader(os.Stdin), time.Now()
+	var stdin io.Reader = input
+	if renderProgress, err = newProgress(os.Stderr, log.Writer(), inputSize(os.Stdin)); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	if renderProgress != nil {
+		stdin = renderProgress.reader(input)
+		log.SetOutput(renderProgress)
+	}
+	err = run(split.OSFS{}, stdin, os.Stdout, outputDirectory)
+	if renderProgress != nil {
+		renderProgress.stop()
+	}
+	stopProfiling()
+	if showTimings {
+		logTimings(time.Since(started))
+	}
+	if err == nil && signOutput {
+		err = signRender(outputDirectory, input, started)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if terminal != nil {
+			terminal.summary(true)
+		}
+		os.Exit(1)
+	}
 
+	if terminal != nil {
+		terminal.summary(false)
+		return
+	}
 	log.Println("Processing complete.")
 }
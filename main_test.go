@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+// setFlag sets the variable of a flag for the duration of the test.
+func setFlag[T any](t *testing.T, p *T, value T) {
+	t.Helper()
+	old := *p
+	*p = value
+	t.Cleanup(func() { *p = old })
+}
+
+// writeFile writes content to the file name on disk, creating its directory.
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// render splits input in memory with the current flags and returns the files written,
+// relative to the output directory.
+func render(t *testing.T, input string) map[string]string {
+	t.Helper()
+	tree, err := renderInMemory(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	files := make(map[string]string, len(tree))
+	for name, data := range tree {
+		files[name] = string(data)
+	}
+	return files
+}
+
+// helmOutput returns a helm template stream of the given Source and content pairs.
+func helmOutput(docs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(docs); i += 2 {
+		b.WriteString(yamlSeparator + docs[i] + "\n" + docs[i+1])
+	}
+	return b.String()
+}
+
+// baselineSplit splits input the way schelm did before the write path pooled its
+// buffers: every document is appended to the file of its Source with a plain string
+// concatenation.
+func baselineSplit(input string) map[string]string {
+	files := make(map[string]string)
+	for _, token := range strings.Split(input, yamlSeparator)[1:] {
+		source, content := split.ParseDocument(token)
+		if source == "" {
+			continue
+		}
+		name := path.Clean(source)
+		if existing, ok := files[name]; ok {
+			separator := "\n---\n"
+			if !strings.HasSuffix(content, "\n") {
+				separator = "\n" + separator
+			}
+			files[name] = existing + separator + content
+			continue
+		}
+		files[name] = content
+	}
+	return files
+}
+
+func configMap(name string, size int) string {
+	return fmt.Sprintf("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\ndata:\n  blob: %q\n", name, strings.Repeat("x", size))
+}
+
+// benchmarkInput returns n documents spread over a few templates.
+func benchmarkInput(n int) string {
+	var docs []string
+	for i := range n {
+		docs = append(docs, fmt.Sprintf("chart/templates/cm%d.yaml", i%10), configMap(fmt.Sprintf("cm-%d", i), 200))
+	}
+	return helmOutput(docs...)
+}
+
+func TestPooledWriteMatchesBaseline(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"single document", helmOutput("chart/templates/cm.yaml", configMap("a", 10))},
+		{"appended documents", helmOutput(
+			"chart/templates/cm.yaml", configMap("a", 10),
+			"chart/templates/cm.yaml", configMap("b", 10),
+			"chart/templates/other.yaml", configMap("c", 10),
+			"chart/templates/cm.yaml", configMap("d", 10),
+		)},
+		{"missing trailing newline", helmOutput(
+			"chart/templates/cm.yaml", strings.TrimSuffix(configMap("a", 10), "\n"),
+			"chart/templates/cm.yaml", strings.TrimSuffix(configMap("b", 10), "\n"),
+		)},
+		// A large document grows the pooled buffer; the small ones after it reuse it.
+		{"large documents between small ones", helmOutput(
+			"chart/templates/small.yaml", configMap("a", 10),
+			"chart/templates/large.yaml", configMap("b", 600<<10),
+			"chart/templates/small.yaml", configMap("c", 10),
+			"chart/templates/large.yaml", configMap("d", 900<<10),
+			"chart/templates/small.yaml", configMap("e", 10),
+		)},
+		{"many documents", benchmarkInput(500)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, want := render(t, tt.input), baselineSplit(tt.input)
+			if len(got) != len(want) {
+				t.Fatalf("wrote %d files, want %d", len(got), len(want))
+			}
+			for name, content := range want {
+				if got[name] != content {
+					t.Errorf("%s differs from the baseline:\n got %.200q\nwant %.200q", name, got[name], content)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkProcessInput(b *testing.B) {
+	logOutput := log.Writer()
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(logOutput) })
+	input := benchmarkInput(2000)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for range b.N {
+		w := newSpecWriter(split.NewMemSink(), yamlFormat{}, nil, nil, nil)
+		if err := processInput(strings.NewReader(input), w); err != nil {
+			b.Fatal(err)
+		}
+		if err := w.flush(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestWritePathDoesNotParse guards the speed of the plain render: without hooks,
+// manifests reach the sink without being parsed, which -timings would charge to
+// the parse stage.
+func TestWritePathDoesNotParse(t *testing.T) {
+	logOutput := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(logOutput) })
+	setFlag(t, &showTimings, true)
+	durations := stages.durations
+	stages.durations = nil
+	t.Cleanup(func() { stages.durations = durations })
+
+	w := newSpecWriter(split.NewMemSink(), yamlFormat{}, nil, nil, nil)
+	if err := processInput(strings.NewReader(benchmarkInput(50)), w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stages.durations["parse"]; ok {
+		t.Error("the write path parsed documents without any hooks")
+	}
+	if _, ok := stages.durations["transform"]; !ok {
+		t.Fatal("-timings recorded no stages")
+	}
+}
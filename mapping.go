@@ -0,0 +1,171 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	sourceMapFile  string     // Rules file rewriting Source paths to custom destinations
+	sourceRewrites stringList // sed-style substitutions applied to Source paths
+)
+
+func init() {
+	flag.StringVar(&sourceMapFile, "map", "", "Rules file rewriting Source paths to custom destinations, matched by exact path, glob or regex")
+	flag.Var(&sourceRewrites, "rewrite", "Rewrite Source paths with a sed-style substitution, e.g. 's|^mychart/templates/||' (repeatable, applied in order before -map)")
+}
+
+// sourceMapper rewrites the Source of a document before its destination is derived.
+type sourceMapper func(source string) (string, error)
+
+// mapRule is one entry of a -map file. Exactly one of Path, Glob and Regex is set.
+// A Glob rule whose Dest ends in / keeps the file name; Regex rules may use $1-style
+// references to their capture groups in Dest.
+type mapRule struct {
+	Path  string `yaml:"path"`
+	Glob  string `yaml:"glob"`
+	Regex string `yaml:"regex"`
+	Dest  string `yaml:"dest"`
+
+	re *regexp.Regexp
+}
+
+// loadSourceMap reads the rules of a -map file and returns a mapper applying the
+// first rule that matches each Source. Sources no rule matches are kept.
+func loadSourceMap(file string) (sourceMapper, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading source map: %w", err)
+	}
+	var rules []mapRule
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("error parsing source map %s: %w", file, err)
+	}
+	for i := range rules {
+		r := &rules[i]
+		set := 0
+		for _, v := range []string{r.Path, r.Glob, r.Regex} {
+			if v != "" {
+				set++
+			}
+		}
+		if set != 1 || r.Dest == "" {
+			return nil, fmt.Errorf("source map %s: rule %d needs a dest and exactly one of path, glob or regex", file, i+1)
+		}
+		switch {
+		case r.Glob != "":
+			r.re = globRegexp(r.Glob)
+		case r.Regex != "":
+			if r.re, err = regexp.Compile(r.Regex); err != nil {
+				return nil, fmt.Errorf("source map %s: rule %d: %w", file, i+1, err)
+			}
+		}
+	}
+
+	return func(source string) (string, error) {
+		for _, r := range rules {
+			var dest string
+			switch {
+			case r.Path != "":
+				if path.Clean(r.Path) != source {
+					continue
+				}
+				dest = r.Dest
+			case r.Glob != "":
+				if !r.re.MatchString(source) {
+					continue
+				}
+				dest = r.Dest
+				if strings.HasSuffix(dest, "/") {
+					dest += path.Base(source)
+				}
+			default:
+				m := r.re.FindStringSubmatchIndex(source)
+				if m == nil {
+					continue
+				}
+				dest = string(r.re.ExpandString(nil, r.Dest, source, m))
+			}
+			return checkDestination(source, dest)
+		}
+		return source, nil
+	}, nil
+}
+
+// parseRewrite compiles a sed-style s/pattern/replacement/[g] rule into a mapper. Any
+// character may delimit the parts; \1 and $1 refer to capture groups.
+func parseRewrite(rule string) (sourceMapper, error) {
+	if len(rule) < 4 || rule[0] != 's' {
+		return nil, fmt.Errorf("invalid -rewrite %q (expected s/pattern/replacement/)", rule)
+	}
+	parts := strings.Split(rule[2:], rule[1:2])
+	if len(parts) != 3 || (parts[2] != "" && parts[2] != "g") {
+		return nil, fmt.Errorf("invalid -rewrite %q (expected s/pattern/replacement/ with an optional g)", rule)
+	}
+	re, err := regexp.Compile(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid -rewrite %q: %w", rule, err)
+	}
+	replacement := sedGroupRef.ReplaceAllString(parts[1], "$${$1}")
+	global := parts[2] == "g"
+
+	return func(source string) (string, error) {
+		var dest string
+		if global {
+			dest = re.ReplaceAllString(source, replacement)
+		} else if m := re.FindStringSubmatchIndex(source); m != nil {
+			dest = source[:m[0]] + string(re.ExpandString(nil, replacement, source, m)) + source[m[1]:]
+		} else {
+			return source, nil
+		}
+		return checkDestination(source, dest)
+	}, nil
+}
+
+// sedGroupRef matches the \1-style group references of sed replacements.
+var sedGroupRef = regexp.MustCompile(`\\([0-9])`)
+
+// checkDestination cleans a rewritten Source and makes sure it stays inside the
+// output directory.
+func checkDestination(source, dest string) (string, error) {
+	dest = path.Clean(dest)
+	if path.IsAbs(dest) || dest == "." || dest == ".." || strings.HasPrefix(dest, "../") {
+		return "", fmt.Errorf("source %s is rewritten to %q, which is outside the output directory", source, dest)
+	}
+	if dest != source {
+		log.Printf("Mapping %s to %s", source, dest)
+	}
+	return dest, nil
+}
+
+// globRegexp converts a glob into an anchored regular expression: * and ? match
+// within a path segment and ** matches across segments.
+func globRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case c == '*' && strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case c == '*' && strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+// mergeBaseFile keeps the previous render in OUTPUT_DIR for -merge. It has no
+// .yaml or .json extension, so kubectl apply -f and kustomize skip it.
+const mergeBaseFile = ".schelm-merge-base"
+
+var mergeEdits bool // Whether to merge hand edits of OUTPUT_DIR into the new render
+
+func init() {
+	flag.BoolVar(&mergeEdits, "merge", false, "Replace OUTPUT_DIR like -f, but three-way merge files edited by hand since the last -merge run into the new render, writing conflict markers where both changed the same lines")
+}
+
+// mergeBase is the content of mergeBaseFile: what the previous run rendered, by
+// file, with the hashes telling whether a file was edited since.
+type mergeBase struct {
+	Files map[string]mergeBaseEntry `json:"files"`
+}
+
+type mergeBaseEntry struct {
+	SHA256  string `json:"sha256"`
+	Content string `json:"content"`
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// mergeSink records the new render while it goes to the output directory, and
+// knows which files of the previous render were edited by hand.
+type mergeSink struct {
+	split.Sink
+	fsys      split.FS
+	dir       string
+	base      map[string]mergeBaseEntry
+	edited    map[string][]byte // the hand-edited files before the run
+	rendered  *split.MemSink
+	conflicts []string
+}
+
+// newMergeSink reads the previous render and the current files of dir before the
+// run replaces them. Without a previous render nothing counts as edited.
+func newMergeSink(fsys split.FS, dir string) (*mergeSink, error) {
+	m := &mergeSink{fsys: fsys, dir: dir, edited: make(map[string][]byte), rendered: split.NewMemSink()}
+	data, err := fsys.ReadFile(path.Join(dir, mergeBaseFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path.Join(dir, mergeBaseFile), err)
+	}
+	var base mergeBase
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path.Join(dir, mergeBaseFile), err)
+	}
+	m.base = base.Files
+	current, err := snapshotTree(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	for name, entry := range m.base {
+		if content, ok := current[name]; ok && sha256Hex(content) != entry.SHA256 {
+			m.edited[name] = content
+		}
+	}
+	return m, nil
+}
+
+// CreateOrAppend writes doc to the wrapped sink and records it.
+func (m *mergeSink) CreateOrAppend(name string, doc []byte) error {
+	if err := m.Sink.CreateOrAppend(name, doc); err != nil {
+		return err
+	}
+	return m.rendered.CreateOrAppend(name, doc)
+}
+
+// Close closes the wrapped sink, merges the edited files into the written render
+// and records the render as the base of the next run.
+func (m *mergeSink) Close() error {
+	if err := split.Close(m.Sink); err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(m.edited)) {
+		file := path.Join(m.dir, name)
+		rendered, ok := m.rendered.Files()[name]
+		if !ok {
+			// The render dropped the file; keep the edits rather than losing them.
+			log.Printf("Conflict: %s was edited but is no longer rendered, keeping it", file)
+			m.conflicts = append(m.conflicts, name)
+			if err := m.fsys.MkdirAll(path.Dir(file), dirPermissions); err != nil {
+				return fmt.Errorf("error creating directory %s: %w", path.Dir(file), err)
+			}
+			if err := m.fsys.WriteFile(file, m.edited[name], filePermissions); err != nil {
+				return fmt.Errorf("error restoring %s: %w", file, err)
+			}
+			continue
+		}
+		merged, conflict := mergeLines(m.base[name].Content, string(m.edited[name]), string(rendered))
+		if conflict {
+			log.Printf("Conflict: %s was edited and the render changed the same lines, writing conflict markers", file)
+			m.conflicts = append(m.conflicts, name)
+		} else {
+			log.Printf("Merging the edits of %s", file)
+		}
+		if err := m.fsys.WriteFile(file, []byte(merged), filePermissions); err != nil {
+			return fmt.Errorf("error writing merged %s: %w", file, err)
+		}
+	}
+
+	base := mergeBase{Files: make(map[string]mergeBaseEntry)}
+	for name, content := range m.rendered.Files() {
+		base.Files[name] = mergeBaseEntry{SHA256: sha256Hex(content), Content: string(content)}
+	}
+	data, err := json.MarshalIndent(base, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := m.fsys.WriteFile(path.Join(m.dir, mergeBaseFile), append(data, '\n'), filePermissions); err != nil {
+		return fmt.Errorf("error writing %s: %w", path.Join(m.dir, mergeBaseFile), err)
+	}
+	return nil
+}
+
+// err reports the files left with conflicts, if there were any.
+func (m *mergeSink) err() error {
+	if len(m.conflicts) == 0 {
+		return nil
+	}
+	return errors.New("hand edits conflict with the render, resolve them in: " + strings.Join(m.conflicts, ", "))
+}
+
+// mergeLines merges the changes from base to ours and from base to theirs line by
+// line, like diff3. Where both changed the same lines differently, both versions
+// are kept between conflict markers.
+func mergeLines(base, ours, theirs string) (string, bool) {
+	b := splitLines([]byte(base))
+	o := splitLines([]byte(ours))
+	t := splitLines([]byte(theirs))
+	// For every base line, the line it is kept as in each version, or -1.
+	inOurs, inTheirs := keptLines(b, o), keptLines(b, t)
+
+	var out strings.Builder
+	conflict := false
+	writeLines := func(lines []string) {
+		for _, line := range lines {
+			out.WriteString(line + "\n")
+		}
+	}
+	i, oi, ti := 0, 0, 0
+	for {
+		// Find the next base line both versions kept, ending the current chunk.
+		j := i
+		for j < len(b) && (inOurs[j] < 0 || inTheirs[j] < 0) {
+			j++
+		}
+		oEnd, tEnd := len(o), len(t)
+		if j < len(b) {
+			oEnd, tEnd = inOurs[j], inTheirs[j]
+		}
+		baseChunk, oursChunk, theirsChunk := b[i:j], o[oi:oEnd], t[ti:tEnd]
+		switch {
+		case slices.Equal(oursChunk, baseChunk):
+			writeLines(theirsChunk)
+		case slices.Equal(theirsChunk, baseChunk), slices.Equal(oursChunk, theirsChunk):
+			writeLines(oursChunk)
+		default:
+			conflict = true
+			out.WriteString("<<<<<<< edited\n")
+			writeLines(oursChunk)
+			out.WriteString("=======\n")
+			writeLines(theirsChunk)
+			out.WriteString(">>>>>>> rendered\n")
+		}
+		if j == len(b) {
+			break
+		}
+		out.WriteString(b[j] + "\n")
+		i, oi, ti = j+1, oEnd+1, tEnd+1
+	}
+	return out.String(), conflict
+}
+
+// keptLines maps each line of a to the line of b it matches in their diff, or to
+// -1 for removed lines.
+func keptLines(a, b []string) []int {
+	kept := make([]int, len(a))
+	for i := range kept {
+		kept[i] = -1
+	}
+	for _, op := range lineDiff(a, b) {
+		if op.kind == ' ' {
+			kept[op.oldLine] = op.newLine
+		}
+	}
+	return kept
+}
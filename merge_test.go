@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+func TestMergeLines(t *testing.T) {
+	base := "a: 1\nb: 2\nc: 3\nd: 4\n"
+	tests := []struct {
+		name         string
+		ours, theirs string
+		want         string
+		conflict     bool
+	}{
+		{"unchanged", base, base, base, false},
+		{"edited only", "a: 1\nb: 20\nc: 3\nd: 4\n", base, "a: 1\nb: 20\nc: 3\nd: 4\n", false},
+		{"rendered only", base, "a: 1\nb: 2\nc: 3\nd: 40\n", "a: 1\nb: 2\nc: 3\nd: 40\n", false},
+		{"different lines", "a: 1\nb: 20\nc: 3\nd: 4\n", "a: 1\nb: 2\nc: 3\nd: 40\n", "a: 1\nb: 20\nc: 3\nd: 40\n", false},
+		{"same change", "a: 1\nb: 20\nc: 3\nd: 4\n", "a: 1\nb: 20\nc: 3\nd: 4\n", "a: 1\nb: 20\nc: 3\nd: 4\n", false},
+		{"added and removed", "a: 1\nb: 2\nc: 3\nd: 4\ne: 5\n", "b: 2\nc: 3\nd: 4\n", "b: 2\nc: 3\nd: 4\ne: 5\n", false},
+		{"same lines", "a: 1\nb: 20\nc: 3\nd: 4\n", "a: 1\nb: 21\nc: 3\nd: 4\n",
+			"a: 1\n<<<<<<< edited\nb: 20\n=======\nb: 21\n>>>>>>> rendered\nc: 3\nd: 4\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflict := mergeLines(base, tt.ours, tt.theirs)
+			if got != tt.want || conflict != tt.conflict {
+				t.Errorf("mergeLines() = %q, %v; want %q, %v", got, conflict, tt.want, tt.conflict)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	setFlag(t, &mergeEdits, true)
+	cm := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\ndata:\n  a: \"1\"\n  b: \"2\"\n  c: \"3\"\n"
+	svc := "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n"
+	fsys := split.NewMemFS()
+	render := func(input string) error {
+		t.Helper()
+		return run(fsys, strings.NewReader(input), io.Discard, "out")
+	}
+	file := func(name string) string {
+		t.Helper()
+		data, err := fsys.ReadFile("out/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	edit := func(name, old, new string) {
+		t.Helper()
+		if err := fsys.WriteFile("out/"+name, []byte(strings.Replace(file(name), old, new, 1)), filePermissions); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without a previous render the directory is replaced, like with -f.
+	writeTree(t, fsys, map[string]string{"out/stale.yaml": svc})
+	if err := render(helmOutput("web/templates/cm.yaml", cm, "web/templates/svc.yaml", svc)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat("out/stale.yaml"); err == nil {
+		t.Error("the first -merge run kept a file of the directory")
+	}
+	if _, err := fsys.Stat("out/" + mergeBaseFile); err != nil {
+		t.Fatalf("no %s after the first run: %v", mergeBaseFile, err)
+	}
+
+	// Edits of other lines than the render changed are kept.
+	edit("web/templates/cm.yaml", `a: "1"`, `a: "edited"`)
+	if err := render(helmOutput("web/templates/cm.yaml", strings.Replace(cm, `c: "3"`, `c: "4"`, 1), "web/templates/svc.yaml", svc)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := file("web/templates/cm.yaml"), strings.NewReplacer(`a: "1"`, `a: "edited"`, `c: "3"`, `c: "4"`).Replace(cm); got != want {
+		t.Errorf("merged cm.yaml =\n%s\nwant:\n%s", got, want)
+	}
+
+	// The merged edits stay edits on the next run, and conflict with a render
+	// changing the same line. A file the render drops keeps its edits.
+	edit("web/templates/svc.yaml", "name: web", "name: edited")
+	err := render(helmOutput("web/templates/cm.yaml", strings.Replace(cm, `a: "1"`, `a: "5"`, 1)))
+	if err == nil || !strings.Contains(err.Error(), "web/templates/cm.yaml, web/templates/svc.yaml") {
+		t.Errorf("run() = %v, want conflicts in cm.yaml and svc.yaml", err)
+	}
+	if got, want := file("web/templates/cm.yaml"), "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\ndata:\n<<<<<<< edited\n  a: \"edited\"\n=======\n  a: \"5\"\n>>>>>>> rendered\n  b: \"2\"\n  c: \"3\"\n"; got != want {
+		t.Errorf("conflicting cm.yaml =\n%s\nwant:\n%s", got, want)
+	}
+	if got, want := file("web/templates/svc.yaml"), strings.Replace(svc, "name: web", "name: edited", 1); got != want {
+		t.Errorf("dropped svc.yaml =\n%s\nwant:\n%s", got, want)
+	}
+}
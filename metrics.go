@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// renderDurationBuckets are the upper bounds, in seconds, of the render latency
+// histogram.
+var renderDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// serverMetrics are the counters of schelm serve, exposed on /metrics in the
+// Prometheus text format.
+type serverMetrics struct {
+	mu        sync.Mutex
+	requests  map[[2]string]uint64 // by handler and status code
+	documents uint64
+	bytes     uint64
+	errors    uint64
+	latency   histogram
+}
+
+// histogram is a cumulative Prometheus histogram.
+type histogram struct {
+	bounds []float64
+	counts []uint64 // observations at most the bound of the same index
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		requests: make(map[[2]string]uint64),
+		latency:  histogram{bounds: renderDurationBuckets, counts: make([]uint64, len(renderDurationBuckets))},
+	}
+}
+
+// observeRender records one render of documents documents, which wrote written bytes.
+func (m *serverMetrics) observeRender(documents int, written int64, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.documents += uint64(documents)
+	m.bytes += uint64(written)
+	if err != nil {
+		m.errors++
+	}
+	m.latency.observe(d.Seconds())
+}
+
+// instrument counts the requests next handles by status code.
+func (m *serverMetrics) instrument(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		m.mu.Lock()
+		m.requests[[2]string{name, strconv.Itoa(rec.status)}]++
+		m.mu.Unlock()
+	})
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (m *serverMetrics) serveHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+// write prints the metrics in the Prometheus text exposition format.
+func (m *serverMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP schelm_http_requests_total HTTP requests by handler and status code.")
+	fmt.Fprintln(w, "# TYPE schelm_http_requests_total counter")
+	for _, key := range slices.SortedFunc(maps.Keys(m.requests), func(a, b [2]string) int {
+		return slices.Compare(a[:], b[:])
+	}) {
+		fmt.Fprintf(w, "schelm_http_requests_total{handler=%q,code=%q} %d\n", key[0], key[1], m.requests[key])
+	}
+	counter := func(name, help string, v uint64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, v)
+	}
+	counter("schelm_documents_processed_total", "Documents received for splitting.", m.documents)
+	counter("schelm_bytes_written_total", "Bytes written to output files.", m.bytes)
+	counter("schelm_render_errors_total", "Renders that failed.", m.errors)
+
+	const name = "schelm_render_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Time taken to split a stream.\n# TYPE %s histogram\n", name, name)
+	for i, bound := range m.latency.bounds {
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), m.latency.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, m.latency.count)
+	fmt.Fprintf(w, "%s_sum %g\n%s_count %d\n", name, m.latency.sum, name, m.latency.count)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+	"gopkg.in/yaml.v3"
+)
+
+var normalizeProfile string // Normalization applied to every document before it is written
+
+func init() {
+	flag.StringVar(&normalizeProfile, "normalize-profile", "", "Normalize every document like a GitOps tool does before diffing, so committed output compares clean: argocd")
+}
+
+// serverSetMetadata are metadata fields owned by the API server, which Argo CD
+// never compares.
+var serverSetMetadata = []string{"creationTimestamp", "generation", "managedFields", "resourceVersion", "selfLink", "uid"}
+
+// newNormalizeHook returns the hook applying the -normalize-profile, or nil if none
+// was requested.
+func newNormalizeHook() (split.DocumentHook, error) {
+	switch normalizeProfile {
+	case "":
+		return nil, nil
+	case "argocd":
+		return untouchedHook(argoCDNormalizeHook), nil
+	}
+	return nil, fmt.Errorf("invalid -normalize-profile %q (expected argocd)", normalizeProfile)
+}
+
+// argoCDNormalizeHook rewrites a document into the form Argo CD compares: without
+// status and server-set metadata, without null fields, with resource quantities in
+// canonical form and with keys sorted, so re-rendering never shows as OutOfSync
+// because of formatting alone.
+func argoCDNormalizeHook(meta split.DocMeta, content []byte) ([]byte, error) {
+	s := metaSpec(meta, content)
+	root, err := s.root()
+	if err != nil || root == nil || root.Kind != yaml.MappingNode {
+		return content, err
+	}
+
+	deleteKey(root, "status")
+	if metadata := lookupNode(root, "metadata"); metadata != nil {
+		for _, key := range serverSetMetadata {
+			deleteKey(metadata, key)
+		}
+	}
+	dropNulls(root)
+	if pod := podSpec(s); pod != nil {
+		for _, c := range append(containers(pod, "initContainers"), containers(pod, "containers")...) {
+			for _, key := range []string{"limits", "requests"} {
+				canonicalizeQuantities(lookupNode(c, "resources", key))
+			}
+		}
+	}
+	sortKeys(root)
+
+	out, err := encodeYAML(root)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding normalized document from %s: %w", meta.Source, err)
+	}
+	return []byte(out), nil
+}
+
+// dropNulls removes the mapping entries below n whose value is null, which the API
+// server treats as absent.
+func dropNulls(n *yaml.Node) {
+	n = resolveAlias(n)
+	switch n.Kind {
+	case yaml.MappingNode:
+		kept := n.Content[:0]
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			value := n.Content[i+1]
+			if value.Kind == yaml.ScalarNode && value.Tag == "!!null" {
+				continue
+			}
+			dropNulls(value)
+			kept = append(kept, n.Content[i], value)
+		}
+		n.Content = kept
+	case yaml.SequenceNode:
+		for _, item := range n.Content {
+			dropNulls(item)
+		}
+	}
+}
+
+// sortKeys orders the keys of every mapping below n, the order Argo CD's JSON
+// comparison effectively uses.
+func sortKeys(n *yaml.Node) {
+	n = resolveAlias(n)
+	switch n.Kind {
+	case yaml.MappingNode:
+		pairs := make([][2]*yaml.Node, 0, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			pairs = append(pairs, [2]*yaml.Node{n.Content[i], n.Content[i+1]})
+			sortKeys(n.Content[i+1])
+		}
+		slices.SortStableFunc(pairs, func(a, b [2]*yaml.Node) int { return strings.Compare(a[0].Value, b[0].Value) })
+		n.Content = n.Content[:0]
+		for _, p := range pairs {
+			n.Content = append(n.Content, p[0], p[1])
+		}
+	case yaml.SequenceNode:
+		for _, item := range n.Content {
+			sortKeys(item)
+		}
+	}
+}
+
+// canonicalizeQuantities rewrites the quantities of a resources mapping, such as
+// 1000m or 1024Mi, in the canonical form the API server returns, 1 and 1Gi.
+func canonicalizeQuantities(m *yaml.Node) {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 1; i < len(m.Content); i += 2 {
+		value := m.Content[i]
+		if value.Kind != yaml.ScalarNode {
+			continue
+		}
+		if q, ok := canonicalQuantity(value.Value); ok && q != value.Value {
+			value.Value, value.Tag, value.Style = q, "!!str", 0
+		}
+	}
+}
+
+// canonicalQuantity formats the quantity q with the largest suffix of its family,
+// binary or decimal, that represents it exactly.
+func canonicalQuantity(q string) (string, bool) {
+	v, err := parseQuantity(q)
+	if err != nil || v < 0 {
+		return "", false
+	}
+	if v == 0 {
+		return "0", true
+	}
+	if strings.HasSuffix(q, "i") {
+		for _, suffix := range []string{"Ei", "Pi", "Ti", "Gi", "Mi", "Ki"} {
+			if n := v / quantitySuffixes[suffix]; n == math.Trunc(n) {
+				return strconv.FormatFloat(n, 'f', -1, 64) + suffix, true
+			}
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), v == math.Trunc(v)
+	}
+	for _, suffix := range []string{"E", "P", "T", "G", "M", "k", "", "m", "u", "n"} {
+		// Round away floating point noise from the division, e.g. 0.3/1e-3.
+		n := v / quantitySuffixes[suffix]
+		if r := math.Round(n); math.Abs(n-r) < 1e-9*math.Max(1, math.Abs(n)) && r >= 1 {
+			return strconv.FormatFloat(r, 'f', -1, 64) + suffix, true
+		}
+	}
+	return "", false
+}
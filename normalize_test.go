@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCanonicalQuantity(t *testing.T) {
+	tests := []struct {
+		q, want string
+		ok      bool
+	}{
+		{"1000m", "1", true},
+		{"1500m", "1500m", true},
+		{"0.5", "500m", true},
+		{"0.3", "300m", true},
+		{"2000", "2k", true},
+		{"1024Mi", "1Gi", true},
+		{"1536Mi", "1536Mi", true},
+		{"1048576Ki", "1Gi", true},
+		{"0Gi", "0", true},
+		{"1e3", "1k", true},
+		{"-1", "", false},
+		{"lots", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := canonicalQuantity(tt.q); got != tt.want || ok != tt.ok {
+			t.Errorf("canonicalQuantity(%q) = %q, %v; want %q, %v", tt.q, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestArgoCDNormalizeProfile(t *testing.T) {
+	setFlag(t, &normalizeProfile, "argocd")
+	deployment := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels: null
+  creationTimestamp: "2026-10-14T10:00:00Z"
+  uid: 1234
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web:1
+        resources:
+          requests:
+            cpu: 1000m
+            memory: 1024Mi
+          limits:
+            memory: 1536Mi
+status:
+  replicas: 1
+`
+	want := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - image: web:1
+          name: web
+          resources:
+            limits:
+              memory: 1536Mi
+            requests:
+              cpu: "1"
+              memory: 1Gi
+`
+	files := render(t, helmOutput("web/templates/deployment.yaml", deployment))
+	if got := files["web/templates/deployment.yaml"]; got != want {
+		t.Errorf("normalized deployment.yaml =\n%s\nwant:\n%s", got, want)
+	}
+
+	setFlag(t, &normalizeProfile, "flux")
+	if _, err := renderInMemory(strings.NewReader("")); err == nil {
+		t.Error("an unknown -normalize-profile was accepted")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+// Annotations -annotate-origin sets.
+const (
+	sourceTemplateAnnotation = "schelm.io/source-template"
+	chartAnnotation          = "schelm.io/chart"
+)
+
+var annotateOrigin bool // Whether every document is annotated with the template and chart it came from
+
+func init() {
+	flag.BoolVar(&annotateOrigin, "annotate-origin", false, "Annotate every document with "+sourceTemplateAnnotation+", its Source, and "+chartAnnotation+", the chart or subchart of that template, so objects found in a cluster can be traced back to their template")
+}
+
+// originHook sets the origin annotations on every Kubernetes object.
+func originHook(meta split.DocMeta, content []byte) ([]byte, error) {
+	s := metaSpec(meta, content)
+	root, err := s.root()
+	if err != nil || root == nil || s.kind() == "" {
+		return content, err
+	}
+	setAnnotation(root, sourceTemplateAnnotation, meta.Source)
+	chart := sourceChart(meta.Source)
+	if chartRef != "" && chartVersion != "" && subchartStart(strings.Split(meta.Source, "/")) == 0 {
+		chart += "-" + chartVersion
+	}
+	setAnnotation(root, chartAnnotation, chart)
+	out, err := encodeYAML(root)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding document from %s: %w", meta.Source, err)
+	}
+	return []byte(out), nil
+}
+
+// sourceChart returns the chart a Source belongs to: its first directory, or the
+// innermost subchart of charts/<name>/ nesting.
+func sourceChart(source string) string {
+	parts := strings.Split(source, "/")
+	return parts[subchartStart(parts)]
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+var emitPatch string // File to write the changes of the render to as a patch, instead of applying them
+
+func init() {
+	flag.StringVar(&emitPatch, "emit-patch", "", "Leave OUTPUT_DIR untouched and write the changes the render would make to this file as a patch for git apply, relative to the current directory")
+}
+
+// writePatch renders the stream in memory and writes the difference between dir and
+// the render to file of fsys in the git diff format, so it can be reviewed and
+// applied with git apply from the current directory.
+func writePatch(fsys split.FS, stdin io.Reader, dir, file string) error {
+	if archivePath != "" || destURL != "" || krmOutput {
+		return fmt.Errorf("-emit-patch describes changes to OUTPUT_DIR and cannot be combined with -archive, -dest or -krm-output")
+	}
+	if _, err := fsys.Stat(dir); err == nil && !force {
+		return fmt.Errorf(`output directory "%s" already exists. Use -f to describe overwriting it`, dir)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to check output directory %s: %w", dir, err)
+	}
+	after, err := renderInMemory(stdin)
+	if err != nil {
+		return err
+	}
+	before, err := snapshotTree(fsys, dir)
+	if err != nil {
+		return err
+	}
+	prefix, err := patchPrefix(dir)
+	if err != nil {
+		return err
+	}
+
+	added, changed, removed := treeChanges(before, after)
+	names := slices.Concat(added, changed, removed)
+	slices.Sort(names)
+	var patch bytes.Buffer
+	for _, name := range names {
+		target := path.Join(prefix, name)
+		fmt.Fprintf(&patch, "diff --git a/%s b/%s\n", target, target)
+		if _, ok := before[name]; !ok {
+			patch.WriteString("new file mode 100644\n")
+		} else if _, ok := after[name]; !ok {
+			patch.WriteString("deleted file mode 100644\n")
+		}
+		patch.WriteString(textFileDiff(target, before[name], after[name]))
+	}
+	if err := fsys.WriteFile(file, patch.Bytes(), filePermissions); err != nil {
+		return fmt.Errorf("error writing patch: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s: %d to create, %d to update, %d to delete in %s\n", file, len(added), len(changed), len(removed), dir)
+	return nil
+}
+
+// patchPrefix returns dir as the slash-separated path relative to the current
+// directory the patch names its files with.
+func patchPrefix(dir string) (string, error) {
+	if !filepath.IsAbs(dir) {
+		return filepath.ToSlash(filepath.Clean(dir)), nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(wd, dir)
+	if err != nil {
+		return "", fmt.Errorf("-emit-patch needs OUTPUT_DIR relative to the current directory: %w", err)
+	}
+	return filepath.ToSlash(rel), nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+func TestWritePatch(t *testing.T) {
+	setFlag(t, &force, true)
+	fsys := split.NewMemFS()
+	for name, content := range map[string]string{
+		"out/web/templates/cm.yaml":  "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\ndata:\n  a: \"1\"\n",
+		"out/web/templates/old.yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: old\n",
+	} {
+		if err := fsys.MkdirAll("out/web/templates", dirPermissions); err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.WriteFile(name, []byte(content), filePermissions); err != nil {
+			t.Fatal(err)
+		}
+	}
+	input := helmOutput(
+		"web/templates/cm.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\ndata:\n  a: \"2\"\n",
+		"web/templates/new.yaml", "apiVersion: v1\nkind: Secret\nmetadata:\n  name: new\n",
+	)
+	if err := writePatch(fsys, strings.NewReader(input), "out", "render.patch"); err != nil {
+		t.Fatal(err)
+	}
+	patch, err := fsys.ReadFile("render.patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `diff --git a/out/web/templates/cm.yaml b/out/web/templates/cm.yaml
+--- a/out/web/templates/cm.yaml
++++ b/out/web/templates/cm.yaml
+@@ -3,4 +3,4 @@
+ metadata:
+   name: web
+ data:
+-  a: "1"
++  a: "2"
+diff --git a/out/web/templates/new.yaml b/out/web/templates/new.yaml
+new file mode 100644
+--- /dev/null
++++ b/out/web/templates/new.yaml
+@@ -0,0 +1,4 @@
++apiVersion: v1
++kind: Secret
++metadata:
++  name: new
+diff --git a/out/web/templates/old.yaml b/out/web/templates/old.yaml
+deleted file mode 100644
+--- a/out/web/templates/old.yaml
++++ /dev/null
+@@ -1,4 +0,0 @@
+-apiVersion: v1
+-kind: Service
+-metadata:
+-  name: old
+`
+	if string(patch) != want {
+		t.Errorf("render.patch:\n%s\nwant:\n%s", patch, want)
+	}
+	info, err := fsys.Stat("render.patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode() != filePermissions {
+		t.Errorf("render.patch has mode %v, want %v", info.Mode(), filePermissions)
+	}
+	// OUTPUT_DIR is left alone.
+	if _, err := fsys.Stat("out/web/templates/new.yaml"); err == nil {
+		t.Error("-emit-patch wrote to OUTPUT_DIR")
+	}
+
+	setFlag(t, &force, false)
+	if err := writePatch(fsys, strings.NewReader(input), "out", "again.patch"); err == nil {
+		t.Error("writePatch() over an existing OUTPUT_DIR without -f succeeded")
+	}
+	setFlag(t, &archivePath, "out.tgz")
+	if err := writePatch(fsys, strings.NewReader(input), "new", "again.patch"); err == nil {
+		t.Error("writePatch() with -archive succeeded")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var (
+	forbidKinds      string // Comma-separated kinds that must not appear in the render
+	requireNamespace bool   // Whether namespaced documents must set metadata.namespace
+)
+
+func init() {
+	flag.StringVar(&forbidKinds, "forbid-kind", "", "Comma-separated kinds, e.g. ClusterRoleBinding,PersistentVolume, that fail the run if rendered")
+	flag.BoolVar(&requireNamespace, "require-namespace", false, "Fail the run if a document of a namespaced kind has no metadata.namespace")
+}
+
+// clusterScopedKinds are the built-in kinds that live outside namespaces. Kinds not
+// listed here are taken to be namespaced unless a CRD in the render says otherwise.
+var clusterScopedKinds = map[string]bool{
+	"APIService":                       true,
+	"CertificateSigningRequest":        true,
+	"ClusterRole":                      true,
+	"ClusterRoleBinding":               true,
+	"ComponentStatus":                  true,
+	"CSIDriver":                        true,
+	"CSINode":                          true,
+	"CustomResourceDefinition":         true,
+	"FlowSchema":                       true,
+	"IngressClass":                     true,
+	"MutatingWebhookConfiguration":     true,
+	"Namespace":                        true,
+	"Node":                             true,
+	"PersistentVolume":                 true,
+	"PodSecurityPolicy":                true,
+	"PriorityClass":                    true,
+	"PriorityLevelConfiguration":       true,
+	"RuntimeClass":                     true,
+	"StorageClass":                     true,
+	"ValidatingAdmissionPolicy":        true,
+	"ValidatingAdmissionPolicyBinding": true,
+	"ValidatingWebhookConfiguration":   true,
+	"VolumeAttachment":                 true,
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// forbidKindCheck reports every document whose kind is in kinds, compared case-insensitively.
+func forbidKindCheck(kinds []string) check {
+	forbidden := make(map[string]bool)
+	for _, kind := range kinds {
+		forbidden[strings.ToLower(kind)] = true
+	}
+	return func(specs []*spec) []finding {
+		var findings []finding
+		for _, s := range specs {
+			if forbidden[strings.ToLower(s.kind())] {
+				findings = append(findings, finding{
+					spec:     s,
+					check:    "forbid-kind",
+					severity: severityError,
+					message:  fmt.Sprintf("kind %s is forbidden", s.kind()),
+				})
+			}
+		}
+		return findings
+	}
+}
+
+// requireNamespaceCheck reports every document of a namespaced kind that doesn't set
+// metadata.namespace, so it can't land in whatever namespace happens to be current.
+func requireNamespaceCheck(specs []*spec) []finding {
+	clusterScoped := make(map[string]bool)
+	for _, s := range specs {
+		if s.kind() == "CustomResourceDefinition" && s.field("spec", "scope") == "Cluster" {
+			clusterScoped[s.field("spec", "names", "kind")] = true
+		}
+	}
+	var findings []finding
+	for _, s := range specs {
+		kind := s.kind()
+		if kind == "" || clusterScopedKinds[kind] || clusterScoped[kind] || s.namespace() != "" {
+			continue
+		}
+		findings = append(findings, finding{
+			spec:     s,
+			check:    "require-namespace",
+			severity: severityError,
+			message:  fmt.Sprintf("namespaced kind %s has no metadata.namespace", kind),
+		})
+	}
+	return findings
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+	"gopkg.in/yaml.v3"
+)
+
+// sourceAnnotation carries each document's Source through post-renderers, which
+// usually drop the "# Source:" comments helm writes.
+const sourceAnnotation = "schelm.bromaniac.github.com/source"
+
+var postRenderers stringList // Commands the whole stream is piped through before splitting
+
+func init() {
+	flag.Var(&postRenderers, "post-renderer", "Pipe the whole stream through this shell command, e.g. kustomize or ytt, before splitting (repeatable, applied in order)")
+}
+
+// runPostRenderers pipes the helm output read from r through every -post-renderer in
+// order and returns the result as helm output again. Sources are kept in an
+// annotation along the way; documents a post-renderer adds are named after their
+// kind and name.
+func runPostRenderers(r io.Reader) (io.Reader, error) {
+	stream, err := annotateSources(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, command := range postRenderers {
+		log.Printf("Running post-renderer %q", command)
+		cmd := shellCommand(command)
+		cmd.Stdin = bytes.NewReader(stream)
+		cmd.Stderr = os.Stderr
+		if stream, err = cmd.Output(); err != nil {
+			return nil, fmt.Errorf("post-renderer %q failed: %w", command, err)
+		}
+	}
+	return restoreSources(stream)
+}
+
+// annotateSources converts helm output into a plain multi-document stream with the
+// Source of every document recorded in its annotations.
+func annotateSources(r io.Reader) ([]byte, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(split.ScanDocuments)
+	scanner.Buffer(make([]byte, bufio.MaxScanTokenSize), bufferSize)
+	scanner.Scan() // Discard the part before the first separator
+
+	var out bytes.Buffer
+	for scanner.Scan() {
+		source, content := split.ParseDocument(scanner.Text())
+		s := newSpec(source, content)
+		root, err := s.root()
+		if err != nil {
+			return nil, err
+		}
+		if root == nil || root.Kind != yaml.MappingNode {
+			continue
+		}
+		setAnnotation(root, sourceAnnotation, source)
+		doc, err := encodeYAML(root)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding document from %s: %w", source, err)
+		}
+		out.WriteString("---\n")
+		out.WriteString(doc)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning input stream: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// restoreSources turns a post-rendered stream back into helm output, taking each
+// document's Source from its annotation.
+func restoreSources(stream []byte) (io.Reader, error) {
+	var out strings.Builder
+	dec := yaml.NewDecoder(bytes.NewReader(stream))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error parsing post-renderer output: %w", err)
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		root := doc.Content[0]
+		source := scalarField(root, "metadata", "annotations", sourceAnnotation)
+		if source == "" {
+			source = krmItemPath(root)
+		}
+		if annotations := lookupNode(root, "metadata", "annotations"); annotations != nil {
+			deleteKey(annotations, sourceAnnotation)
+			if len(annotations.Content) == 0 {
+				deleteKey(lookupNode(root, "metadata"), "annotations")
+			}
+		}
+		content, err := encodeYAML(root)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding post-rendered document for %s: %w", source, err)
+		}
+		out.WriteString(yamlSeparator + path.Clean(source) + "\n" + content)
+	}
+	return strings.NewReader(out.String()), nil
+}
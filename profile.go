@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime/trace"
+	"strings"
+	"time"
+)
+
+var (
+	pprofAddress string // Address the pprof endpoints are served on during the run
+	traceFile    string // File the execution trace of the run is written to
+	showTimings  bool   // Whether the time spent in every stage is logged
+)
+
+func init() {
+	flag.StringVar(&pprofAddress, "pprof", "", "Serve the net/http/pprof endpoints on this address, e.g. :6060, while the render runs")
+	flag.StringVar(&traceFile, "trace", "", "Write a runtime execution trace of the render to this file, for go tool trace; the stages are traced as regions")
+	flag.BoolVar(&showTimings, "timings", false, "Log the time spent in every stage of the render: scan (reading and splitting the input), parse, transform (hooks, mappers and batch transforms), write and check")
+}
+
+// stageOrder is the order -timings reports the stages in.
+var stageOrder = []string{"chart", "scan", "parse", "transform", "write", "check"}
+
+// stages accumulates the time spent in every stage. Stages nest, as parsing inside
+// a transform, and each is only charged the time not spent in the stages it
+// started. The render is single-threaded, so no locking is needed.
+var stages struct {
+	durations map[string]time.Duration
+	current   string
+	since     time.Time
+}
+
+// timed starts charging time to stage and returns the function ending it, which
+// charges the time after it to the stage that was running before.
+func timed(stage string) func() {
+	if !showTimings && statsFile == "" && !trace.IsEnabled() {
+		return func() {}
+	}
+	region := trace.StartRegion(context.Background(), stage)
+	previous := switchStage(stage)
+	return func() {
+		switchStage(previous)
+		region.End()
+	}
+}
+
+// switchStage charges the time since the last switch to the current stage and
+// makes stage the current one, returning the one it replaces.
+func switchStage(stage string) string {
+	now := time.Now()
+	if stages.durations == nil {
+		stages.durations = make(map[string]time.Duration)
+	}
+	if stages.current != "" {
+		stages.durations[stages.current] += now.Sub(stages.since)
+	}
+	previous := stages.current
+	stages.current, stages.since = stage, now
+	return previous
+}
+
+// logTimings logs the time spent in every stage that ran, and the total.
+func logTimings(total time.Duration) {
+	var parts []string
+	for _, stage := range stageOrder {
+		if d, ok := stages.durations[stage]; ok {
+			parts = append(parts, fmt.Sprintf("%s %s", stage, d.Round(time.Microsecond)))
+		}
+	}
+	parts = append(parts, fmt.Sprintf("total %s", total.Round(time.Microsecond)))
+	log.Printf("Timings: %s", strings.Join(parts, ", "))
+}
+
+// startProfiling starts the -pprof server and the -trace, returning the function
+// stopping the trace.
+func startProfiling() (func(), error) {
+	if pprofAddress != "" {
+		listener, err := net.Listen("tcp", pprofAddress)
+		if err != nil {
+			return nil, fmt.Errorf("-pprof: %w", err)
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		go http.Serve(listener, mux)
+		log.Printf("Serving pprof on http://%s/debug/pprof/", listener.Addr())
+	}
+	if traceFile == "" {
+		return func() {}, nil
+	}
+	f, err := os.Create(traceFile)
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace %s: %w", traceFile, err)
+	}
+	if err := trace.Start(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error starting trace: %w", err)
+	}
+	return func() {
+		trace.Stop()
+		if err := f.Close(); err != nil {
+			log.Printf("Warning: error writing trace %s: %v", traceFile, err)
+		}
+	}, nil
+}
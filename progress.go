@@ -0,0 +1,180 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var progressMode string // When a progress bar is shown: auto, always or never
+
+func init() {
+	flag.StringVar(&progressMode, "progress", "auto", "Show a progress bar on stderr during long splits: auto (when stderr is a terminal), always or never. It shows a percentage when stdin is a file, else the documents and bytes read so far")
+}
+
+const (
+	progressDelay    = time.Second            // Splits finishing sooner show no bar
+	progressInterval = 200 * time.Millisecond // How often the bar is redrawn
+	progressWidth    = 30                     // Width of the bar in characters
+)
+
+// stderrIsTerminal reports whether stderr is an interactive terminal that
+// understands cursor movement.
+func stderrIsTerminal() bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	stat, err := os.Stderr.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// renderProgress is the progress of the running split, nil when no bar is shown.
+var renderProgress *progress
+
+// progress draws a bar of the input read so far on the last line of the terminal
+// out. The log, which goes to the same terminal, is written to logOut through it,
+// so log lines appear above the bar.
+type progress struct {
+	mu      sync.Mutex
+	out     io.Writer
+	logOut  io.Writer
+	total   int64 // size of the input, 0 if unknown
+	read    int64
+	docs    int
+	started time.Time
+	drawn   bool
+	done    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// newProgress returns the -progress bar for an input of the given size, with 0
+// for an unknown size, or nil if none is to be shown.
+func newProgress(out, logOut io.Writer, total int64) (*progress, error) {
+	switch progressMode {
+	case "never":
+		return nil, nil
+	case "auto":
+		if !stderrIsTerminal() {
+			return nil, nil
+		}
+	case "always":
+	default:
+		return nil, fmt.Errorf("invalid -progress %q (expected auto, always or never)", progressMode)
+	}
+	p := &progress{out: out, logOut: logOut, total: total, started: time.Now(), done: make(chan struct{})}
+	p.stopped.Add(1)
+	go p.loop()
+	return p, nil
+}
+
+// inputSize returns the size of f if it is a regular file, else 0.
+func inputSize(f *os.File) int64 {
+	stat, err := f.Stat()
+	if err != nil || !stat.Mode().IsRegular() {
+		return 0
+	}
+	return stat.Size()
+}
+
+func (p *progress) loop() {
+	defer p.stopped.Done()
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			if time.Since(p.started) >= progressDelay {
+				p.draw()
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// draw replaces the bar with the current state. p.mu must be held.
+func (p *progress) draw() {
+	var line string
+	if p.total > 0 {
+		fraction := min(float64(p.read)/float64(p.total), 1)
+		filled := int(fraction * progressWidth)
+		line = fmt.Sprintf("[%s%s] %3.0f%% %s/%s, %d documents", strings.Repeat("=", filled), strings.Repeat(" ", progressWidth-filled),
+			fraction*100, progressBytes(p.read), progressBytes(p.total), p.docs)
+	} else {
+		line = fmt.Sprintf("%d documents, %s read", p.docs, progressBytes(p.read))
+	}
+	fmt.Fprintf(p.out, "\r\033[K%s", line)
+	p.drawn = true
+}
+
+// clear removes the bar, if drawn. p.mu must be held.
+func (p *progress) clear() {
+	if p.drawn {
+		fmt.Fprint(p.out, "\r\033[K")
+		p.drawn = false
+	}
+}
+
+// Write writes a log line above the bar.
+func (p *progress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	wasDrawn := p.drawn
+	p.clear()
+	n, err := p.logOut.Write(b)
+	if wasDrawn {
+		p.draw()
+	}
+	return n, err
+}
+
+// reader returns r counting the bytes read from it.
+func (p *progress) reader(r io.Reader) io.Reader {
+	return progressReader{r, p}
+}
+
+type progressReader struct {
+	io.Reader
+	p *progress
+}
+
+func (r progressReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.p.mu.Lock()
+	r.p.read += int64(n)
+	r.p.mu.Unlock()
+	return n, err
+}
+
+// document counts a document of the input. It is a no-op on a nil progress.
+func (p *progress) document() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.docs++
+	p.mu.Unlock()
+}
+
+// stop removes the bar for good.
+func (p *progress) stop() {
+	close(p.done)
+	p.stopped.Wait()
+	p.mu.Lock()
+	p.clear()
+	p.mu.Unlock()
+}
+
+// progressBytes renders n like 12.5MiB.
+func progressBytes(n int64) string {
+	if n == 0 {
+		return "0B"
+	}
+	return formatBytes(float64(n)) + "B"
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+var protectPatterns string // Comma-separated globs of OUTPUT_DIR files a split never touches
+
+func init() {
+	flag.StringVar(&protectPatterns, "protect", "", "Comma-separated globs, e.g. 'overlays/**,README.md', of existing OUTPUT_DIR files that -f never removes and the split never overwrites; conflicts fail the run")
+}
+
+// protectedFiles matches paths relative to the output directory against -protect.
+type protectedFiles []*regexp.Regexp
+
+func parseProtectPatterns(value string) protectedFiles {
+	var p protectedFiles
+	for _, glob := range splitList(value) {
+		p = append(p, globRegexp(strings.TrimPrefix(path.Clean(glob), "/")))
+	}
+	return p
+}
+
+func (p protectedFiles) matches(name string) bool {
+	for _, re := range p {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// clearUnprotected empties dir like RemoveAll would, but keeps the protected files
+// and the directories leading to them. It returns the kept files, relative to dir.
+func clearUnprotected(fsys split.FS, dir string, p protectedFiles) (map[string]bool, error) {
+	kept := make(map[string]bool)
+	var clear func(rel string) (bool, error)
+	clear = func(rel string) (bool, error) {
+		entries, err := fs.ReadDir(fsys, path.Join(dir, rel))
+		if err != nil {
+			return false, err
+		}
+		keep := false
+		for _, e := range entries {
+			child := path.Join(rel, e.Name())
+			if e.IsDir() {
+				childKept, err := clear(child)
+				if err != nil {
+					return false, err
+				}
+				if childKept {
+					keep = true
+					continue
+				}
+			} else if p.matches(child) {
+				kept[child] = true
+				keep = true
+				continue
+			}
+			if err := fsys.RemoveAll(path.Join(dir, child)); err != nil {
+				return false, err
+			}
+		}
+		return keep, nil
+	}
+	if _, err := clear("."); err != nil {
+		return nil, fmt.Errorf("failed to clear output directory %s: %w", dir, err)
+	}
+	return kept, nil
+}
+
+// protectSink refuses to write to the protected files that existed before the run,
+// recording the attempts as conflicts instead.
+type protectSink struct {
+	split.Sink
+	existing  map[string]bool
+	conflicts []string
+}
+
+// CreateOrAppend forwards to the wrapped sink unless name is a protected file.
+func (p *protectSink) CreateOrAppend(name string, doc []byte) error {
+	name = path.Clean(name)
+	if p.existing[name] {
+		if !slices.Contains(p.conflicts, name) {
+			log.Printf("Conflict: %s is protected, not writing to it", name)
+			p.conflicts = append(p.conflicts, name)
+		}
+		return nil
+	}
+	return p.Sink.CreateOrAppend(name, doc)
+}
+
+// Close closes the wrapped sink.
+func (p *protectSink) Close() error {
+	return split.Close(p.Sink)
+}
+
+// err reports the conflicts, if there were any.
+func (p *protectSink) err() error {
+	if len(p.conflicts) == 0 {
+		return nil
+	}
+	return errors.New("rendered files conflict with protected files: " + strings.Join(p.conflicts, ", "))
+}
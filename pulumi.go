@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+	"gopkg.in/yaml.v3"
+)
+
+// pulumiProgramFile is the Pulumi YAML program the pulumi format writes.
+const pulumiProgramFile = "Pulumi.yaml"
+
+// pulumiGroups are the API groups the Pulumi Kubernetes provider has resource
+// types for. Documents of other groups become CustomResources.
+var pulumiGroups = map[string]bool{
+	"core": true, "admissionregistration.k8s.io": true, "apiextensions.k8s.io": true,
+	"apiregistration.k8s.io": true, "apps": true, "autoscaling": true, "batch": true,
+	"certificates.k8s.io": true, "coordination.k8s.io": true, "discovery.k8s.io": true,
+	"events.k8s.io": true, "flowcontrol.apiserver.k8s.io": true, "networking.k8s.io": true,
+	"node.k8s.io": true, "policy": true, "rbac.authorization.k8s.io": true,
+	"resource.k8s.io": true, "scheduling.k8s.io": true, "storage.k8s.io": true,
+}
+
+// pulumiFormat writes the documents as rendered, like the yaml format, and collects
+// them into a Pulumi YAML program with one resource per document, written once
+// the render is done.
+type pulumiFormat struct {
+	project   string
+	names     identifierSet
+	resources *yaml.Node // mapping of resource names to their definitions
+}
+
+func newPulumiFormat() *pulumiFormat {
+	return &pulumiFormat{names: make(identifierSet), resources: &yaml.Node{Kind: yaml.MappingNode}}
+}
+
+func (p *pulumiFormat) render(s *spec) (string, string, error) {
+	root, err := s.root()
+	if err != nil || root == nil || s.kind() == "" {
+		return s.source, tidyWhitespace(s.content), err
+	}
+	if p.project == "" {
+		p.project = strings.Trim(strings.ReplaceAll(sanitizeIdentifier(sourceChart(s.source)), "_", "-"), "-")
+	}
+
+	properties := cloneNode(root)
+	escapeInterpolations(properties)
+	typ := pulumiType(s.apiVersion(), s.kind())
+	if typ != pulumiCustomResource {
+		deleteKey(properties, "apiVersion")
+		deleteKey(properties, "kind")
+	}
+	resource := &yaml.Node{Kind: yaml.MappingNode}
+	setKey(resource, "type", scalarNode(typ))
+	setKey(resource, "properties", properties)
+	setKey(p.resources, p.names.claim("", specIdentifier(s)), resource)
+	return s.source, tidyWhitespace(s.content), nil
+}
+
+func (p *pulumiFormat) separator(content string) string {
+	return yamlFormat{}.separator(content)
+}
+
+// finish writes the Pulumi YAML program.
+func (p *pulumiFormat) finish(sink split.Sink, written []string) error {
+	if len(p.resources.Content) == 0 {
+		return nil
+	}
+	project := p.project
+	if project == "" {
+		project = "rendered-chart"
+	}
+	program := &yaml.Node{Kind: yaml.MappingNode}
+	setKey(program, "name", scalarNode(project))
+	setKey(program, "runtime", scalarNode("yaml"))
+	setKey(program, "description", scalarNode("Resources rendered by helm and split by schelm"))
+	setKey(program, "resources", p.resources)
+	content, err := encodeYAML(program)
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %w", pulumiProgramFile, err)
+	}
+	return sink.CreateOrAppend(pulumiProgramFile, []byte(content))
+}
+
+// pulumiCustomResource is the Pulumi type of objects of API groups the provider
+// has no types for.
+const pulumiCustomResource = "kubernetes:apiextensions.k8s.io:CustomResource"
+
+// pulumiType returns the Pulumi resource type of a Kubernetes object, such as
+// kubernetes:apps/v1:Deployment.
+func pulumiType(apiVersion, kind string) string {
+	group, version, found := strings.Cut(apiVersion, "/")
+	if !found {
+		group, version = "core", apiVersion
+	}
+	if !pulumiGroups[group] {
+		return pulumiCustomResource
+	}
+	return fmt.Sprintf("kubernetes:%s/%s:%s", group, version, kind)
+}
+
+// escapeInterpolations doubles the $ of every ${ in the strings below n, which
+// Pulumi YAML would otherwise read as interpolations.
+func escapeInterpolations(n *yaml.Node) {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if strings.Contains(n.Value, "${") {
+			n.Value = strings.ReplaceAll(n.Value, "${", "$${")
+		}
+	default:
+		for _, child := range n.Content {
+			escapeInterpolations(child)
+		}
+	}
+}
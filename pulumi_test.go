@@ -0,0 +1,89 @@
+package main
+
+import "testing"
+
+func TestPulumiType(t *testing.T) {
+	tests := []struct{ apiVersion, kind, want string }{
+		{"v1", "ConfigMap", "kubernetes:core/v1:ConfigMap"},
+		{"apps/v1", "Deployment", "kubernetes:apps/v1:Deployment"},
+		{"networking.k8s.io/v1", "Ingress", "kubernetes:networking.k8s.io/v1:Ingress"},
+		{"apiextensions.k8s.io/v1", "CustomResourceDefinition", "kubernetes:apiextensions.k8s.io/v1:CustomResourceDefinition"},
+		{"cert-manager.io/v1", "Certificate", pulumiCustomResource},
+		{"example.com/v1alpha1", "Widget", pulumiCustomResource},
+	}
+	for _, tt := range tests {
+		if got := pulumiType(tt.apiVersion, tt.kind); got != tt.want {
+			t.Errorf("pulumiType(%s, %s) = %s, want %s", tt.apiVersion, tt.kind, got, tt.want)
+		}
+	}
+}
+
+func TestPulumiFormat(t *testing.T) {
+	setFlag(t, &format, "pulumi")
+	deployment := "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 2\n"
+	certificate := "apiVersion: cert-manager.io/v1\nkind: Certificate\nmetadata:\n  name: web\n  namespace: prod\nspec:\n  secretName: web-tls\n"
+	configMap := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\ndata:\n  cmd: \"echo ${HOME} $PATH\"\n"
+	files := render(t, helmOutput(
+		"my-chart/templates/deploy.yaml", deployment,
+		"my-chart/templates/cert.yaml", certificate,
+		"my-chart/templates/cm.yaml", configMap,
+		"my-chart/templates/cm2.yaml", configMap, // the same resource name again
+	))
+	// The manifests are written as rendered.
+	for name, want := range map[string]string{
+		"my-chart/templates/deploy.yaml": deployment,
+		"my-chart/templates/cert.yaml":   certificate,
+		"my-chart/templates/cm.yaml":     configMap,
+	} {
+		if files[name] != want {
+			t.Errorf("%s = %q, want %q", name, files[name], want)
+		}
+	}
+	want := `name: my-chart
+runtime: yaml
+description: Resources rendered by helm and split by schelm
+resources:
+  deployment_web:
+    type: kubernetes:apps/v1:Deployment
+    properties:
+      metadata:
+        name: web
+      spec:
+        replicas: 2
+  certificate_prod_web:
+    type: kubernetes:apiextensions.k8s.io:CustomResource
+    properties:
+      apiVersion: cert-manager.io/v1
+      kind: Certificate
+      metadata:
+        name: web
+        namespace: prod
+      spec:
+        secretName: web-tls
+  configmap_web:
+    type: kubernetes:core/v1:ConfigMap
+    properties:
+      metadata:
+        name: web
+      data:
+        cmd: "echo $${HOME} $PATH"
+  configmap_web_2:
+    type: kubernetes:core/v1:ConfigMap
+    properties:
+      metadata:
+        name: web
+      data:
+        cmd: "echo $${HOME} $PATH"
+`
+	if got := files[pulumiProgramFile]; got != want {
+		t.Errorf("%s:\n%s\nwant:\n%s", pulumiProgramFile, got, want)
+	}
+}
+
+func TestPulumiFormatWithoutObjects(t *testing.T) {
+	setFlag(t, &format, "pulumi")
+	files := render(t, helmOutput("my-chart/templates/notes.yaml", "# nothing to deploy\n"))
+	if _, ok := files[pulumiProgramFile]; ok {
+		t.Errorf("wrote %s without any objects", pulumiProgramFile)
+	}
+}
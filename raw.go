@@ -0,0 +1,204 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// rawDir is the directory of OUTPUT_DIR that documents which aren't Kubernetes
+// objects are written to.
+const rawDir = "_raw"
+
+// artifactDirs are the directories of OUTPUT_DIR that the documents of other tools
+// than Kubernetes, which some charts render next to their manifests, are written
+// to, by the tool they are for.
+var artifactDirs = map[string]string{"nomad": "_nomad", "podman": "_podman"}
+
+var rawDocuments string // What happens to documents without apiVersion or kind
+
+func init() {
+	flag.StringVar(&rawDocuments, "raw-documents", "route", "What to do with documents that lack apiVersion or kind, such as values dumps or plain YAML emitted by templates, and with Nomad jobspecs and podman kube YAML: route (write them below OUTPUT_DIR/"+rawDir+"/, "+artifactDirs["nomad"]+"/ and "+artifactDirs["podman"]+"/), skip or keep (write them with the manifests). -layout helm keeps them, like helm")
+}
+
+func validateRawDocuments(mode string) error {
+	switch mode {
+	case "route", "skip", "keep":
+		return nil
+	}
+	return fmt.Errorf("invalid -raw-documents %q (expected route, skip or keep)", mode)
+}
+
+// rawDocumentsMode returns the -raw-documents mode that applies to the -layout.
+func rawDocumentsMode() string {
+	if layout == "helm" && rawDocuments == "route" {
+		return "keep"
+	}
+	return rawDocuments
+}
+
+// isManifest reports whether s is a Kubernetes object: a mapping with apiVersion and
+// kind. Documents that hold only comments or don't parse count as manifests, so
+// they are written, or reported, as before.
+func isManifest(s *spec) bool {
+	// Block mappings setting both at the top level, nearly every manifest, need no
+	// parsing.
+	if hasTopLevelKey(s.content, "apiVersion") && hasTopLevelKey(s.content, "kind") {
+		return true
+	}
+	root, err := s.root()
+	if err != nil || root == nil {
+		return true
+	}
+	return root.Kind == yaml.MappingNode && s.apiVersion() != "" && s.kind() != ""
+}
+
+// routeRaw applies the -raw-documents mode to s, moving it below the directory of
+// its tool if it is an artifact of another tool, or below rawDir if it isn't a
+// Kubernetes object. It returns false if s is to be skipped.
+func routeRaw(mode string, s *spec) bool {
+	s.artifact = artifactKind(s)
+	if mode == "keep" {
+		return true
+	}
+	if s.artifact != "" {
+		if mode == "skip" {
+			log.Printf("Skipping %s document from %s", s.artifact, s.source)
+			return false
+		}
+		s.source = path.Join(artifactDirs[s.artifact], s.source)
+		return true
+	}
+	if isManifest(s) {
+		return true
+	}
+	if mode == "skip" {
+		log.Printf("Skipping document from %s without apiVersion and kind", s.source)
+		return false
+	}
+	s.source = path.Join(rawDir, s.source)
+	return true
+}
+
+// hasTopLevelKey reports whether a line of content sets key to a value, without
+// indentation.
+func hasTopLevelKey(content, key string) bool {
+	for content != "" {
+		line, rest, _ := strings.Cut(content, "\n")
+		if value, ok := strings.CutPrefix(line, key+":"); ok && value != "" && (value[0] == ' ' || value[0] == '\t') {
+			if value = strings.TrimSpace(value); value != "" && value[0] != '#' {
+				return true
+			}
+		}
+		content = rest
+	}
+	return false
+}
+
+// nomadJobBlock matches the job block of a Nomad jobspec in HCL, which YAML either
+// reads as a plain string or fails to parse.
+var nomadJobBlock = regexp.MustCompile(`(?m)^job\s+"[^"\n]*"\s*\{`)
+
+// podmanAnnotation prefixes the annotations only podman kube play reads.
+const podmanAnnotation = "io.podman.annotations."
+
+// artifactKind returns the tool s is for when it isn't meant for Kubernetes: nomad
+// for Nomad jobspecs, in HCL, HCL's JSON or the JSON of the jobs API, and podman
+// for podman kube YAML, Kubernetes-shaped objects that carry podman annotations or
+// the header of podman kube generate. It returns "" for everything else.
+func artifactKind(s *spec) string {
+	if strings.Contains(s.content, "job") && nomadJobBlock.MatchString(s.content) {
+		return "nomad"
+	}
+	nomad := strings.Contains(s.content, "Job") || strings.Contains(s.content, "job")
+	podman := strings.Contains(s.content, "podman")
+	if !nomad && !podman {
+		return ""
+	}
+	root, err := s.root()
+	if err != nil || root == nil || root.Kind != yaml.MappingNode {
+		return ""
+	}
+	if nomad && isNomadJob(root) {
+		return "nomad"
+	}
+	if podman && s.kind() != "" && isPodmanKube(s, root) {
+		return "podman"
+	}
+	return ""
+}
+
+// isNomadJob reports whether root is a Nomad job: a Job of the jobs API with task
+// groups, or a job block of HCL's JSON whose jobs have groups.
+func isNomadJob(root *yaml.Node) bool {
+	if job := lookupNode(root, "Job"); job != nil && job.Kind == yaml.MappingNode && lookupNode(job, "TaskGroups") != nil {
+		return true
+	}
+	jobs := lookupNode(root, "job")
+	if jobs == nil || jobs.Kind != yaml.MappingNode || len(jobs.Content) == 0 {
+		return false
+	}
+	for i := 1; i < len(jobs.Content); i += 2 {
+		if job := jobs.Content[i]; job.Kind != yaml.MappingNode || lookupNode(job, "group") == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// isPodmanKube reports whether s, a Kubernetes-shaped object, was written for
+// podman kube play: podman kube generate heads its output with a "Created with
+// podman" comment, and podman annotations mean nothing to Kubernetes.
+func isPodmanKube(s *spec, root *yaml.Node) bool {
+	if strings.Contains(s.content, "# Created with podman") {
+		return true
+	}
+	annotations := []*yaml.Node{lookupNode(root, "metadata", "annotations")}
+	if paths, ok := podSpecPaths[s.kind()]; ok {
+		annotations = append(annotations, lookupNode(root, append(paths[:len(paths)-1:len(paths)-1], "metadata", "annotations")...))
+	}
+	for _, n := range annotations {
+		if n == nil || n.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if strings.HasPrefix(n.Content[i].Value, podmanAnnotation) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// kubernetesSpecs returns the specs that aren't artifacts of other tools, which the
+// checks and deployment configs leave out.
+func kubernetesSpecs(specs []*spec) []*spec {
+	var kept []*spec
+	for _, s := range specs {
+		if s.artifact == "" {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// kubernetesFiles returns the files written that hold documents for Kubernetes,
+// specs being the documents written to them.
+func kubernetesFiles(files []string, specs []*spec) []string {
+	holds := make(map[string]bool)
+	for _, s := range kubernetesSpecs(specs) {
+		holds[s.dest] = true
+	}
+	var kept []string
+	for _, name := range files {
+		if holds[name] {
+			kept = append(kept, name)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+var rbacReport bool // Whether to print the permissions granted by the render
+
+func init() {
+	flag.BoolVar(&rbacReport, "rbac-report", false, "Print a matrix of the permissions the rendered Roles, ClusterRoles and bindings grant, per subject, to stdout")
+}
+
+// rbacRole is a Role or ClusterRole found in the render.
+type rbacRole struct {
+	kind      string
+	namespace string
+	name      string
+	rules     []string // one "verbs on resources" line per rule
+	bound     bool
+}
+
+// rbacRuleLines renders each policy rule of a role as "verbs\tresources".
+func rbacRuleLines(rules *yaml.Node) []string {
+	if rules == nil || rules.Kind != yaml.SequenceNode {
+		return nil
+	}
+	list := func(n *yaml.Node, key string) []string {
+		var out []string
+		if seq := lookupNode(n, key); seq != nil && seq.Kind == yaml.SequenceNode {
+			for _, item := range seq.Content {
+				out = append(out, item.Value)
+			}
+		}
+		return out
+	}
+	var lines []string
+	for _, rule := range rules.Content {
+		verbs := strings.Join(list(rule, "verbs"), ",")
+		targets := list(rule, "nonResourceURLs")
+		groups := list(rule, "apiGroups")
+		if len(groups) == 0 {
+			groups = []string{""}
+		}
+		names := list(rule, "resourceNames")
+		for _, group := range groups {
+			for _, resource := range list(rule, "resources") {
+				target := resource
+				if group != "" {
+					target = group + "/" + resource
+				}
+				if len(names) > 0 {
+					target += "[" + strings.Join(names, ",") + "]"
+				}
+				targets = append(targets, target)
+			}
+		}
+		lines = append(lines, verbs+"\t"+strings.Join(targets, " "))
+	}
+	return lines
+}
+
+// writeRBACReport prints, for every subject bound in the render, the rules it is granted
+// and where, followed by roles nothing in the render binds.
+func writeRBACReport(out io.Writer, specs []*spec) error {
+	roles := make(map[string]*rbacRole)
+	var order []string
+	for _, s := range specs {
+		if kind := s.kind(); kind == "Role" || kind == "ClusterRole" {
+			root, _ := s.root()
+			key := kind + "/" + s.namespace() + "/" + s.name()
+			if kind == "ClusterRole" {
+				key = kind + "//" + s.name()
+			}
+			roles[key] = &rbacRole{kind: kind, namespace: s.namespace(), name: s.name(), rules: rbacRuleLines(lookupNode(root, "rules"))}
+			order = append(order, key)
+		}
+	}
+
+	type row struct{ subject, scope, role, rule string }
+	var rows []row
+	for _, s := range specs {
+		kind := s.kind()
+		if kind != "RoleBinding" && kind != "ClusterRoleBinding" {
+			continue
+		}
+		root, _ := s.root()
+		scope := "cluster"
+		if kind == "RoleBinding" {
+			scope = "namespace " + s.namespace()
+			if s.namespace() == "" {
+				scope = "release namespace"
+			}
+		}
+
+		refKind := s.field("roleRef", "kind")
+		refName := s.field("roleRef", "name")
+		key := refKind + "/" + s.namespace() + "/" + refName
+		if refKind == "ClusterRole" {
+			key = refKind + "//" + refName
+		}
+		roleLabel := refKind + "/" + refName
+		rules := []string{"(role not in render)\t"}
+		if role, ok := roles[key]; ok {
+			role.bound = true
+			rules = role.rules
+		}
+
+		subjects := lookupNode(root, "subjects")
+		if subjects == nil || subjects.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, subj := range subjects.Content {
+			name := scalarField(subj, "name")
+			subjectKind := scalarField(subj, "kind")
+			if subjectKind == "ServiceAccount" {
+				ns := scalarField(subj, "namespace")
+				if ns == "" {
+					ns = s.namespace()
+				}
+				if ns != "" {
+					name = ns + "/" + name
+				}
+			}
+			for _, rule := range rules {
+				rows = append(rows, row{subjectKind + " " + name, scope, roleLabel, rule})
+			}
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].subject < rows[j].subject })
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SUBJECT\tSCOPE\tROLE\tVERBS\tRESOURCES")
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.subject, r.scope, r.role, r.rule)
+	}
+	for _, key := range order {
+		role := roles[key]
+		if role.bound {
+			continue
+		}
+		for _, rule := range role.rules {
+			fmt.Fprintf(tw, "(unbound)\t-\t%s/%s\t%s\n", role.kind, role.name, rule)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+var releaseMetadata string // Comma-separated key=value release metadata stamped as labels
+
+func init() {
+	flag.StringVar(&releaseMetadata, "inject-release-metadata", "", "Label every document with release metadata, e.g. name=myrel,version=1.2.3,chart=mychart-0.1.0 (app.kubernetes.io/instance, app.kubernetes.io/version, helm.sh/chart)")
+}
+
+// releaseLabels maps the -inject-release-metadata keys to the labels they set.
+var releaseLabels = map[string]string{
+	"name":       "app.kubernetes.io/instance",
+	"version":    "app.kubernetes.io/version",
+	"chart":      "helm.sh/chart",
+	"managed-by": "app.kubernetes.io/managed-by",
+}
+
+// newReleaseMetadataHook returns a hook setting the labels requested by
+// -inject-release-metadata on every document, or nil if none were requested.
+func newReleaseMetadataHook() (split.DocumentHook, error) {
+	items := splitList(releaseMetadata)
+	if len(items) == 0 {
+		return nil, nil
+	}
+	var labels [][2]string
+	for _, item := range items {
+		key, value, ok := strings.Cut(item, "=")
+		label, known := releaseLabels[strings.TrimSpace(key)]
+		if !ok || !known {
+			return nil, fmt.Errorf("invalid -inject-release-metadata entry %q (expected name=, version=, chart= or managed-by=)", item)
+		}
+		labels = append(labels, [2]string{label, strings.TrimSpace(value)})
+	}
+
+	return func(meta split.DocMeta, content []byte) ([]byte, error) {
+		s := metaSpec(meta, content)
+		root, err := s.root()
+		if err != nil || root == nil || s.kind() == "" {
+			return content, err
+		}
+		m := mappingAt(root, "metadata", "labels")
+		for _, l := range labels {
+			setKey(m, l[0], scalarNode(l[1]))
+		}
+		out, err := encodeYAML(root)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding document from %s: %w", meta.Source, err)
+		}
+		return []byte(out), nil
+	}, nil
+}
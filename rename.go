@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	namePrefix string // Prefix added to the name of every rendered resource
+	nameSuffix string // Suffix added to the name of every rendered resource
+)
+
+func init() {
+	flag.StringVar(&namePrefix, "name-prefix", "", "Prefix metadata.name of every resource, and the references to them within the render")
+	flag.StringVar(&nameSuffix, "name-suffix", "", "Suffix metadata.name of every resource, and the references to them within the render")
+}
+
+// fixedNameKinds keep their names: namespaces are shared by releases and CRD names
+// must be <plural>.<group>.
+var fixedNameKinds = map[string]bool{"Namespace": true, "CustomResourceDefinition": true}
+
+// renamer rewrites resource names and the references to resources of the same render.
+type renamer struct {
+	renamed map[string]string // "Kind/name" to the new name
+}
+
+// nameAffixTransform adds -name-prefix and -name-suffix to every resource name, so a
+// chart can be rendered several times into one namespace, and updates the references
+// between the renamed resources.
+func nameAffixTransform(specs []*spec) ([]*spec, error) {
+	r := renamer{renamed: make(map[string]string)}
+	for _, s := range specs {
+		if name := s.name(); name != "" && !fixedNameKinds[s.kind()] {
+			r.renamed[s.kind()+"/"+name] = namePrefix + name + nameSuffix
+		}
+	}
+	if len(r.renamed) == 0 {
+		return specs, nil
+	}
+
+	for i, s := range specs {
+		root, err := s.root()
+		if err != nil || root == nil {
+			continue
+		}
+		if !r.rewrite(s, root) {
+			continue
+		}
+		content, err := encodeYAML(root)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding %s from %s: %w", resourceName(s), s.source, err)
+		}
+		specs[i] = s.withContent(content)
+	}
+	return specs, nil
+}
+
+// rewrite renames the document s, rooted at root, and its references, reporting
+// whether anything changed.
+func (r renamer) rewrite(s *spec, root *yaml.Node) bool {
+	kind := s.kind()
+	changed := r.ref(kind, root, "metadata", "name")
+
+	switch kind {
+	case "Ingress":
+		ingress := lookupNode(root, "spec")
+		changed = r.backend(lookupNode(ingress, "defaultBackend")) || changed
+		changed = r.backend(lookupNode(ingress, "backend")) || changed
+		for _, rule := range sequenceItems(lookupNode(ingress, "rules")) {
+			for _, p := range sequenceItems(lookupNode(rule, "http", "paths")) {
+				changed = r.backend(lookupNode(p, "backend")) || changed
+			}
+		}
+		for _, tls := range sequenceItems(lookupNode(ingress, "tls")) {
+			changed = r.ref("Secret", tls, "secretName") || changed
+		}
+	case "RoleBinding", "ClusterRoleBinding":
+		changed = r.ref(scalarField(root, "roleRef", "kind"), root, "roleRef", "name") || changed
+		for _, subject := range sequenceItems(lookupNode(root, "subjects")) {
+			if scalarField(subject, "kind") == "ServiceAccount" {
+				changed = r.ref("ServiceAccount", subject, "name") || changed
+			}
+		}
+	case "StatefulSet":
+		changed = r.ref("Service", root, "spec", "serviceName") || changed
+	}
+
+	if pod := podSpec(s); pod != nil {
+		changed = r.pod(pod) || changed
+	}
+	return changed
+}
+
+// pod renames the ConfigMaps, Secrets, ServiceAccount and claims a pod spec uses.
+func (r renamer) pod(pod *yaml.Node) bool {
+	changed := r.ref("ServiceAccount", pod, "serviceAccountName")
+	for _, s := range sequenceItems(lookupNode(pod, "imagePullSecrets")) {
+		changed = r.ref("Secret", s, "name") || changed
+	}
+	for _, v := range sequenceItems(lookupNode(pod, "volumes")) {
+		changed = r.ref("ConfigMap", v, "configMap", "name") || changed
+		changed = r.ref("Secret", v, "secret", "secretName") || changed
+		changed = r.ref("PersistentVolumeClaim", v, "persistentVolumeClaim", "claimName") || changed
+		for _, source := range sequenceItems(lookupNode(v, "projected", "sources")) {
+			changed = r.ref("ConfigMap", source, "configMap", "name") || changed
+			changed = r.ref("Secret", source, "secret", "name") || changed
+		}
+	}
+	for _, c := range append(containers(pod, "initContainers"), containers(pod, "containers")...) {
+		for _, env := range sequenceItems(lookupNode(c, "env")) {
+			changed = r.ref("ConfigMap", env, "valueFrom", "configMapKeyRef", "name") || changed
+			changed = r.ref("Secret", env, "valueFrom", "secretKeyRef", "name") || changed
+		}
+		for _, from := range sequenceItems(lookupNode(c, "envFrom")) {
+			changed = r.ref("ConfigMap", from, "configMapRef", "name") || changed
+			changed = r.ref("Secret", from, "secretRef", "name") || changed
+		}
+	}
+	return changed
+}
+
+// backend renames the Service of an Ingress backend, in the v1 or v1beta1 shape.
+func (r renamer) backend(b *yaml.Node) bool {
+	if b == nil {
+		return false
+	}
+	changed := r.ref("Service", b, "service", "name")
+	return r.ref("Service", b, "serviceName") || changed
+}
+
+// ref renames the scalar at keys below n if it names a renamed resource of kind.
+func (r renamer) ref(kind string, n *yaml.Node, keys ...string) bool {
+	value := lookupNode(n, keys...)
+	if value == nil || value.Kind != yaml.ScalarNode {
+		return false
+	}
+	name, ok := r.renamed[kind+"/"+value.Value]
+	if !ok {
+		return false
+	}
+	value.Value = name
+	return true
+}
@@ -0,0 +1,124 @@
+package main
+
+import "testing"
+
+func TestNameAffixes(t *testing.T) {
+	setFlag(t, &namePrefix, "blue-")
+	setFlag(t, &nameSuffix, "-v2")
+	input := helmOutput(
+		"web/templates/ns.yaml", "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: shop\n",
+		"web/templates/cm.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n",
+		"web/templates/sa.yaml", "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: web\n",
+		"web/templates/svc.yaml", "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n",
+		"web/templates/deployment.yaml", `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: shop
+spec:
+  template:
+    spec:
+      serviceAccountName: web
+      volumes:
+      - name: settings
+        configMap:
+          name: settings
+      - name: certs
+        secret:
+          secretName: external
+      containers:
+      - name: web
+        envFrom:
+        - configMapRef:
+            name: settings
+`,
+		"web/templates/ingress.yaml", `apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+spec:
+  rules:
+  - http:
+      paths:
+      - path: /
+        backend:
+          service:
+            name: web
+`,
+		"web/templates/binding.yaml", `apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: web
+roleRef:
+  kind: ClusterRole
+  name: view
+subjects:
+- kind: ServiceAccount
+  name: web
+- kind: User
+  name: web
+`,
+	)
+	want := map[string]string{
+		"web/templates/ns.yaml":  "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: shop\n",
+		"web/templates/cm.yaml":  "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: blue-settings-v2\n",
+		"web/templates/sa.yaml":  "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: blue-web-v2\n",
+		"web/templates/svc.yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: blue-web-v2\n",
+		// The namespace, the volume and container names, and the Secret and
+		// ClusterRole from outside the render keep their names.
+		"web/templates/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: blue-web-v2
+  namespace: shop
+spec:
+  template:
+    spec:
+      serviceAccountName: blue-web-v2
+      volumes:
+        - name: settings
+          configMap:
+            name: blue-settings-v2
+        - name: certs
+          secret:
+            secretName: external
+      containers:
+        - name: web
+          envFrom:
+            - configMapRef:
+                name: blue-settings-v2
+`,
+		"web/templates/ingress.yaml": `apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: blue-web-v2
+spec:
+  rules:
+    - http:
+        paths:
+          - path: /
+            backend:
+              service:
+                name: blue-web-v2
+`,
+		"web/templates/binding.yaml": `apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: blue-web-v2
+roleRef:
+  kind: ClusterRole
+  name: view
+subjects:
+  - kind: ServiceAccount
+    name: blue-web-v2
+  - kind: User
+    name: web
+`,
+	}
+	files := render(t, input)
+	for name, content := range want {
+		if got := files[name]; got != content {
+			t.Errorf("%s =\n%s\nwant:\n%s", name, got, content)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+var (
+	reportFormat string // Format of the check report: junit, or empty for none
+	reportFile   string // File the check report is written to, stdout if empty
+)
+
+func init() {
+	flag.StringVar(&reportFormat, "report-format", "", "Write the results of the checks as a report in this format: junit, or github for workflow commands that annotate the files of the pull request")
+	flag.StringVar(&reportFile, "report-file", "", "File to write the -report-format report to (default stdout)")
+}
+
+// validateReportFormat checks the -report-format value.
+func validateReportFormat(format string) error {
+	switch format {
+	case "", "junit", "github":
+		return nil
+	}
+	return fmt.Errorf("invalid -report-format %q (expected junit or github)", format)
+}
+
+// writeReport renders the check results for specs in the requested format. root is
+// the directory the documents were written to, below the output directory with
+// -overlays and -cdk8s.
+func writeReport(out io.Writer, format, root string, specs []*spec, findings []finding) error {
+	switch format {
+	case "junit":
+		return writeJUnitReport(out, specs, findings)
+	case "github":
+		return writeGitHubReport(out, root, findings)
+	}
+	return nil
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnitReport writes one test case per document, named after the resource and
+// grouped by output file. Error findings make the case fail; warnings are attached
+// as output so they show up without failing the build.
+func writeJUnitReport(out io.Writer, specs []*spec, findings []finding) error {
+	bySpec := make(map[*spec][]finding)
+	for _, f := range findings {
+		bySpec[f.spec] = append(bySpec[f.spec], f)
+	}
+
+	suite := junitTestSuite{Name: "schelm"}
+	for _, s := range specs {
+		tc := junitTestCase{Name: resourceName(s), Classname: s.dest}
+		var failures, warnings []string
+		for _, f := range bySpec[s] {
+			line := fmt.Sprintf("%s [%s%s]", f.message, f.check, f.inputLocation())
+			if f.severity == severityError {
+				failures = append(failures, line)
+			} else {
+				warnings = append(warnings, line)
+			}
+		}
+		if len(failures) > 0 {
+			tc.Failure = &junitFailure{Message: failures[0], Type: "policy", Text: strings.Join(failures, "\n")}
+			suite.Failures++
+		}
+		if len(warnings) > 0 {
+			tc.SystemOut = "warning: " + strings.Join(warnings, "\nwarning: ")
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Tests = len(suite.Cases)
+
+	report := junitTestSuites{Tests: suite.Tests, Failures: suite.Failures, Suites: []junitTestSuite{suite}}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return fmt.Errorf("error encoding JUnit report: %w", err)
+	}
+	buf.WriteString("\n")
+	_, err := out.Write(buf.Bytes())
+	return err
+}
+
+// writeGitHubReport writes a GitHub Actions workflow command per finding, ::error or
+// ::warning with the file and line of the document, so they show up inline on the
+// pull request.
+func writeGitHubReport(out io.Writer, root string, findings []finding) error {
+	for _, f := range findings {
+		command := "warning"
+		if f.severity == severityError {
+			command = "error"
+		}
+		file := f.spec.dest
+		if root != "" {
+			file = path.Join(root, file)
+		}
+		properties := "file=" + githubEscapeProperty(file)
+		if f.spec.line > 0 {
+			properties += fmt.Sprintf(",line=%d", f.spec.line+max(f.line, 1)-1)
+		}
+		properties += ",title=" + githubEscapeProperty(f.check)
+		message := resourceName(f.spec) + ": " + f.message
+		if _, err := fmt.Fprintf(out, "::%s %s::%s\n", command, properties, githubEscapeData(message)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// githubEscapeData escapes the message of a workflow command.
+func githubEscapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// githubEscapeProperty escapes a property value of a workflow command.
+func githubEscapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
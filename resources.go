@@ -0,0 +1,203 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+var resourcesReport bool // Whether to print the CPU/memory footprint of the render
+
+func init() {
+	flag.BoolVar(&resourcesReport, "resources-report", false, "Print the CPU and memory requests and limits of every workload, multiplied by replicas, and their totals to stdout")
+}
+
+// quantitySuffixes are the Kubernetes quantity suffixes and their multipliers.
+var quantitySuffixes = map[string]float64{
+	"n": 1e-9, "u": 1e-6, "m": 1e-3, "": 1,
+	"k": 1e3, "M": 1e6, "G": 1e9, "T": 1e12, "P": 1e15, "E": 1e18,
+	"Ki": 1 << 10, "Mi": 1 << 20, "Gi": 1 << 30, "Ti": 1 << 40, "Pi": 1 << 50, "Ei": 1 << 60,
+}
+
+// parseQuantity parses a Kubernetes resource quantity such as 250m, 0.5, 128Mi or 1e3
+// into its value in base units (cores or bytes).
+func parseQuantity(q string) (float64, error) {
+	q = strings.TrimSpace(q)
+	i := len(q)
+	for i > 0 && (q[i-1] < '0' || q[i-1] > '9') && q[i-1] != '.' {
+		i--
+	}
+	number, suffix := q[:i], q[i:]
+	multiplier, ok := quantitySuffixes[suffix]
+	if !ok {
+		// Exponent notation, e.g. 1e3.
+		if f, err := strconv.ParseFloat(q, 64); err == nil {
+			return f, nil
+		}
+		return 0, fmt.Errorf("invalid quantity %q", q)
+	}
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid quantity %q", q)
+	}
+	return f * multiplier, nil
+}
+
+// footprint holds requests and limits in cores and bytes.
+type footprint struct {
+	cpuRequest, cpuLimit, memRequest, memLimit float64
+}
+
+func (f *footprint) add(o footprint, times float64) {
+	f.cpuRequest += o.cpuRequest * times
+	f.cpuLimit += o.cpuLimit * times
+	f.memRequest += o.memRequest * times
+	f.memLimit += o.memLimit * times
+}
+
+// max raises every field of f to at least the corresponding field of o.
+func (f *footprint) max(o footprint) {
+	f.cpuRequest = math.Max(f.cpuRequest, o.cpuRequest)
+	f.cpuLimit = math.Max(f.cpuLimit, o.cpuLimit)
+	f.memRequest = math.Max(f.memRequest, o.memRequest)
+	f.memLimit = math.Max(f.memLimit, o.memLimit)
+}
+
+// containerFootprint reads the resources of a single container.
+func containerFootprint(c *yaml.Node) (footprint, error) {
+	var f footprint
+	fields := []struct {
+		keys []string
+		dst  *float64
+	}{
+		{[]string{"resources", "requests", "cpu"}, &f.cpuRequest},
+		{[]string{"resources", "limits", "cpu"}, &f.cpuLimit},
+		{[]string{"resources", "requests", "memory"}, &f.memRequest},
+		{[]string{"resources", "limits", "memory"}, &f.memLimit},
+	}
+	for _, field := range fields {
+		if v := scalarField(c, field.keys...); v != "" {
+			q, err := parseQuantity(v)
+			if err != nil {
+				return f, err
+			}
+			*field.dst = q
+		}
+	}
+	return f, nil
+}
+
+// podFootprint computes the effective resources of a pod the way the scheduler does:
+// the sum over its containers, but at least the largest init container.
+func podFootprint(pod *yaml.Node) (footprint, error) {
+	var total, init footprint
+	for _, c := range containers(pod, "containers") {
+		f, err := containerFootprint(c)
+		if err != nil {
+			return total, err
+		}
+		total.add(f, 1)
+	}
+	for _, c := range containers(pod, "initContainers") {
+		f, err := containerFootprint(c)
+		if err != nil {
+			return total, err
+		}
+		init.max(f)
+	}
+	total.max(init)
+	return total, nil
+}
+
+// workloadReplicas returns how many pods a workload runs and whether the count is per node.
+func workloadReplicas(s *spec) (float64, bool) {
+	count := func(keys ...string) float64 {
+		if v := s.field(keys...); v != "" {
+			if n, err := strconv.ParseFloat(v, 64); err == nil {
+				return n
+			}
+		}
+		return 1
+	}
+	switch s.kind() {
+	case "DaemonSet":
+		return 1, true
+	case "Job":
+		return count("spec", "parallelism"), false
+	case "CronJob":
+		return count("spec", "jobTemplate", "spec", "parallelism"), false
+	case "Pod":
+		return 1, false
+	}
+	return count("spec", "replicas"), false
+}
+
+// writeResourcesReport prints the footprint of every workload in specs and the total.
+func writeResourcesReport(out io.Writer, specs []*spec) error {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "WORKLOAD\tREPLICAS\tCPU REQ\tCPU LIM\tMEM REQ\tMEM LIM")
+	var total footprint
+	perNode := false
+	for _, s := range specs {
+		pod := podSpec(s)
+		if pod == nil {
+			continue
+		}
+		f, err := podFootprint(pod)
+		if err != nil {
+			return fmt.Errorf("error reading resources of %s in %s: %w", resourceName(s), s.source, err)
+		}
+		replicas, daemon := workloadReplicas(s)
+		replicaText := strconv.FormatFloat(replicas, 'f', -1, 64)
+		if daemon {
+			replicaText = "1/node"
+			perNode = true
+		}
+		var w footprint
+		w.add(f, replicas)
+		total.add(w, 1)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", resourceName(s), replicaText,
+			formatCPU(w.cpuRequest), formatCPU(w.cpuLimit), formatBytes(w.memRequest), formatBytes(w.memLimit))
+	}
+	fmt.Fprintf(tw, "TOTAL\t\t%s\t%s\t%s\t%s\n",
+		formatCPU(total.cpuRequest), formatCPU(total.cpuLimit), formatBytes(total.memRequest), formatBytes(total.memLimit))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if perNode {
+		_, err := fmt.Fprintln(out, "DaemonSets are counted once; multiply by the number of nodes they run on.")
+		return err
+	}
+	return nil
+}
+
+// formatCPU renders cores as millicores below one core, and as cores otherwise.
+func formatCPU(cores float64) string {
+	switch {
+	case cores == 0:
+		return "-"
+	case cores < 1:
+		return strconv.FormatFloat(math.Round(cores*1000), 'f', -1, 64) + "m"
+	}
+	return strconv.FormatFloat(math.Round(cores*100)/100, 'f', -1, 64)
+}
+
+// formatBytes renders bytes using the largest binary unit that keeps the value >= 1.
+func formatBytes(bytes float64) string {
+	if bytes == 0 {
+		return "-"
+	}
+	units := []string{"", "Ki", "Mi", "Gi", "Ti", "Pi"}
+	i := 0
+	for bytes >= 1024 && i < len(units)-1 {
+		bytes /= 1024
+		i++
+	}
+	return strconv.FormatFloat(math.Round(bytes*100)/100, 'f', -1, 64) + units[i]
+}
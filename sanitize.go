@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxNameLength is the longest file name, in bytes, of the common filesystems.
+const maxNameLength = 255
+
+var sanitizeMode string // How destination file names derived from Sources are made safe
+
+func init() {
+	flag.StringVar(&sanitizeMode, "sanitize-mode", "posix", "How file names derived from Sources are made safe: posix replaces control characters and shortens names over 255 bytes, strict also replaces the characters and names Windows rejects, off keeps them as they are")
+}
+
+// windowsReserved are the device names Windows refuses as file names, with any
+// extension.
+var windowsReserved = map[string]bool{"CON": true, "PRN": true, "AUX": true, "NUL": true}
+
+func init() {
+	for i := 1; i <= 9; i++ {
+		windowsReserved[fmt.Sprintf("COM%d", i)] = true
+		windowsReserved[fmt.Sprintf("LPT%d", i)] = true
+	}
+}
+
+func validateSanitizeMode(mode string) error {
+	switch mode {
+	case "strict", "posix", "off":
+		return nil
+	}
+	return fmt.Errorf("invalid -sanitize-mode %q (expected strict, posix or off)", mode)
+}
+
+// sanitizer rewrites destinations for the -sanitize-mode, logging each rename
+// once.
+type sanitizer struct {
+	mode    string
+	renamed map[string]bool
+}
+
+func newSanitizer(mode string) *sanitizer {
+	return &sanitizer{mode: mode, renamed: make(map[string]bool)}
+}
+
+// sanitize returns dest with every path component made safe.
+func (s *sanitizer) sanitize(dest string) string {
+	if s.mode == "off" {
+		return dest
+	}
+	parts := strings.Split(dest, "/")
+	for i, part := range parts {
+		parts[i] = sanitizeComponent(part, s.mode == "strict")
+	}
+	clean := strings.Join(parts, "/")
+	if clean != dest && !s.renamed[dest] {
+		s.renamed[dest] = true
+		log.Printf("Sanitizing %s to %s", dest, clean)
+	}
+	return clean
+}
+
+// sanitizeComponent replaces the characters of one file name that cannot be used
+// and shortens it to maxNameLength, keeping the extension and adding a hash of
+// the full name so shortened names stay distinct.
+func sanitizeComponent(name string, strict bool) string {
+	clean := strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsControl(r), r == unicode.ReplacementChar:
+			return '_'
+		case strict && strings.ContainsRune(`:<>|?*"\`, r):
+			return '_'
+		}
+		return r
+	}, name)
+	if strict {
+		if trimmed := strings.TrimRight(clean, ". "); trimmed != clean && trimmed != "" {
+			clean = trimmed + strings.Repeat("_", len(clean)-len(trimmed))
+		}
+		stem, _, _ := strings.Cut(clean, ".")
+		if windowsReserved[strings.ToUpper(stem)] {
+			clean = "_" + clean
+		}
+	}
+	if len(clean) > maxNameLength {
+		sum := sha256.Sum256([]byte(name))
+		ext := path.Ext(clean)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		keep := maxNameLength - len(ext) - 9
+		for keep > 0 && !utf8.RuneStart(clean[keep]) {
+			keep--
+		}
+		clean = clean[:keep] + "-" + hex.EncodeToString(sum[:4]) + ext
+	}
+	return clean
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+// selftestMain implements "schelm selftest [options] CHART": it renders CHART with
+// helm template --output-dir and through schelm's splitter, and exits with status 1,
+// printing the differences, unless both trees are identical.
+func selftestMain(args []string) int {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return 2
+	}
+	if flag.NArg() != 1 || flag.Arg(0) == "" {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: schelm selftest [options] CHART")
+		flag.PrintDefaults()
+		return 2
+	}
+	err := runSelftest(flag.Arg(0), os.Stdout)
+	if errors.Is(err, errDifferences) {
+		return 1
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// runSelftest compares the tree helm template --output-dir writes for chart with
+// the one schelm splits from helm's stdout, with -layout helm, writing the
+// differences to stdout.
+func runSelftest(chart string, stdout io.Writer) error {
+	if _, err := exec.LookPath("helm"); err != nil {
+		return fmt.Errorf("helm is required for schelm selftest: %w", err)
+	}
+	chartRef, layout = chart, "helm"
+
+	dir, err := os.MkdirTemp("", "schelm-selftest-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	args := append(helmTemplateArgs(), "--output-dir", dir)
+	if useReleaseName {
+		args = append(args, "--release-name")
+	}
+	log.Printf("Rendering chart %s with helm template --output-dir", chart)
+	cmd := exec.Command("helm", args...)
+	cmd.Stdout = io.Discard
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("helm template %s --output-dir failed: %w", chart, err)
+	}
+	expected, err := snapshotTree(split.OSFS{}, dir)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Rendering chart %s with schelm", chart)
+	got, err := renderInMemory(strings.NewReader(""))
+	if err != nil {
+		return err
+	}
+
+	names := slices.Sorted(maps.Keys(expected))
+	for name := range got {
+		if _, ok := expected[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	var differing int
+	for _, name := range names {
+		if diff := textFileDiff(name, expected[name], got[name]); diff != "" {
+			differing++
+			if _, err := io.WriteString(stdout, diff); err != nil {
+				return err
+			}
+		}
+	}
+	if differing > 0 {
+		log.Printf("%d of %d files differ between helm (---) and schelm (+++)", differing, len(names))
+		return errDifferences
+	}
+	log.Printf("All %d files are identical", len(names))
+	return nil
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// releasesURL is the GitHub API endpoint listing the project's releases. Forks can
+// point it at their own with -ldflags "-X main.releasesURL=...".
+var releasesURL = "https://api.github.com/repos/bromaniac/schelm/releases"
+
+// Release assets: one binary per platform, the SHA-256 sums of all of them and a
+// cosign signature with its certificate over the sums.
+const (
+	checksumsAsset   = "checksums.txt"
+	signatureAsset   = "checksums.txt.sig"
+	certificateAsset = "checksums.txt.pem"
+)
+
+var httpClient = &http.Client{Timeout: 5 * time.Minute}
+
+// release is the part of a GitHub release self-update needs.
+type release struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (r *release) asset(name string) string {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL
+		}
+	}
+	return ""
+}
+
+// selfUpdateMain implements "schelm self-update [-check] [-version TAG] [-insecure]".
+func selfUpdateMain(args []string) int {
+	flags := flag.NewFlagSet("self-update", flag.ContinueOnError)
+	check := flags.Bool("check", false, "Only report whether a newer release is available")
+	tag := flags.String("version", "", "Install this release tag instead of the latest release, also when it is older than the running version")
+	insecure := flags.Bool("insecure", false, "Install releases without a cosign signature, verifying their checksums only")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: schelm self-update [-check] [-version TAG] [-insecure]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+	if err := selfUpdate(*tag, *check, *insecure); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// selfUpdate replaces the running binary with the one of the release tag, or of the
+// latest release when it is newer, after verifying its checksum and the signature
+// over the checksums, which insecure waives for unsigned releases.
+func selfUpdate(tag string, checkOnly, insecure bool) error {
+	url := releasesURL + "/latest"
+	if tag != "" {
+		url = releasesURL + "/tags/" + tag
+	}
+	data, err := download(url)
+	if err != nil {
+		return fmt.Errorf("error looking up the release: %w", err)
+	}
+	var r release
+	if err := json.Unmarshal(data, &r); err != nil {
+		return fmt.Errorf("error parsing the release: %w", err)
+	}
+
+	current := currentBuild().Version
+	if _, ok := parseSemver(r.TagName); !ok {
+		return fmt.Errorf("release tag %q is not a semantic version", r.TagName)
+	}
+	// Builds that aren't releases, such as dev, take any release
+	order, comparable := compareSemver(r.TagName, current)
+	switch {
+	case comparable && order == 0:
+		fmt.Printf("schelm %s is up to date\n", current)
+		return nil
+	case comparable && order < 0 && tag == "":
+		fmt.Printf("schelm %s is up to date (the latest release is %s)\n", current, r.TagName)
+		return nil
+	}
+	if checkOnly {
+		if comparable && order < 0 {
+			fmt.Printf("schelm %s is older than the running %s\n", r.TagName, current)
+		} else {
+			fmt.Printf("schelm %s is available (running %s)\n", r.TagName, current)
+		}
+		return nil
+	}
+	if comparable && order < 0 {
+		log.Printf("Downgrading schelm %s to %s, as -version asks", current, r.TagName)
+	}
+
+	binaryAsset := "schelm_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		binaryAsset += ".exe"
+	}
+	binaryURL, checksumsURL := r.asset(binaryAsset), r.asset(checksumsAsset)
+	if binaryURL == "" {
+		return fmt.Errorf("release %s has no binary for %s/%s", r.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+	if checksumsURL == "" {
+		return fmt.Errorf("release %s publishes no %s, refusing to install an unverified binary", r.TagName, checksumsAsset)
+	}
+	checksums, err := download(checksumsURL)
+	if err != nil {
+		return fmt.Errorf("error downloading %s: %w", checksumsAsset, err)
+	}
+	if err := verifySignature(&r, checksums, insecure); err != nil {
+		return err
+	}
+	want, err := findChecksum(checksums, binaryAsset)
+	if err != nil {
+		return err
+	}
+	log.Printf("Downloading %s %s", binaryAsset, r.TagName)
+	binary, err := download(binaryURL)
+	if err != nil {
+		return fmt.Errorf("error downloading %s: %w", binaryAsset, err)
+	}
+	if sum := sha256.Sum256(binary); hex.EncodeToString(sum[:]) != want {
+		return fmt.Errorf("checksum mismatch for %s: the download does not match %s", binaryAsset, checksumsAsset)
+	}
+
+	if err := replaceExecutable(binary); err != nil {
+		return err
+	}
+	fmt.Printf("Updated schelm %s to %s\n", current, r.TagName)
+	return nil
+}
+
+// verifySignature checks the cosign signature over the checksums of a release. An
+// unsigned release is refused unless insecure is set, as checksums published next to
+// the binary only guard against corrupted downloads, not against tampered ones.
+func verifySignature(r *release, checksums []byte, insecure bool) error {
+	signatureURL, certificateURL := r.asset(signatureAsset), r.asset(certificateAsset)
+	if signatureURL == "" || certificateURL == "" {
+		if !insecure {
+			return fmt.Errorf("release %s is not signed, refusing to install it (-insecure installs it verifying checksums only)", r.TagName)
+		}
+		log.Printf("Warning: release %s is not signed; verifying checksums only, as -insecure asks", r.TagName)
+		return nil
+	}
+	if _, err := exec.LookPath("cosign"); err != nil {
+		return fmt.Errorf("release %s is signed and verifying it requires cosign in PATH", r.TagName)
+	}
+
+	dir, err := os.MkdirTemp("", "schelm-update")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	files := map[string][]byte{checksumsAsset: checksums}
+	for name, url := range map[string]string{signatureAsset: signatureURL, certificateAsset: certificateURL} {
+		if files[name], err = download(url); err != nil {
+			return fmt.Errorf("error downloading %s: %w", name, err)
+		}
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, filePermissions); err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.Command("cosign", "verify-blob",
+		"--signature", filepath.Join(dir, signatureAsset),
+		"--certificate", filepath.Join(dir, certificateAsset),
+		"--certificate-identity-regexp", "^https://github.com/bromaniac/schelm/",
+		"--certificate-oidc-issuer", "https://token.actions.githubusercontent.com",
+		filepath.Join(dir, checksumsAsset))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("signature verification of release %s failed: %s", r.TagName, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// semver is a parsed semantic version, v1.2.3-rc.1+build.
+type semver struct {
+	major, minor, patch int
+	prerelease          []string
+}
+
+// parseSemver parses a semantic version, with or without a leading v.
+func parseSemver(v string) (semver, bool) {
+	v = strings.TrimPrefix(v, "v")
+	v, _, _ = strings.Cut(v, "+")
+	v, pre, hasPre := strings.Cut(v, "-")
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 || hasPre && pre == "" {
+		return semver{}, false
+	}
+	var numbers [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || part != strconv.Itoa(n) {
+			return semver{}, false
+		}
+		numbers[i] = n
+	}
+	s := semver{major: numbers[0], minor: numbers[1], patch: numbers[2]}
+	if hasPre {
+		s.prerelease = strings.Split(pre, ".")
+	}
+	return s, true
+}
+
+// compareSemver compares the semantic versions a and b like cmp.Compare, with
+// prereleases before their release. It returns false if either isn't one.
+func compareSemver(a, b string) (int, bool) {
+	va, okA := parseSemver(a)
+	vb, okB := parseSemver(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	if c := cmp.Compare(va.major, vb.major); c != 0 {
+		return c, true
+	}
+	if c := cmp.Compare(va.minor, vb.minor); c != 0 {
+		return c, true
+	}
+	if c := cmp.Compare(va.patch, vb.patch); c != 0 {
+		return c, true
+	}
+	switch {
+	case len(va.prerelease) == 0 && len(vb.prerelease) == 0:
+		return 0, true
+	case len(va.prerelease) == 0:
+		return 1, true
+	case len(vb.prerelease) == 0:
+		return -1, true
+	}
+	for i := 0; i < len(va.prerelease) && i < len(vb.prerelease); i++ {
+		if c := comparePrerelease(va.prerelease[i], vb.prerelease[i]); c != 0 {
+			return c, true
+		}
+	}
+	return cmp.Compare(len(va.prerelease), len(vb.prerelease)), true
+}
+
+// comparePrerelease compares prerelease identifiers: numeric ones numerically and
+// before alphanumeric ones, which compare as strings.
+func comparePrerelease(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return cmp.Compare(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// findChecksum returns the SHA-256 sum of name in a sha256sum-style listing.
+func findChecksum(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("%s lists no checksum for %s", checksumsAsset, name)
+}
+
+// replaceExecutable atomically replaces the running binary with binary.
+func replaceExecutable(binary []byte) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("error locating the running binary: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return fmt.Errorf("error locating the running binary: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".schelm-update-*")
+	if err != nil {
+		return fmt.Errorf("error writing next to %s: %w", exe, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		return fmt.Errorf("error replacing %s: %w", exe, err)
+	}
+	return nil
+}
+
+// download fetches url into memory.
+func download(url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(url + ": " + resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
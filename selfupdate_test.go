@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCompareSemver(t *testing.T) {
+	tests := []struct {
+		a, b       string
+		want       int
+		comparable bool
+	}{
+		{"v1.2.3", "v1.2.3", 0, true},
+		{"1.2.3", "v1.2.3", 0, true},
+		{"v1.2.4", "v1.2.3", 1, true},
+		{"v1.10.0", "v1.9.0", 1, true},
+		{"v2.0.0", "v10.0.0", -1, true},
+		{"v1.2.3-rc.1", "v1.2.3", -1, true},
+		{"v1.2.3-rc.2", "v1.2.3-rc.10", -1, true},
+		{"v1.2.3-rc.1", "v1.2.3-beta", 1, true},
+		{"v1.2.3-1", "v1.2.3-alpha", -1, true},
+		{"v1.2.3-alpha", "v1.2.3-alpha.1", -1, true},
+		{"v1.2.3+build.5", "v1.2.3", 0, true},
+		{"dev", "v1.2.3", 0, false},
+		{"v1.2", "v1.2.0", 0, false},
+		{"v1.02.3", "v1.2.3", 0, false},
+		{"v1.2.3-", "v1.2.3", 0, false},
+		{"", "v1.2.3", 0, false},
+	}
+	for _, tt := range tests {
+		got, comparable := compareSemver(tt.a, tt.b)
+		if got != tt.want || comparable != tt.comparable {
+			t.Errorf("compareSemver(%q, %q) = %d, %v; want %d, %v", tt.a, tt.b, got, comparable, tt.want, tt.comparable)
+		}
+	}
+}
+
+func TestFindChecksum(t *testing.T) {
+	checksums := []byte("ABC123  schelm_linux_amd64\ndef456 *schelm_windows_amd64.exe\n")
+	tests := []struct{ name, want string }{
+		{"schelm_linux_amd64", "abc123"},
+		{"schelm_windows_amd64.exe", "def456"},
+		{"schelm_darwin_arm64", ""},
+		{"schelm_linux", ""},
+	}
+	for _, tt := range tests {
+		got, err := findChecksum(checksums, tt.name)
+		if got != tt.want || (err == nil) != (tt.want != "") {
+			t.Errorf("findChecksum(%s) = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+// releaseServer serves releases like the GitHub API, with the given assets and their
+// contents, keyed by name.
+func releaseServer(t *testing.T, latest string, assets map[string]string) {
+	t.Helper()
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	serveRelease := func(w http.ResponseWriter, tag string) {
+		r := map[string]any{"tag_name": tag}
+		var list []map[string]string
+		for name := range assets {
+			list = append(list, map[string]string{"name": name, "browser_download_url": server.URL + "/download/" + name})
+		}
+		r["assets"] = list
+		json.NewEncoder(w).Encode(r)
+	}
+	mux.HandleFunc("/releases/latest", func(w http.ResponseWriter, r *http.Request) { serveRelease(w, latest) })
+	mux.HandleFunc("/releases/tags/{tag}", func(w http.ResponseWriter, r *http.Request) { serveRelease(w, r.PathValue("tag")) })
+	mux.HandleFunc("/download/{name}", func(w http.ResponseWriter, r *http.Request) {
+		content, ok := assets[r.PathValue("name")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, content)
+	})
+	setFlag(t, &releasesURL, server.URL+"/releases")
+}
+
+// captureStdout returns what f prints.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	f()
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestSelfUpdate(t *testing.T) {
+	binaryAsset := "schelm_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		binaryAsset += ".exe"
+	}
+	unsigned := map[string]string{
+		binaryAsset:    "new binary",
+		checksumsAsset: strings.Repeat("0", 64) + "  " + binaryAsset + "\n",
+	}
+	tests := []struct {
+		name     string
+		running  string
+		latest   string
+		assets   map[string]string
+		tag      string
+		check    bool
+		insecure bool
+		output   string // printed on success
+		err      string // part of the error, if one is expected
+	}{
+		{name: "up to date", running: "v1.2.0", latest: "v1.2.0", assets: unsigned, output: "schelm v1.2.0 is up to date\n"},
+		{name: "newer than the latest release", running: "v1.3.0-rc.1", latest: "v1.2.0", assets: unsigned,
+			output: "schelm v1.3.0-rc.1 is up to date (the latest release is v1.2.0)\n"},
+		{name: "check finds a newer release", running: "v1.2.0", latest: "v1.10.0", assets: unsigned, check: true,
+			output: "schelm v1.10.0 is available (running v1.2.0)\n"},
+		{name: "check of an older tag", running: "v1.2.0", latest: "v1.2.0", tag: "v1.1.0", assets: unsigned, check: true,
+			output: "schelm v1.1.0 is older than the running v1.2.0\n"},
+		{name: "development builds take any release", running: "dev", latest: "v0.1.0", assets: unsigned, check: true,
+			output: "schelm v0.1.0 is available (running dev)\n"},
+		{name: "tag that isn't a version", running: "v1.2.0", latest: "nightly", assets: unsigned, err: "not a semantic version"},
+		{name: "unsigned release", running: "v1.2.0", latest: "v1.3.0", assets: unsigned, err: "is not signed"},
+		{name: "unsigned downgrade", running: "v1.2.0", latest: "v1.2.0", tag: "v1.1.0", assets: unsigned, err: "is not signed"},
+		{name: "unsigned release with -insecure still checks the checksum", running: "v1.2.0", latest: "v1.3.0", assets: unsigned, insecure: true,
+			err: "checksum mismatch"},
+		{name: "no checksums", running: "v1.2.0", latest: "v1.3.0", assets: map[string]string{binaryAsset: "new binary"}, insecure: true,
+			err: "publishes no checksums.txt"},
+		{name: "no binary for the platform", running: "v1.2.0", latest: "v1.3.0", assets: map[string]string{checksumsAsset: ""}, insecure: true,
+			err: "has no binary for"},
+		{name: "binary missing from the checksums", running: "v1.2.0", latest: "v1.3.0", insecure: true,
+			assets: map[string]string{binaryAsset: "new binary", checksumsAsset: "abc  other\n"}, err: "lists no checksum"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			releaseServer(t, tt.latest, tt.assets)
+			setFlag(t, &version, tt.running)
+			var err error
+			output := captureStdout(t, func() { err = selfUpdate(tt.tag, tt.check, tt.insecure) })
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("selfUpdate() = %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != tt.output {
+				t.Errorf("printed %q, want %q", output, tt.output)
+			}
+		})
+	}
+}
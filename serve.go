@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+var (
+	listenAddress   string        // Address schelm serve listens on
+	shutdownTimeout time.Duration // How long schelm serve waits for running renders on SIGTERM
+)
+
+func init() {
+	flag.StringVar(&listenAddress, "listen", ":8080", "With schelm serve and schelm daemon, the address to listen on")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "With schelm serve, how long to wait for running renders after SIGTERM")
+}
+
+// serveMain implements "schelm serve [options] OUTPUT_ROOT": an HTTP service
+// splitting the helm output POSTed to /render/NAME into OUTPUT_ROOT/NAME, with the
+// options of a plain schelm run.
+func serveMain(args []string) int {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return 2
+	}
+	if flag.NArg() != 1 || flag.Arg(0) == "" {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: schelm serve [options] OUTPUT_ROOT")
+		flag.PrintDefaults()
+		return 2
+	}
+	if err := checkServeFlags(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	limits, err := newServerLimits()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	s := newServer(split.OSFS{}, flag.Arg(0), limits)
+	if authConfigFile != "" {
+		clients, err := loadServeClients(authConfigFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		s.clients = clients
+	}
+	if err := s.listen(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// serveFileFlags are the options that write files of their own outside the output,
+// such as a report next to it or the -trash below the temporary directory. Every
+// render would write to the same place, outside the tenant roots renders are
+// confined to, so schelm serve refuses them.
+var serveFileFlags = []string{"archive", "dest", "emit-patch", "html-report", "path-map", "report-file", "skaffold", "stats-file", "summary-md", "tiltfile", "trace", "trash"}
+
+// checkServeFlags reports the serveFileFlags that were set.
+func checkServeFlags() error {
+	var set []string
+	flag.Visit(func(f *flag.Flag) {
+		if slices.Contains(serveFileFlags, f.Name) {
+			set = append(set, "-"+f.Name)
+		}
+	})
+	if len(set) > 0 {
+		return fmt.Errorf("schelm serve writes every render to OUTPUT_ROOT/NAME and can't use %s; the response carries what a run prints to stdout, such as a -report-format report", strings.Join(set, ", "))
+	}
+	return nil
+}
+
+// listen serves until SIGTERM or SIGINT, then stops accepting requests and waits up
+// to -shutdown-timeout for running renders to finish.
+func (s *server) listen() error {
+	if _, err := s.fsys.Stat(s.root); err != nil {
+		return fmt.Errorf("output root %s: %w", s.root, err)
+	}
+	config, err := serverTLSConfig()
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return err
+	}
+	if config != nil {
+		listener = tls.NewListener(listener, config)
+	}
+	srv := &http.Server{Handler: s.handler()}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(listener) }()
+	log.Printf("Serving renders into %s on %s", s.root, listener.Addr())
+	s.ready.Store(true)
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	// Fail readiness first so load balancers stop sending requests, then drain.
+	s.ready.Store(false)
+	log.Printf("Shutting down, waiting up to %s for running renders", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error shutting down: %w", err)
+	}
+	return nil
+}
+
+// server splits the streams it receives into directories below root.
+type server struct {
+	fsys    split.FS
+	root    string
+	metrics *serverMetrics
+	clients []serveClient // who may render, nil when -auth-config is not set
+	limits  *serverLimits
+	ready   atomic.Bool // Whether the server accepts renders, for /readyz
+
+	// A render reads the process-wide options and swaps the log output, so only one
+	// runs at a time.
+	mu sync.Mutex
+}
+
+func newServer(fsys split.FS, root string, limits *serverLimits) *server {
+	return &server{fsys: fsys, root: root, metrics: newServerMetrics(), limits: limits}
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("POST /render/{name...}", s.metrics.instrument("/render", http.HandlerFunc(s.render)))
+	mux.HandleFunc("GET /metrics", s.metrics.serveHTTP)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		io.WriteString(w, "ok\n")
+	})
+	mux.HandleFunc("GET /readyz", s.readyz)
+	return mux
+}
+
+// readyz reports whether the server takes renders: it is listening, not shutting
+// down, and the output root is still there.
+func (s *server) readyz(w http.ResponseWriter, _ *http.Request) {
+	if !s.ready.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	if stat, err := s.fsys.Stat(s.root); err != nil || !stat.IsDir() {
+		http.Error(w, fmt.Sprintf("output root %s is unavailable", s.root), http.StatusServiceUnavailable)
+		return
+	}
+	io.WriteString(w, "ok\n")
+}
+
+// render splits the request body into the directory named by the request path and
+// responds with what the run wrote to stdout, such as a report.
+func (s *server) render(w http.ResponseWriter, r *http.Request) {
+	var client *serveClient
+	if s.clients != nil {
+		var err error
+		if client, err = authenticate(s.clients, r); err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="schelm"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+	name, ok := relativePath(r.PathValue("name"))
+	if !ok {
+		http.Error(w, fmt.Sprintf("invalid output directory %q", r.PathValue("name")), http.StatusBadRequest)
+		return
+	}
+	tenant, err := tenantRoot(s.root, client, r)
+	if errors.Is(err, errForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, wait := s.limits.allow(clientKey(client, r)); !ok {
+		retryAfter(w, wait)
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+	if !s.limits.acquire() {
+		retryAfter(w, time.Second)
+		http.Error(w, "too many concurrent renders", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.limits.release()
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.limits.maxBody))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("stream exceeds -max-request-size %s", maxRequestSize), http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("error reading request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.fsys.MkdirAll(tenant, dirPermissions); err != nil {
+		http.Error(w, fmt.Sprintf("error creating %s: %v", tenant, err), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	start := time.Now()
+	fsys := &meteredFS{FS: confinedFS{FS: s.fsys, root: tenant}}
+	var stdout bytes.Buffer
+	err = run(fsys, bytes.NewReader(body), &stdout, path.Join(tenant, name))
+	s.metrics.observeRender(bytes.Count(body, []byte(yamlSeparator)), fsys.written, time.Since(start), err)
+	s.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Render of %s failed: %v", path.Join(tenant, name), err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(stdout.Bytes())
+}
+
+// relativePath cleans p and reports whether it names a directory strictly below the
+// one it is relative to.
+func relativePath(p string) (string, bool) {
+	p = path.Clean(p)
+	return p, p != "." && p != ".." && !strings.HasPrefix(p, "../") && !path.IsAbs(p)
+}
+
+// meteredFS counts the bytes written through a split.FS.
+type meteredFS struct {
+	split.FS
+	written int64
+}
+
+func (m *meteredFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.written += int64(len(data))
+	return m.FS.WriteFile(name, data, perm)
+}
+
+func (m *meteredFS) AppendFile(name string, data []byte) error {
+	m.written += int64(len(data))
+	return m.FS.AppendFile(name, data)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+// testServer returns a server rendering into a temporary directory, ready for
+// requests, with the limits the current flags set.
+func testServer(t *testing.T) *server {
+	t.Helper()
+	limits, err := newServerLimits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(split.OSFS{}, t.TempDir(), limits)
+	s.ready.Store(true)
+	return s
+}
+
+// do sends a request to the handler of s.
+func do(s *server, method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	s.handler().ServeHTTP(w, r)
+	return w
+}
+
+var serveInput = helmOutput("chart/templates/cm.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n")
+
+func TestRelativePath(t *testing.T) {
+	tests := []struct {
+		p, want string
+		ok      bool
+	}{
+		{"app", "app", true},
+		{"team/app/", "team/app", true},
+		{"team/../app", "app", true},
+		{"", ".", false},
+		{".", ".", false},
+		{"..", "..", false},
+		{"../app", "../app", false},
+		{"app/../..", "..", false},
+		{"/etc", "/etc", false},
+	}
+	for _, tt := range tests {
+		got, ok := relativePath(tt.p)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("relativePath(%q) = %q, %v; want %q, %v", tt.p, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestServeRender(t *testing.T) {
+	s := testServer(t)
+	w := do(s, "POST", "/render/team/app", serveInput, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	data, err := os.ReadFile(filepath.Join(s.root, "team", "app", "chart", "templates", "cm.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "name: a") {
+		t.Errorf("cm.yaml = %q", data)
+	}
+
+	// Without -f a render doesn't replace an earlier one.
+	if w := do(s, "POST", "/render/team/app", serveInput, nil); w.Code != http.StatusInternalServerError {
+		t.Errorf("second render: status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	setFlag(t, &force, true)
+	if w := do(s, "POST", "/render/team/app", serveInput, nil); w.Code != http.StatusOK {
+		t.Errorf("second render with -f: status %d: %s", w.Code, w.Body)
+	}
+
+	metrics := do(s, "GET", "/metrics", "", nil).Body.String()
+	for _, want := range []string{
+		`schelm_http_requests_total{handler="/render",code="200"} 2`,
+		`schelm_http_requests_total{handler="/render",code="500"} 1`,
+		"schelm_documents_processed_total 3",
+		"schelm_render_errors_total 1",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("/metrics lacks %s:\n%s", want, metrics)
+		}
+	}
+}
+
+func TestServeRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{"GET", "GET", "/render/app", "", http.StatusMethodNotAllowed},
+		{"no name", "POST", "/render/", serveInput, http.StatusBadRequest},
+		{"escaping name", "POST", "/render/a/%2e%2e/%2e%2e/b", serveInput, http.StatusBadRequest},
+		{"too large", "POST", "/render/app", serveInput + strings.Repeat("#\n", 1024), http.StatusRequestEntityTooLarge},
+	}
+	setFlag(t, &maxRequestSize, "1KiB")
+	s := testServer(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do(s, tt.method, tt.target, tt.body, nil); w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+	if entries, _ := os.ReadDir(s.root); len(entries) != 0 {
+		t.Errorf("rejected renders wrote %v", entries)
+	}
+}
+
+func TestServeConfinesSources(t *testing.T) {
+	s := testServer(t)
+	input := helmOutput("../../../escaped.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n")
+	do(s, "POST", "/render/app", input, nil)
+	if _, err := os.Stat(filepath.Join(filepath.Dir(s.root), "escaped.yaml")); err == nil {
+		t.Error("a Source wrote outside the output root")
+	}
+}
+
+func TestServeLimits(t *testing.T) {
+	t.Run("rate limit", func(t *testing.T) {
+		setFlag(t, &rateLimit, 1)
+		s := testServer(t)
+		if w := do(s, "POST", "/render/a", serveInput, nil); w.Code != http.StatusOK {
+			t.Fatalf("first render: status %d: %s", w.Code, w.Body)
+		}
+		w := do(s, "POST", "/render/b", serveInput, nil)
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+			t.Errorf("second render: status %d, Retry-After %q; want %d with Retry-After", w.Code, w.Header().Get("Retry-After"), http.StatusTooManyRequests)
+		}
+	})
+	t.Run("concurrency", func(t *testing.T) {
+		setFlag(t, &maxConcurrentRequests, 1)
+		s := testServer(t)
+		if !s.limits.acquire() {
+			t.Fatal("no slot for the first render")
+		}
+		if w := do(s, "POST", "/render/a", serveInput, nil); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("render with every slot taken: status %d, want %d", w.Code, http.StatusServiceUnavailable)
+		}
+		s.limits.release()
+		if w := do(s, "POST", "/render/a", serveInput, nil); w.Code != http.StatusOK {
+			t.Errorf("render after the slot was released: status %d: %s", w.Code, w.Body)
+		}
+	})
+}
+
+func TestNewServerLimits(t *testing.T) {
+	tests := []struct {
+		size       string
+		concurrent int
+		rate       int
+		ok         bool
+	}{
+		{"64MiB", 16, 0, true},
+		{"500K", 0, 10, true},
+		{"lots", 16, 0, false},
+		{"1MiB", -1, 0, false},
+		{"1MiB", 1, -1, false},
+	}
+	for _, tt := range tests {
+		setFlag(t, &maxRequestSize, tt.size)
+		setFlag(t, &maxConcurrentRequests, tt.concurrent)
+		setFlag(t, &rateLimit, tt.rate)
+		if _, err := newServerLimits(); (err == nil) != tt.ok {
+			t.Errorf("newServerLimits(%s, %d, %d) = %v, want ok %v", tt.size, tt.concurrent, tt.rate, err, tt.ok)
+		}
+	}
+}
+
+func TestServeProbes(t *testing.T) {
+	s := testServer(t)
+	if w := do(s, "GET", "/healthz", "", nil); w.Code != http.StatusOK {
+		t.Errorf("/healthz: status %d", w.Code)
+	}
+	if w := do(s, "GET", "/readyz", "", nil); w.Code != http.StatusOK {
+		t.Errorf("/readyz: status %d", w.Code)
+	}
+	s.ready.Store(false)
+	if w := do(s, "GET", "/readyz", "", nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz while shutting down: status %d", w.Code)
+	}
+	s.ready.Store(true)
+	os.Remove(s.root)
+	if w := do(s, "GET", "/readyz", "", nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz without the output root: status %d", w.Code)
+	}
+}
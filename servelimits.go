@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	maxRequestSize        string // Largest stream schelm serve accepts
+	maxConcurrentRequests int    // Renders schelm serve accepts at once, running or queued
+	rateLimit             int    // Renders per minute and client
+)
+
+func init() {
+	flag.StringVar(&maxRequestSize, "max-request-size", "64MiB", "With schelm serve, reject streams larger than this, e.g. 500K or 1GiB")
+	flag.IntVar(&maxConcurrentRequests, "max-concurrent-requests", 16, "With schelm serve, renders accepted at once, running or waiting for their turn; more are rejected (0 disables the limit)")
+	flag.IntVar(&rateLimit, "rate-limit", 0, "With schelm serve, renders per minute each client (authenticated name or address) may start (0 disables the limit)")
+}
+
+// serverLimits keeps one client from exhausting the memory or disk of the server.
+type serverLimits struct {
+	maxBody int64
+	slots   chan struct{} // nil when concurrency is unlimited
+	perMin  int
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newServerLimits() (*serverLimits, error) {
+	maxBody, err := parseByteSize(maxRequestSize)
+	if err != nil {
+		return nil, fmt.Errorf("-max-request-size: %w", err)
+	}
+	if maxConcurrentRequests < 0 || rateLimit < 0 {
+		return nil, fmt.Errorf("-max-concurrent-requests and -rate-limit cannot be negative")
+	}
+	l := &serverLimits{maxBody: maxBody, perMin: rateLimit, buckets: make(map[string]*tokenBucket)}
+	if maxConcurrentRequests > 0 {
+		l.slots = make(chan struct{}, maxConcurrentRequests)
+	}
+	return l, nil
+}
+
+// acquire takes a render slot, returning false if all are taken.
+func (l *serverLimits) acquire() bool {
+	if l.slots == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *serverLimits) release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// maxTrackedClients bounds the rate limiter's memory; beyond it, clients whose
+// buckets have refilled are forgotten.
+const maxTrackedClients = 10000
+
+// allow takes a token from the bucket of client. When the bucket is empty it returns
+// false and how long until the next token.
+func (l *serverLimits) allow(client string) (bool, time.Duration) {
+	if l.perMin == 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	b, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= maxTrackedClients {
+			for c, b := range l.buckets {
+				if b.refill(now, l.perMin) == float64(l.perMin) {
+					delete(l.buckets, c)
+				}
+			}
+		}
+		b = &tokenBucket{tokens: float64(l.perMin), updated: now}
+		l.buckets[client] = b
+	}
+	if b.refill(now, l.perMin) < 1 {
+		return false, time.Duration((1 - b.tokens) * float64(time.Minute) / float64(l.perMin))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// tokenBucket allows bursts of up to a minute's worth of renders.
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// refill adds the tokens earned since the last update and returns the new count.
+func (b *tokenBucket) refill(now time.Time, perMin int) float64 {
+	earned := now.Sub(b.updated).Minutes() * float64(perMin)
+	b.tokens, b.updated = math.Min(float64(perMin), b.tokens+earned), now
+	return b.tokens
+}
+
+// clientKey identifies the client of r for rate limiting.
+func clientKey(client *serveClient, r *http.Request) string {
+	if client != nil {
+		return "client:" + client.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// retryAfter sets the Retry-After header to d, rounded up to whole seconds.
+func retryAfter(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+}
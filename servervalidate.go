@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+)
+
+var serverValidate bool // Whether to dry-run every document against the API server
+
+func init() {
+	flag.BoolVar(&serverValidate, "server-validate", false, "Submit every document to the API server with a server-side dry run (kubectl, see -kubeconfig and -context), reporting webhook and schema errors per file")
+}
+
+// newServerValidateCheck returns a check that applies every document with
+// --dry-run=server, so admission webhooks and the server's schema see it without
+// anything being persisted.
+func newServerValidateCheck() (check, error) {
+	if err := requireKubectl(); err != nil {
+		return nil, err
+	}
+	return func(specs []*spec) []finding {
+		var findings []finding
+		for _, s := range specs {
+			if s.kind() == "" {
+				continue
+			}
+			log.Printf("Validating %s from %s against the API server", resourceName(s), s.dest)
+			if _, err := kubectl([]byte(s.content), "apply", "--dry-run=server", "-o", "name", "-f", "-"); err != nil {
+				findings = append(findings, finding{
+					spec:     s,
+					check:    "server-validate",
+					severity: severityError,
+					message:  fmt.Sprintf("server-side dry run failed: %v", err),
+				})
+			}
+		}
+		return findings
+	}, nil
+}
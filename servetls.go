@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	tlsCertFile string // Certificate schelm serve terminates TLS with
+	tlsKeyFile  string // Private key of the -tls-cert certificate
+	tlsReload   bool   // Whether a rotated certificate is picked up without a restart
+)
+
+func init() {
+	flag.StringVar(&tlsCertFile, "tls-cert", "", "With schelm serve, serve HTTPS with this PEM certificate (requires -tls-key)")
+	flag.StringVar(&tlsKeyFile, "tls-key", "", "With schelm serve, the PEM private key of -tls-cert")
+	flag.BoolVar(&tlsReload, "tls-reload", false, "With schelm serve, reload -tls-cert and -tls-key when they change on disk, e.g. when cert-manager rotates them")
+}
+
+// serverTLSConfig returns the TLS configuration of schelm serve, or nil to serve
+// plain HTTP.
+func serverTLSConfig() (*tls.Config, error) {
+	if (tlsCertFile == "") != (tlsKeyFile == "") {
+		return nil, errors.New("-tls-cert and -tls-key must be set together")
+	}
+	if tlsCertFile == "" {
+		if clientCAFile != "" || tlsReload {
+			return nil, errors.New("-client-ca and -tls-reload require -tls-cert and -tls-key")
+		}
+		return nil, nil
+	}
+	certs := &certReloader{certFile: tlsCertFile, keyFile: tlsKeyFile, reload: tlsReload}
+	if err := certs.load(); err != nil {
+		return nil, err
+	}
+	config := &tls.Config{GetCertificate: certs.get, MinVersion: tls.VersionTLS12}
+	if err := clientTLSConfig(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// certReloaderInterval is how often a reloading certReloader looks at the files.
+const certReloaderInterval = 10 * time.Second
+
+// certReloader serves a certificate loaded from disk. With reload set it reloads the
+// files when their modification time changes, keeping the previous certificate if
+// the new files don't load, e.g. because only one of them has been replaced yet.
+type certReloader struct {
+	certFile, keyFile string
+	reload            bool
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time // latest modification time of the loaded files
+	checked time.Time
+}
+
+func (c *certReloader) load() error {
+	modTime, err := c.filesModTime()
+	if err != nil {
+		return fmt.Errorf("error loading TLS certificate: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading TLS certificate: %w", err)
+	}
+	c.cert, c.modTime = &cert, modTime
+	return nil
+}
+
+func (c *certReloader) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{c.certFile, c.keyFile} {
+		stat, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if stat.ModTime().After(latest) {
+			latest = stat.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// get implements tls.Config.GetCertificate.
+func (c *certReloader) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reload && time.Since(c.checked) >= certReloaderInterval {
+		c.checked = time.Now()
+		if modTime, err := c.filesModTime(); err == nil && !modTime.Equal(c.modTime) {
+			if err := c.load(); err != nil {
+				log.Printf("Warning: keeping the current TLS certificate: %v", err)
+			} else {
+				log.Printf("Reloaded TLS certificate %s", c.certFile)
+			}
+		}
+	}
+	return c.cert, nil
+}
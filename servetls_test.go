@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for name and its key to dir and
+// returns their paths.
+func writeCert(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeFile(t, certFile, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	writeFile(t, keyFile, string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})))
+	return certFile, keyFile
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "schelm.example.com")
+	garbage := filepath.Join(dir, "garbage.pem")
+	writeFile(t, garbage, "not a certificate\n")
+	tests := []struct {
+		name                  string
+		cert, key, clientCA   string
+		reload, enabled, fail bool
+	}{
+		{name: "plain HTTP"},
+		{name: "TLS", cert: certFile, key: keyFile, enabled: true},
+		{name: "mTLS", cert: certFile, key: keyFile, clientCA: certFile, enabled: true},
+		{name: "reload", cert: certFile, key: keyFile, reload: true, enabled: true},
+		{name: "certificate without key", cert: certFile, fail: true},
+		{name: "key without certificate", key: keyFile, fail: true},
+		{name: "client CA without TLS", clientCA: certFile, fail: true},
+		{name: "reload without TLS", reload: true, fail: true},
+		{name: "missing certificate", cert: filepath.Join(dir, "missing.crt"), key: keyFile, fail: true},
+		{name: "invalid certificate", cert: garbage, key: keyFile, fail: true},
+		{name: "invalid client CA", cert: certFile, key: keyFile, clientCA: garbage, fail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, &tlsCertFile, tt.cert)
+			setFlag(t, &tlsKeyFile, tt.key)
+			setFlag(t, &clientCAFile, tt.clientCA)
+			setFlag(t, &tlsReload, tt.reload)
+			config, err := serverTLSConfig()
+			if tt.fail {
+				if err == nil {
+					t.Error("serverTLSConfig() succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (config != nil) != tt.enabled {
+				t.Fatalf("serverTLSConfig() = %v, want TLS %v", config, tt.enabled)
+			}
+			if config == nil {
+				return
+			}
+			if config.MinVersion != tls.VersionTLS12 {
+				t.Errorf("minimum version %x", config.MinVersion)
+			}
+			if wantClientCA := tt.clientCA != ""; (config.ClientCAs != nil) != wantClientCA || (config.ClientAuth == tls.VerifyClientCertIfGiven) != wantClientCA {
+				t.Errorf("client certificates verified %v, ClientAuth %v", config.ClientCAs != nil, config.ClientAuth)
+			}
+		})
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	commonName := func(c *certReloader) string {
+		t.Helper()
+		cert, err := c.get(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.Subject.CommonName
+	}
+	touch := func(file string, modTime time.Time) {
+		t.Helper()
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rotate := func(dir, name string, modTime time.Time) {
+		certFile, keyFile := writeCert(t, dir, name)
+		touch(certFile, modTime)
+		touch(keyFile, modTime)
+	}
+	for _, reload := range []bool{false, true} {
+		dir := t.TempDir()
+		certFile, keyFile := writeCert(t, dir, "old")
+		c := &certReloader{certFile: certFile, keyFile: keyFile, reload: reload}
+		if err := c.load(); err != nil {
+			t.Fatal(err)
+		}
+		rotate(dir, "new", time.Now().Add(time.Minute))
+		want := "old"
+		if reload {
+			want = "new"
+		}
+		if got := commonName(c); got != want {
+			t.Errorf("reload %v: serving %s after the rotation, want %s", reload, got, want)
+		}
+
+		// Half-rotated files don't replace a working certificate.
+		writeFile(t, keyFile, "truncated")
+		touch(keyFile, time.Now().Add(2*time.Minute))
+		c.checked = time.Time{}
+		if got := commonName(c); got != want {
+			t.Errorf("reload %v: serving %s after a broken rotation, want %s", reload, got, want)
+		}
+	}
+}
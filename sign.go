@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+// provenanceBuildType identifies how schelm renders in its provenance.
+const provenanceBuildType = "https://github.com/bromaniac/schelm/render/v1"
+
+var (
+	signOutput bool   // Whether to sign the output and attest its provenance with cosign
+	signingKey string // cosign key reference; keyless signing without one
+)
+
+func init() {
+	flag.BoolVar(&signOutput, "sign", false, "Sign the -archive, or an index of the files of OUTPUT_DIR, with cosign and attest its SLSA provenance (chart digest, values hashes, schelm version)")
+	flag.StringVar(&signingKey, "sign-key", "", "With -sign, the cosign key to sign with (file, KMS or hardware key reference) instead of keyless signing")
+}
+
+// digestReader hashes what is read through it, to record the input stream in the
+// provenance.
+type digestReader struct {
+	r    io.Reader
+	hash hash.Hash
+}
+
+func newDigestReader(r io.Reader) *digestReader {
+	return &digestReader{r: r, hash: sha256.New()}
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.hash.Write(p[:n])
+	return n, err
+}
+
+// checkSigning rejects outputs -sign cannot cover.
+func checkSigning(outputDirectory string) error {
+	if _, err := exec.LookPath("cosign"); err != nil {
+		return fmt.Errorf("-sign requires cosign in PATH: %w", err)
+	}
+	if destURL != "" {
+		return fmt.Errorf("-sign signs an -archive or OUTPUT_DIR and cannot be combined with -dest")
+	}
+	if archivePath == "" && outputDirectory == "" {
+		return fmt.Errorf("-sign requires an -archive or OUTPUT_DIR")
+	}
+	return nil
+}
+
+// signRender signs the render and attests its provenance. The subject is the
+// -archive, or for a directory an index of its files in sha256sum format written
+// next to it as DIR.sha256. The signature, certificate, provenance predicate and
+// signed attestation are written next to the subject.
+func signRender(outputDirectory string, input *digestReader, started time.Time) error {
+	subject := archivePath
+	if subject == "" {
+		subject = filepath.Clean(outputDirectory) + ".sha256"
+		index, err := indexTree(outputDirectory)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(subject, index, filePermissions); err != nil {
+			return fmt.Errorf("error writing index %s: %w", subject, err)
+		}
+	}
+	data, err := os.ReadFile(subject)
+	if err != nil {
+		return err
+	}
+
+	predicate, err := json.MarshalIndent(newProvenance(input, started), "", "  ")
+	if err != nil {
+		return err
+	}
+	predicateFile := subject + ".provenance.json"
+	if err := os.WriteFile(predicateFile, append(predicate, '\n'), filePermissions); err != nil {
+		return fmt.Errorf("error writing provenance %s: %w", predicateFile, err)
+	}
+
+	log.Printf("Signing %s (sha256:%s)", subject, sha256Hex(data))
+	signArgs := []string{"sign-blob", "--yes", "--output-signature", subject + ".sig", "--output-certificate", subject + ".pem"}
+	attestArgs := []string{"attest-blob", "--yes", "--predicate", predicateFile, "--type", "slsaprovenance1", "--output-attestation", subject + ".intoto.jsonl"}
+	if signingKey != "" {
+		signArgs = append(signArgs, "--key", signingKey)
+		attestArgs = append(attestArgs, "--key", signingKey)
+	}
+	for _, args := range [][]string{append(signArgs, subject), append(attestArgs, subject)} {
+		if err := cosign(args...); err != nil {
+			return err
+		}
+	}
+	log.Printf("Wrote %s.sig and the provenance attestation %s.intoto.jsonl", subject, subject)
+	return nil
+}
+
+// cosign runs a cosign command, passing its messages through. Stdin holds the
+// render, so key passwords come from $COSIGN_PASSWORD.
+func cosign(args ...string) error {
+	cmd := exec.Command("cosign", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("cosign %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// indexTree lists the files below dir with their SHA-256 sums, sorted, as
+// sha256sum prints them.
+func indexTree(dir string) ([]byte, error) {
+	files, err := snapshotTree(split.OSFS{}, dir)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		fmt.Fprintf(&b, "%s  %s\n", sha256Hex(files[name]), name)
+	}
+	return b.Bytes(), nil
+}
+
+// provenance is the SLSA v1 provenance predicate of a render.
+type provenance struct {
+	BuildDefinition struct {
+		BuildType            string               `json:"buildType"`
+		ExternalParameters   map[string]any       `json:"externalParameters"`
+		ResolvedDependencies []resourceDescriptor `json:"resolvedDependencies,omitempty"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID      string            `json:"id"`
+			Version map[string]string `json:"version"`
+		} `json:"builder"`
+		Metadata struct {
+			StartedOn  string `json:"startedOn"`
+			FinishedOn string `json:"finishedOn"`
+		} `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+type resourceDescriptor struct {
+	Name   string            `json:"name,omitempty"`
+	URI    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// newProvenance describes the render: the chart and its digest when it is local,
+// or the digest of the input stream, and the hashes of the values files and of the
+// values set on the command line.
+func newProvenance(input *digestReader, started time.Time) *provenance {
+	var p provenance
+	p.BuildDefinition.BuildType = provenanceBuildType
+	params := map[string]any{"format": format}
+	if chartRef != "" {
+		params["chart"] = chartRef
+		params["release"] = releaseName
+		if chartVersion != "" {
+			params["chartVersion"] = chartVersion
+		}
+		if helmNamespace != "" {
+			params["namespace"] = helmNamespace
+		}
+		if len(helmSet)+len(helmSetString) > 0 {
+			params["set"] = setDigests(slices.Concat(helmSet, helmSetString))
+		}
+		chart := resourceDescriptor{Name: "chart", URI: chartRef}
+		if digest, err := chartDigest(chartRef); err == nil {
+			chart.Digest = map[string]string{"sha256": digest}
+		}
+		p.BuildDefinition.ResolvedDependencies = append(p.BuildDefinition.ResolvedDependencies, chart)
+		files := slices.Clone(helmValues)
+		for _, set := range helmSetFile {
+			_, file, _ := strings.Cut(set, "=")
+			files = append(files, file)
+		}
+		for _, file := range files {
+			values := resourceDescriptor{Name: "values", URI: file}
+			if data, err := os.ReadFile(file); err == nil {
+				values.Digest = map[string]string{"sha256": sha256Hex(data)}
+			}
+			p.BuildDefinition.ResolvedDependencies = append(p.BuildDefinition.ResolvedDependencies, values)
+		}
+	} else if input != nil {
+		p.BuildDefinition.ResolvedDependencies = append(p.BuildDefinition.ResolvedDependencies, resourceDescriptor{
+			Name:   "stdin",
+			Digest: map[string]string{"sha256": hex.EncodeToString(input.hash.Sum(nil))},
+		})
+	}
+	p.BuildDefinition.ExternalParameters = params
+	p.RunDetails.Builder.ID = "https://github.com/bromaniac/schelm"
+	p.RunDetails.Builder.Version = map[string]string{"schelm": currentBuild().Version}
+	p.RunDetails.Metadata.StartedOn = started.UTC().Format(time.RFC3339)
+	p.RunDetails.Metadata.FinishedOn = time.Now().UTC().Format(time.RFC3339)
+	return &p
+}
+
+// setDigests returns the -set and -set-string assignments as key=sha256:digest, so
+// the published attestation pins their values without revealing the passwords and
+// tokens they often are.
+func setDigests(sets []string) []string {
+	digests := make([]string, len(sets))
+	for i, set := range sets {
+		key, value, _ := strings.Cut(set, "=")
+		digests[i] = key + "=sha256:" + sha256Hex([]byte(value))
+	}
+	return digests
+}
+
+// chartDigest hashes a local chart: a packaged chart file, or the files of a chart
+// directory with their names. Repository charts have no local digest.
+func chartDigest(chart string) (string, error) {
+	stat, err := os.Stat(chart)
+	if err != nil {
+		return "", err
+	}
+	if !stat.IsDir() {
+		data, err := os.ReadFile(chart)
+		if err != nil {
+			return "", err
+		}
+		return sha256Hex(data), nil
+	}
+	index, err := indexTree(chart)
+	if err != nil {
+		return "", err
+	}
+	return sha256Hex(index), nil
+}
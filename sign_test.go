@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetDigests(t *testing.T) {
+	tests := []struct {
+		sets []string
+		want []string
+	}{
+		{nil, []string{}},
+		{[]string{"image.tag=1.2.3"}, []string{"image.tag=sha256:" + sha256Hex([]byte("1.2.3"))}},
+		{[]string{"db.password=hunter2", "empty="}, []string{"db.password=sha256:" + sha256Hex([]byte("hunter2")), "empty=sha256:" + sha256Hex(nil)}},
+		{[]string{"a=b=c"}, []string{"a=sha256:" + sha256Hex([]byte("b=c"))}},
+		{[]string{"flag"}, []string{"flag=sha256:" + sha256Hex(nil)}},
+	}
+	for _, tt := range tests {
+		if got := setDigests(tt.sets); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("setDigests(%q) = %q, want %q", tt.sets, got, tt.want)
+		}
+	}
+}
+
+func TestChartDigest(t *testing.T) {
+	dir := t.TempDir()
+	chart := filepath.Join(dir, "chart")
+	writeFile(t, filepath.Join(chart, "Chart.yaml"), "name: chart\n")
+	writeFile(t, filepath.Join(chart, "templates", "cm.yaml"), "kind: ConfigMap\n")
+	packaged := filepath.Join(dir, "chart-0.1.0.tgz")
+	writeFile(t, packaged, "packaged")
+
+	if got, err := chartDigest(packaged); err != nil || got != sha256Hex([]byte("packaged")) {
+		t.Errorf("chartDigest(packaged) = %s, %v", got, err)
+	}
+	index := sha256Hex([]byte("name: chart\n")) + "  Chart.yaml\n" + sha256Hex([]byte("kind: ConfigMap\n")) + "  templates/cm.yaml\n"
+	if got, err := chartDigest(chart); err != nil || got != sha256Hex([]byte(index)) {
+		t.Errorf("chartDigest(directory) = %s, %v; want the digest of %q", got, err, index)
+	}
+	if _, err := chartDigest("bitnami/nginx"); err == nil {
+		t.Error("repository chart has a digest")
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	dir := t.TempDir()
+	values := filepath.Join(dir, "values.yaml")
+	writeFile(t, values, "replicas: 2\n")
+	setFlag(t, &chartRef, "bitnami/nginx")
+	setFlag(t, &releaseName, "web")
+	setFlag(t, &helmValues, stringList{values, filepath.Join(dir, "missing.yaml")})
+	setFlag(t, &helmSet, stringList{"auth.password=hunter2"})
+	setFlag(t, &helmSetString, stringList{"token=s3cr3t-t0ken"})
+	setFlag(t, &helmSetFile, stringList{"script=" + values})
+
+	started := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	data, err := json.Marshal(newProvenance(nil, started))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"hunter2", "s3cr3t-t0ken"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("the provenance reveals %s: %s", secret, data)
+		}
+	}
+
+	var p provenance
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	params := p.BuildDefinition.ExternalParameters
+	if params["chart"] != "bitnami/nginx" || params["release"] != "web" {
+		t.Errorf("parameters = %v", params)
+	}
+	wantSets := []any{"auth.password=sha256:" + sha256Hex([]byte("hunter2")), "token=sha256:" + sha256Hex([]byte("s3cr3t-t0ken"))}
+	if !reflect.DeepEqual(params["set"], wantSets) {
+		t.Errorf("set = %v, want %v", params["set"], wantSets)
+	}
+	valuesDigest := map[string]string{"sha256": sha256Hex([]byte("replicas: 2\n"))}
+	wantDependencies := []resourceDescriptor{
+		{Name: "chart", URI: "bitnami/nginx"},
+		{Name: "values", URI: values, Digest: valuesDigest},
+		{Name: "values", URI: filepath.Join(dir, "missing.yaml")},
+		{Name: "values", URI: values, Digest: valuesDigest},
+	}
+	if !reflect.DeepEqual(p.BuildDefinition.ResolvedDependencies, wantDependencies) {
+		t.Errorf("dependencies = %+v, want %+v", p.BuildDefinition.ResolvedDependencies, wantDependencies)
+	}
+	if p.RunDetails.Metadata.StartedOn != "2026-01-02T03:04:05Z" {
+		t.Errorf("startedOn = %s", p.RunDetails.Metadata.StartedOn)
+	}
+}
+
+func TestProvenanceOfStdin(t *testing.T) {
+	input := newDigestReader(strings.NewReader(serveInput))
+	if _, err := renderInMemory(input); err != nil {
+		t.Fatal(err)
+	}
+	p := newProvenance(input, time.Now())
+	want := []resourceDescriptor{{Name: "stdin", Digest: map[string]string{"sha256": sha256Hex([]byte(serveInput))}}}
+	if !reflect.DeepEqual(p.BuildDefinition.ResolvedDependencies, want) {
+		t.Errorf("dependencies = %+v, want %+v", p.BuildDefinition.ResolvedDependencies, want)
+	}
+	if _, ok := p.BuildDefinition.ExternalParameters["set"]; ok {
+		t.Error("a render of stdin records -set values")
+	}
+}
+
+// fakeCosign puts a cosign on PATH that records its arguments and succeeds.
+func fakeCosign(t *testing.T) (calls string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake cosign is a shell script")
+	}
+	dir := t.TempDir()
+	calls = filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"$@\" >> " + calls + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "cosign"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	return calls
+}
+
+func TestCheckSigning(t *testing.T) {
+	fakeCosign(t)
+	tests := []struct {
+		archive, dest, dir string
+		ok                 bool
+	}{
+		{"", "", "out", true},
+		{"out.tgz", "", "", true},
+		{"", "s3://bucket/out", "", false},
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		setFlag(t, &archivePath, tt.archive)
+		setFlag(t, &destURL, tt.dest)
+		if err := checkSigning(tt.dir); (err == nil) != tt.ok {
+			t.Errorf("checkSigning(-archive %q -dest %q %q) = %v, want ok %v", tt.archive, tt.dest, tt.dir, err, tt.ok)
+		}
+	}
+	t.Setenv("PATH", t.TempDir())
+	if err := checkSigning("out"); err == nil {
+		t.Error("checkSigning without cosign succeeded")
+	}
+}
+
+func TestSignRender(t *testing.T) {
+	calls := fakeCosign(t)
+	out := filepath.Join(t.TempDir(), "out")
+	writeFile(t, filepath.Join(out, "chart", "cm.yaml"), "kind: ConfigMap\n")
+	setFlag(t, &signingKey, "cosign.key")
+
+	if err := signRender(out, newDigestReader(strings.NewReader("")), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	index, err := os.ReadFile(out + ".sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := sha256Hex([]byte("kind: ConfigMap\n")) + "  chart/cm.yaml\n"; string(index) != want {
+		t.Errorf("index = %q, want %q", index, want)
+	}
+	if _, err := os.Stat(out + ".sha256.provenance.json"); err != nil {
+		t.Error(err)
+	}
+	invocations, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(invocations)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "sign-blob ") || !strings.HasPrefix(lines[1], "attest-blob ") {
+		t.Fatalf("cosign ran as %q", lines)
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, "--key cosign.key") || !strings.HasSuffix(line, " "+out+".sha256") {
+			t.Errorf("cosign %s", line)
+		}
+	}
+}
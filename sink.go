@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+// bufferPool holds the buffers documents are assembled in before they are handed
+// to a sink, so a render of thousands of documents doesn't allocate one per document.
+var bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns buf to the pool, unless a huge document grew it past the size
+// of a scanned document.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= bufferSize {
+		bufferPool.Put(buf)
+	}
+}
+
+// recordingSink forwards to the wrapped sink and keeps a copy of everything written,
+// so the final tree can be inspected whatever the destination.
+type recordingSink struct {
+	split.Sink
+	copy *split.MemSink
+}
+
+func newRecordingSink(s split.Sink) *recordingSink {
+	return &recordingSink{Sink: s, copy: split.NewMemSink()}
+}
+
+// CreateOrAppend writes doc to the wrapped sink and records it.
+func (r *recordingSink) CreateOrAppend(name string, doc []byte) error {
+	if err := r.Sink.CreateOrAppend(name, doc); err != nil {
+		return err
+	}
+	return r.copy.CreateOrAppend(name, doc)
+}
+
+// Close closes the wrapped sink.
+func (r *recordingSink) Close() error {
+	return split.Close(r.Sink)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+// skaffoldProfile is the profile of the generated Skaffold config deploying the
+// split manifests.
+const skaffoldProfile = "schelm"
+
+var skaffoldFile string // Skaffold config written with a profile deploying the output
+
+func init() {
+	flag.StringVar(&skaffoldFile, "skaffold", "", "Write a Skaffold config to this file, e.g. skaffold.schelm.yaml, with a "+skaffoldProfile+" profile whose rawYaml manifests are the files of OUTPUT_DIR, for skaffold run or apply in dev loops")
+}
+
+// writeSkaffoldConfig writes the -skaffold config listing files, the documents
+// written to dir, relative to the directory of the config.
+func writeSkaffoldConfig(fsys split.FS, file, dir string, files []string) error {
+	var b strings.Builder
+	b.WriteString("# Generated by schelm: deploys the split manifests with skaffold run -p " + skaffoldProfile + ".\n")
+	b.WriteString("apiVersion: skaffold/v4beta11\nkind: Config\nmetadata:\n  name: schelm\n")
+	b.WriteString("profiles:\n  - name: " + skaffoldProfile + "\n    manifests:\n      rawYaml:\n")
+	listed := 0
+	for _, name := range files {
+		if ext := path.Ext(name); ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		rel, err := relativeToFile(file, path.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "        - %s\n", quoteString(rel))
+		listed++
+	}
+	if listed == 0 {
+		return fmt.Errorf("-skaffold: the render wrote no YAML files")
+	}
+	b.WriteString("    deploy:\n      kubectl: {}\n")
+	if err := fsys.WriteFile(file, []byte(b.String()), filePermissions); err != nil {
+		return fmt.Errorf("error writing Skaffold config %s: %w", file, err)
+	}
+	return nil
+}
+
+// relativeToFile returns name, a path of the output, relative to the directory of
+// file, with forward slashes, as configs next to the output refer to it.
+func relativeToFile(file, name string) (string, error) {
+	base, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(filepath.FromSlash(name))
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(base, abs)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"path"
+	"slices"
+	"strings"
+)
+
+// skippedDir is the directory of OUTPUT_DIR that -keep-skipped writes the documents
+// of skipped Sources to.
+const skippedDir = "_skipped"
+
+var keepSkipped bool // Whether documents that render nothing are written anyway
+
+func init() {
+	flag.BoolVar(&keepSkipped, "keep-skipped", false, "Write the documents of Sources that render nothing but comments or whitespace, such as _helpers.tpl, below OUTPUT_DIR/"+skippedDir+"/ for debugging instead of skipping them")
+}
+
+// isBlank reports whether s holds nothing but comments and whitespace. That is
+// decided from the lines of the document, which is much cheaper than parsing it.
+func isBlank(s *spec) bool {
+	content := s.content
+	for content != "" {
+		line, rest, _ := strings.Cut(content, "\n")
+		if line = strings.TrimSpace(line); line != "" && line[0] != '#' && line != "..." {
+			return false
+		}
+		content = rest
+	}
+	return true
+}
+
+// skipBlank records s if it is blank and, unless -keep-skipped moves it below
+// skippedDir, returns false so it isn't written. -layout helm writes blank
+// documents the way helm does.
+func (w *specWriter) skipBlank(s *spec) bool {
+	if layout == "helm" {
+		return true
+	}
+	if !isBlank(s) {
+		w.filled[s.origin] = true
+		return true
+	}
+	if !slices.Contains(w.blank, s.origin) {
+		w.blank = append(w.blank, s.origin)
+	}
+	if keepSkipped {
+		s.source = path.Join(skippedDir, s.source)
+		return true
+	}
+	log.Printf("Skipping document from %s: it renders nothing but comments or whitespace", s.source)
+	return false
+}
+
+// skippedSources returns the Sources, in input order, that rendered nothing but
+// blank documents.
+func (w *specWriter) skippedSources() []string {
+	var skipped []string
+	for _, source := range w.blank {
+		if !w.filled[source] {
+			skipped = append(skipped, source)
+		}
+	}
+	return skipped
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"text/template"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+// The flags kubectl-slice users know, so its invocations carry over unchanged.
+var (
+	sliceTemplate string // Go template naming the file of every document
+	sliceInclude  string // Comma-separated kind/name globs of the documents to keep
+	sliceExclude  string // Comma-separated kind/name globs of the documents to drop
+	sliceStdout   bool   // Whether the files are printed instead of written
+)
+
+func init() {
+	flag.StringVar(&sliceTemplate, "template", "", `Name the file of every document with this Go template over the document, like kubectl-slice, e.g. '{{.kind | lower}}-{{.metadata.name}}.yaml'. Functions: lower, upper, title, trim, replace, default, dottodash, dottounderscore, sha256sum`)
+	flag.StringVar(&sliceInclude, "include", "", "Only write the documents matching one of these comma-separated kind/name globs, compared case-insensitively, e.g. 'deployment/*,*/web'")
+	flag.StringVar(&sliceExclude, "exclude", "", "Drop the documents matching one of these comma-separated kind/name globs, compared case-insensitively")
+	flag.BoolVar(&sliceStdout, "stdout", false, "Print the files to stdout, as one YAML stream with a '# File: NAME (N bytes)' line before each, instead of writing OUTPUT_DIR")
+}
+
+// sliceFuncs are the template functions of kubectl-slice.
+var sliceFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"title": func(s string) string {
+		if s == "" {
+			return s
+		}
+		return strings.ToUpper(s[:1]) + s[1:]
+	},
+	"trim":            strings.TrimSpace,
+	"replace":         func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"dottodash":       func(s string) string { return strings.ReplaceAll(s, ".", "-") },
+	"dottounderscore": func(s string) string { return strings.ReplaceAll(s, ".", "_") },
+	"sha256sum":       func(s string) string { return sha256Hex([]byte(s)) },
+	"default": func(def string, value any) string {
+		if s, ok := value.(string); ok && s != "" {
+			return s
+		}
+		if value != nil {
+			if s := fmt.Sprint(value); s != "" {
+				return s
+			}
+		}
+		return def
+	},
+}
+
+// newSliceFormat returns the output format naming files by -template, given the
+// one of -format and -layout.
+func newSliceFormat(f outputFormat) (outputFormat, error) {
+	if sliceTemplate == "" {
+		return f, nil
+	}
+	if format != "yaml" || layout != "source" {
+		return nil, fmt.Errorf("-template requires -format yaml and -layout source")
+	}
+	tmpl, err := template.New("template").Funcs(sliceFuncs).Option("missingkey=zero").Parse(sliceTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -template: %w", err)
+	}
+	return templateFormat{outputFormat: f, tmpl: tmpl}, nil
+}
+
+// templateFormat writes documents like the wrapped format, to the file named by
+// executing the template over the document.
+type templateFormat struct {
+	outputFormat
+	tmpl *template.Template
+}
+
+func (t templateFormat) render(s *spec) (string, string, error) {
+	_, content, err := t.outputFormat.render(s)
+	if err != nil {
+		return "", "", err
+	}
+	root, err := s.root()
+	if err != nil {
+		return "", "", err
+	}
+	var doc any
+	if root != nil {
+		if err := root.Decode(&doc); err != nil {
+			return "", "", err
+		}
+	}
+	var name bytes.Buffer
+	if err := t.tmpl.Execute(&name, doc); err != nil {
+		return "", "", fmt.Errorf("error executing -template: %w", err)
+	}
+	if strings.TrimSpace(name.String()) == "" {
+		return "", "", fmt.Errorf("-template gives an empty file name")
+	}
+	dest, err := checkDestination(s.source, name.String())
+	return dest, content, err
+}
+
+// newSliceFilterHook returns the hook applying -include and -exclude, or nil if
+// neither was given.
+func newSliceFilterHook() (split.DocumentHook, error) {
+	include, err := parseKindNameGlobs("-include", sliceInclude)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := parseKindNameGlobs("-exclude", sliceExclude)
+	if err != nil {
+		return nil, err
+	}
+	if len(include)+len(exclude) == 0 {
+		return nil, nil
+	}
+	return func(meta split.DocMeta, content []byte) ([]byte, error) {
+		id := strings.ToLower(meta.Kind + "/" + meta.Name)
+		if len(include) > 0 && !matchAnyGlob(include, id) || matchAnyGlob(exclude, id) {
+			return nil, nil
+		}
+		return content, nil
+	}, nil
+}
+
+// parseKindNameGlobs splits a comma-separated list of kind/name globs.
+func parseKindNameGlobs(option, list string) ([]string, error) {
+	var globs []string
+	for _, glob := range splitList(list) {
+		if strings.Count(glob, "/") != 1 {
+			return nil, fmt.Errorf("invalid %s %q (expected kind/name, e.g. deployment/*)", option, glob)
+		}
+		glob = strings.ToLower(glob)
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", option, glob, err)
+		}
+		globs = append(globs, glob)
+	}
+	return globs, nil
+}
+
+func matchAnyGlob(globs []string, id string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, id); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// printFiles writes the files of m to w the way kubectl-slice --stdout does.
+func printFiles(w io.Writer, m *split.MemSink) error {
+	for i, name := range m.Names() {
+		if i > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		data := m.Files()[name]
+		if _, err := fmt.Fprintf(w, "# File: %s (%d bytes)\n%s", name, len(data), data); err != nil {
+			return err
+		}
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"slices"
+)
+
+var sortDocs string // Comma-separated keys the documents of a file are sorted by
+
+func init() {
+	flag.StringVar(&sortDocs, "sort-docs", "", "Sort the documents that share a file by these comma-separated keys: kind (in helm's install order, e.g. ServiceAccount before Deployment), name, namespace, apiVersion")
+}
+
+// installOrder is the order helm installs kinds in; other kinds come after them,
+// alphabetically.
+var installOrder = []string{
+	"PriorityClass", "Namespace", "NetworkPolicy", "ResourceQuota", "LimitRange",
+	"PodSecurityPolicy", "PodDisruptionBudget", "ServiceAccount", "Secret", "SecretList",
+	"ConfigMap", "StorageClass", "PersistentVolume", "PersistentVolumeClaim",
+	"CustomResourceDefinition", "ClusterRole", "ClusterRoleList", "ClusterRoleBinding",
+	"ClusterRoleBindingList", "Role", "RoleList", "RoleBinding", "RoleBindingList",
+	"Service", "DaemonSet", "Pod", "ReplicationController", "ReplicaSet", "Deployment",
+	"HorizontalPodAutoscaler", "StatefulSet", "Job", "CronJob", "IngressClass", "Ingress",
+	"APIService",
+}
+
+// docSortKeys maps the -sort-docs keys to comparisons of two documents.
+var docSortKeys = map[string]func(a, b *spec) int{
+	"kind": func(a, b *spec) int {
+		ia, ib := slices.Index(installOrder, a.kind()), slices.Index(installOrder, b.kind())
+		if ia < 0 {
+			ia = len(installOrder)
+		}
+		if ib < 0 {
+			ib = len(installOrder)
+		}
+		return cmp.Or(cmp.Compare(ia, ib), cmp.Compare(a.kind(), b.kind()))
+	},
+	"name":       func(a, b *spec) int { return cmp.Compare(a.name(), b.name()) },
+	"namespace":  func(a, b *spec) int { return cmp.Compare(a.namespace(), b.namespace()) },
+	"apiVersion": func(a, b *spec) int { return cmp.Compare(a.apiVersion(), b.apiVersion()) },
+}
+
+// newSortDocsTransform returns the batch transform sorting the documents of every
+// file by keys, keeping the files in the order they were first written.
+func newSortDocsTransform(keys string) (batchTransform, error) {
+	var compares []func(a, b *spec) int
+	for _, key := range splitList(keys) {
+		compare, ok := docSortKeys[key]
+		if !ok {
+			return nil, fmt.Errorf("invalid -sort-docs key %q (expected kind, name, namespace or apiVersion)", key)
+		}
+		compares = append(compares, compare)
+	}
+	return func(specs []*spec) ([]*spec, error) {
+		first := make(map[string]int)
+		for i, s := range specs {
+			if _, ok := first[s.source]; !ok {
+				first[s.source] = i
+			}
+		}
+		sorted := slices.Clone(specs)
+		slices.SortStableFunc(sorted, func(a, b *spec) int {
+			if c := cmp.Compare(first[a.source], first[b.source]); c != 0 {
+				return c
+			}
+			for _, compare := range compares {
+				if c := compare(a, b); c != 0 {
+					return c
+				}
+			}
+			return 0
+		})
+		return sorted, nil
+	}, nil
+}
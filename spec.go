@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// spec is a single rendered document together with the Source path helm reported for it.
+type spec struct {
+	source  string
+	origin  string // source before -map and -rewrite, set when the spec is written
+	content string
+	dest    string // path relative to the output directory, set once the spec is written
+	line    int    // line of dest the document starts on, set once the spec is written
+	// inputLine is the line of the input stream the content starts on, 0 when it
+	// didn't come from one, so errors can point to the helm output.
+	inputLine int
+	artifact  string // tool other than Kubernetes the document is for, such as nomad, set once the spec is written
+
+	parsed bool
+	node   *yaml.Node // root mapping of the document, nil if the document is empty
+	err    error
+}
+
+// newSpec returns a spec for the given source and raw document content.
+func newSpec(source, content string) *spec {
+	return &spec{source: source, content: content}
+}
+
+// withContent returns a copy of s with its content replaced.
+func (s *spec) withContent(content string) *spec {
+	return &spec{source: s.source, origin: s.origin, content: content, inputLine: s.inputLine}
+}
+
+// root parses the document on first use and returns its top-level node.
+// It returns nil without an error for documents that contain only comments or whitespace.
+func (s *spec) root() (*yaml.Node, error) {
+	if !s.parsed {
+		s.parsed = true
+		defer timed("parse")()
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(s.content), &doc); err != nil {
+			s.err = fmt.Errorf("error parsing document from %s%s: %w", s.source, s.inputLocation(yamlErrorLine(err)), err)
+		} else if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+			s.node = doc.Content[0]
+		}
+	}
+	return s.node, s.err
+}
+
+// inputLocation describes where line, 1-based within the content, is in the input
+// stream, as ", input line N", or returns "" if the document has no input line.
+// Line 0 stands for the start of the document.
+func (s *spec) inputLocation(line int) string {
+	if s.inputLine == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", input line %d", s.inputLine+max(line, 1)-1)
+}
+
+// yamlErrorLine returns the line a YAML parse error reports, or 0.
+func yamlErrorLine(err error) int {
+	if m := yamlErrorLinePattern.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return line
+	}
+	return 0
+}
+
+var yamlErrorLinePattern = regexp.MustCompile(`yaml: line (\d+):`)
+
+// field returns the string value at the given mapping path, or "" if it is absent.
+func (s *spec) field(keys ...string) string {
+	root, err := s.root()
+	if err != nil || root == nil {
+		return ""
+	}
+	return scalarField(root, keys...)
+}
+
+// kind returns the document's kind, or "" if it has none.
+func (s *spec) kind() string { return s.field("kind") }
+
+// apiVersion returns the document's apiVersion, or "" if it has none.
+func (s *spec) apiVersion() string { return s.field("apiVersion") }
+
+// name returns metadata.name, or "" if it is not set.
+func (s *spec) name() string { return s.field("metadata", "name") }
+
+// namespace returns metadata.namespace, or "" if it is not set.
+func (s *spec) namespace() string { return s.field("metadata", "namespace") }
+
+// lookupNode follows keys through nested mappings starting at n.
+func lookupNode(n *yaml.Node, keys ...string) *yaml.Node {
+	for _, key := range keys {
+		n = resolveAlias(n)
+		if n == nil || n.Kind != yaml.MappingNode {
+			return nil
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				next = n.Content[i+1]
+				break
+			}
+		}
+		n = next
+	}
+	return resolveAlias(n)
+}
+
+// resolveAlias follows YAML aliases to the node they refer to.
+func resolveAlias(n *yaml.Node) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+// scalarValue resolves a scalar node to a string, int64, uint64, float64, bool or nil.
+// Scalars without a natural representation (timestamps, binary) are returned as their text.
+func scalarValue(n *yaml.Node) (interface{}, error) {
+	switch n.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var b bool
+		if err := n.Decode(&b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	case "!!int":
+		var i int64
+		if err := n.Decode(&i); err == nil {
+			return i, nil
+		}
+		var u uint64
+		if err := n.Decode(&u); err == nil {
+			return u, nil
+		}
+		// Too large for any integer type; keep the literal text.
+		return n.Value, nil
+	case "!!float":
+		var f float64
+		if err := n.Decode(&f); err != nil {
+			return nil, err
+		}
+		return f, nil
+	default:
+		return n.Value, nil
+	}
+}
+
+// formatNumber renders a numeric scalar value as a literal shared by JSON, HCL and CUE.
+// It returns false for values those languages cannot express, such as NaN and infinities.
+func formatNumber(v interface{}) (string, bool) {
+	switch n := v.(type) {
+	case int64:
+		return strconv.FormatInt(n, 10), true
+	case float64:
+		s := strconv.FormatFloat(n, 'g', -1, 64)
+		if strings.ContainsAny(s, "IN") { // +Inf, -Inf, NaN
+			return "", false
+		}
+		return s, true
+	case uint64:
+		return strconv.FormatUint(n, 10), true
+	}
+	return "", false
+}
+
+// scalarField returns the scalar value at the given mapping path below n, or "".
+func scalarField(n *yaml.Node, keys ...string) string {
+	if v := lookupNode(n, keys...); v != nil && v.Kind == yaml.ScalarNode {
+		return v.Value
+	}
+	return ""
+}
+
+// scalarNode returns a plain string scalar.
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// setKey sets key to value in mapping m, replacing an existing entry in place.
+func setKey(m *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, scalarNode(key), value)
+}
+
+// deleteKey removes key from mapping m.
+func deleteKey(m *yaml.Node, key string) {
+	if m == nil {
+		return
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// mappingAt returns the mapping at the given path below m, creating missing mappings.
+func mappingAt(m *yaml.Node, keys ...string) *yaml.Node {
+	for _, key := range keys {
+		next := lookupNode(m, key)
+		if next == nil || next.Kind != yaml.MappingNode {
+			next = &yaml.Node{Kind: yaml.MappingNode}
+			setKey(m, key, next)
+		}
+		m = next
+	}
+	return m
+}
+
+// setAnnotation sets metadata.annotations[key] on the document root.
+func setAnnotation(root *yaml.Node, key, value string) {
+	setKey(mappingAt(root, "metadata", "annotations"), key, scalarNode(value))
+}
+
+// cloneNode returns a deep copy of n.
+func cloneNode(n *yaml.Node) *yaml.Node {
+	if n == nil {
+		return nil
+	}
+	c := *n
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = cloneNode(child)
+	}
+	return &c
+}
@@ -0,0 +1,4 @@
+// Package split holds the parts of schelm that programs embedding it build on: the
+// filesystems and sinks a split writes its files to, and the hooks that see every
+// document on its way. The schelm command wraps them with its options.
+package split
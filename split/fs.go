@@ -0,0 +1,241 @@
+package split
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FS is the filesystem a split writes its output through. It extends the read-only
+// io/fs interfaces with the few mutating operations a split needs, so the whole
+// pipeline can run against the real disk or an in-memory tree.
+type FS interface {
+	fs.StatFS
+	fs.ReadFileFS
+	MkdirAll(name string, perm fs.FileMode) error
+	RemoveAll(name string) error
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	AppendFile(name string, data []byte) error
+}
+
+// OSFS is the local filesystem. Names are ordinary OS paths, relative to the working
+// directory or absolute.
+type OSFS struct{}
+
+func (OSFS) Open(name string) (fs.File, error)            { return os.Open(name) }
+func (OSFS) Stat(name string) (fs.FileInfo, error)        { return os.Stat(name) }
+func (OSFS) ReadFile(name string) ([]byte, error)         { return os.ReadFile(name) }
+func (OSFS) MkdirAll(name string, perm fs.FileMode) error { return os.MkdirAll(name, perm) }
+func (OSFS) RemoveAll(name string) error                  { return os.RemoveAll(name) }
+
+func (OSFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+// AppendFile appends data to the existing file name.
+func (OSFS) AppendFile(name string, data []byte) error {
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// MemFS is an in-memory filesystem of files and directories keyed by their cleaned
+// names, for tests and for embedders that don't want to touch the disk. Names
+// follow io/fs: unrooted and slash-separated, without . or .. elements, the root
+// being ".".
+type MemFS struct {
+	files map[string]*memFile
+}
+
+// memFile is a file or, with fs.ModeDir set, a directory of a MemFS.
+type memFile struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// NewMemFS returns an empty in-memory filesystem.
+func NewMemFS() *MemFS {
+	return &MemFS{files: make(map[string]*memFile)}
+}
+
+// checkName rejects names io/fs doesn't accept.
+func checkName(op, name string) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return nil
+}
+
+// lookup returns the file or directory name, the root being a directory.
+func (m *MemFS) lookup(op, name string) (*memFile, error) {
+	if err := checkName(op, name); err != nil {
+		return nil, err
+	}
+	if name == "." {
+		return &memFile{mode: fs.ModeDir | 0o755}, nil
+	}
+	if f, ok := m.files[name]; ok {
+		return f, nil
+	}
+	return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	f, err := m.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	info := memInfo{name: path.Base(name), file: f}
+	if !f.mode.IsDir() {
+		return &memOpenFile{Reader: bytes.NewReader(f.data), info: info}, nil
+	}
+	var entries []fs.DirEntry
+	for child, cf := range m.files {
+		if path.Dir(child) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(memInfo{name: path.Base(child), file: cf}))
+		}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return &memDir{info: info, entries: entries}, nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	f, err := m.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return memInfo{name: path.Base(name), file: f}, nil
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	f, err := m.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if f.mode.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	return slices.Clone(f.data), nil
+}
+
+// MkdirAll records name and its parents as directories.
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	if err := checkName("mkdir", name); err != nil {
+		return err
+	}
+	for dir := name; dir != "."; dir = path.Dir(dir) {
+		if f, ok := m.files[dir]; ok {
+			if !f.mode.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: name, Err: errors.New("not a directory")}
+			}
+			continue
+		}
+		m.files[dir] = &memFile{mode: fs.ModeDir | perm, modTime: time.Now()}
+	}
+	return nil
+}
+
+// RemoveAll deletes name and everything below it.
+func (m *MemFS) RemoveAll(name string) error {
+	if err := checkName("remove", name); err != nil {
+		return err
+	}
+	for key := range m.files {
+		if name == "." || key == name || strings.HasPrefix(key, name+"/") {
+			delete(m.files, key)
+		}
+	}
+	return nil
+}
+
+// WriteFile creates or truncates name, which requires its directory to exist.
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if err := checkName("open", name); err != nil {
+		return err
+	}
+	if dir := path.Dir(name); dir != "." {
+		if f, ok := m.files[dir]; !ok || !f.mode.IsDir() {
+			return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+	}
+	m.files[name] = &memFile{data: slices.Clone(data), mode: perm, modTime: time.Now()}
+	return nil
+}
+
+// AppendFile appends data to the existing file name.
+func (m *MemFS) AppendFile(name string, data []byte) error {
+	if err := checkName("open", name); err != nil {
+		return err
+	}
+	f, ok := m.files[name]
+	if !ok || f.mode.IsDir() {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	f.data = append(f.data, data...)
+	f.modTime = time.Now()
+	return nil
+}
+
+// memInfo describes a file of a MemFS.
+type memInfo struct {
+	name string
+	file *memFile
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return int64(len(i.file.data)) }
+func (i memInfo) Mode() fs.FileMode  { return i.file.mode }
+func (i memInfo) ModTime() time.Time { return i.file.modTime }
+func (i memInfo) IsDir() bool        { return i.file.mode.IsDir() }
+func (i memInfo) Sys() any           { return nil }
+
+// memOpenFile is an open file of a MemFS, reading a snapshot of its data.
+type memOpenFile struct {
+	*bytes.Reader
+	info memInfo
+}
+
+func (f *memOpenFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memOpenFile) Close() error               { return nil }
+
+// memDir is an open directory of a MemFS.
+type memDir struct {
+	info    memInfo
+	entries []fs.DirEntry
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *memDir) Close() error               { return nil }
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir returns the next n entries, or all remaining ones when n <= 0.
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
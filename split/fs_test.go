@@ -0,0 +1,123 @@
+package split
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMemFSIsAnFS(t *testing.T) {
+	m := NewMemFS()
+	if err := m.MkdirAll("chart/templates", DirPermissions); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		"chart/Chart.yaml":          "name: chart\n",
+		"chart/templates/a.yaml":    "a: 1\n",
+		"chart/templates/empty.txt": "",
+	} {
+		if err := m.WriteFile(name, []byte(data), FilePermissions); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fstest.TestFS(m, "chart/Chart.yaml", "chart/templates/a.yaml", "chart/templates/empty.txt"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMemFSRejectsInvalidNames(t *testing.T) {
+	m := NewMemFS()
+	m.MkdirAll("a", DirPermissions)
+	for _, name := range []string{"/a", "a/", "a//b", "./a", "a/../b", "..", ""} {
+		ops := map[string]func() error{
+			"Open":       func() error { _, err := m.Open(name); return err },
+			"Stat":       func() error { _, err := m.Stat(name); return err },
+			"ReadFile":   func() error { _, err := m.ReadFile(name); return err },
+			"MkdirAll":   func() error { return m.MkdirAll(name, DirPermissions) },
+			"RemoveAll":  func() error { return m.RemoveAll(name) },
+			"WriteFile":  func() error { return m.WriteFile(name, nil, FilePermissions) },
+			"AppendFile": func() error { return m.AppendFile(name, nil) },
+		}
+		for op, call := range ops {
+			if err := call(); !errors.Is(err, fs.ErrInvalid) {
+				t.Errorf("%s(%q) = %v, want fs.ErrInvalid", op, name, err)
+			}
+		}
+	}
+	if _, err := m.Stat("a"); err != nil {
+		t.Errorf("a was removed through an invalid name: %v", err)
+	}
+}
+
+func TestMemFSOperations(t *testing.T) {
+	m := NewMemFS()
+	steps := []struct {
+		name string
+		op   func() error
+		err  error // nil for success, fs.ErrNotExist or any other error for failure
+	}{
+		{"write without a directory", func() error { return m.WriteFile("out/a.yaml", nil, FilePermissions) }, fs.ErrNotExist},
+		{"append to a missing file", func() error { return m.AppendFile("out/a.yaml", []byte("x")) }, fs.ErrNotExist},
+		{"mkdir", func() error { return m.MkdirAll("out/sub", DirPermissions) }, nil},
+		{"write", func() error { return m.WriteFile("out/a.yaml", []byte("a: 1\n"), FilePermissions) }, nil},
+		{"append", func() error { return m.AppendFile("out/a.yaml", []byte("b: 2\n")) }, nil},
+		{"append to a directory", func() error { return m.AppendFile("out/sub", []byte("x")) }, fs.ErrNotExist},
+		{"mkdir below a file", func() error { return m.MkdirAll("out/a.yaml/sub", DirPermissions) }, errors.New("not a directory")},
+		{"read a directory", func() error { _, err := m.ReadFile("out"); return err }, errors.New("is a directory")},
+	}
+	for _, step := range steps {
+		err := step.op()
+		switch {
+		case step.err == nil && err != nil:
+			t.Fatalf("%s: %v", step.name, err)
+		case step.err != nil && err == nil:
+			t.Fatalf("%s succeeded, want an error", step.name)
+		case errors.Is(step.err, fs.ErrNotExist) && !errors.Is(err, fs.ErrNotExist):
+			t.Fatalf("%s: %v, want fs.ErrNotExist", step.name, err)
+		}
+	}
+
+	data, err := m.ReadFile("out/a.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a: 1\nb: 2\n" {
+		t.Errorf("out/a.yaml = %q", data)
+	}
+	// ReadFile returns a copy.
+	clear(data)
+	if data, _ := m.ReadFile("out/a.yaml"); string(data) != "a: 1\nb: 2\n" {
+		t.Errorf("changing the data read changed the file: %q", data)
+	}
+
+	if err := m.RemoveAll("out"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"out", "out/sub", "out/a.yaml"} {
+		if _, err := m.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s survived RemoveAll: %v", name, err)
+		}
+	}
+	if info, err := m.Stat("."); err != nil || !info.IsDir() {
+		t.Errorf("the root is not a directory: %v, %v", info, err)
+	}
+}
+
+func TestMemFSRemoveAllKeepsSiblings(t *testing.T) {
+	m := NewMemFS()
+	for _, dir := range []string{"out", "output"} {
+		if err := m.MkdirAll(dir, DirPermissions); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.WriteFile(dir+"/a", nil, FilePermissions); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.RemoveAll("out"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Stat("output/a"); err != nil {
+		t.Errorf("RemoveAll(out) removed output/a: %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package split
+
+// DocMeta describes a document passed to document hooks.
+type DocMeta struct {
+	Source     string `json:"source"`         // the "# Source:" path helm reported
+	Index      int    `json:"index"`          // position of the document in the input stream, starting at 0
+	Line       int    `json:"line,omitempty"` // line of the input stream the content starts on, 0 if unknown
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+}
+
+// DocumentHook inspects or rewrites a document before it is written. It returns the
+// content to continue with; nil content drops the document, and an error aborts the split.
+type DocumentHook func(meta DocMeta, content []byte) ([]byte, error)
+
+// ApplyHooks runs hooks over content in order, with meta describing it; describe
+// re-reads the metadata whenever a hook rewrites the document. It returns nil if a
+// hook dropped the document.
+func ApplyHooks(meta DocMeta, content []byte, hooks []DocumentHook, describe func(DocMeta, []byte) DocMeta) ([]byte, error) {
+	for _, hook := range hooks {
+		out, err := hook(meta, content)
+		if err != nil {
+			return nil, err
+		}
+		if out == nil {
+			return nil, nil
+		}
+		if string(out) != string(content) {
+			content = out
+			meta = describe(meta, content)
+		}
+	}
+	return content, nil
+}
@@ -0,0 +1,237 @@
+package split
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Permissions of the directories and files a split creates.
+const (
+	DirPermissions  fs.FileMode = 0750
+	FilePermissions fs.FileMode = 0640
+)
+
+// Sink receives the files produced by a split. Paths are slash-separated and relative
+// to the root of the destination.
+type Sink interface {
+	// CreateOrAppend creates the file at path with doc as its content, or appends doc
+	// to it if the file already exists. Callers add any separator between documents,
+	// and may reuse doc once CreateOrAppend returns.
+	CreateOrAppend(path string, doc []byte) error
+}
+
+// Close flushes sinks that buffer their output, such as archives.
+func Close(s Sink) error {
+	if c, ok := s.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// FSSink writes files below a directory of an FS.
+type FSSink struct {
+	fsys FS
+	root string
+}
+
+// NewFSSink returns a sink writing below the directory root of fsys.
+func NewFSSink(fsys FS, root string) *FSSink {
+	return &FSSink{fsys: fsys, root: root}
+}
+
+// CreateOrAppend writes doc to a new file or appends it to an existing one.
+func (f *FSSink) CreateOrAppend(name string, doc []byte) error {
+	destinationFile := path.Join(f.root, name)
+	dir := path.Dir(destinationFile)
+
+	// Ensure the subdirectory for the file exists
+	if err := f.fsys.MkdirAll(dir, DirPermissions); err != nil {
+		return fmt.Errorf("error creating directory %s: %w", dir, err)
+	}
+
+	// Check if the file already exists
+	if _, err := f.fsys.Stat(destinationFile); errors.Is(err, fs.ErrNotExist) {
+		// File does not exist, create and write
+		log.Printf("Creating %s", destinationFile)
+		if err := f.fsys.WriteFile(destinationFile, doc, FilePermissions); err != nil {
+			return fmt.Errorf("error writing new file %s: %w", destinationFile, err)
+		}
+	} else if err == nil {
+		// File exists, append
+		log.Printf("Appending to %s", destinationFile)
+		if err := f.fsys.AppendFile(destinationFile, doc); err != nil {
+			return fmt.Errorf("error appending to file %s: %w", destinationFile, err)
+		}
+	} else {
+		// Another error occurred during Stat
+		return fmt.Errorf("error checking file %s: %w", destinationFile, err)
+	}
+	return nil
+}
+
+// MemSink keeps files in memory, remembering the order they were created in.
+type MemSink struct {
+	files map[string][]byte
+	order []string
+}
+
+// NewMemSink returns an empty in-memory sink.
+func NewMemSink() *MemSink {
+	return &MemSink{files: make(map[string][]byte)}
+}
+
+// CreateOrAppend stores doc as a new file or appends it to the stored content.
+func (m *MemSink) CreateOrAppend(name string, doc []byte) error {
+	name = path.Clean(name)
+	if _, ok := m.files[name]; !ok {
+		m.order = append(m.order, name)
+	}
+	m.files[name] = append(m.files[name], doc...)
+	return nil
+}
+
+// Names returns the names of the files, in the order they were created in.
+func (m *MemSink) Names() []string {
+	return m.order
+}
+
+// Files returns the files by name. The map belongs to the sink and must not be
+// modified.
+func (m *MemSink) Files() map[string][]byte {
+	return m.files
+}
+
+// SubdirSink places every file below Dir in the wrapped sink.
+type SubdirSink struct {
+	Sink
+	Dir string
+}
+
+// CreateOrAppend forwards to the wrapped sink with Dir prepended to name.
+func (s SubdirSink) CreateOrAppend(name string, doc []byte) error {
+	return s.Sink.CreateOrAppend(path.Join(s.Dir, name), doc)
+}
+
+// ArchiveSink collects files in memory and writes them as a tar, gzipped tar or zip
+// archive, chosen by the file extension, when it is closed.
+type ArchiveSink struct {
+	*MemSink
+	file string
+}
+
+// NewArchiveSink prepares an archive at file, refusing to replace an existing one unless force is set.
+func NewArchiveSink(file string, force bool) (*ArchiveSink, error) {
+	if archiveKind(file) == "" {
+		return nil, fmt.Errorf("unsupported archive %s (expected .tar, .tar.gz, .tgz or .zip)", file)
+	}
+	if _, err := os.Stat(file); err == nil && !force {
+		return nil, fmt.Errorf(`archive "%s" already exists. Use -f to overwrite`, file)
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to check archive %s: %w", file, err)
+	}
+	return &ArchiveSink{MemSink: NewMemSink(), file: file}, nil
+}
+
+// archiveKind returns "tar", "tgz" or "zip" for a supported archive name, or "".
+func archiveKind(file string) string {
+	switch {
+	case strings.HasSuffix(file, ".tar.gz"), strings.HasSuffix(file, ".tgz"):
+		return "tgz"
+	case strings.HasSuffix(file, ".tar"):
+		return "tar"
+	case strings.HasSuffix(file, ".zip"):
+		return "zip"
+	}
+	return ""
+}
+
+// Close writes the collected files to the archive.
+func (a *ArchiveSink) Close() error {
+	var buf bytes.Buffer
+	if err := a.write(&buf); err != nil {
+		return fmt.Errorf("error building archive %s: %w", a.file, err)
+	}
+	log.Printf("Writing archive %s", a.file)
+	if err := os.WriteFile(a.file, buf.Bytes(), FilePermissions); err != nil {
+		return fmt.Errorf("error writing archive %s: %w", a.file, err)
+	}
+	return nil
+}
+
+// write writes the archive reproducibly: entries are sorted by name and carry a
+// fixed time, owner and mode, so the same files always give the same bytes.
+func (a *ArchiveSink) write(w io.Writer) error {
+	names := slices.Sorted(maps.Keys(a.files))
+	modTime := archiveTime()
+	switch archiveKind(a.file) {
+	case "zip":
+		zw := zip.NewWriter(w)
+		for _, name := range names {
+			header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime}
+			header.SetMode(FilePermissions)
+			fw, err := zw.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			if _, err := fw.Write(a.files[name]); err != nil {
+				return err
+			}
+		}
+		return zw.Close()
+	case "tgz":
+		// The gzip header keeps its zero modification time and no file name.
+		gw := gzip.NewWriter(w)
+		if err := writeTar(gw, a.MemSink, names, modTime); err != nil {
+			return err
+		}
+		return gw.Close()
+	default:
+		return writeTar(w, a.MemSink, names, modTime)
+	}
+}
+
+// archiveTime is the modification time of archive entries: $SOURCE_DATE_EPOCH if
+// set, as reproducible builds define it, or else 1980-01-01, the earliest time
+// zip can store.
+func archiveTime() time.Time {
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0).UTC()
+	}
+	return time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// writeTar writes the named files of m to w as a tar stream, owned by root.
+func writeTar(w io.Writer, m *MemSink, names []string, modTime time.Time) error {
+	tw := tar.NewWriter(w)
+	for _, name := range names {
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     int64(FilePermissions),
+			Size:     int64(len(m.files[name])),
+			ModTime:  modTime,
+			Format:   tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(m.files[name]); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
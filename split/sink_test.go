@@ -0,0 +1,303 @@
+package split
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// write is a CreateOrAppend call.
+type write struct{ name, doc string }
+
+var sinkWrites = []struct {
+	name   string
+	writes []write
+	want   map[string]string
+}{
+	{
+		name:   "one file",
+		writes: []write{{"chart/templates/a.yaml", "a: 1\n"}},
+		want:   map[string]string{"chart/templates/a.yaml": "a: 1\n"},
+	},
+	{
+		name:   "append",
+		writes: []write{{"a.yaml", "a: 1\n"}, {"b/b.yaml", "b: 1\n"}, {"a.yaml", "---\na: 2\n"}},
+		want:   map[string]string{"a.yaml": "a: 1\n---\na: 2\n", "b/b.yaml": "b: 1\n"},
+	},
+	{
+		name:   "line endings of a single document are kept",
+		writes: []write{{"a.yaml", "a: 1\r\nb: 2\r\n"}},
+		want:   map[string]string{"a.yaml": "a: 1\r\nb: 2\r\n"},
+	},
+	{
+		name:   "appending keeps the line endings",
+		writes: []write{{"a.yaml", "a: 1\r\n"}, {"a.yaml", "\n---\n"}, {"a.yaml", "b: 2\r\n"}},
+		want:   map[string]string{"a.yaml": "a: 1\r\n\n---\nb: 2\r\n"},
+	},
+}
+
+func TestFSSink(t *testing.T) {
+	for _, tt := range sinkWrites {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := NewMemFS()
+			sink := NewFSSink(fsys, "out/dir")
+			for _, w := range tt.writes {
+				if err := sink.CreateOrAppend(w.name, []byte(w.doc)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for name, want := range tt.want {
+				got, err := fsys.ReadFile("out/dir/" + name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+				info, err := fsys.Stat("out/dir/" + name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode() != FilePermissions {
+					t.Errorf("%s has mode %v, want %v", name, info.Mode(), FilePermissions)
+				}
+			}
+		})
+	}
+}
+
+func TestFSSinkOnDisk(t *testing.T) {
+	root := t.TempDir()
+	sink := NewFSSink(OSFS{}, root)
+	for _, w := range []write{{"a/b.yaml", "b: 1\r\n"}, {"a/b.yaml", "b: 2\n"}} {
+		if err := sink.CreateOrAppend(w.name, []byte(w.doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := os.ReadFile(filepath.Join(root, "a", "b.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "b: 1\r\nb: 2\n"; string(got) != want {
+		t.Errorf("a/b.yaml = %q, want %q", got, want)
+	}
+}
+
+func TestFSSinkRefusesFileAsDirectory(t *testing.T) {
+	fsys := NewMemFS()
+	sink := NewFSSink(fsys, ".")
+	if err := sink.CreateOrAppend("a", []byte("a: 1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.CreateOrAppend("a/b.yaml", []byte("b: 1\n")); err == nil {
+		t.Error("wrote a/b.yaml below the file a")
+	}
+}
+
+func TestMemSink(t *testing.T) {
+	for _, tt := range sinkWrites {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := NewMemSink()
+			var order []string
+			for _, w := range tt.writes {
+				// The sink must copy what it keeps, since callers reuse their buffers.
+				doc := []byte(w.doc)
+				if err := sink.CreateOrAppend(w.name, doc); err != nil {
+					t.Fatal(err)
+				}
+				clear(doc)
+				if _, ok := tt.want[w.name]; ok && !slices.Contains(order, w.name) {
+					order = append(order, w.name)
+				}
+			}
+			got := make(map[string]string)
+			for name, data := range sink.Files() {
+				got[name] = string(data)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(sink.Names(), order) {
+				t.Errorf("Names() = %q, want %q", sink.Names(), order)
+			}
+		})
+	}
+}
+
+func TestMemSinkCleansNames(t *testing.T) {
+	sink := NewMemSink()
+	if err := sink.CreateOrAppend("a/./b.yaml", []byte("1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.CreateOrAppend("a//b.yaml", []byte("2\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(sink.Files()["a/b.yaml"]); got != "1\n2\n" {
+		t.Errorf("a/b.yaml = %q, want both documents", got)
+	}
+	if !reflect.DeepEqual(sink.Names(), []string{"a/b.yaml"}) {
+		t.Errorf("Names() = %q", sink.Names())
+	}
+}
+
+func TestSubdirSink(t *testing.T) {
+	mem := NewMemSink()
+	sink := SubdirSink{Sink: mem, Dir: "base"}
+	if err := sink.CreateOrAppend("chart/a.yaml", []byte("a: 1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.CreateOrAppend("../b.yaml", []byte("b: 1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"base/chart/a.yaml", "b.yaml"}; !reflect.DeepEqual(mem.Names(), want) {
+		t.Errorf("Names() = %q, want %q", mem.Names(), want)
+	}
+	if err := Close(sink); err != nil {
+		t.Errorf("Close of a sink that doesn't buffer = %v", err)
+	}
+}
+
+func TestArchiveKind(t *testing.T) {
+	tests := []struct{ file, want string }{
+		{"out.tar", "tar"},
+		{"out.tar.gz", "tgz"},
+		{"out.tgz", "tgz"},
+		{"out.zip", "zip"},
+		{"out.gz", ""},
+		{"out", ""},
+	}
+	for _, tt := range tests {
+		if got := archiveKind(tt.file); got != tt.want {
+			t.Errorf("archiveKind(%q) = %q, want %q", tt.file, got, tt.want)
+		}
+	}
+}
+
+// readArchive returns the files of the archive at file.
+func readArchive(t *testing.T, file string) map[string]string {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	if archiveKind(file) == "zip" {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range zr.File {
+			r, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[f.Name] = string(content)
+		}
+		return files
+	}
+	var r io.Reader = bytes.NewReader(data)
+	if archiveKind(file) == "tgz" {
+		if r, err = gzip.NewReader(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Mode != int64(FilePermissions) || header.Uid != 0 || !header.ModTime.Equal(archiveTime()) {
+			t.Errorf("%s: mode %o, uid %d, time %v", header.Name, header.Mode, header.Uid, header.ModTime)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[header.Name] = string(content)
+	}
+	return files
+}
+
+func TestArchiveSink(t *testing.T) {
+	want := map[string]string{"b/b.yaml": "b: 1\n", "a.yaml": "a: 1\n---\na: 2\n"}
+	for _, name := range []string{"out.tar", "out.tar.gz", "out.tgz", "out.zip"} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), name)
+			var archives [][]byte
+			for range 2 {
+				sink, err := NewArchiveSink(file, true)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, w := range []write{{"b/b.yaml", "b: 1\n"}, {"a.yaml", "a: 1\n"}, {"a.yaml", "---\na: 2\n"}} {
+					if err := sink.CreateOrAppend(w.name, []byte(w.doc)); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := Close(sink); err != nil {
+					t.Fatal(err)
+				}
+				if got := readArchive(t, file); !reflect.DeepEqual(got, want) {
+					t.Errorf("archive holds %q, want %q", got, want)
+				}
+				data, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				archives = append(archives, data)
+			}
+			if !bytes.Equal(archives[0], archives[1]) {
+				t.Error("the same files gave different archives")
+			}
+		})
+	}
+}
+
+func TestArchiveTimeHonorsSourceDateEpoch(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	if got := archiveTime().Unix(); got != 1700000000 {
+		t.Errorf("archiveTime() = %d, want 1700000000", got)
+	}
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	if got := archiveTime().Year(); got != 1980 {
+		t.Errorf("archiveTime() without SOURCE_DATE_EPOCH is in %d, want 1980", got)
+	}
+}
+
+func TestNewArchiveSinkErrors(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "out.tar")
+	if err := os.WriteFile(existing, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		file  string
+		force bool
+		ok    bool
+	}{
+		{filepath.Join(dir, "out.rar"), false, false},
+		{existing, false, false},
+		{existing, true, true},
+		{filepath.Join(dir, "new.zip"), false, true},
+	}
+	for _, tt := range tests {
+		if _, err := NewArchiveSink(tt.file, tt.force); (err == nil) != tt.ok {
+			t.Errorf("NewArchiveSink(%s, %v) = %v, want ok %v", filepath.Base(tt.file), tt.force, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package split
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Separator precedes every document of helm output, followed by its Source path
+	// and a newline.
+	Separator = "---\n# Source: "
+	// MaxDocumentSize is the size of the largest document a split reads.
+	MaxDocumentSize = 1048576
+)
+
+// ScanDocuments is a bufio.SplitFunc splitting helm output at every Separator. The
+// first token is what precedes the first document, every other one a Source line
+// followed by the content of its document.
+func ScanDocuments(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.Index(data, []byte(Separator)); i >= 0 {
+		// We found a separator. Return the data before it.
+		return i + len(Separator), data[0:i], nil
+	}
+	// If we're at EOF, we have a final, non-terminated line. Return it.
+	if atEOF {
+		return len(data), data, nil
+	}
+	// Request more data.
+	return 0, nil, nil
+}
+
+// ParseDocument splits a token of ScanDocuments into the Source path and the content
+// of the document. A token without a newline is all Source.
+func ParseDocument(token string) (source, content string) {
+	if i := strings.Index(token, "\n"); i >= 0 {
+		return token[0:i], token[i+1:]
+	}
+	return token, ""
+}
+
+// Splitter writes every document of helm output to the file named by its Source,
+// the way schelm does without options, passing the documents through its hooks
+// first.
+type Splitter struct {
+	sink  Sink
+	hooks []DocumentHook
+}
+
+// New returns a Splitter writing to sink.
+func New(sink Sink) *Splitter {
+	return &Splitter{sink: sink}
+}
+
+// OnDocument registers a hook that runs, in registration order, for every document
+// in the stream before it is written.
+func (s *Splitter) OnDocument(hook DocumentHook) {
+	s.hooks = append(s.hooks, hook)
+}
+
+// Split reads helm output from r and writes its documents. Documents sharing a
+// Source are appended to the same file with a --- separator. Sources are confined
+// to the sink: a leading / or .. is dropped.
+func (s *Splitter) Split(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(ScanDocuments)
+	scanner.Buffer(make([]byte, bufio.MaxScanTokenSize), MaxDocumentSize)
+	if !scanner.Scan() {
+		return scanner.Err()
+	}
+	// Every separator starts a line of its own, followed by the Source line.
+	separatorLine := 1 + strings.Count(scanner.Text(), "\n")
+	written := make(map[string]bool)
+	for index := 0; scanner.Scan(); index++ {
+		token := scanner.Text()
+		contentLine := separatorLine + 2
+		separatorLine += 1 + strings.Count(token, "\n")
+		source, content := ParseDocument(token)
+		name := strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(source, `\`, "/")), "/")
+		if name == "" {
+			continue
+		}
+		out := []byte(content)
+		if len(s.hooks) > 0 {
+			meta := describe(DocMeta{Source: source, Index: index, Line: contentLine}, out)
+			var err error
+			if out, err = ApplyHooks(meta, out, s.hooks, describe); err != nil {
+				return fmt.Errorf("document %d from %s: %w", index, source, err)
+			}
+		}
+		if out == nil || len(bytes.TrimSpace(out)) == 0 {
+			continue
+		}
+		if written[name] {
+			// The separator the yaml format of the command writes
+			separator := "\n---\n"
+			if !bytes.HasSuffix(out, []byte("\n")) {
+				separator = "\n" + separator
+			}
+			out = append([]byte(separator), out...)
+		}
+		if err := s.sink.CreateOrAppend(name, out); err != nil {
+			return err
+		}
+		written[name] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error scanning input stream: %w", err)
+	}
+	return Close(s.sink)
+}
+
+// describe returns meta with the apiVersion, kind, name and namespace of content.
+func describe(meta DocMeta, content []byte) DocMeta {
+	var object struct {
+		APIVersion string `yaml:"apiVersion"`
+		Kind       string `yaml:"kind"`
+		Metadata   struct {
+			Name      string `yaml:"name"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"metadata"`
+	}
+	// Documents that aren't Kubernetes objects keep empty metadata.
+	_ = yaml.Unmarshal(content, &object)
+	meta.APIVersion, meta.Kind = object.APIVersion, object.Kind
+	meta.Name, meta.Namespace = object.Metadata.Name, object.Metadata.Namespace
+	return meta
+}
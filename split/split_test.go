@@ -0,0 +1,222 @@
+package split
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// helmOutput returns a helm template stream of the given Source and content pairs.
+func helmOutput(docs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(docs); i += 2 {
+		b.WriteString(Separator + docs[i] + "\n" + docs[i+1])
+	}
+	return b.String()
+}
+
+func TestScanDocuments(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"empty", "", nil},
+		{"no separator", "NOTES: hello\n", []string{"NOTES: hello\n"}},
+		{"documents", "preamble\n" + helmOutput("a.yaml", "a: 1\n", "b.yaml", "b: 1\n"), []string{"preamble\n", "a.yaml\na: 1\n", "b.yaml\nb: 1\n"}},
+		{"plain --- is not a separator", helmOutput("a.yaml", "a: 1\n---\nb: 1\n"), []string{"", "a.yaml\na: 1\n---\nb: 1\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A tiny buffer makes the scanner ask for more data mid-separator.
+			scanner := bufio.NewScanner(bufio.NewReaderSize(strings.NewReader(tt.input), 16))
+			scanner.Buffer(make([]byte, 4), MaxDocumentSize)
+			scanner.Split(ScanDocuments)
+			var got []string
+			for scanner.Scan() {
+				got = append(got, scanner.Text())
+			}
+			if err := scanner.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokens = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDocument(t *testing.T) {
+	tests := []struct{ token, source, content string }{
+		{"a.yaml\na: 1\n", "a.yaml", "a: 1\n"},
+		{"a.yaml\n", "a.yaml", ""},
+		{"a.yaml", "a.yaml", ""},
+		{"\na: 1\n", "", "a: 1\n"},
+	}
+	for _, tt := range tests {
+		source, content := ParseDocument(tt.token)
+		if source != tt.source || content != tt.content {
+			t.Errorf("ParseDocument(%q) = %q, %q; want %q, %q", tt.token, source, content, tt.source, tt.content)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]string
+	}{
+		{"none", "", map[string]string{}},
+		{"shared Source", helmOutput("c/t/a.yaml", "a: 1\n", "c/t/b.yaml", "b: 1\n", "c/t/a.yaml", "a: 2\n"),
+			map[string]string{"c/t/a.yaml": "a: 1\n\n---\na: 2\n", "c/t/b.yaml": "b: 1\n"}},
+		{"missing trailing newline", helmOutput("a.yaml", "a: 1", "a.yaml", "a: 2"),
+			map[string]string{"a.yaml": "a: 1\n\n---\na: 2"}},
+		{"empty documents are skipped", helmOutput("a.yaml", "\n  \n", "a.yaml", "a: 1\n", "", "b: 1\n"),
+			map[string]string{"a.yaml": "a: 1\n"}},
+		{"Sources are confined", helmOutput("/etc/passwd", "a: 1\n", "../../x.yaml", "b: 1\n", `c\t\a.yaml`, "c: 1\n"),
+			map[string]string{"etc/passwd": "a: 1\n", "x.yaml": "b: 1\n", "c/t/a.yaml": "c: 1\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := NewMemSink()
+			if err := New(sink).Split(strings.NewReader(tt.input)); err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string)
+			for name, data := range sink.Files() {
+				got[name] = string(data)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitTooLargeDocument(t *testing.T) {
+	input := helmOutput("a.yaml", strings.Repeat("x", MaxDocumentSize+1))
+	if err := New(NewMemSink()).Split(strings.NewReader(input)); err == nil {
+		t.Error("split a document larger than MaxDocumentSize")
+	}
+}
+
+// closingSink records whether it was closed.
+type closingSink struct {
+	*MemSink
+	closed bool
+}
+
+func (c *closingSink) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestSplitClosesTheSink(t *testing.T) {
+	sink := &closingSink{MemSink: NewMemSink()}
+	if err := New(sink).Split(strings.NewReader(helmOutput("a.yaml", "a: 1\n"))); err != nil {
+		t.Fatal(err)
+	}
+	if !sink.closed {
+		t.Error("the sink was not closed")
+	}
+}
+
+func TestSplitHooks(t *testing.T) {
+	input := "preamble\n" + helmOutput(
+		"c/templates/cm.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n  namespace: prod\ndata:\n  a: \"1\"\n",
+		"c/templates/secret.yaml", "apiVersion: v1\nkind: Secret\nmetadata:\n  name: token\n",
+		"c/templates/notes.txt", "just text\n",
+	)
+	var seen []DocMeta
+	s := New(NewMemSink())
+	s.OnDocument(func(meta DocMeta, content []byte) ([]byte, error) {
+		seen = append(seen, meta)
+		return content, nil
+	})
+	if err := s.Split(strings.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+	want := []DocMeta{
+		{Source: "c/templates/cm.yaml", Index: 0, Line: 4, APIVersion: "v1", Kind: "ConfigMap", Name: "settings", Namespace: "prod"},
+		{Source: "c/templates/secret.yaml", Index: 1, Line: 13, APIVersion: "v1", Kind: "Secret", Name: "token"},
+		{Source: "c/templates/notes.txt", Index: 2, Line: 19},
+	}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("hooks saw\n%+v\nwant\n%+v", seen, want)
+	}
+}
+
+func TestSplitHookResults(t *testing.T) {
+	input := helmOutput(
+		"a.yaml", "apiVersion: v1\nkind: Secret\nmetadata:\n  name: s\n",
+		"a.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: c\n",
+	)
+	dropSecrets := func(meta DocMeta, content []byte) ([]byte, error) {
+		if meta.Kind == "Secret" {
+			return nil, nil
+		}
+		return content, nil
+	}
+	rename := func(meta DocMeta, content []byte) ([]byte, error) {
+		return bytes.ReplaceAll(content, []byte("kind: ConfigMap"), []byte("kind: Secret")), nil
+	}
+	fail := func(meta DocMeta, content []byte) ([]byte, error) {
+		return nil, errors.New("refused")
+	}
+	tests := []struct {
+		name  string
+		hooks []DocumentHook
+		want  string // content of a.yaml
+		err   bool
+	}{
+		{"none", nil, "apiVersion: v1\nkind: Secret\nmetadata:\n  name: s\n\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: c\n", false},
+		{"drop", []DocumentHook{dropSecrets}, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: c\n", false},
+		// Later hooks see the metadata of what earlier ones returned.
+		{"rewrite, then drop", []DocumentHook{rename, dropSecrets}, "", false},
+		{"drop, then rewrite", []DocumentHook{dropSecrets, rename}, "apiVersion: v1\nkind: Secret\nmetadata:\n  name: c\n", false},
+		{"error", []DocumentHook{fail}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := NewMemSink()
+			s := New(sink)
+			for _, hook := range tt.hooks {
+				s.OnDocument(hook)
+			}
+			err := s.Split(strings.NewReader(input))
+			if (err != nil) != tt.err {
+				t.Fatalf("Split() = %v, want error %v", err, tt.err)
+			}
+			if got := string(sink.Files()["a.yaml"]); got != tt.want {
+				t.Errorf("a.yaml = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyHooksDescribesOnlyRewrites(t *testing.T) {
+	describes := 0
+	describe := func(meta DocMeta, content []byte) DocMeta {
+		describes++
+		meta.Kind = string(content)
+		return meta
+	}
+	same := func(meta DocMeta, content []byte) ([]byte, error) { return content, nil }
+	upper := func(meta DocMeta, content []byte) ([]byte, error) { return bytes.ToUpper(content), nil }
+	var kinds []string
+	record := func(meta DocMeta, content []byte) ([]byte, error) {
+		kinds = append(kinds, meta.Kind)
+		return content, nil
+	}
+	out, err := ApplyHooks(DocMeta{Kind: "doc"}, []byte("doc"), []DocumentHook{same, record, upper, record, same}, describe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "DOC" || describes != 1 || !reflect.DeepEqual(kinds, []string{"doc", "DOC"}) {
+		t.Errorf("ApplyHooks() = %q after %d describes, hooks saw kinds %q", out, describes, kinds)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+var statsFile string // File the machine-readable counters of the render are written to
+
+func init() {
+	flag.StringVar(&statsFile, "stats-file", "", "Write machine-readable counters of the render to this JSON file: documents per kind, documents and bytes per Source, bytes per file, stage durations and findings, for later pipeline steps to assert on")
+}
+
+// renderStats is the document -stats-file writes.
+type renderStats struct {
+	Documents      int                    `json:"documents"`
+	Files          map[string]int         `json:"files"` // bytes per written file
+	Kinds          map[string]int         `json:"kinds"`
+	Sources        map[string]sourceStats `json:"sources"`
+	SkippedSources []string               `json:"skippedSources"`
+	Durations      map[string]float64     `json:"durations"` // seconds per stage, and in total
+	Warnings       int                    `json:"warnings"`
+	Errors         int                    `json:"errors"`
+	Findings       []findingStats         `json:"findings"`
+}
+
+type sourceStats struct {
+	Documents int `json:"documents"`
+	Bytes     int `json:"bytes"`
+}
+
+type findingStats struct {
+	File     string `json:"file"`
+	Resource string `json:"resource"`
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Line     int    `json:"line,omitempty"` // line of the input stream
+}
+
+// writeStats writes the -stats-file of a render that started at started. files are
+// the written files with their content.
+func writeStats(fsys split.FS, file string, files map[string][]byte, result *renderResult, findings []finding, started time.Time) error {
+	stats := renderStats{
+		Documents:      len(result.specs),
+		Files:          make(map[string]int),
+		Kinds:          kindCounts(result.specs),
+		Sources:        make(map[string]sourceStats),
+		SkippedSources: result.skipped,
+		Durations:      map[string]float64{"total": time.Since(started).Seconds()},
+		Findings:       []findingStats{},
+	}
+	if stats.SkippedSources == nil {
+		stats.SkippedSources = []string{}
+	}
+	for name, data := range files {
+		stats.Files[name] = len(data)
+	}
+	for _, s := range result.specs {
+		source := stats.Sources[s.origin]
+		source.Documents++
+		source.Bytes += len(s.content)
+		stats.Sources[s.origin] = source
+	}
+	for stage, d := range stages.durations {
+		stats.Durations[stage] = d.Seconds()
+	}
+	for _, f := range findings {
+		if f.severity == severityError {
+			stats.Errors++
+		} else {
+			stats.Warnings++
+		}
+		stats.Findings = append(stats.Findings, findingStats{
+			File:     f.spec.dest,
+			Resource: resourceName(f.spec),
+			Check:    f.check,
+			Severity: f.severity,
+			Message:  f.message,
+			Line:     f.inputLine(),
+		})
+	}
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := fsys.WriteFile(file, append(data, '\n'), filePermissions); err != nil {
+		return fmt.Errorf("error writing stats %s: %w", file, err)
+	}
+	return nil
+}
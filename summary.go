@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+var summaryMD string // File to write the Markdown summary of the render to
+
+func init() {
+	flag.StringVar(&summaryMD, "summary-md", "", "Write a Markdown summary of the render (files added/changed/removed, kinds, images, skipped sources, findings) to this file")
+}
+
+// snapshotTree reads every file below dir, keyed by its slash-separated path relative
+// to dir. A missing dir gives an empty snapshot.
+func snapshotTree(fsys split.FS, dir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	if _, err := fsys.Stat(dir); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return files, nil
+		}
+		return nil, err
+	}
+	err := fs.WalkDir(fsys, dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fsys.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		files[strings.TrimPrefix(name, path.Clean(dir)+"/")] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+// treeChanges compares two snapshots and returns the sorted names of the files that
+// were added, changed and removed going from before to after.
+func treeChanges(before, after map[string][]byte) (added, changed, removed []string) {
+	for _, name := range slices.Sorted(maps.Keys(after)) {
+		if old, ok := before[name]; !ok {
+			added = append(added, name)
+		} else if !bytes.Equal(old, after[name]) {
+			changed = append(changed, name)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(before)) {
+		if _, ok := after[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	return added, changed, removed
+}
+
+// renderImages returns the distinct container images of the written workloads, sorted.
+func renderImages(specs []*spec) []string {
+	seen := make(map[string]bool)
+	for _, s := range specs {
+		pod := podSpec(s)
+		if pod == nil {
+			continue
+		}
+		for _, c := range append(containers(pod, "initContainers"), containers(pod, "containers")...) {
+			if image := scalarField(c, "image"); image != "" {
+				seen[image] = true
+			}
+		}
+	}
+	return slices.Sorted(maps.Keys(seen))
+}
+
+// kindCounts returns how many documents of each kind were written.
+func kindCounts(specs []*spec) map[string]int {
+	kinds := make(map[string]int)
+	for _, s := range specs {
+		kind := s.kind()
+		if kind == "" {
+			kind = "(none)"
+		}
+		kinds[kind]++
+	}
+	return kinds
+}
+
+// writeMarkdownSummary renders a short summary of the render, meant to be posted as a
+// pull-request comment. before and after are the output tree before and after the run.
+func writeMarkdownSummary(before, after map[string][]byte, result *renderResult, findings []finding) []byte {
+	specs := result.specs
+	var b strings.Builder
+	added, changed, removed := treeChanges(before, after)
+
+	b.WriteString("## schelm render summary\n\n")
+	fmt.Fprintf(&b, "%d file(s), %d document(s): %d added, %d changed, %d removed.\n",
+		len(after), len(specs), len(added), len(changed), len(removed))
+
+	if len(added)+len(changed)+len(removed) > 0 {
+		b.WriteString("\n<details><summary>Changed files</summary>\n\n")
+		for _, group := range []struct {
+			mark  string
+			names []string
+		}{{"added", added}, {"changed", changed}, {"removed", removed}} {
+			for _, name := range group.names {
+				fmt.Fprintf(&b, "- `%s` (%s)\n", name, group.mark)
+			}
+		}
+		b.WriteString("\n</details>\n")
+	}
+
+	if kinds := kindCounts(specs); len(kinds) > 0 {
+		b.WriteString("\n### Kinds\n\n| Kind | Count |\n| --- | ---: |\n")
+		for _, kind := range slices.Sorted(maps.Keys(kinds)) {
+			fmt.Fprintf(&b, "| %s | %d |\n", kind, kinds[kind])
+		}
+	}
+
+	if images := renderImages(specs); len(images) > 0 {
+		b.WriteString("\n### Images\n\n")
+		for _, image := range images {
+			fmt.Fprintf(&b, "- `%s`\n", image)
+		}
+	}
+
+	if len(result.skipped) > 0 {
+		b.WriteString("\n### Skipped sources\n\nThese rendered nothing but comments or whitespace.\n\n")
+		for _, source := range result.skipped {
+			fmt.Fprintf(&b, "- `%s`\n", source)
+		}
+	}
+
+	if len(findings) > 0 {
+		b.WriteString("\n### Findings\n\n")
+		for _, f := range findings {
+			icon := ":warning:"
+			if f.severity == severityError {
+				icon = ":x:"
+			}
+			fmt.Fprintf(&b, "- %s `%s` %s: %s [%s]\n", icon, f.spec.dest, resourceName(f.spec), f.message, f.check)
+		}
+	}
+	return []byte(b.String())
+}
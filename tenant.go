@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+var tenantHeader string // Request header naming the tenant a render belongs to
+
+func init() {
+	flag.StringVar(&tenantHeader, "tenant-header", "", "With schelm serve, take the tenant of a render from this request header, e.g. X-Schelm-Tenant, and confine it to OUTPUT_ROOT/TENANT")
+}
+
+// tenantName matches the tenant names a -tenant-header may carry.
+var tenantName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// errForbidden is returned when a client asks for a tenant it may not use.
+var errForbidden = errors.New("forbidden")
+
+// tenantRoot returns the directory below root the render r of client is confined
+// to. The -tenant-header picks a tenant, which an authenticated client must list in
+// its tenants; otherwise the client's root applies.
+func tenantRoot(root string, client *serveClient, r *http.Request) (string, error) {
+	var tenant string
+	if tenantHeader != "" {
+		tenant = r.Header.Get(tenantHeader)
+	}
+	switch {
+	case tenant != "":
+		if !tenantName.MatchString(tenant) {
+			return "", fmt.Errorf("invalid tenant %q", tenant)
+		}
+		if client != nil && !slices.Contains(client.Tenants, tenant) {
+			return "", fmt.Errorf("%w: %s may not render for tenant %s", errForbidden, client.Name, tenant)
+		}
+		return path.Join(root, tenant), nil
+	case client != nil && client.Root != "":
+		return path.Join(root, client.Root), nil
+	case tenantHeader != "":
+		return "", fmt.Errorf("missing %s header", tenantHeader)
+	}
+	return root, nil
+}
+
+// confinedFS is a split.FS on the local disk that refuses any access outside its
+// root, whether by a ".." in a name, such as a hostile Source, or through a symlink.
+type confinedFS struct {
+	split.FS
+	root string
+}
+
+func (c confinedFS) check(name string) error {
+	clean := filepath.Clean(name)
+	root := filepath.Clean(c.root)
+	if clean != root && !strings.HasPrefix(clean, root+string(filepath.Separator)) {
+		return fmt.Errorf("%s is outside the tenant root %s", name, c.root)
+	}
+	// Resolve the part of the path that exists and make sure it stays inside, too.
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	for existing := clean; ; existing = filepath.Dir(existing) {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if errors.Is(err, fs.ErrNotExist) && existing != root {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if resolved != resolvedRoot && !strings.HasPrefix(resolved, resolvedRoot+string(filepath.Separator)) {
+			return fmt.Errorf("%s resolves outside the tenant root %s", name, c.root)
+		}
+		return nil
+	}
+}
+
+func (c confinedFS) Open(name string) (fs.File, error) {
+	if err := c.check(name); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return c.FS.Open(name)
+}
+
+func (c confinedFS) Stat(name string) (fs.FileInfo, error) {
+	if err := c.check(name); err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return c.FS.Stat(name)
+}
+
+func (c confinedFS) ReadFile(name string) ([]byte, error) {
+	if err := c.check(name); err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return c.FS.ReadFile(name)
+}
+
+func (c confinedFS) MkdirAll(name string, perm fs.FileMode) error {
+	if err := c.check(name); err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return c.FS.MkdirAll(name, perm)
+}
+
+func (c confinedFS) RemoveAll(name string) error {
+	if err := c.check(name); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return c.FS.RemoveAll(name)
+}
+
+func (c confinedFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if err := c.check(name); err != nil {
+		return &fs.PathError{Op: "write", Path: name, Err: err}
+	}
+	return c.FS.WriteFile(name, data, perm)
+}
+
+func (c confinedFS) AppendFile(name string, data []byte) error {
+	if err := c.check(name); err != nil {
+		return &fs.PathError{Op: "append", Path: name, Err: err}
+	}
+	return c.FS.AppendFile(name, data)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+func TestTenantRoot(t *testing.T) {
+	alice := &serveClient{Name: "alice", Tenants: []string{"shop", "blog"}}
+	rooted := &serveClient{Name: "ci", Root: "ci"}
+	tests := []struct {
+		name   string
+		header string // -tenant-header
+		tenant string // its value in the request
+		client *serveClient
+		want   string
+		err    error // errForbidden, or any other error
+	}{
+		{name: "no tenants", want: "/srv"},
+		{name: "client root", client: rooted, want: "/srv/ci"},
+		{name: "tenant", header: "X-Tenant", tenant: "shop", want: "/srv/shop"},
+		{name: "tenant of the client", header: "X-Tenant", tenant: "blog", client: alice, want: "/srv/blog"},
+		{name: "tenant over the client root", header: "X-Tenant", tenant: "shop", client: &serveClient{Name: "x", Root: "x", Tenants: []string{"shop"}}, want: "/srv/shop"},
+		{name: "client root without a tenant header value", header: "X-Tenant", client: rooted, want: "/srv/ci"},
+		{name: "foreign tenant", header: "X-Tenant", tenant: "bank", client: alice, err: errForbidden},
+		{name: "missing tenant", header: "X-Tenant", err: errors.New("missing")},
+		{name: "escaping tenant", header: "X-Tenant", tenant: "..", err: errors.New("invalid")},
+		{name: "tenant with a slash", header: "X-Tenant", tenant: "a/b", err: errors.New("invalid")},
+		{name: "hidden tenant", header: "X-Tenant", tenant: ".git", err: errors.New("invalid")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, &tenantHeader, tt.header)
+			r := httptest.NewRequest("POST", "/render/app", nil)
+			if tt.tenant != "" {
+				r.Header.Set("X-Tenant", tt.tenant)
+			}
+			got, err := tenantRoot("/srv", tt.client, r)
+			switch {
+			case tt.err == nil && err != nil:
+				t.Fatal(err)
+			case tt.err != nil && err == nil:
+				t.Fatalf("tenantRoot() = %q, want an error", got)
+			case errors.Is(tt.err, errForbidden) != errors.Is(err, errForbidden):
+				t.Fatalf("tenantRoot() = %v, want forbidden %v", err, errors.Is(tt.err, errForbidden))
+			}
+			if got != tt.want {
+				t.Errorf("tenantRoot() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfinedFS(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "tenant")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{root, outside} {
+		if err := os.Mkdir(dir, 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	c := confinedFS{FS: split.OSFS{}, root: root}
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{root, true},
+		{filepath.Join(root, "app", "a.yaml"), true},
+		{filepath.Join(root, "app", "..", "b.yaml"), true},
+		{filepath.Join(root, "..", "outside", "a.yaml"), false},
+		{outside, false},
+		{root + "-other", false},
+		{filepath.Join(root, "link", "a.yaml"), false},
+		{filepath.Join(root, "link", "new", "a.yaml"), false},
+	}
+	for _, tt := range tests {
+		err := c.check(tt.name)
+		if (err == nil) != tt.ok {
+			t.Errorf("check(%s) = %v, want ok %v", tt.name, err, tt.ok)
+		}
+		if tt.ok {
+			continue
+		}
+		if err := c.MkdirAll(filepath.Dir(tt.name), dirPermissions); err == nil {
+			t.Errorf("MkdirAll(%s) succeeded", filepath.Dir(tt.name))
+		}
+		if err := c.WriteFile(tt.name, []byte("x"), filePermissions); err == nil {
+			t.Errorf("WriteFile(%s) succeeded", tt.name)
+		}
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("wrote %v outside the tenant root", entries)
+	}
+}
+
+// withCommandLine parses args as the command line for the duration of the test,
+// with flag.CommandLine replaced by a copy so the flags set don't outlive it.
+func withCommandLine(t *testing.T, args ...string) {
+	t.Helper()
+	original := flag.CommandLine
+	commandLine := flag.NewFlagSet(original.Name(), flag.ContinueOnError)
+	original.VisitAll(func(f *flag.Flag) { commandLine.Var(f.Value, f.Name, f.Usage) })
+	flag.CommandLine = commandLine
+	t.Cleanup(func() {
+		commandLine.Visit(func(f *flag.Flag) { f.Value.Set(original.Lookup(f.Name).DefValue) })
+		flag.CommandLine = original
+	})
+	if err := commandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckServeFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"/srv"}, true},
+		{[]string{"-f", "-report-format", "github", "-tenant-header", "X-Tenant", "/srv"}, true},
+		{[]string{"-summary-md", "summary.md", "/srv"}, false},
+		{[]string{"-report-file", "report.txt", "/srv"}, false},
+		{[]string{"-archive", "out.tgz", "/srv"}, false},
+		{[]string{"-f", "-trash", "/srv"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.args[0], func(t *testing.T) {
+			withCommandLine(t, tt.args...)
+			if err := checkServeFlags(); (err == nil) != tt.ok {
+				t.Errorf("checkServeFlags() = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestServeTenants(t *testing.T) {
+	setFlag(t, &tenantHeader, "X-Tenant")
+	s := testServer(t)
+	s.clients = []serveClient{{Name: "alice", Token: "secret", Tenants: []string{"shop"}}}
+	tests := []struct {
+		name   string
+		header map[string]string
+		status int
+	}{
+		{"anonymous", map[string]string{"X-Tenant": "shop"}, http.StatusUnauthorized},
+		{"wrong token", map[string]string{"Authorization": "Bearer guess", "X-Tenant": "shop"}, http.StatusUnauthorized},
+		{"foreign tenant", map[string]string{"Authorization": "Bearer secret", "X-Tenant": "bank"}, http.StatusForbidden},
+		{"no tenant", map[string]string{"Authorization": "Bearer secret"}, http.StatusBadRequest},
+		{"own tenant", map[string]string{"Authorization": "Bearer secret", "X-Tenant": "shop"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do(s, "POST", "/render/app", serveInput, tt.header); w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+	if _, err := os.Stat(filepath.Join(s.root, "shop", "app", "chart", "templates", "cm.yaml")); err != nil {
+		t.Errorf("the render of tenant shop is missing: %v", err)
+	}
+}
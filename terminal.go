@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var colorMode string // When the log is shown as a colored table: auto, always or never
+
+func init() {
+	flag.StringVar(&colorMode, "color", "auto", "Show progress as a colored table with a summary line: auto (when stderr is a terminal and NO_COLOR is unset), always or never")
+}
+
+// useTerminalLog reports whether the log should go through a terminalLog.
+func useTerminalLog() (bool, error) {
+	switch colorMode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		return os.Getenv("NO_COLOR") == "" && stderrIsTerminal(), nil
+	}
+	return false, fmt.Errorf("invalid -color %q (expected auto, always or never)", colorMode)
+}
+
+// terminalAction is a kind of log line the terminal table shows as a row.
+type terminalAction struct {
+	prefix, verb, icon, color string
+	counted                   string // How the summary line counts the rows, empty to leave them out
+	count                     int
+}
+
+// terminalLog renders the log lines about created, appended and skipped files as a
+// compact table, passing the other lines through dimmed. The log must have no
+// flags set, so that every write is one message.
+type terminalLog struct {
+	out     io.Writer
+	actions []*terminalAction
+}
+
+func newTerminalLog(out io.Writer) *terminalLog {
+	return &terminalLog{out: out, actions: []*terminalAction{
+		{prefix: "Creating output directory ", verb: "mkdir", icon: "▸", color: ansiDim},
+		{prefix: "Creating ", verb: "create", icon: "+", color: ansiGreen, counted: "created"},
+		{prefix: "Appending to ", verb: "append", icon: "»", color: ansiCyan, counted: "appended"},
+		{prefix: "Skipping ", verb: "skip", icon: "-", color: ansiYellow, counted: "skipped"},
+		{prefix: "Warning: ", verb: "warning", icon: "!", color: ansiYellow, counted: "warnings"},
+		{prefix: "Conflict: ", verb: "conflict", icon: "✗", color: ansiRed, counted: "conflicts"},
+	}}
+}
+
+func (t *terminalLog) Write(p []byte) (int, error) {
+	msg := string(bytes.TrimRight(p, "\n"))
+	for _, a := range t.actions {
+		if rest, ok := strings.CutPrefix(msg, a.prefix); ok {
+			a.count++
+			_, err := fmt.Fprintf(t.out, "  %s%s %-8s%s %s\n", a.color, a.icon, a.verb, ansiReset, rest)
+			return len(p), err
+		}
+	}
+	_, err := fmt.Fprintf(t.out, "  %s%s%s\n", ansiDim, msg, ansiReset)
+	return len(p), err
+}
+
+// summary writes the final line counting the rows of each kind.
+func (t *terminalLog) summary(failed bool) {
+	var counts []string
+	for _, a := range t.actions {
+		if a.count > 0 && a.counted != "" {
+			counts = append(counts, fmt.Sprintf("%d %s", a.count, a.counted))
+		}
+	}
+	if len(counts) == 0 {
+		counts = append(counts, "nothing written")
+	}
+	if failed {
+		fmt.Fprintf(t.out, "%s%s✗ Failed:%s %s\n", ansiBold, ansiRed, ansiReset, strings.Join(counts, ", "))
+		return
+	}
+	fmt.Fprintf(t.out, "%s%s✓ Done:%s %s\n", ansiBold, ansiGreen, ansiReset, strings.Join(counts, ", "))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path"
+	"strings"
+)
+
+var terraformSplit string // Whether terraform output gets one file per source or per resource
+
+func init() {
+	flag.StringVar(&terraformSplit, "terraform-split", "source", "With -format terraform, write one .tf file per \"source\" or per \"resource\"")
+}
+
+// parseTerraformSplit validates the --terraform-split value and reports whether
+// every resource gets its own file.
+func parseTerraformSplit(value string) (bool, error) {
+	switch value {
+	case "", "source":
+		return false, nil
+	case "resource":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid -terraform-split %q (expected source or resource)", value)
+}
+
+// terraformFormat converts each document into a kubernetes_manifest resource block.
+type terraformFormat struct {
+	perResource bool
+	// names are scoped per directory, since every .tf file in a directory
+	// belongs to the same Terraform module and names must be unique there.
+	names identifierSet
+}
+
+func newTerraformFormat(perResource bool) *terraformFormat {
+	return &terraformFormat{perResource: perResource, names: make(identifierSet)}
+}
+
+func (t *terraformFormat) render(s *spec) (string, string, error) {
+	root, err := s.root()
+	if err != nil {
+		return "", "", err
+	}
+	if root == nil {
+		return "", "", nil
+	}
+
+	dir := path.Dir(s.source)
+	name := t.names.claim(dir, specIdentifier(s))
+	dest := strings.TrimSuffix(s.source, path.Ext(s.source)) + ".tf"
+	if t.perResource {
+		dest = path.Join(dir, name+".tf")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "resource \"kubernetes_manifest\" %s {\n  manifest = ", hclString(name))
+	if err := writeLiteral(&b, hclStyle, root, 1); err != nil {
+		return "", "", fmt.Errorf("error converting document from %s: %w", s.source, err)
+	}
+	b.WriteString("\n}\n")
+	return dest, b.String(), nil
+}
+
+func (t *terraformFormat) separator(string) string {
+	return "\n"
+}
+
+// hclStyle writes Terraform object and tuple literals.
+var hclStyle = literalStyle{language: "HCL", assign: " = ", key: hclKey, str: hclString}
+
+// hclKey returns key as an HCL object key, quoting it unless it is a plain identifier.
+// Keywords are always quoted since HCL would otherwise read them as literals or a for expression.
+func hclKey(key string) string {
+	switch key {
+	case "true", "false", "null", "for", "in", "if":
+		return hclString(key)
+	}
+	if isIdentifier(key, true) {
+		return key
+	}
+	return hclString(key)
+}
+
+// hclString quotes s as an HCL string literal, escaping template sequences so the
+// value is taken literally.
+func hclString(s string) string {
+	// "${" and "%{" start interpolations and directives; doubling escapes them.
+	s = strings.ReplaceAll(s, "${", "$${")
+	s = strings.ReplaceAll(s, "%{", "%%{")
+	return quoteString(s)
+}
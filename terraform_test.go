@@ -0,0 +1,142 @@
+package main
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseTerraformSplit(t *testing.T) {
+	tests := []struct {
+		value       string
+		perResource bool
+		ok          bool
+	}{
+		{"", false, true},
+		{"source", false, true},
+		{"resource", true, true},
+		{"file", false, false},
+	}
+	for _, tt := range tests {
+		perResource, err := parseTerraformSplit(tt.value)
+		if (err == nil) != tt.ok || perResource != tt.perResource {
+			t.Errorf("parseTerraformSplit(%q) = %v, %v; want %v, ok %v", tt.value, perResource, err, tt.perResource, tt.ok)
+		}
+	}
+}
+
+func TestHCLKey(t *testing.T) {
+	tests := []struct{ key, want string }{
+		{"name", "name"},
+		{"app-name", "app-name"},
+		{"app.kubernetes.io/name", `"app.kubernetes.io/name"`},
+		{"9lives", `"9lives"`},
+		{"for", `"for"`},
+		{"true", `"true"`},
+		{"null", `"null"`},
+		{"", `""`},
+	}
+	for _, tt := range tests {
+		if got := hclKey(tt.key); got != tt.want {
+			t.Errorf("hclKey(%q) = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestHCLString(t *testing.T) {
+	tests := []struct{ s, want string }{
+		{"plain", `"plain"`},
+		{"nginx:${TAG}", `"nginx:$${TAG}"`},
+		{"%{ if x }", `"%%{ if x }"`},
+		{"$HOME and $", `"$HOME and $"`},
+		{"line\n\"quoted\"\t\\", `"line\n\"quoted\"\t\\"`},
+	}
+	for _, tt := range tests {
+		if got := hclString(tt.s); got != tt.want {
+			t.Errorf("hclString(%q) = %s, want %s", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestTerraformFormat(t *testing.T) {
+	setFlag(t, &format, "terraform")
+	input := helmOutput(
+		"web/templates/app.yaml", "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n  labels:\n    app.kubernetes.io/name: web\nspec:\n  ports: [{port: 80}]\n  selector: {}\n  publishNotReadyAddresses: false\n",
+		"web/templates/app.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\n  namespace: prod\ndata:\n  image: \"nginx:${TAG}\"\n  ratio: \"0.5\"\n  empty: null\n",
+	)
+	want := `resource "kubernetes_manifest" "service_web" {
+  manifest = {
+    apiVersion = "v1"
+    kind = "Service"
+    metadata = {
+      name = "web"
+      labels = {
+        "app.kubernetes.io/name" = "web"
+      }
+    }
+    spec = {
+      ports = [
+        {
+          port = 80
+        },
+      ]
+      selector = {}
+      publishNotReadyAddresses = false
+    }
+  }
+}
+
+resource "kubernetes_manifest" "configmap_prod_web" {
+  manifest = {
+    apiVersion = "v1"
+    kind = "ConfigMap"
+    metadata = {
+      name = "web"
+      namespace = "prod"
+    }
+    data = {
+      image = "nginx:$${TAG}"
+      ratio = "0.5"
+      empty = null
+    }
+  }
+}
+`
+	files := render(t, input)
+	if got := files["web/templates/app.tf"]; got != want {
+		t.Errorf("app.tf:\n%s\nwant:\n%s", got, want)
+	}
+	if len(files) != 1 {
+		t.Errorf("wrote %v, want only web/templates/app.tf", slices.Sorted(maps.Keys(files)))
+	}
+}
+
+func TestTerraformSplitPerResource(t *testing.T) {
+	setFlag(t, &format, "terraform")
+	setFlag(t, &terraformSplit, "resource")
+	cm := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\n"
+	input := helmOutput(
+		"web/templates/a.yaml", cm,
+		"web/templates/b.yaml", cm, // same name in the same module
+		"web/charts/db/templates/c.yaml", cm, // another directory, another module
+	)
+	got := slices.Sorted(maps.Keys(render(t, input)))
+	want := []string{
+		"web/charts/db/templates/configmap_web.tf",
+		"web/templates/configmap_web.tf",
+		"web/templates/configmap_web_2.tf",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrote %v, want %v", got, want)
+	}
+}
+
+func TestTerraformRejectsUnrepresentableNumbers(t *testing.T) {
+	setFlag(t, &format, "terraform")
+	_, err := renderInMemory(strings.NewReader(helmOutput("web/templates/a.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\nspec:\n  value: .inf\n")))
+	if err == nil {
+		t.Fatal("rendered infinity, want an error")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+	"gopkg.in/yaml.v3"
+)
+
+var tiltFile string // Tiltfile fragment written with the k8s_yaml calls of the output
+
+func init() {
+	flag.StringVar(&tiltFile, "tiltfile", "", "Write a Tiltfile fragment to this file, e.g. Tiltfile.schelm for include(), that loads the files of OUTPUT_DIR with one k8s_yaml call per workload, attaching the ConfigMaps, Secrets and Services each uses to its resource")
+}
+
+// tiltGroup is a workload with the files and objects it loads.
+type tiltGroup struct {
+	workload *spec
+	files    []string
+	objects  []string // Tilt object selectors, name:kind[:namespace]
+}
+
+// writeTiltfile writes the -tiltfile fragment for specs, written to dir.
+func writeTiltfile(fsys split.FS, file, dir string, specs []*spec) error {
+	claimed := make(map[string]bool)  // files loaded by a k8s_yaml call already
+	attached := make(map[string]bool) // objects of a k8s_resource already
+	var groups []*tiltGroup
+	var others []string
+	claim := func(g *tiltGroup, s *spec) {
+		if !claimed[s.dest] {
+			claimed[s.dest] = true
+			g.files = append(g.files, s.dest)
+		}
+	}
+
+	var configs, services []*spec
+	for _, s := range specs {
+		switch s.kind() {
+		case "ConfigMap", "Secret":
+			configs = append(configs, s)
+		case "Service":
+			services = append(services, s)
+		}
+	}
+	for _, s := range specs {
+		pod := podSpec(s)
+		if pod == nil {
+			continue
+		}
+		g := &tiltGroup{workload: s}
+		claim(g, s)
+		for _, ref := range configReferences(pod) {
+			if c := findConfig(configs, ref, s.namespace()); c != nil {
+				claim(g, c)
+				if object := tiltObject(c); !attached[object] {
+					attached[object] = true
+					g.objects = append(g.objects, object)
+				}
+			}
+		}
+		root, _ := s.root()
+		paths := podSpecPaths[s.kind()]
+		labels := lookupNode(root, append(paths[:len(paths)-1:len(paths)-1], "metadata", "labels")...)
+		for _, svc := range services {
+			if svc.namespace() == s.namespace() && selects(svc, labels) {
+				claim(g, svc)
+			}
+		}
+		groups = append(groups, g)
+	}
+	for _, s := range specs {
+		if !claimed[s.dest] {
+			claimed[s.dest] = true
+			others = append(others, s.dest)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("# Generated by schelm: load the split manifests with include('" + path.Base(file) + "').\n")
+	for _, g := range groups {
+		fmt.Fprintf(&b, "\n# %s\n", resourceName(g.workload))
+		if err := writeK8sYAML(&b, file, dir, g.files); err != nil {
+			return err
+		}
+		if len(g.objects) > 0 {
+			fmt.Fprintf(&b, "k8s_resource(%s, objects=[%s])\n", quoteString(g.workload.name()), quoteList(g.objects))
+		}
+	}
+	if len(others) > 0 {
+		b.WriteString("\n# Other resources\n")
+		if err := writeK8sYAML(&b, file, dir, others); err != nil {
+			return err
+		}
+	}
+	if err := fsys.WriteFile(file, []byte(b.String()), filePermissions); err != nil {
+		return fmt.Errorf("error writing Tiltfile %s: %w", file, err)
+	}
+	return nil
+}
+
+// writeK8sYAML writes a k8s_yaml call loading files, written to dir, relative to
+// the Tiltfile.
+func writeK8sYAML(b *strings.Builder, file, dir string, files []string) error {
+	var paths []string
+	for _, name := range files {
+		rel, err := relativeToFile(file, path.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		paths = append(paths, rel)
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	fmt.Fprintf(b, "k8s_yaml([%s])\n", quoteList(paths))
+	return nil
+}
+
+// tiltObject returns the Tilt selector of the object s.
+func tiltObject(s *spec) string {
+	object := s.name() + ":" + strings.ToLower(s.kind())
+	if ns := s.namespace(); ns != "" {
+		object += ":" + ns
+	}
+	return object
+}
+
+// selects reports whether the selector of the Service svc matches labels.
+func selects(svc *spec, labels *yaml.Node) bool {
+	root, err := svc.root()
+	if err != nil {
+		return false
+	}
+	selector := lookupNode(root, "spec", "selector")
+	if selector == nil || selector.Kind != yaml.MappingNode || len(selector.Content) == 0 {
+		return false
+	}
+	for i := 0; i+1 < len(selector.Content); i += 2 {
+		if value := scalarField(labels, selector.Content[i].Value); value == "" || value != selector.Content[i+1].Value {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteList joins the quoted strings of items with commas.
+func quoteList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = quoteString(item)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+var transforms stringList // Commands every document is piped through, in order
+
+func init() {
+	flag.Var(&transforms, "transform", "Pipe every document through this shell command's stdin/stdout before writing (repeatable, applied in order; empty output drops the document)")
+}
+
+// transformHook returns a hook piping each document through command, run by the
+// platform shell. The document's metadata is exported as SCHELM_* environment
+// variables so scripts can act on it without parsing.
+func transformHook(command string) split.DocumentHook {
+	return func(meta split.DocMeta, content []byte) ([]byte, error) {
+		cmd := shellCommand(command)
+		cmd.Stdin = bytes.NewReader(content)
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(),
+			"SCHELM_SOURCE="+meta.Source,
+			"SCHELM_API_VERSION="+meta.APIVersion,
+			"SCHELM_KIND="+meta.Kind,
+			"SCHELM_NAME="+meta.Name,
+			"SCHELM_NAMESPACE="+meta.Namespace,
+		)
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("transform %q failed: %w", command, err)
+		}
+		if len(bytes.TrimSpace(out)) == 0 {
+			return nil, nil
+		}
+		return out, nil
+	}
+}
+
+// shellCommand runs command through sh, or cmd on Windows, so quoting works as typed.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
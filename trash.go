@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+// trashIndexFile lists, one per line, the absolute paths a trash session holds.
+const trashIndexFile = "index"
+
+var trashFiles bool // Whether removed files go to the trash instead of being deleted
+
+func init() {
+	flag.BoolVar(&trashFiles, "trash", false, "Move the files -f removes from OUTPUT_DIR to a trash directory below the temporary directory instead of deleting them, so schelm restore can bring them back")
+}
+
+// trashRoot is the directory holding one trash session directory per run.
+func trashRoot() string {
+	return filepath.Join(os.TempDir(), "schelm-trash")
+}
+
+// trashFS copies whatever is removed through it into a trash session before
+// removing it. Trashed paths keep their absolute path below the session directory.
+type trashFS struct {
+	split.FS
+	session string
+}
+
+// Sessions are named by their start time to the nanosecond, so a restore, which
+// trashes what it replaces, never adds to the session it restores from.
+func newTrashFS(fsys split.FS) *trashFS {
+	session := fmt.Sprintf("%s-%d", time.Now().Format("20060102T150405.000000000"), os.Getpid())
+	return &trashFS{FS: fsys, session: filepath.Join(trashRoot(), session)}
+}
+
+// RemoveAll moves name and everything below it to the trash.
+func (t *trashFS) RemoveAll(name string) error {
+	if _, err := t.Stat(name); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+	if err := copyToOS(t.FS, name, trashPath(t.session, abs)); err != nil {
+		return fmt.Errorf("error moving %s to the trash: %w", name, err)
+	}
+	index, err := os.OpenFile(filepath.Join(t.session, trashIndexFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, filePermissions)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(index, abs)
+	if closeErr := index.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Moved %s to the trash in %s", name, t.session)
+	return t.FS.RemoveAll(name)
+}
+
+// trashPath is where a session keeps the absolute path abs.
+func trashPath(session, abs string) string {
+	return filepath.Join(session, strings.TrimPrefix(abs, filepath.VolumeName(abs)))
+}
+
+// copyToOS copies the file or tree name of fsys to dest on the local disk.
+func copyToOS(fsys fs.FS, name, dest string) error {
+	return fs.WalkDir(fsys, name, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(name, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, dirPermissions)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), dirPermissions); err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, info.Mode().Perm())
+	})
+}
+
+// trashSessions returns the trash sessions, newest first.
+func trashSessions() ([]string, error) {
+	entries, err := os.ReadDir(trashRoot())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var sessions []string
+	for _, e := range entries {
+		if e.IsDir() {
+			sessions = append(sessions, e.Name())
+		}
+	}
+	slices.Sort(sessions)
+	slices.Reverse(sessions)
+	return sessions, nil
+}
+
+// trashedPaths reads the index of a session.
+func trashedPaths(session string) ([]string, error) {
+	file, err := os.Open(filepath.Join(trashRoot(), session, trashIndexFile))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var paths []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		paths = append(paths, scanner.Text())
+	}
+	return paths, scanner.Err()
+}
+
+// restoreMain implements "schelm restore [-session ID] [PATH...]": without paths
+// it lists the trash, otherwise it puts back the newest trashed copy of each path,
+// moving what is there now to the trash first.
+func restoreMain(args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	session := flags.String("session", "", "Restore from this trash session instead of the newest one holding the path")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: schelm restore [-session ID] [PATH...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	sessions, err := trashSessions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if *session != "" {
+		if !slices.Contains(sessions, *session) {
+			fmt.Fprintf(os.Stderr, "Error: no trash session %s in %s\n", *session, trashRoot())
+			return 1
+		}
+		sessions = []string{*session}
+	}
+	if flags.NArg() == 0 {
+		for _, s := range sessions {
+			paths, err := trashedPaths(s)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+			for _, p := range paths {
+				fmt.Printf("%s\t%s\n", s, p)
+			}
+		}
+		return 0
+	}
+
+	status := 0
+	for _, name := range flags.Args() {
+		if err := restorePath(sessions, name); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// restorePath puts back the copy of name from the first session holding it.
+func restorePath(sessions []string, name string) error {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		src := trashPath(filepath.Join(trashRoot(), s), abs)
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		if err := newTrashFS(split.OSFS{}).RemoveAll(name); err != nil {
+			return err
+		}
+		if err := copyToOS(os.DirFS(filepath.Dir(src)), filepath.Base(src), abs); err != nil {
+			return fmt.Errorf("error restoring %s: %w", name, err)
+		}
+		log.Printf("Restored %s from trash session %s", name, s)
+		return nil
+	}
+	return fmt.Errorf("%s is not in the trash", name)
+}
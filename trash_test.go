@@ -0,0 +1,113 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+func TestTrash(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	setFlag(t, &force, true)
+	setFlag(t, &trashFiles, true)
+	fsys := split.NewMemFS()
+	svc := "apiVersion: v1\nkind: Service\nmetadata:\n  name: old\n"
+	writeTree(t, fsys, map[string]string{"out/web/templates/svc.yaml": svc, "out/notes.txt": "hand-written\n"})
+	input := helmOutput("web/templates/cm.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\n")
+	if err := run(fsys, strings.NewReader(input), io.Discard, "out"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat("out/notes.txt"); err == nil {
+		t.Error("-f -trash kept a file of OUTPUT_DIR")
+	}
+
+	sessions, err := trashSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("trash sessions %q, want one", sessions)
+	}
+	paths, err := trashedPaths(sessions[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs, err := filepath.Abs("out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != abs {
+		t.Fatalf("trashed %q, want %s", paths, abs)
+	}
+	session := filepath.Join(trashRoot(), sessions[0])
+	for name, want := range map[string]string{"web/templates/svc.yaml": svc, "notes.txt": "hand-written\n"} {
+		got, err := os.ReadFile(filepath.Join(trashPath(session, abs), filepath.FromSlash(name)))
+		if err != nil || string(got) != want {
+			t.Errorf("trashed %s = %q, %v; want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	file := filepath.Join(t.TempDir(), "cm.yaml")
+	if err := os.WriteFile(file, []byte("v1\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := newTrashFS(split.OSFS{}).RemoveAll(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file); err == nil {
+		t.Fatal("RemoveAll() kept the file")
+	}
+	if err := newTrashFS(split.OSFS{}).RemoveAll(file); err != nil {
+		t.Errorf("RemoveAll() of a missing file = %v", err)
+	}
+
+	sessions, err := trashSessions()
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("trashSessions() = %q, %v; want one session", sessions, err)
+	}
+	if got, want := captureStdout(t, func() { restoreMain(nil) }), sessions[0]+"\t"+file+"\n"; got != want {
+		t.Errorf("schelm restore listed %q, want %q", got, want)
+	}
+
+	// Restoring moves what is there now to the trash.
+	if err := os.WriteFile(file, []byte("v2\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if status := restoreMain([]string{"-session", sessions[0], file}); status != 0 {
+		t.Fatalf("schelm restore exited with %d", status)
+	}
+	if got, err := os.ReadFile(file); err != nil || string(got) != "v1\n" {
+		t.Errorf("restored %q, %v; want v1", got, err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o640 {
+		t.Errorf("restored with mode %v, want 0640", info.Mode().Perm())
+	}
+	// The replaced file goes to a session of its own, leaving the restored copy.
+	if sessions, err = trashSessions(); err != nil || len(sessions) != 2 {
+		t.Fatalf("trashSessions() = %q, %v; want two sessions", sessions, err)
+	}
+	for i, want := range []string{"v2\n", "v1\n"} {
+		got, err := os.ReadFile(trashPath(filepath.Join(trashRoot(), sessions[i]), file))
+		if err != nil || string(got) != want {
+			t.Errorf("session %s holds %q, %v; want %q", sessions[i], got, err, want)
+		}
+	}
+
+	if status := restoreMain([]string{filepath.Join(t.TempDir(), "missing.yaml")}); status != 1 {
+		t.Errorf("restoring a path not in the trash exited with %d, want 1", status)
+	}
+	if status := restoreMain([]string{"-session", "no-such-session", file}); status != 1 {
+		t.Errorf("restoring from an unknown session exited with %d, want 1", status)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io/fs"
+	"log"
+	"os"
+	"strconv"
+
+	"bromaniac.github.com/schelm/split"
+	"gopkg.in/yaml.v3"
+)
+
+// untouchedRules select the documents and fields that the rewrites of
+// -config-checksums and -normalize-profile must leave as rendered, such as the
+// annotations cert-manager's CA injector reads. They have the shape of ignore rules;
+// a rule without jsonPointers or fieldPaths protects the whole document.
+type untouchedRules []ignoreRule
+
+// untouched are the rules of the config file, loaded by run when a rewrite that
+// honours them is enabled.
+var untouched untouchedRules
+
+// loadUntouchedRules reads the untouched rules of the -config file. A missing
+// default config file is no error, as most renders have none.
+func loadUntouchedRules() (untouchedRules, error) {
+	explicit := false
+	flag.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "config" })
+	if _, err := os.Stat(configFile); errors.Is(err, fs.ErrNotExist) && !explicit {
+		return nil, nil
+	}
+	config, err := loadConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+	return config.Untouched, nil
+}
+
+// restore puts the protected fields of after, a rewrite of the document before, back
+// the way they were in before. It returns true if a rule protects the whole
+// document, which must then be kept as it was.
+func (rules untouchedRules) restore(before, after *yaml.Node) bool {
+	for _, r := range rules {
+		if !r.matches(before) {
+			continue
+		}
+		if len(r.paths) == 0 {
+			return true
+		}
+		for _, segs := range r.paths {
+			restoreField(after, before, segs)
+		}
+	}
+	return false
+}
+
+// keep applies the rules to rewritten, a rewrite of the document original from
+// source.
+func (rules untouchedRules) keep(source string, original, rewritten []byte) ([]byte, error) {
+	if len(rules) == 0 {
+		return rewritten, nil
+	}
+	before, err := newSpec(source, string(original)).root()
+	if err != nil || before == nil || before.Kind != yaml.MappingNode {
+		return rewritten, nil
+	}
+	after, err := newSpec(source, string(rewritten)).root()
+	if err != nil || after == nil || after.Kind != yaml.MappingNode {
+		return rewritten, nil
+	}
+	if rules.restore(before, after) {
+		return original, nil
+	}
+	out, err := encodeYAML(after)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(out), nil
+}
+
+// restoreField makes the fields at segs below dst what they are below src: values
+// are copied back, and fields src lacks are removed.
+func restoreField(dst, src *yaml.Node, segs []string) {
+	dst, src = resolveAlias(dst), resolveAlias(src)
+	seg, last := segs[0], len(segs) == 1
+	switch {
+	case dst.Kind == yaml.MappingNode && src.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			key, value := src.Content[i].Value, src.Content[i+1]
+			if seg != "*" && key != seg {
+				continue
+			}
+			current := lookupNode(dst, key)
+			switch {
+			case last:
+				setKey(dst, key, cloneNode(value))
+			case current == nil && resolveAlias(value).Kind == yaml.MappingNode:
+				current = &yaml.Node{Kind: yaml.MappingNode}
+				setKey(dst, key, current)
+				restoreField(current, value, segs[1:])
+			case current != nil:
+				restoreField(current, value, segs[1:])
+			}
+		}
+		for i := 0; i+1 < len(dst.Content); i += 2 {
+			key := dst.Content[i].Value
+			if seg != "*" && key != seg || lookupNode(src, key) != nil {
+				continue
+			}
+			if last {
+				dst.Content = append(dst.Content[:i], dst.Content[i+2:]...)
+				i -= 2
+			} else {
+				removeField(dst.Content[i+1], segs[1:])
+			}
+		}
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode:
+		for i, item := range src.Content {
+			if i >= len(dst.Content) {
+				break
+			}
+			if seg != "*" && seg != strconv.Itoa(i) {
+				continue
+			}
+			if last {
+				dst.Content[i] = cloneNode(item)
+			} else {
+				restoreField(dst.Content[i], item, segs[1:])
+			}
+		}
+	}
+}
+
+// untouchedHook wraps a hook so its rewrites honour the untouched rules.
+func untouchedHook(hook split.DocumentHook) split.DocumentHook {
+	return func(meta split.DocMeta, content []byte) ([]byte, error) {
+		out, err := hook(meta, content)
+		if err != nil || len(untouched) == 0 {
+			return out, err
+		}
+		kept, err := untouched.keep(meta.Source, content, out)
+		if err != nil {
+			return nil, err
+		}
+		if string(kept) == string(content) && string(out) != string(content) {
+			log.Printf("Leaving document from %s untouched, as the config lists it", meta.Source)
+		}
+		return kept, nil
+	}
+}
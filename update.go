@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+// updateIndexFile lists the files the last -update run wrote to OUTPUT_DIR, so the
+// next one knows which of them are stale.
+const updateIndexFile = ".schelm-index"
+
+var updateOutput bool // Whether OUTPUT_DIR is updated in place instead of replaced
+
+func init() {
+	flag.BoolVar(&updateOutput, "update", false, "Update OUTPUT_DIR in place, without -f: overwrite the files of this render, remove the files an earlier -update run wrote that this render no longer produces, as listed in OUTPUT_DIR/"+updateIndexFile+", and leave every other file alone. With schelm verify, rewrite GOLDEN_DIR from the input instead of comparing against it")
+}
+
+// updateSink writes a render over an existing directory. The first document written
+// to a file replaces whatever the file held; on Close the files of the previous
+// index that weren't written are removed and the index is rewritten.
+type updateSink struct {
+	*split.FSSink
+	fsys     split.FS
+	root     string
+	clearFS  split.FS // removes the replaced and stale files, possibly to the trash
+	previous []string
+	written  map[string]bool
+}
+
+// newUpdateSink reads the index of dir, creating dir if it doesn't exist.
+func newUpdateSink(fsys, clearFS split.FS, dir string) (*updateSink, error) {
+	u := &updateSink{FSSink: split.NewFSSink(fsys, dir), fsys: fsys, root: dir, clearFS: clearFS, written: make(map[string]bool)}
+	if _, err := fsys.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Creating output directory %s\n", dir)
+		if err := fsys.MkdirAll(dir, dirPermissions); err != nil {
+			return nil, fmt.Errorf("failed to create output directory %s: %w", dir, err)
+		}
+		return u, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to check output directory %s: %w", dir, err)
+	}
+	index := path.Join(dir, updateIndexFile)
+	data, err := fsys.ReadFile(index)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error reading %s: %w", index, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" && !strings.HasPrefix(line, "#") {
+			u.previous = append(u.previous, line)
+		}
+	}
+	return u, nil
+}
+
+// CreateOrAppend replaces the file on the first write of this render and appends to
+// it afterwards.
+func (u *updateSink) CreateOrAppend(name string, doc []byte) error {
+	name = path.Clean(name)
+	if !u.written[name] {
+		u.written[name] = true
+		file := path.Join(u.root, name)
+		if _, err := u.fsys.Stat(file); err == nil {
+			if err := u.clearFS.RemoveAll(file); err != nil {
+				return fmt.Errorf("error replacing %s: %w", file, err)
+			}
+		}
+	}
+	return u.FSSink.CreateOrAppend(name, doc)
+}
+
+// Close removes the stale files and writes the new index.
+func (u *updateSink) Close() error {
+	for _, name := range u.previous {
+		if u.written[name] || !fs.ValidPath(name) {
+			continue
+		}
+		file := path.Join(u.root, name)
+		if _, err := u.fsys.Stat(file); err != nil {
+			continue
+		}
+		log.Printf("Removing stale %s", file)
+		if err := u.clearFS.RemoveAll(file); err != nil {
+			return fmt.Errorf("error removing stale %s: %w", file, err)
+		}
+		u.removeEmptyDirs(path.Dir(name))
+	}
+	var b strings.Builder
+	b.WriteString("# Files written by schelm -update; the next run removes those it no longer renders.\n")
+	for _, name := range slices.Sorted(maps.Keys(u.written)) {
+		b.WriteString(name + "\n")
+	}
+	index := path.Join(u.root, updateIndexFile)
+	if err := u.fsys.WriteFile(index, []byte(b.String()), filePermissions); err != nil {
+		return fmt.Errorf("error writing %s: %w", index, err)
+	}
+	return nil
+}
+
+// removeEmptyDirs removes dir, relative to the output directory, and its parents as
+// long as they are empty.
+func (u *updateSink) removeEmptyDirs(dir string) {
+	for ; dir != "." && dir != "/"; dir = path.Dir(dir) {
+		full := path.Join(u.root, dir)
+		entries, err := fs.ReadDir(u.fsys, full)
+		if err != nil || len(entries) > 0 {
+			return
+		}
+		if err := u.fsys.RemoveAll(full); err != nil {
+			return
+		}
+	}
+}
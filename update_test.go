@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+func TestUpdate(t *testing.T) {
+	setFlag(t, &updateOutput, true)
+	cm := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\n"
+	svc := "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n"
+	fsys := split.NewMemFS()
+	writeTree(t, fsys, map[string]string{
+		"out/web/templates/cm.yaml": "stale: true\n",
+		"out/kustomization.yaml":    "resources: []\n",
+	})
+	snapshot := func() map[string]string {
+		t.Helper()
+		tree, err := snapshotTree(fsys, "out")
+		if err != nil {
+			t.Fatal(err)
+		}
+		files := make(map[string]string, len(tree))
+		for name, data := range tree {
+			files[name] = string(data)
+		}
+		return files
+	}
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]string
+	}{
+		{
+			// The first run overwrites what it renders and leaves every other file alone.
+			"first run", helmOutput("web/templates/cm.yaml", cm, "web/templates/cm.yaml", svc, "web/templates/extra/svc.yaml", svc),
+			map[string]string{
+				"web/templates/cm.yaml":        cm + "\n---\n" + svc,
+				"web/templates/extra/svc.yaml": svc,
+				"kustomization.yaml":           "resources: []\n",
+				updateIndexFile:                "# Files written by schelm -update; the next run removes those it no longer renders.\nweb/templates/cm.yaml\nweb/templates/extra/svc.yaml\n",
+			},
+		},
+		{
+			// Files the last run wrote but this one doesn't are removed, with their
+			// directories once empty.
+			"stale files", helmOutput("web/templates/cm.yaml", cm),
+			map[string]string{
+				"web/templates/cm.yaml": cm,
+				"kustomization.yaml":    "resources: []\n",
+				updateIndexFile:         "# Files written by schelm -update; the next run removes those it no longer renders.\nweb/templates/cm.yaml\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		if err := run(fsys, strings.NewReader(tt.input), io.Discard, "out"); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got := snapshot()
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: OUTPUT_DIR holds %d files, want %d: %q", tt.name, len(got), len(tt.want), got)
+		}
+		for name, want := range tt.want {
+			if got[name] != want {
+				t.Errorf("%s: %s = %q, want %q", tt.name, name, got[name], want)
+			}
+		}
+	}
+	if _, err := fsys.Stat("out/web/templates/extra"); err == nil {
+		t.Error("the emptied directory of a stale file is still there")
+	}
+	if _, err := fsys.Stat("out/web/templates"); err != nil {
+		t.Errorf("the directory of a rendered file was removed: %v", err)
+	}
+}
+
+func TestUpdateCreatesOutputDirectory(t *testing.T) {
+	fsys := split.NewMemFS()
+	u, err := newUpdateSink(fsys, fsys, "out/render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.CreateOrAppend("cm.yaml", []byte("kind: ConfigMap\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := fsys.ReadFile("out/render/cm.yaml"); err != nil || string(got) != "kind: ConfigMap\n" {
+		t.Errorf("cm.yaml = %q, %v", got, err)
+	}
+}
+
+func TestUpdateConflictingOptions(t *testing.T) {
+	setFlag(t, &updateOutput, true)
+	setFlag(t, &force, true)
+	if err := run(split.NewMemFS(), strings.NewReader(""), io.Discard, "out"); err == nil || !strings.Contains(err.Error(), "-update") {
+		t.Errorf("run() with -update -f = %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// valuesSnapshotFile is where -values-snapshot writes the computed values, relative
+// to the output.
+const valuesSnapshotFile = ".schelm/values.yaml"
+
+var valuesSnapshot bool // Whether the computed values of the -chart are written next to the manifests
+
+func init() {
+	flag.BoolVar(&valuesSnapshot, "values-snapshot", false, "With -chart, write the values helm computed for the release, chart defaults merged with -values and -set, to "+valuesSnapshotFile+" in the output, with secrets redacted, so audits can tell what produced the manifests. Requires helm 3.13 or later")
+}
+
+// redactedValue replaces the values -values-snapshot doesn't write.
+const redactedValue = "<redacted>"
+
+// secretValueKey matches the keys of values that are taken to be secrets.
+var secretValueKey = regexp.MustCompile(`(?i)passw|secret|token|credential|api_?key|private_?key|access_?key|auth_?key|client_?key|cert_?key|salt|cookie`)
+
+// computeValues returns the values helm computes for the -chart, as YAML, with
+// secrets redacted. helm template doesn't print them, so a client-side dry-run
+// install with the same options does.
+func computeValues() ([]byte, error) {
+	args := []string{"install", releaseName, chartRef, "--dry-run=client", "--debug"}
+	if chartVersion != "" {
+		args = append(args, "--version", chartVersion)
+	}
+	if helmNamespace != "" {
+		args = append(args, "--namespace", helmNamespace)
+	}
+	args = append(args, helmValueArgs()...)
+	log.Printf("Computing the values of release %s", releaseName)
+	cmd := exec.Command("helm", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		os.Stderr.Write(stderr.Bytes())
+		return nil, fmt.Errorf("helm install --dry-run %s failed: %w", chartRef, err)
+	}
+
+	section, ok := computedValuesSection(string(out))
+	if !ok {
+		return nil, fmt.Errorf("helm install --dry-run %s printed no COMPUTED VALUES", chartRef)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(section), &doc); err != nil {
+		return nil, fmt.Errorf("error parsing the computed values of %s: %w", chartRef, err)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Values computed by helm for release %s of chart %s", releaseName, chartRef)
+	if chartVersion != "" {
+		fmt.Fprintf(&b, " %s", chartVersion)
+	}
+	b.WriteString(", secrets redacted.\n")
+	if len(doc.Content) == 0 {
+		b.WriteString("{}\n")
+		return []byte(b.String()), nil
+	}
+	redactSecrets(doc.Content[0], false)
+	text, err := encodeYAML(doc.Content[0])
+	if err != nil {
+		return nil, err
+	}
+	b.WriteString(text)
+	return []byte(b.String()), nil
+}
+
+// computedValuesSection returns the COMPUTED VALUES section of helm install --debug
+// output, which ends where the HOOKS or MANIFEST section starts.
+func computedValuesSection(out string) (string, bool) {
+	_, rest, ok := strings.Cut(out, "\nCOMPUTED VALUES:\n")
+	if !ok {
+		return "", false
+	}
+	for _, end := range []string{"\nHOOKS:\n", "\nMANIFEST:\n"} {
+		if i := strings.Index(rest, end); i >= 0 {
+			rest = rest[:i]
+		}
+	}
+	return rest, true
+}
+
+// redactSecrets replaces the scalars below n that are secrets: those below a key that
+// looks like one, when secret is set or the key matches, and PEM blocks anywhere.
+// Booleans and nulls are kept, as they only tell whether a feature is on.
+func redactSecrets(n *yaml.Node, secret bool) {
+	n = resolveAlias(n)
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			redactSecrets(n.Content[i+1], secret || secretValueKey.MatchString(n.Content[i].Value))
+		}
+	case yaml.SequenceNode:
+		for _, item := range n.Content {
+			redactSecrets(item, secret)
+		}
+	case yaml.ScalarNode:
+		if n.Tag == "!!bool" || n.Tag == "!!null" || n.Value == "" {
+			return
+		}
+		if secret || strings.Contains(n.Value, "-----BEGIN ") {
+			n.Value, n.Tag, n.Style = redactedValue, "!!str", 0
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"bromaniac.github.com/schelm/split"
+)
+
+// verifyMain implements "schelm verify [options] GOLDEN_DIR", a snapshot test: it
+// splits stdin in memory and fails, printing the differences, unless the result
+// matches GOLDEN_DIR. With -update the golden directory is rewritten instead.
+func verifyMain(args []string) int {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return 2
+	}
+	if flag.NArg() != 1 || flag.Arg(0) == "" {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: schelm verify [options] [-update] GOLDEN_DIR")
+		flag.PrintDefaults()
+		return 2
+	}
+	golden := flag.Arg(0)
+
+	if updateOutput {
+		// Goldens are rewritten wholesale rather than updated in place.
+		updateOutput, force = false, true
+		if err := run(split.OSFS{}, os.Stdin, os.Stdout, golden); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		fmt.Fprintf(os.Stderr, "Updated golden directory %s\n", golden)
+		return 0
+	}
+
+	err := runDiff(split.OSFS{}, os.Stdin, os.Stdout, golden)
+	switch {
+	case errors.Is(err, errDifferences):
+		fmt.Fprintf(os.Stderr, "FAIL: the render differs from golden directory %s; rerun with -update to accept it\n", golden)
+		return 1
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	fmt.Fprintf(os.Stderr, "OK: the render matches golden directory %s\n", golden)
+	return 0
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Build information, set at build time with
+// -ldflags "-X main.version=v1.2.3 -X main.commit=... -X main.buildDate=...".
+// When unset they are taken from the module and VCS information Go embeds.
+var (
+	version   = ""
+	commit    = ""
+	buildDate = ""
+)
+
+var showVersion bool // Whether to print the version and exit
+
+func init() {
+	flag.BoolVar(&showVersion, "version", false, "Print the version, git commit, build date and Go version and exit")
+}
+
+// buildInfo describes the running binary.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// currentBuild returns the build information, falling back to what the Go toolchain
+// recorded for values not set with -ldflags.
+func currentBuild() buildInfo {
+	b := buildInfo{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if b.Version == "" && info.Main.Version != "(devel)" {
+			b.Version = info.Main.Version
+		}
+		modified := false
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if b.Commit == "" {
+					b.Commit = setting.Value
+				}
+			case "vcs.time":
+				if b.BuildDate == "" {
+					b.BuildDate = setting.Value
+				}
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+		if modified && commit == "" && b.Commit != "" {
+			b.Commit += "-dirty"
+		}
+	}
+	if b.Version == "" {
+		b.Version = "dev"
+	}
+	return b
+}
+
+func (b buildInfo) String() string {
+	s := "schelm " + b.Version
+	var details []string
+	if b.Commit != "" {
+		details = append(details, "commit "+b.Commit)
+	}
+	if b.BuildDate != "" {
+		details = append(details, "built "+b.BuildDate)
+	}
+	details = append(details, b.GoVersion, b.Platform)
+	return s + " (" + strings.Join(details, ", ") + ")"
+}
+
+// versionMain implements "schelm version [-o json]".
+func versionMain(args []string) int {
+	flags := flag.NewFlagSet("version", flag.ContinueOnError)
+	output := flags.String("o", "text", "Output format: text or json")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: schelm version [-o json]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+	b := currentBuild()
+	switch *output {
+	case "text":
+		fmt.Println(b)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(b); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid -o %q (expected text or json)\n", *output)
+		return 2
+	}
+	return 0
+}
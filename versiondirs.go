@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// chartLabel is the label helm charts conventionally set to <name>-<version>.
+const chartLabel = "helm.sh/chart"
+
+var (
+	versionDirs      bool   // Whether every chart directory is stamped with the chart version
+	versionDirsValue string // Version used where the chart metadata has none
+)
+
+func init() {
+	flag.BoolVar(&versionDirs, "version-dirs", false, "Name the directory of every chart <chart>-<version>, so renders of several chart versions can live side by side. The version comes from the "+chartLabel+" labels, the Chart.yaml of a local -chart, or -chart-version")
+	flag.StringVar(&versionDirsValue, "dir-version", "", "With -version-dirs, the version to use instead of the chart metadata")
+}
+
+// versionDirsTransform renames the first directory of every Source, the chart, to
+// <chart>-<version>.
+func versionDirsTransform(specs []*spec) ([]*spec, error) {
+	versions := make(map[string]string)
+	for _, s := range specs {
+		chart, _, _ := strings.Cut(s.source, "/")
+		if _, ok := versions[chart]; ok {
+			continue
+		}
+		root, err := s.root()
+		if err != nil || root == nil {
+			continue
+		}
+		if version, ok := strings.CutPrefix(scalarField(root, "metadata", "labels", chartLabel), chart+"-"); ok && version != "" {
+			versions[chart] = version
+		}
+	}
+
+	logged := make(map[string]bool)
+	for _, s := range specs {
+		chart, rest, found := strings.Cut(s.source, "/")
+		if !found {
+			continue
+		}
+		version := versionDirsValue
+		if version == "" {
+			version = versions[chart]
+		}
+		if version == "" {
+			version = localChartVersion(chart)
+		}
+		if version == "" {
+			return nil, fmt.Errorf("-version-dirs: no version found for chart %s (no %s label, local Chart.yaml or -chart-version); set -dir-version", chart, chartLabel)
+		}
+		if !logged[chart] {
+			logged[chart] = true
+			log.Printf("Writing chart %s to %s-%s", chart, chart, version)
+		}
+		s.source = chart + "-" + version + "/" + rest
+	}
+	return specs, nil
+}
+
+// localChartVersion returns the version of the -chart if it is the named chart: the
+// one of its Chart.yaml when it is a local directory, else the -chart-version.
+func localChartVersion(chart string) string {
+	if chartRef == "" {
+		return ""
+	}
+	data, err := os.ReadFile(filepath.Join(chartRef, "Chart.yaml"))
+	if err != nil {
+		return chartVersion
+	}
+	var metadata struct {
+		Name    string `yaml:"name"`
+		Version string `yaml:"version"`
+	}
+	if yaml.Unmarshal(data, &metadata) != nil || metadata.Name != chart {
+		return chartVersion
+	}
+	return metadata.Version
+}
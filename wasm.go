@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"bromaniac.github.com/schelm/split"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+var wasmPlugins stringList // WASM modules every document is passed through, in order
+
+func init() {
+	flag.Var(&wasmPlugins, "plugin", "Pass every document through this WASM plugin before writing (repeatable, applied in order)")
+}
+
+// wasmPlugin is a loaded WASM module implementing the schelm plugin ABI:
+//
+//	export schelm_alloc(size u32) u32
+//	export schelm_transform(meta_ptr, meta_len, doc_ptr, doc_len u32) u64
+//	export schelm_free(ptr, size u32)   (optional)
+//	import schelm.error(ptr, len u32)   (optional)
+//
+// The host copies the document's metadata, as JSON, and its content into buffers
+// obtained from schelm_alloc and calls schelm_transform, which returns the output
+// buffer packed as ptr<<32 | len. A zero length drops the document, and calling
+// schelm.error during the transform fails the split with the given message.
+// The module is instantiated once and reused for every document.
+type wasmPlugin struct {
+	file      string
+	runtime   wazero.Runtime
+	module    api.Module
+	alloc     api.Function
+	free      api.Function
+	transform api.Function
+	failure   string // message passed to schelm.error during the current call
+}
+
+// loadWASMPlugin compiles and instantiates the plugin in file. WASI is provided so
+// modules built for wasip1 targets work, but they get no filesystem access.
+func loadWASMPlugin(ctx context.Context, file string) (*wasmPlugin, error) {
+	code, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading plugin %s: %w", file, err)
+	}
+
+	p := &wasmPlugin{file: file, runtime: wazero.NewRuntime(ctx)}
+	wasi_snapshot_preview1.MustInstantiate(ctx, p.runtime)
+	_, err = p.runtime.NewHostModuleBuilder("schelm").
+		NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) {
+			msg, ok := m.Memory().Read(ptr, size)
+			if !ok {
+				p.failure = "plugin reported an error outside its memory"
+				return
+			}
+			p.failure = string(msg)
+		}).
+		Export("error").
+		Instantiate(ctx)
+	if err != nil {
+		p.Close(ctx)
+		return nil, fmt.Errorf("error preparing plugin %s: %w", file, err)
+	}
+
+	config := wazero.NewModuleConfig().WithStderr(os.Stderr).WithStartFunctions("_initialize")
+	p.module, err = p.runtime.InstantiateWithConfig(ctx, code, config)
+	if err != nil {
+		p.Close(ctx)
+		return nil, fmt.Errorf("error loading plugin %s: %w", file, err)
+	}
+	p.alloc = p.module.ExportedFunction("schelm_alloc")
+	p.transform = p.module.ExportedFunction("schelm_transform")
+	p.free = p.module.ExportedFunction("schelm_free")
+	if p.alloc == nil || p.transform == nil || p.module.Memory() == nil {
+		p.Close(ctx)
+		return nil, fmt.Errorf("plugin %s must export memory, schelm_alloc and schelm_transform", file)
+	}
+	return p, nil
+}
+
+// Close releases the plugin's runtime.
+func (p *wasmPlugin) Close(ctx context.Context) error {
+	return p.runtime.Close(ctx)
+}
+
+// hook returns a split.DocumentHook running documents through the plugin.
+func (p *wasmPlugin) hook(ctx context.Context) split.DocumentHook {
+	return func(meta split.DocMeta, content []byte) ([]byte, error) {
+		metaJSON, err := json.Marshal(meta)
+		if err != nil {
+			return nil, err
+		}
+		metaPtr, err := p.write(ctx, metaJSON)
+		if err != nil {
+			return nil, err
+		}
+		defer p.release(ctx, metaPtr, len(metaJSON))
+		docPtr, err := p.write(ctx, content)
+		if err != nil {
+			return nil, err
+		}
+		defer p.release(ctx, docPtr, len(content))
+
+		p.failure = ""
+		results, err := p.transform.Call(ctx, uint64(metaPtr), uint64(len(metaJSON)), uint64(docPtr), uint64(len(content)))
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s failed: %w", p.file, err)
+		}
+		if p.failure != "" {
+			return nil, fmt.Errorf("plugin %s: %s", p.file, p.failure)
+		}
+		outPtr, outLen := uint32(results[0]>>32), uint32(results[0])
+		if outLen == 0 {
+			return nil, nil
+		}
+		defer p.release(ctx, outPtr, int(outLen))
+		out, ok := p.module.Memory().Read(outPtr, outLen)
+		if !ok {
+			return nil, fmt.Errorf("plugin %s returned output outside its memory", p.file)
+		}
+		// Copy out before the buffer is freed and reused by the next document.
+		return append([]byte(nil), out...), nil
+	}
+}
+
+// write copies data into a buffer allocated by the plugin.
+func (p *wasmPlugin) write(ctx context.Context, data []byte) (uint32, error) {
+	results, err := p.alloc.Call(ctx, uint64(len(data)))
+	if err != nil {
+		return 0, fmt.Errorf("plugin %s failed to allocate memory: %w", p.file, err)
+	}
+	ptr := uint32(results[0])
+	if !p.module.Memory().Write(ptr, data) {
+		return 0, fmt.Errorf("plugin %s allocated memory out of range", p.file)
+	}
+	return ptr, nil
+}
+
+// release hands a buffer back to the plugin if it exports schelm_free.
+func (p *wasmPlugin) release(ctx context.Context, ptr uint32, size int) {
+	if p.free != nil {
+		p.free.Call(ctx, uint64(ptr), uint64(size))
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import "gopkg.in/yaml.v3"
+
+// podSpecPaths maps workload kinds to the location of their pod spec.
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// podSpec returns the pod spec of a workload document, or nil for other kinds.
+func podSpec(s *spec) *yaml.Node {
+	keys, ok := podSpecPaths[s.kind()]
+	if !ok {
+		return nil
+	}
+	root, err := s.root()
+	if err != nil || root == nil {
+		return nil
+	}
+	if n := lookupNode(root, keys...); n != nil && n.Kind == yaml.MappingNode {
+		return n
+	}
+	return nil
+}
+
+// containers returns the container mappings listed under key ("containers" or
+// "initContainers") of a pod spec.
+func containers(pod *yaml.Node, key string) []*yaml.Node {
+	list := lookupNode(pod, key)
+	if list == nil || list.Kind != yaml.SequenceNode {
+		return nil
+	}
+	var out []*yaml.Node
+	for _, c := range list.Content {
+		if c = resolveAlias(c); c.Kind == yaml.MappingNode {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// isTrue reports whether n is the boolean scalar true.
+func isTrue(n *yaml.Node) bool {
+	if n == nil || n.Kind != yaml.ScalarNode {
+		return false
+	}
+	var b bool
+	return n.Decode(&b) == nil && b
+}
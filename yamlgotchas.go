@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var warnYAMLGotchas bool // Whether unquoted values that YAML 1.1 and 1.2 read differently are reported
+
+func init() {
+	flag.BoolVar(&warnYAMLGotchas, "warn-yaml-gotchas", false, "Warn about unquoted values that YAML 1.1 parsers read differently from YAML 1.2 ones: booleans like no, yes, on, off, y and n, octal-looking numbers like 0755 and sexagesimal numbers like 22:30")
+}
+
+var (
+	yaml11Booleans = map[string]bool{
+		"y": true, "Y": true, "yes": true, "Yes": true, "YES": true, "on": true, "On": true, "ON": true,
+		"n": false, "N": false, "no": false, "No": false, "NO": false, "off": false, "Off": false, "OFF": false,
+	}
+	yaml11Octal = regexp.MustCompile(`^[-+]?0[0-7_]+$`)
+	yaml12Octal = regexp.MustCompile(`^0o[0-7]+$`)
+	sexagesimal = regexp.MustCompile(`^[-+]?[1-9][0-9_]*(:[0-5]?[0-9])+(\.[0-9_]*)?$`)
+)
+
+const quoteHint = "; quote it to keep it a string"
+
+// yamlGotchasCheck reports the plain scalars, keys and values, of every document
+// whose meaning depends on the YAML version of the parser reading it.
+func yamlGotchasCheck(specs []*spec) []finding {
+	var findings []finding
+	for _, s := range specs {
+		root, err := s.root()
+		if err != nil || root == nil {
+			continue
+		}
+		walkGotchas(root, "", func(n *yaml.Node, path, problem string) {
+			findings = append(findings, finding{
+				spec:     s,
+				check:    "yaml-gotchas",
+				severity: severityWarning,
+				message:  fmt.Sprintf("%s: unquoted %s %s", path, n.Value, problem),
+				line:     n.Line,
+			})
+		})
+	}
+	return findings
+}
+
+// walkGotchas calls report for every ambiguous scalar below n, with its field path.
+func walkGotchas(n *yaml.Node, path string, report func(n *yaml.Node, path, problem string)) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			child := fieldPath(path, key.Value)
+			if problem := yamlGotcha(key); problem != "" {
+				report(key, child+" (key)", problem)
+			}
+			walkGotchas(value, child, report)
+		}
+	case yaml.SequenceNode:
+		for i, item := range n.Content {
+			walkGotchas(item, fmt.Sprintf("%s[%d]", path, i), report)
+		}
+	case yaml.ScalarNode:
+		if problem := yamlGotcha(n); problem != "" {
+			if path == "" {
+				path = "."
+			}
+			report(n, path, problem)
+		}
+	}
+}
+
+// yamlGotcha describes how YAML 1.1 and 1.2 disagree about a scalar, or returns ""
+// if they agree or the scalar is quoted or explicitly tagged.
+func yamlGotcha(n *yaml.Node) string {
+	if n.Kind != yaml.ScalarNode || n.Style != 0 {
+		return ""
+	}
+	v := n.Value
+	if b, ok := yaml11Booleans[v]; ok {
+		return fmt.Sprintf("is the boolean %t in YAML 1.1 but a string in YAML 1.2%s", b, quoteHint)
+	}
+	if yaml11Octal.MatchString(v) {
+		digits := strings.ReplaceAll(v, "_", "")
+		if octal, err := strconv.ParseInt(digits, 8, 64); err == nil {
+			decimal, _ := strconv.ParseInt(digits, 10, 64)
+			return fmt.Sprintf("is the octal number %d in YAML 1.1 but the decimal %d in YAML 1.2; write it as 0o%o or quote it", octal, decimal, octal)
+		}
+	}
+	if yaml12Octal.MatchString(v) {
+		return "is an octal number in YAML 1.2 but a string in YAML 1.1" + quoteHint
+	}
+	if sexagesimal.MatchString(v) {
+		return fmt.Sprintf("is the base 60 number %s in YAML 1.1 but a string in YAML 1.2%s", sexagesimalValue(v), quoteHint)
+	}
+	return ""
+}
+
+// sexagesimalValue evaluates a YAML 1.1 base 60 number such as 1:30:00.
+func sexagesimalValue(v string) string {
+	sign := ""
+	if v[0] == '-' || v[0] == '+' {
+		sign, v = strings.TrimPrefix(v[:1], "+"), v[1:]
+	}
+	v = strings.ReplaceAll(v, "_", "")
+	var total float64
+	for _, part := range strings.Split(v, ":") {
+		f, _ := strconv.ParseFloat(part, 64)
+		total = total*60 + f
+	}
+	return sign + strconv.FormatFloat(total, 'f', -1, 64)
+}